@@ -0,0 +1,22 @@
+// Package v1alpha1 holds the ObservedService API, which the observer keeps
+// up to date with the endpoints it writes when run with --publish-crd.
+//
+// +kubebuilder:object:generate=true
+// +groupName=observer.ealebed.github.io
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+	// GroupVersion is the group and version of the ObservedService API.
+	GroupVersion = schema.GroupVersion{Group: "observer.ealebed.github.io", Version: "v1alpha1"}
+
+	// SchemeBuilder registers the types of this package.
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+
+	// AddToScheme adds the types of this package to a scheme.
+	AddToScheme = SchemeBuilder.AddToScheme
+)
@@ -0,0 +1,89 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MaxListedEndpoints caps ObservedServiceStatus.Endpoints, so the object of
+// a large Service stays well below the API server's size limit.
+const MaxListedEndpoints = 1000
+
+// ObservedEndpoint is one endpoint written for a Service.
+type ObservedEndpoint struct {
+	// UID identifies the endpoint: its Pod's UID, or one derived from its
+	// address for endpoints without a Pod.
+	UID string `json:"uid"`
+	// Name is the endpoint's Pod name.
+	// +optional
+	Name string `json:"name,omitempty"`
+	// IP is the endpoint's address; a hostname for FQDN slices.
+	IP string `json:"ip"`
+	// +optional
+	Port int32 `json:"port,omitempty"`
+	// +optional
+	NodeName string `json:"nodeName,omitempty"`
+	// Owner is the Pod's top-level controller as "Kind/name", with
+	// --resolve-owner.
+	// +optional
+	Owner string `json:"owner,omitempty"`
+}
+
+// ObservedServiceStatus is the set of endpoints last written for a Service
+// and how it last changed.
+type ObservedServiceStatus struct {
+	// Cluster is the cluster name the endpoints were written under.
+	// +optional
+	Cluster string `json:"cluster,omitempty"`
+	// EndpointCount is the number of endpoints written, listed or not.
+	EndpointCount int32 `json:"endpointCount"`
+	// Endpoints lists the endpoints ordered by UID, at most
+	// MaxListedEndpoints of them.
+	// +optional
+	// +listType=atomic
+	Endpoints []ObservedEndpoint `json:"endpoints,omitempty"`
+	// Truncated is set when Endpoints lists only the first
+	// MaxListedEndpoints.
+	// +optional
+	Truncated bool `json:"truncated,omitempty"`
+	// Added and Removed count the listed endpoints that the last change
+	// added (or changed) and removed.
+	// +optional
+	Added int32 `json:"added,omitempty"`
+	// +optional
+	Removed int32 `json:"removed,omitempty"`
+	// LastChangeTime is when the endpoints last changed.
+	// +optional
+	LastChangeTime *metav1.Time `json:"lastChangeTime,omitempty"`
+}
+
+// ObservedService mirrors the endpoints the observer writes for the Service
+// of the same name and namespace. It has no spec: the observer creates,
+// updates and deletes it along with the Service's rows.
+//
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=obsvc
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.status.cluster`
+// +kubebuilder:printcolumn:name="Endpoints",type=integer,JSONPath=`.status.endpointCount`
+// +kubebuilder:printcolumn:name="Changed",type=date,JSONPath=`.status.lastChangeTime`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type ObservedService struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// +optional
+	Status ObservedServiceStatus `json:"status,omitempty"`
+}
+
+// ObservedServiceList is a list of ObservedServices.
+//
+// +kubebuilder:object:root=true
+type ObservedServiceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ObservedService `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ObservedService{}, &ObservedServiceList{})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ealebed/observer/internal/config"
+	"github.com/ealebed/observer/internal/controller"
+)
+
+// dumpOptions is the parsed command line of observer dump.
+type dumpOptions struct {
+	cfg        config.Config
+	configPath string
+	filter     controller.DumpFilter
+	output     string
+}
+
+// parseDumpFlags registers the flags of observer dump on fs and parses
+// args. Only the settings needed to reach and read the table are bound;
+// they resolve from the same file and env as the controller's.
+func parseDumpFlags(fs *flag.FlagSet, args []string) (*dumpOptions, error) {
+	o := &dumpOptions{cfg: config.Default()}
+	fs.StringVar(&o.configPath, "config", getenv("CONFIG_FILE", ""), "Path to a YAML config file (flags and env take precedence).")
+	fs.StringVar(&o.cfg.Table, "table", o.cfg.Table, "Destination table to read, optionally schema-qualified. Env: TABLE_NAME.")
+	fs.StringVar(&o.cfg.RowFormat, "row-format", o.cfg.RowFormat, "Layout the rows were written with: columns or jsonb.")
+	fs.StringVar(&o.cfg.PGPasswordFile, "pg-password-file", o.cfg.PGPasswordFile, "Read the Postgres password from this file instead of PGPASSWORD.")
+	fs.StringVar(&o.cfg.PGSSLRootCert, "pg-sslrootcert", o.cfg.PGSSLRootCert, "CA certificate file to verify the Postgres server with. Env: PGSSLROOTCERT.")
+	fs.StringVar(&o.cfg.PGSSLCert, "pg-sslcert", o.cfg.PGSSLCert, "Client certificate file for Postgres mutual TLS. Env: PGSSLCERT.")
+	fs.StringVar(&o.cfg.PGSSLKey, "pg-sslkey", o.cfg.PGSSLKey, "Private key file of --pg-sslcert. Env: PGSSLKEY.")
+	fs.StringVar(&o.filter.Cluster, "cluster", "", "Only print rows of this cluster (default: all).")
+	fs.StringVar(&o.filter.Namespace, "namespace", "", "Only print rows of this namespace (default: all).")
+	fs.StringVar(&o.filter.Service, "service", "", "Only print rows of this service (default: all).")
+	fs.StringVar(&o.output, "output", controller.DumpFormatTable, "Output format: table or json.")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := config.Resolve(fs, &o.cfg, o.configPath, os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := validateConfig(&o.cfg); err != nil {
+		return nil, err
+	}
+	if o.output != controller.DumpFormatTable && o.output != controller.DumpFormatJSON {
+		return nil, fmt.Errorf("--output must be %q or %q, got %q", controller.DumpFormatTable, controller.DumpFormatJSON, o.output)
+	}
+	return o, nil
+}
+
+// runDump implements observer dump: it prints the stored rows matching
+// the filter flags to w.
+func runDump(ctx context.Context, args []string, w io.Writer) error {
+	o, err := parseDumpFlags(flag.NewFlagSet("observer dump", flag.ContinueOnError), args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	pool, err := newPoolFromEnv(ctx, &o.cfg)
+	if err != nil {
+		return fmt.Errorf("postgres: %w", err)
+	}
+	defer pool.Close()
+
+	reader := &controller.PostgresReader{DB: pool, TableName: o.cfg.Table, JSONB: o.cfg.RowFormat == controller.RowFormatJSONB}
+	rows, err := reader.Dump(ctx, o.filter)
+	if err != nil {
+		return err
+	}
+	return controller.WriteDump(w, rows, o.output)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/ealebed/observer/internal/controller"
+)
+
+func TestParseDumpFlags(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		env        map[string]string
+		wantTable  string
+		wantFilter controller.DumpFilter
+		wantOutput string
+		wantErr    string
+	}{
+		{
+			name:       "defaults read everything as a table",
+			wantTable:  "server",
+			wantOutput: controller.DumpFormatTable,
+		},
+		{
+			name:       "filters and json",
+			args:       []string{"--cluster=dev", "--namespace=default", "--service=web", "--output=json"},
+			wantTable:  "server",
+			wantFilter: controller.DumpFilter{Cluster: "dev", Namespace: "default", Service: "web"},
+			wantOutput: controller.DumpFormatJSON,
+		},
+		{
+			name:       "table from the env",
+			env:        map[string]string{"TABLE_NAME": "observer.endpoints"},
+			wantTable:  "observer.endpoints",
+			wantOutput: controller.DumpFormatTable,
+		},
+		{
+			name:       "flag wins over the env",
+			args:       []string{"--table=other"},
+			env:        map[string]string{"TABLE_NAME": "observer.endpoints"},
+			wantTable:  "other",
+			wantOutput: controller.DumpFormatTable,
+		},
+		{
+			name:       "cluster env is not a filter",
+			env:        map[string]string{"CLUSTER_NAME": "prod", "NAMESPACE": "kube-system"},
+			wantTable:  "server",
+			wantOutput: controller.DumpFormatTable,
+		},
+		{
+			name:    "unknown output",
+			args:    []string{"--output=yaml"},
+			wantErr: "--output must be",
+		},
+		{
+			name:    "bad table",
+			args:    []string{"--table=a..b"},
+			wantErr: "empty segment",
+		},
+		{
+			name:    "bad row format",
+			args:    []string{"--row-format=xml"},
+			wantErr: "--row-format must be",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, k := range []string{"TABLE_NAME", "CLUSTER_NAME", "NAMESPACE", "CONFIG_FILE"} {
+				t.Setenv(k, tt.env[k])
+			}
+			o, err := parseDumpFlags(flag.NewFlagSet("observer dump", flag.ContinueOnError), tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseDumpFlags(%v) error = %v, want %q", tt.args, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDumpFlags(%v) error = %v", tt.args, err)
+			}
+			if o.cfg.Table != tt.wantTable || o.filter != tt.wantFilter || o.output != tt.wantOutput {
+				t.Errorf("parseDumpFlags(%v) = table %q, filter %+v, output %q; want %q, %+v, %q",
+					tt.args, o.cfg.Table, o.filter, o.output, tt.wantTable, tt.wantFilter, tt.wantOutput)
+			}
+		})
+	}
+}
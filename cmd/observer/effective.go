@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/ealebed/observer/internal/config"
+)
+
+// redacted replaces a secret in the effective config; it's what
+// url.URL.Redacted puts in place of a password.
+const redacted = "xxxxx"
+
+// secretSettings are the settings logged as redacted when set.
+var secretSettings = map[string]bool{
+	"webhook-secret": true,
+	"redis-password": true,
+}
+
+// dsnPassword matches the password of a keyword/value DSN, quoted or not,
+// and queryPassword the one of a URL's query.
+var (
+	dsnPassword   = regexp.MustCompile(`(?i)\bpassword\s*=\s*('(?:[^'\\]|\\.)*'|\S+)`)
+	queryPassword = regexp.MustCompile(`(^|&)password=[^&]*`)
+)
+
+// logEffectiveConfig logs every setting after flags, env and the config
+// file are resolved, plus the libpq env the Postgres pool is built from,
+// as a single line so "what is this pod running with" needs no kubectl
+// describe. Passwords and secrets are redacted.
+func logEffectiveConfig(log logr.Logger, cfg *config.Config) {
+	log.Info("effective config", "config", effectiveSettings(cfg), "env", effectivePGEnv())
+}
+
+// effectiveSettings maps each setting's flag name to its value.
+func effectiveSettings(cfg *config.Config) map[string]any {
+	v := reflect.ValueOf(*cfg)
+	settings := make(map[string]any, v.NumField())
+	for i := range v.NumField() {
+		name := v.Type().Field(i).Tag.Get("yaml")
+		var value any = v.Field(i).Interface()
+		switch x := value.(type) {
+		case time.Duration:
+			value = x.String()
+		case string:
+			switch {
+			case x != "" && secretSettings[name]:
+				value = redacted
+			case name == "pg-mirror-dsn":
+				value = redactDSN(x)
+			}
+		}
+		settings[name] = value
+	}
+	return settings
+}
+
+// effectivePGEnv returns the libpq env with pgConfigFromEnv's defaults.
+func effectivePGEnv() map[string]string {
+	env := map[string]string{
+		"PGHOST":     os.Getenv("PGHOST"),
+		"PGPORT":     getenv("PGPORT", "5432"),
+		"PGUSER":     os.Getenv("PGUSER"),
+		"PGDATABASE": os.Getenv("PGDATABASE"),
+		"PGSSLMODE":  getenv("PGSSLMODE", "require"),
+		"PGPASSWORD": "",
+	}
+	if os.Getenv("PGPASSWORD") != "" {
+		env["PGPASSWORD"] = redacted
+	}
+	return env
+}
+
+// redactDSN hides the password of a URL or keyword/value DSN.
+func redactDSN(dsn string) string {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return dsnPassword.ReplaceAllString(dsn, "password="+redacted)
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		// Don't echo what might be a mistyped password.
+		return redacted
+	}
+	u.RawQuery = queryPassword.ReplaceAllString(u.RawQuery, "${1}password="+redacted)
+	return u.Redacted()
+}
@@ -2,124 +2,706 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
+	"unicode"
 
+	corev1 "k8s.io/api/core/v1"
 	discoveryv1 "k8s.io/api/discovery/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/discovery"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
+	"github.com/go-logr/logr"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
 
+	observerv1alpha1 "github.com/ealebed/observer/api/v1alpha1"
+	"github.com/ealebed/observer/internal/config"
 	"github.com/ealebed/observer/internal/controller"
 	"github.com/ealebed/observer/internal/version"
 )
 
 var scheme = runtime.NewScheme()
 
+// Values of --timestamp-source.
+const (
+	timestampServer = "server"
+	timestampClient = "client"
+)
+
+// workloadKind is what --target-workload must look like: a Kind such as
+// StatefulSet.
+var workloadKind = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+
+// statementCacheModes are the values of --pg-statement-cache-mode.
+var statementCacheModes = map[string]pgx.QueryExecMode{
+	"statement": pgx.QueryExecModeCacheStatement,
+	"describe":  pgx.QueryExecModeCacheDescribe,
+	"exec":      pgx.QueryExecModeExec,
+	"off":       pgx.QueryExecModeDescribeExec,
+}
+
+// poolMaxConns caps the Postgres pool; --pg-warmup-conns can't exceed it.
+const poolMaxConns = 4
+
+// Backoff of the retries of a failed write to an auxiliary sink (webhook,
+// Redis, ...), which the reconcile doesn't retry.
+const (
+	auxRetryBackoff    = 5 * time.Second
+	auxRetryMaxBackoff = 5 * time.Minute
+)
+
+// maxPGIdentifierLen is the longest name Postgres accepts, e.g. for a
+// --pg-notify-channel; pg_notify rejects longer ones.
+const maxPGIdentifierLen = 63
+
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(discoveryv1.AddToScheme(scheme))
+	utilruntime.Must(discoveryv1beta1.AddToScheme(scheme))
+	utilruntime.Must(observerv1alpha1.AddToScheme(scheme))
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "dump" {
+		if err := runDump(context.Background(), os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "observer dump:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		if err := runRestore(context.Background(), os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "observer restore:", err)
+			os.Exit(1)
+		}
+		return
+	}
 	if err := run(); err != nil {
 		os.Exit(1)
 	}
 }
 
-func run() error {
-	// ---- flags & env ----
-	var (
-		requeueAfter  time.Duration
-		labelSelector string
-		watchNS       string
-		tableName     string
-		clusterName   string
-	)
-	flag.DurationVar(&requeueAfter, "requeue-after", 60*time.Second, "Periodic reconcile interval.")
-	flag.StringVar(&labelSelector, "selector", getenv("ENDPOINT_SELECTOR", ""), "EndpointSlice label selector (e.g. 'app=my-svc').")
-	flag.StringVar(&watchNS, "namespace", getenv("NAMESPACE", ""), "Namespace to watch (empty = all).")
-	flag.StringVar(&tableName, "table", getenv("TABLE_NAME", "server"), "Destination Postgres table (optionally schema-qualified, e.g. 'public.server').")
-	flag.StringVar(&clusterName, "cluster", getenv("CLUSTER_NAME", "default"), "Cluster name label to write with each row.")
+// options is the parsed command line.
+type options struct {
+	cfg        config.Config
+	configPath string
+	zap        zap.Options
+	version    bool
+}
 
-	zopts := zap.Options{Development: false}
-	zopts.BindFlags(flag.CommandLine)
-	flag.Parse()
+// parseFlags registers every flag on fs and parses args. The config file
+// and env are applied later, by config.Resolve.
+func parseFlags(fs *flag.FlagSet, args []string) (*options, error) {
+	o := &options{cfg: config.Default(), zap: zap.Options{Development: false}}
+	fs.StringVar(&o.configPath, "config", getenv("CONFIG_FILE", ""), "Path to a YAML config file (flags and env take precedence).")
+	fs.BoolVar(&o.version, "version", false, "Print the version and exit.")
+	config.BindFlags(fs, &o.cfg)
+	o.zap.BindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// printVersion writes the --version output.
+func printVersion(w io.Writer) {
+	fmt.Fprintf(w, "observer %s (%s)\n", version.Version, version.GoVersion())
+}
+
+func run() error {
+	// ---- flags, env & config file ----
+	cmdline, err := parseFlags(flag.CommandLine, os.Args[1:]) // exits on a bad flag
+	if err != nil {
+		return err
+	}
+	if cmdline.version {
+		printVersion(os.Stdout)
+		return nil
+	}
+	// Resolve re-sets the explicit flags, which write to the struct they
+	// were bound to, so it must be resolved before it's copied.
+	if err := config.Resolve(flag.CommandLine, &cmdline.cfg, cmdline.configPath, os.LookupEnv); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	cfg, zopts := cmdline.cfg, cmdline.zap
+	if err := validateConfig(&cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&zopts)))
 	log := ctrl.Log.WithName("observer")
 	log.Info("starting",
 		"version", version.Version,
-		"selector", labelSelector,
-		"cluster", clusterName,
-		"namespace", watchNS,
-		"table", tableName,
+		"selector", cfg.Selector,
+		"cluster", cfg.Cluster,
+		"namespace", cfg.Namespace,
+		"table", cfg.Table,
+		"webhook", cfg.WebhookURL != "",
+		"redis", cfg.RedisAddr,
+		"kafka", cfg.KafkaTopic,
 	)
+	logEffectiveConfig(log, &cfg)
+
+	// ---- live --cluster / --table files ----
+	// Validated above; the file is read again here in case it changed.
+	clusterFile, err := loadLiveSetting("--cluster", cfg.Cluster, func(s string) error { return checkClusterFile(s, cfg.ClusterPattern) })
+	if err != nil {
+		log.Error(err, "cluster file read failed")
+		return err
+	}
+	tableFile, err := loadLiveSetting("--table", cfg.Table, controller.ValidateTableName)
+	if err != nil {
+		log.Error(err, "table file read failed")
+		return err
+	}
+	selectorFile, err := loadLiveSetting("--selector", cfg.Selector, checkSelector)
+	if err != nil {
+		log.Error(err, "selector file read failed")
+		return err
+	}
+	if clusterFile != nil {
+		clusterFile.Log = ctrl.Log.WithName("cluster-file")
+		cfg.Cluster = clusterFile.Get()
+		log.Info("reading the cluster name from a file", "path", clusterFile.Path, "cluster", cfg.Cluster)
+	}
+	if tableFile != nil {
+		tableFile.Log = ctrl.Log.WithName("table-file")
+		cfg.Table = tableFile.Get()
+		log.Info("reading the table name from a file", "path", tableFile.Path, "table", cfg.Table)
+	}
+	if selectorFile != nil {
+		selectorFile.Log = ctrl.Log.WithName("selector-file")
+		log.Info("reading the selector from a file", "path", selectorFile.Path, "selector", selectorFile.Get())
+	}
+	shard, err := resolveShard(&cfg, os.Hostname)
+	if err != nil {
+		log.Error(err, "shard setup failed")
+		return err
+	}
+	if shard.Count > 1 {
+		log.Info("writing the services of one shard", "shard", shard.Index, "shards", shard.Count)
+	}
 
 	// ---- Postgres ----
-	pool, err := newPoolFromEnv(context.Background())
+	pool, err := newPoolFromEnv(context.Background(), &cfg)
 	if err != nil {
 		log.Error(err, "postgres connect failed")
 		return err
 	}
-	defer pool.Close()
+	// Everything past startup goes through db, which swaps in a new pool if
+	// this one is left unusable.
+	db := controller.NewReconnectingDB(pool, reconnectPool(&cfg))
+	db.Log = ctrl.Log.WithName("postgres")
+	defer db.Close()
+	if cfg.PGWarmupConns > 0 {
+		if err := warmPool(context.Background(), pool, cfg.PGWarmupConns); err != nil {
+			log.Error(err, "postgres warm-up failed")
+			return err
+		}
+		log.Info("warmed up postgres pool", "conns", cfg.PGWarmupConns)
+	}
+	if cfg.CheckSchema {
+		return checkSchema(context.Background(), pool, &cfg)
+	}
 
-	// ---- manager options (no HA, no metrics/probes) ----
+	// ---- manager options (no HA, no built-in probes) ----
 	opts := ctrl.Options{
 		Scheme:                 scheme,
 		LeaderElection:         false,
-		Metrics:                server.Options{BindAddress: "0"}, // disable metrics server
-		HealthProbeBindAddress: "0",                              // disable health/ready probes
+		Metrics:                server.Options{BindAddress: cfg.MetricsBindAddress}, // "0" disables the metrics server
+		PprofBindAddress:       cfg.PprofBindAddress,                                // "0" disables pprof; see checkPprofAddress
+		HealthProbeBindAddress: "0",                                                 // built-in probes off; see the health server below
 	}
 
 	// Optional: scope cache to a single namespace
-	if watchNS != "" {
+	if cfg.Namespace != "" {
 		opts.Cache = cache.Options{
 			DefaultNamespaces: map[string]cache.Config{
-				watchNS: {},
+				cfg.Namespace: {},
 			},
 		}
 	}
+	if cfg.ServiceName != "" {
+		opts.Cache.ByObject = serviceCacheScope(cfg.ServiceLabel, cfg.ServiceName)
+	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), opts)
+	restCfg := ctrl.GetConfigOrDie()
+	mgr, err := ctrl.NewManager(restCfg, opts)
 	if err != nil {
 		log.Error(err, "manager start failed")
 		return err
 	}
 
+	sliceVersion := controller.EndpointSliceV1
+	if cfg.Source == controller.SourceEndpoints {
+		log.Info("watching legacy Endpoints objects")
+	} else {
+		dc, err := discovery.NewDiscoveryClientForConfig(restCfg)
+		if err != nil {
+			log.Error(err, "discovery client setup failed")
+			return err
+		}
+		if sliceVersion, err = controller.DetectEndpointSliceVersion(dc); err != nil {
+			log.Error(err, "EndpointSlice API detection failed")
+			return err
+		}
+		log.Info("watching EndpointSlices", "apiVersion", "discovery.k8s.io/"+sliceVersion)
+	}
+
+	if cfg.Cluster == controller.ClusterAuto {
+		name, err := controller.DetectClusterName(context.Background(), mgr.GetAPIReader(), os.Hostname)
+		if name == "" {
+			log.Error(err, "cluster name auto-detection failed")
+			return err
+		}
+		if err != nil {
+			log.Error(err, "cluster name auto-detection fell back to the hostname", "cluster", name)
+		} else {
+			log.Info("detected cluster name from the kube-system namespace", "cluster", name)
+		}
+		if err := checkClusterName(name, cfg.ClusterPattern); err != nil {
+			log.Error(err, "detected cluster name is not usable; set --cluster explicitly")
+			return err
+		}
+		cfg.Cluster = name
+	}
+
+	// ---- destination table ----
+	migrator := &controller.Migrator{
+		DB:          db,
+		TableName:   cfg.Table,
+		RowFormat:   cfg.RowFormat,
+		Region:      cfg.Region != "",
+		Partitioned: cfg.PartitionByCluster,
+		Log:         ctrl.Log.WithName("migrate"),
+	}
+	if cfg.AutoMigrate {
+		if err := migrator.Migrate(context.Background()); err != nil {
+			log.Error(err, "schema migration failed")
+			return err
+		}
+	} else if err := migrator.Check(context.Background()); errors.Is(err, controller.ErrSchemaTooNew) {
+		log.Error(err, "refusing to write to a newer schema")
+		return err
+	} else if err != nil {
+		log.Error(err, "schema version check failed, continuing")
+	}
+	if cfg.StrictTable {
+		if err := strictTable(context.Background(), db, &cfg); err != nil {
+			log.Error(err, "table can't take the configured writes")
+			return err
+		}
+		log.Info("table has every column the configured options write", "table", cfg.Table)
+	}
+	writeTable := cfg.Table
+	if cfg.PartitionByCluster {
+		if writeTable, err = controller.PartitionTableName(cfg.Table, cfg.Cluster); err != nil {
+			log.Error(err, "partition name derivation failed")
+			return err
+		}
+		if cfg.AutoMigrate {
+			if err := controller.EnsurePartition(context.Background(), db, cfg.Table, writeTable, cfg.Cluster); err != nil {
+				log.Error(err, "partition setup failed")
+				return err
+			}
+		}
+		log.Info("writing to cluster partition", "partition", writeTable)
+	}
+
+	if cfg.TrackInstance {
+		log.Info("recording writes as instance", "instance", processInstance())
+	}
+
+	// ---- cluster lease ----
+	var lease *controller.ClusterLease
+	if cfg.ClusterLease {
+		lease = newClusterLease(&cfg, db)
+		if err := lease.Claim(context.Background()); err != nil {
+			log.Error(err, "cluster lease claim failed")
+			return err
+		}
+		log.Info("claimed cluster lease", "cluster", cfg.Cluster, "instance", lease.InstanceID)
+		if !cfg.Once { // one-shot runs release the lease when done
+			if err := mgr.Add(lease); err != nil {
+				log.Error(err, "cluster lease setup failed")
+				return err
+			}
+		}
+	}
+
+	// ---- pool supervisor ----
+	if !cfg.Once {
+		if err := mgr.Add(db); err != nil {
+			log.Error(err, "postgres supervisor setup failed")
+			return err
+		}
+	}
+
+	// ---- sync status endpoint ----
+	// POST /pause and /resume are served next to /healthz and the read API.
+	pause := &controller.Pause{}
+	tracker := controller.NewSyncTracker()
+	tracker.Pause = pause
+	status := controller.NewSyncStatus()
+	// /readyz fails until the initial sync of --bootstrap-sync is written.
+	var bootstrap *controller.Bootstrap
+	if cfg.BootstrapSync {
+		bootstrap = &controller.Bootstrap{Namespace: cfg.Namespace, Log: ctrl.Log.WithName("bootstrap")}
+	}
+	if cfg.HealthProbeBindAddress != "" && cfg.HealthProbeBindAddress != "0" {
+		mux := http.NewServeMux()
+		mux.Handle("/healthz", tracker.Handler(healthStaleAfter(&cfg)))
+		mux.Handle("/readyz", healthz.CheckHandler{Checker: bootstrap.Check})
+		mux.Handle("/status", status.Handler())
+		pause.Register(mux)
+		if err := mgr.Add(&manager.Server{
+			Name:   "health",
+			Server: &http.Server{Addr: cfg.HealthProbeBindAddress, Handler: mux, ReadHeaderTimeout: 5 * time.Second},
+		}); err != nil {
+			log.Error(err, "health server setup failed")
+			return err
+		}
+	}
+
+	// ---- read API ----
+	if cfg.APIBindAddress != "" && cfg.APIBindAddress != "0" {
+		mux := http.NewServeMux()
+		mux.Handle("/", controller.NewAPIHandler(&controller.PostgresReader{
+			DB:        db,
+			TableName: cfg.Table,
+			TableFile: tableFile,
+			JSONB:     cfg.RowFormat == controller.RowFormatJSONB,
+		}, cfg.Cluster))
+		pause.Register(mux)
+		if err := mgr.Add(&manager.Server{
+			Name:   "api",
+			Server: &http.Server{Addr: cfg.APIBindAddress, Handler: mux, ReadHeaderTimeout: 5 * time.Second},
+		}); err != nil {
+			log.Error(err, "api server setup failed")
+			return err
+		}
+	}
+
+	// ---- sinks ----
+	var tables controller.TableResolver
+	if cfg.TableAnnotation != "" {
+		// Services are cached for the ServiceReconciler; one-shot runs
+		// never start the cache.
+		var reader client.Reader = mgr.GetClient()
+		if cfg.Once {
+			reader = mgr.GetAPIReader()
+		}
+		tables = &controller.AnnotationTables{Reader: reader, Annotation: cfg.TableAnnotation}
+	}
+
+	// ---- mirror database ----
+	var mirror controller.DB
+	if cfg.PGMirrorDSN != "" {
+		mirrorPool, err := newMirrorPool(context.Background(), &cfg)
+		if err != nil {
+			log.Error(err, "postgres mirror setup failed")
+			return err
+		}
+		defer mirrorPool.Close()
+		mirror = mirrorPool
+		log.Info("mirroring table writes to a second database")
+	}
+	sink, retries := buildSink(&cfg, db, mirror, writeTable, tableFile, tables)
+	if cfg.GRPCBindAddress != "" && cfg.GRPCBindAddress != "0" {
+		watch := &controller.WatchServer{Addr: cfg.GRPCBindAddress, Log: ctrl.Log.WithName("grpc")}
+		if err := mgr.Add(watch); err != nil {
+			log.Error(err, "grpc server setup failed")
+			return err
+		}
+		sink = controller.FanOutSink{sink, watch}
+	}
+	if cfg.PublishCRD {
+		// Read uncached: the sink reads each object right before writing it.
+		crd := auxSink("crd", &controller.ObservedServiceSink{Client: mgr.GetClient(), Reader: mgr.GetAPIReader()})
+		sink, retries = controller.FanOutSink{sink, crd}, append(retries, crd)
+		log.Info("publishing endpoints in ObservedService status")
+	}
+	for _, r := range retries {
+		if err := mgr.Add(r); err != nil {
+			log.Error(err, "sink retry setup failed", "sink", r.Name)
+			return err
+		}
+	}
+
+	// ---- database breaker ----
+	var breaker *controller.Breaker
+	if cfg.BreakerThreshold > 0 {
+		breaker = &controller.Breaker{Threshold: cfg.BreakerThreshold, Cooldown: cfg.BreakerCooldown, Log: ctrl.Log.WithName("breaker")}
+	}
+
 	// ---- controller ----
-	if err := (&controller.EndpointSliceReconciler{
-		Client:        mgr.GetClient(),
-		DB:            pool,
-		Log:           ctrl.Log.WithName("endpointslice"),
-		LabelSelector: labelSelector,
-		RequeueAfter:  requeueAfter,
-		TableName:     tableName,
-		ClusterName:   clusterName,
-	}).SetupWithManager(mgr); err != nil {
+	// Validated above. Pods for exclusion and enrichment are read straight
+	// from the API server so we don't cache every Pod in the cluster.
+	exclude, _ := labels.Parse(cfg.ExcludeSelector)
+	readiness, _ := controller.ParseReadinessExpr(cfg.ReadinessExpr)
+	reconciler := &controller.EndpointSliceReconciler{
+		Client:                     mgr.GetClient(),
+		Sink:                       sink,
+		Log:                        ctrl.Log.WithName("endpointslice"),
+		LabelSelector:              cfg.Selector,
+		ServiceName:                cfg.ServiceName,
+		Namespaces:                 controller.NameFilter{Allow: splitList(cfg.NamespaceAllow), Deny: splitList(cfg.NamespaceDeny)},
+		Services:                   controller.NameFilter{Allow: splitList(cfg.ServiceAllow), Deny: splitList(cfg.ServiceDeny)},
+		Shard:                      shard,
+		ServiceLabel:               cfg.ServiceLabel,
+		RequeueAfter:               cfg.RequeueAfter,
+		RequeueJitter:              cfg.RequeueJitter,
+		HeartbeatInterval:          cfg.HeartbeatInterval,
+		DebounceWindow:             cfg.DebounceWindow,
+		MaxConcurrentReconciles:    cfg.Concurrency,
+		ListRetries:                cfg.ListRetries,
+		ListRetryBackoff:           cfg.ListRetryBackoff,
+		PortFilter:                 cfg.PortFilter,
+		ExcludeSelector:            exclude,
+		RequireContainer:           cfg.RequireContainer,
+		RequireContainerFailClosed: cfg.RequireFailClosed,
+		EnrichPodLabels:            splitList(cfg.EnrichPodLabels),
+		ResolveOwner:               cfg.ResolveOwner,
+		TargetWorkload:             cfg.TargetWorkload,
+		PodReader:                  mgr.GetAPIReader(),
+		LiveReader:                 mgr.GetAPIReader(),
+		RecordSlices:               cfg.RecordSliceNames,
+		RecordNodeNames:            cfg.WatchNodes,
+		UseOwnerRef:                cfg.UseOwnerRef,
+		RecordServiceUID:           cfg.RecordServiceUID,
+		MaxEndpointsPerService:     cfg.MaxEndpoints,
+		UniqueIP:                   cfg.UniqueIP,
+		ClusterName:                cfg.Cluster,
+		Tracker:                    tracker,
+		Status:                     status,
+		Pause:                      pause,
+		Breaker:                    breaker,
+		APIVersion:                 sliceVersion,
+		Source:                     cfg.Source,
+		GeneratedUIDFormat:         cfg.GeneratedUIDFormat,
+		AddressFamily:              cfg.AddressFamily,
+		AddressSelect:              cfg.AddressSelect,
+		Readiness:                  readiness,
+		ClusterFile:                clusterFile,
+		SelectorFile:               selectorFile,
+	}
+
+	// ---- one-shot ----
+	if cfg.Once {
+		return runOnce(restCfg, reconciler, &cfg, lease)
+	}
+
+	if err := reconciler.SetupWithManager(mgr); err != nil {
 		log.Error(err, "controller setup failed")
 		return err
 	}
 
+	// A changed name means every service's rows belong somewhere else now,
+	// so the next reconcile of each one writes them in full.
+	for _, v := range []*controller.LiveValue{clusterFile, tableFile} {
+		if v == nil {
+			continue
+		}
+		v.OnChange = func(string) { reconciler.ForgetWrites() }
+		if err := mgr.Add(v); err != nil {
+			log.Error(err, "live file setup failed", "path", v.Path)
+			return err
+		}
+	}
+	// A changed selector adds and drops services, so every one is synced
+	// again and those no longer selected are deleted.
+	if selectorFile != nil {
+		changes := make(chan struct{}, 1)
+		selectorFile.OnChange = func(string) {
+			reconciler.ForgetWrites()
+			select {
+			case changes <- struct{}{}:
+			default: // a pass is already queued
+			}
+		}
+		if err := mgr.Add(selectorFile); err != nil {
+			log.Error(err, "live file setup failed", "path", selectorFile.Path)
+			return err
+		}
+		if err := mgr.Add(&controller.SelectorResync{
+			Reconciler: reconciler,
+			Namespace:  cfg.Namespace,
+			Changes:    changes,
+			Log:        ctrl.Log.WithName("resync"),
+		}); err != nil {
+			log.Error(err, "selector resync setup failed")
+			return err
+		}
+	}
+
+	if bootstrap != nil {
+		bootstrap.Reconciler = reconciler
+		if err := mgr.Add(bootstrap); err != nil {
+			log.Error(err, "bootstrap sync setup failed")
+			return err
+		}
+	}
+
+	// SIGHUP forces a full resync; ctrl.SetupSignalHandler only takes
+	// SIGINT and SIGTERM.
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	if err := mgr.Add(&controller.HangupResync{
+		Reconciler: reconciler,
+		Namespace:  cfg.Namespace,
+		Signals:    hangup,
+		Log:        ctrl.Log.WithName("resync"),
+	}); err != nil {
+		log.Error(err, "resync setup failed")
+		return err
+	}
+
+	// The mirror is swept and reaped by runnables of its own, next to the
+	// primary's.
+	pruned := []prunedDB{{db: db}}
+	if mirror != nil {
+		pruned = append(pruned, prunedDB{db: mirror, name: "mirror"})
+	}
+	for _, p := range pruned {
+		if cfg.GCInterval > 0 {
+			sweeper := &controller.Sweeper{
+				DB:          p.db,
+				TableName:   writeTable,
+				TableFile:   tableFile,
+				Reconciler:  reconciler,
+				Namespace:   cfg.Namespace,
+				Region:      cfg.Region,
+				PruneAction: cfg.PruneAction,
+				Interval:    cfg.GCInterval,
+				Pause:       pause,
+				Log:         p.logger("sweep"),
+			}
+			if cfg.TimestampSource == timestampClient {
+				sweeper.Now = time.Now
+			}
+			if err := mgr.Add(sweeper); err != nil {
+				log.Error(err, "sweep setup failed")
+				return err
+			}
+		}
+
+		if cfg.PruneMode == controller.PruneTTL {
+			reaper := &controller.Reaper{
+				DB:          p.db,
+				TableName:   writeTable,
+				TableFile:   tableFile,
+				ClusterName: cfg.Cluster,
+				ClusterFile: clusterFile,
+				Namespace:   cfg.Namespace,
+				Region:      cfg.Region,
+				PruneAction: cfg.PruneAction,
+				TTL:         cfg.RowTTL,
+				Interval:    cfg.RowTTL / 4, // a row is pruned at most a quarter TTL after it expired
+				Pause:       pause,
+				Log:         p.logger("reap"),
+			}
+			if cfg.TimestampSource == timestampClient {
+				reaper.Now = time.Now
+			}
+			if err := mgr.Add(reaper); err != nil {
+				log.Error(err, "reaper setup failed")
+				return err
+			}
+		}
+	}
+
 	if err := (&controller.ServiceReconciler{
-		Client:      mgr.GetClient(),
-		DB:          pool,
-		TableName:   tableName,
-		ClusterName: clusterName,
+		Client:          mgr.GetClient(),
+		Sink:            sink,
+		ClusterName:     cfg.Cluster,
+		ClusterFile:     clusterFile,
+		Tracker:         tracker,
+		Status:          status,
+		Pause:           pause,
+		Breaker:         breaker,
+		Slices:          reconciler,
+		Shard:           shard,
+		TableAnnotation: cfg.TableAnnotation,
 	}).SetupWithManager(mgr); err != nil {
 		log.Error(err, "service controller setup failed")
 		return err
 	}
 
+	if cfg.WatchNodes {
+		if err := (&controller.NodeReconciler{
+			Client:           mgr.GetClient(),
+			DB:               db,
+			Mirror:           mirror,
+			TableName:        writeTable,
+			TableFile:        tableFile,
+			ClusterName:      cfg.Cluster,
+			ClusterFile:      clusterFile,
+			Region:           cfg.Region,
+			StatementTimeout: cfg.StatementTimeout,
+			PruneAction:      cfg.PruneAction,
+			Pause:            pause,
+		}).SetupWithManager(mgr); err != nil {
+			log.Error(err, "node controller setup failed")
+			return err
+		}
+	}
+
+	if cfg.WatchNamespaces {
+		if err := (&controller.NamespaceReconciler{
+			Client:           mgr.GetClient(),
+			DB:               db,
+			Mirror:           mirror,
+			TableName:        writeTable,
+			TableFile:        tableFile,
+			ClusterName:      cfg.Cluster,
+			ClusterFile:      clusterFile,
+			Region:           cfg.Region,
+			StatementTimeout: cfg.StatementTimeout,
+			PruneAction:      cfg.PruneAction,
+			Tracker:          tracker,
+			Status:           status,
+			Slices:           reconciler,
+			Pause:            pause,
+		}).SetupWithManager(mgr); err != nil {
+			log.Error(err, "namespace controller setup failed")
+			return err
+		}
+	}
+
 	// ---- run ----
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		log.Error(err, "manager stopped with error")
@@ -128,7 +710,515 @@ func run() error {
 	return nil
 }
 
-func newPoolFromEnv(ctx context.Context) (*pgxpool.Pool, error) {
+// prunedDB is a database pruned by a Sweeper or Reaper of its own, and
+// the name of its logger beneath theirs, if any.
+type prunedDB struct {
+	db   controller.DB
+	name string
+}
+
+func (p prunedDB) logger(name string) logr.Logger {
+	if p.name == "" {
+		return ctrl.Log.WithName(name)
+	}
+	return ctrl.Log.WithName(name).WithName(p.name)
+}
+
+// errSchemaMismatch is returned by --check-schema when the table differs.
+var errSchemaMismatch = errors.New("table schema does not match")
+
+// checkSchema prints how cfg.Table differs from what the sink writes with
+// the configured options, and fails if it differs at all.
+func checkSchema(ctx context.Context, db controller.DB, cfg *config.Config) error {
+	diff, err := newPostgresSink(cfg, db, cfg.Table).CheckSchema(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	fmt.Print(diff)
+	if !diff.Empty() {
+		return errSchemaMismatch
+	}
+	return nil
+}
+
+// strictTable fails unless cfg.Table has every column, of a usable type,
+// and the unique index that the sink writes with the configured options
+// (--strict-table), naming all that's wrong at once.
+func strictTable(ctx context.Context, db controller.DB, cfg *config.Config) error {
+	diff, err := newPostgresSink(cfg, db, cfg.Table).CheckSchema(ctx)
+	if err != nil {
+		return err
+	}
+	return diff.Err()
+}
+
+// runOnce syncs every service a single time with an uncached client and
+// returns, for CronJob-style runs. The manager is never started.
+func runOnce(restCfg *rest.Config, r *controller.EndpointSliceReconciler, cfg *config.Config, lease *controller.ClusterLease) error {
+	log := ctrl.Log.WithName("observer")
+	c, err := client.New(restCfg, client.Options{Scheme: scheme})
+	if err != nil {
+		log.Error(err, "client setup failed")
+		return err
+	}
+	r.Client = c
+
+	ctx := ctrl.SetupSignalHandler()
+	err = r.SyncAll(ctx, cfg.Namespace)
+	if lease != nil {
+		if rerr := lease.Release(context.Background()); rerr != nil {
+			log.Error(rerr, "release cluster lease")
+		}
+	}
+	if err != nil {
+		log.Error(err, "one-shot sync failed")
+	}
+	return err
+}
+
+// checkPprofAddress requires --pprof-bind-address to name its host. Profiles
+// expose memory contents, so listening on every interface must be asked for
+// with an explicit 0.0.0.0 (or [::]); ":6060" is refused.
+func checkPprofAddress(addr string) error {
+	if addr == "" || addr == "0" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("--pprof-bind-address %q: %w", addr, err)
+	}
+	if host == "" {
+		return fmt.Errorf("--pprof-bind-address %q must name a host, e.g. 127.0.0.1%s (or 0.0.0.0%s to listen on all interfaces)", addr, addr, addr)
+	}
+	return nil
+}
+
+// serviceCacheScope narrows the cache to the objects of --service-name, so
+// those of other services aren't even fetched: slices by their service
+// label, Endpoints and Services by name.
+func serviceCacheScope(serviceLabel, name string) map[client.Object]cache.ByObject {
+	byLabel := cache.ByObject{Label: labels.SelectorFromSet(labels.Set{serviceLabel: name})}
+	byName := cache.ByObject{Field: fields.OneTermEqualSelector("metadata.name", name)}
+	return map[client.Object]cache.ByObject{
+		&discoveryv1.EndpointSlice{}:      byLabel,
+		&discoveryv1beta1.EndpointSlice{}: byLabel,
+		&corev1.Endpoints{}:               byName, //nolint:staticcheck // --source=endpoints
+		&corev1.Service{}:                 byName,
+	}
+}
+
+// newPostgresSink configures the table sink writing to table. One-shot runs
+// sync services one after another, so they never batch writes.
+func newPostgresSink(cfg *config.Config, db controller.DB, table string) *controller.PostgresSink {
+	pg := &controller.PostgresSink{
+		DB:               db,
+		TableName:        table,
+		RowFormat:        cfg.RowFormat,
+		ConflictAction:   cfg.ConflictAction,
+		TouchLastSeen:    cfg.HeartbeatInterval > 0,
+		Region:           cfg.Region,
+		OmitNamespace:    cfg.OmitNamespace,
+		StatementTimeout: cfg.StatementTimeout,
+		PodLabels:        cfg.EnrichPodLabels != "",
+		AddressType:      cfg.AddressTypeColumn,
+		Owner:            cfg.ResolveOwner,
+		SliceNames:       cfg.RecordSliceNames,
+		NodeName:         cfg.WatchNodes,
+		ServiceUID:       cfg.RecordServiceUID,
+		Addr:             cfg.AddrColumn,
+		VerifyWrites:     cfg.VerifyWrites,
+		SyncVersion:      cfg.SyncVersion,
+		PruneGracePeriod: cfg.PruneGracePeriod,
+		PruneAction:      cfg.PruneAction,
+		PruneMode:        cfg.PruneMode,
+		NotifyChannel:    cfg.PGNotifyChannel,
+	}
+	if cfg.TrackInstance {
+		pg.Instance = processInstance()
+	}
+	if cfg.TimestampSource == timestampClient {
+		pg.Now = time.Now
+	}
+	if !cfg.Once {
+		pg.FlushInterval = cfg.WriteFlushInterval
+	}
+	return pg
+}
+
+// buildSink returns the Postgres sink writing to table (or the current
+// value of tableFile, if set), mirrored to the same table in mirror if
+// that's set and fanned out to any extra sinks that are configured. The
+// extra sinks retry their failed writes on their own once the returned
+// RetrySinks are started.
+func buildSink(cfg *config.Config, db, mirror controller.DB, table string, tableFile *controller.LiveValue, tables controller.TableResolver) (controller.Sink, []*controller.RetrySink) {
+	pg := newPostgresSink(cfg, db, table)
+	pg.TableFile, pg.Tables = tableFile, tables
+	var primary controller.Sink = pg
+	if mirror != nil {
+		m := newPostgresSink(cfg, mirror, table)
+		m.TableFile, m.Tables = tableFile, tables
+		primary = &controller.MirrorSink{Primary: pg, Mirror: m}
+	}
+	var aux []*controller.RetrySink
+	if cfg.WebhookURL != "" {
+		aux = append(aux, auxSink("webhook", &controller.HTTPSink{
+			URL:        cfg.WebhookURL,
+			Secret:     cfg.WebhookSecret,
+			Client:     &http.Client{Timeout: 10 * time.Second},
+			MaxRetries: 3,
+			Backoff:    500 * time.Millisecond,
+			Gzip:       cfg.WebhookGzip,
+			BatchSize:  cfg.WebhookBatchSize,
+		}))
+	}
+	if cfg.RedisAddr != "" {
+		aux = append(aux, auxSink("redis", &controller.RedisSink{
+			Client:      redis.NewClient(&redis.Options{Addr: cfg.RedisAddr, Password: cfg.RedisPassword}),
+			KeyTemplate: cfg.RedisKeyTemplate,
+		}))
+	}
+	if cfg.KafkaBrokers != "" {
+		aux = append(aux, auxSink("kafka", controller.NewKafkaSink(splitList(cfg.KafkaBrokers), cfg.KafkaTopic)))
+	}
+	if cfg.OutputFile != "" {
+		aux = append(aux, auxSink("file", &controller.FileSink{Path: cfg.OutputFile, Format: cfg.OutputFormat}))
+	}
+	if len(aux) == 0 {
+		return primary, nil
+	}
+	sinks := controller.FanOutSink{primary}
+	for _, s := range aux {
+		sinks = append(sinks, s)
+	}
+	return sinks, aux
+}
+
+// auxSink wraps s, an auxiliary sink, to retry its failed writes.
+func auxSink(name string, s controller.Sink) *controller.RetrySink {
+	return &controller.RetrySink{
+		Sink:       s,
+		Name:       name,
+		Backoff:    auxRetryBackoff,
+		MaxBackoff: auxRetryMaxBackoff,
+		Log:        ctrl.Log.WithName("sink").WithName(name),
+	}
+}
+
+// validateConfig checks the resolved configuration and reports every problem
+// it finds at once, so a broken Deployment can be fixed in one go. It also
+// trims surrounding whitespace from --cluster.
+func validateConfig(cfg *config.Config) error {
+	var errs []error
+	if cfg.RequeueAfter < 0 {
+		errs = append(errs, fmt.Errorf("--requeue-after must be >= 0, got %s", cfg.RequeueAfter))
+	}
+	if cfg.PGMirrorDSN != "" {
+		if _, err := pgxpool.ParseConfig(cfg.PGMirrorDSN); err != nil {
+			errs = append(errs, fmt.Errorf("--pg-mirror-dsn: %w", err))
+		}
+	}
+	if len(cfg.PGNotifyChannel) > maxPGIdentifierLen {
+		errs = append(errs, fmt.Errorf("--pg-notify-channel must be at most %d bytes, got %q", maxPGIdentifierLen, cfg.PGNotifyChannel))
+	}
+	if cfg.RequeueJitter < 0 || cfg.RequeueJitter >= 1 {
+		errs = append(errs, fmt.Errorf("--requeue-jitter must be in [0, 1), got %g", cfg.RequeueJitter))
+	}
+	if cfg.DebounceWindow < 0 {
+		errs = append(errs, fmt.Errorf("--debounce-window must be >= 0, got %s", cfg.DebounceWindow))
+	}
+	if cfg.WebhookBatchSize < 0 {
+		errs = append(errs, fmt.Errorf("--webhook-batch-size must be >= 0, got %d", cfg.WebhookBatchSize))
+	}
+	if cfg.Concurrency < 1 {
+		errs = append(errs, fmt.Errorf("--max-concurrent-reconciles must be >= 1, got %d", cfg.Concurrency))
+	}
+	if cfg.ListRetries < 0 {
+		errs = append(errs, fmt.Errorf("--list-retries must be >= 0, got %d", cfg.ListRetries))
+	}
+	if cfg.ListRetryBackoff < 0 {
+		errs = append(errs, fmt.Errorf("--list-retry-backoff must be >= 0, got %s", cfg.ListRetryBackoff))
+	}
+	if err := checkPprofAddress(cfg.PprofBindAddress); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.MaxEndpoints < 0 {
+		errs = append(errs, fmt.Errorf("--max-endpoints-per-service must be >= 0, got %d", cfg.MaxEndpoints))
+	}
+	if cfg.GCInterval < 0 {
+		errs = append(errs, fmt.Errorf("--gc-interval must be >= 0, got %s", cfg.GCInterval))
+	}
+	if cfg.WriteFlushInterval < 0 {
+		errs = append(errs, fmt.Errorf("--write-flush-interval must be >= 0, got %s", cfg.WriteFlushInterval))
+	}
+	if cfg.HeartbeatInterval < 0 {
+		errs = append(errs, fmt.Errorf("--heartbeat-interval must be >= 0, got %s", cfg.HeartbeatInterval))
+	}
+	if cfg.ClusterLease && cfg.ClusterLeaseTTL <= 0 {
+		errs = append(errs, fmt.Errorf("--cluster-lease-ttl must be > 0, got %s", cfg.ClusterLeaseTTL))
+	}
+	if cfg.ShardCount < 1 {
+		errs = append(errs, fmt.Errorf("--shard-count must be >= 1, got %d", cfg.ShardCount))
+	} else if cfg.ShardIndex < -1 || cfg.ShardIndex >= cfg.ShardCount {
+		errs = append(errs, fmt.Errorf("--shard-index must be -1 or in 0-%d, got %d", cfg.ShardCount-1, cfg.ShardIndex))
+	}
+	if cfg.ShardCount > 1 && cfg.ClusterLease {
+		errs = append(errs, errors.New("--shard-count can't be used with --cluster-lease, which admits one instance per cluster"))
+	}
+	if cfg.PGWarmupConns < 0 || cfg.PGWarmupConns > poolMaxConns {
+		errs = append(errs, fmt.Errorf("--pg-warmup-conns must be in 0-%d, got %d", poolMaxConns, cfg.PGWarmupConns))
+	}
+	if _, ok := statementCacheModes[cfg.StatementCacheMode]; !ok {
+		errs = append(errs, fmt.Errorf(`--pg-statement-cache-mode must be "statement", "describe", "exec" or "off", got %q`, cfg.StatementCacheMode))
+	}
+	if cfg.StatementCacheSize < 1 {
+		errs = append(errs, fmt.Errorf("--pg-statement-cache-size must be >= 1, got %d", cfg.StatementCacheSize))
+	}
+	for _, f := range pgTLSFiles(cfg) {
+		if f.path == "" {
+			continue
+		}
+		if _, err := os.Stat(f.path); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.flag, err))
+		}
+	}
+	if (cfg.PGSSLCert == "") != (cfg.PGSSLKey == "") {
+		errs = append(errs, errors.New("--pg-sslcert and --pg-sslkey must be set together"))
+	}
+	if cfg.StatementTimeout < 0 {
+		errs = append(errs, fmt.Errorf("--db-statement-timeout must be >= 0, got %s", cfg.StatementTimeout))
+	}
+	if cfg.BreakerThreshold < 0 {
+		errs = append(errs, fmt.Errorf("--db-breaker-threshold must be >= 0, got %d", cfg.BreakerThreshold))
+	} else if cfg.BreakerThreshold > 0 && cfg.BreakerCooldown <= 0 {
+		errs = append(errs, fmt.Errorf("--db-breaker-cooldown must be > 0 with --db-breaker-threshold, got %s", cfg.BreakerCooldown))
+	}
+	cfg.Cluster = strings.TrimSpace(cfg.Cluster)
+	if _, err := regexp.Compile(cfg.ClusterPattern); err != nil {
+		errs = append(errs, fmt.Errorf("--cluster-name-pattern: %w", err))
+	} else if cfg.Cluster == "" {
+		errs = append(errs, errors.New("--cluster must not be empty"))
+	} else if strings.HasPrefix(cfg.Cluster, liveFilePrefix) {
+		if _, err := loadLiveSetting("--cluster", cfg.Cluster, func(s string) error { return checkClusterFile(s, cfg.ClusterPattern) }); err != nil {
+			errs = append(errs, err)
+		}
+		if cfg.PartitionByCluster || cfg.ClusterLease {
+			errs = append(errs, errors.New("--cluster=@file can't be used with --partition-by-cluster or --cluster-lease, which fix the name at startup"))
+		}
+	} else if cfg.Cluster != controller.ClusterAuto {
+		if err := checkClusterName(cfg.Cluster, cfg.ClusterPattern); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	cfg.Region = strings.TrimSpace(cfg.Region)
+	if strings.IndexFunc(cfg.Region, unicode.IsControl) >= 0 {
+		errs = append(errs, fmt.Errorf("--region %q must not contain control characters", cfg.Region))
+	}
+	if strings.HasPrefix(cfg.Selector, liveFilePrefix) {
+		if _, err := loadLiveSetting("--selector", cfg.Selector, checkSelector); err != nil {
+			errs = append(errs, err)
+		}
+	} else if err := checkSelector(cfg.Selector); err != nil {
+		errs = append(errs, fmt.Errorf("--selector %w", err))
+	}
+	if cfg.ServiceName != "" {
+		if msgs := validation.IsDNS1035Label(cfg.ServiceName); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("--service-name %q is not a valid Service name: %s", cfg.ServiceName, strings.Join(msgs, "; ")))
+		}
+	}
+	if msgs := validation.IsQualifiedName(cfg.ServiceLabel); len(msgs) > 0 {
+		errs = append(errs, fmt.Errorf("--service-label %q is not a valid label key: %s", cfg.ServiceLabel, strings.Join(msgs, "; ")))
+	}
+	if cfg.TableAnnotation != "" {
+		if msgs := validation.IsQualifiedName(cfg.TableAnnotation); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("--table-annotation %q is not a valid annotation key: %s", cfg.TableAnnotation, strings.Join(msgs, "; ")))
+		}
+	}
+	for _, l := range []struct{ flag, value string }{
+		{"--namespace-allow", cfg.NamespaceAllow}, {"--namespace-deny", cfg.NamespaceDeny},
+		{"--service-allow", cfg.ServiceAllow}, {"--service-deny", cfg.ServiceDeny},
+	} {
+		if err := (controller.NameFilter{Allow: splitList(l.value)}).Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", l.flag, err))
+		}
+	}
+	if _, err := labels.Parse(cfg.ExcludeSelector); err != nil {
+		errs = append(errs, fmt.Errorf("--exclude-selector %q is not a valid label selector: %w", cfg.ExcludeSelector, err))
+	}
+	if cfg.RequireContainer != "" {
+		if msgs := validation.IsDNS1123Label(cfg.RequireContainer); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("--require-container %q is not a valid container name: %s", cfg.RequireContainer, strings.Join(msgs, "; ")))
+		}
+	} else if cfg.RequireFailClosed {
+		errs = append(errs, errors.New("--require-container-fail-closed needs --require-container"))
+	}
+	if cfg.TargetWorkload != "" && !workloadKind.MatchString(cfg.TargetWorkload) {
+		errs = append(errs, fmt.Errorf("--target-workload %q is not a kind such as StatefulSet", cfg.TargetWorkload))
+	}
+	if strings.HasPrefix(cfg.Table, liveFilePrefix) {
+		if _, err := loadLiveSetting("--table", cfg.Table, controller.ValidateTableName); err != nil {
+			errs = append(errs, err)
+		}
+		if cfg.PartitionByCluster {
+			errs = append(errs, errors.New("--table=@file can't be used with --partition-by-cluster, which derives the partition at startup"))
+		}
+	} else if err := controller.ValidateTableName(cfg.Table); err != nil {
+		errs = append(errs, fmt.Errorf("--table %q: %w", cfg.Table, err))
+	}
+	if cfg.Source != controller.SourceEndpointSlices && cfg.Source != controller.SourceEndpoints {
+		errs = append(errs, fmt.Errorf("--source must be %q or %q, got %q", controller.SourceEndpointSlices, controller.SourceEndpoints, cfg.Source))
+	}
+	switch cfg.GeneratedUIDFormat {
+	case controller.GeneratedUIDIP, controller.GeneratedUIDPort, controller.GeneratedUIDFamily:
+	default:
+		errs = append(errs, fmt.Errorf("--generated-uid-format must be %q, %q or %q, got %q",
+			controller.GeneratedUIDIP, controller.GeneratedUIDPort, controller.GeneratedUIDFamily, cfg.GeneratedUIDFormat))
+	}
+	switch cfg.AddressFamily {
+	case controller.AddressFamilyAll, controller.AddressFamilyIPv4, controller.AddressFamilyIPv6:
+	default:
+		errs = append(errs, fmt.Errorf("--address-family must be %q, %q or %q, got %q",
+			controller.AddressFamilyIPv4, controller.AddressFamilyIPv6, controller.AddressFamilyAll, cfg.AddressFamily))
+	}
+	if cfg.RowFormat != controller.RowFormatColumns && cfg.RowFormat != controller.RowFormatJSONB {
+		errs = append(errs, fmt.Errorf("--row-format must be %q or %q, got %q", controller.RowFormatColumns, controller.RowFormatJSONB, cfg.RowFormat))
+	}
+	if cfg.PruneGracePeriod < 0 {
+		errs = append(errs, fmt.Errorf("--prune-grace-period must be >= 0, got %s", cfg.PruneGracePeriod))
+	} else if cfg.PruneGracePeriod > 0 && cfg.RowFormat == controller.RowFormatJSONB {
+		errs = append(errs, errors.New("--prune-grace-period needs the ready column of --row-format=columns"))
+	}
+	if cfg.ConflictAction != controller.ConflictUpdate && cfg.ConflictAction != controller.ConflictNothing {
+		errs = append(errs, fmt.Errorf("--conflict-action must be %q or %q, got %q", controller.ConflictUpdate, controller.ConflictNothing, cfg.ConflictAction))
+	} else if cfg.ConflictAction == controller.ConflictNothing && cfg.PruneGracePeriod > 0 {
+		// The insert marks a row ready again; DO NOTHING never would.
+		errs = append(errs, errors.New("--prune-grace-period needs --conflict-action=update"))
+	}
+	if cfg.PruneAction != controller.PruneDelete && cfg.PruneAction != controller.PruneClear {
+		errs = append(errs, fmt.Errorf("--prune-action must be %q or %q, got %q", controller.PruneDelete, controller.PruneClear, cfg.PruneAction))
+	} else if cfg.PruneAction == controller.PruneClear {
+		if cfg.RowFormat == controller.RowFormatJSONB {
+			errs = append(errs, errors.New("--prune-action=clear needs the pod_ip and ready columns of --row-format=columns"))
+		}
+		if cfg.PruneGracePeriod > 0 {
+			errs = append(errs, errors.New("--prune-action=clear can't be used with --prune-grace-period, which deletes the rows it marked"))
+		}
+		if cfg.ConflictAction == controller.ConflictNothing {
+			// The insert restores pod_ip of a returning endpoint; DO NOTHING never would.
+			errs = append(errs, errors.New("--prune-action=clear needs --conflict-action=update"))
+		}
+	}
+	if cfg.PruneMode != controller.PruneImmediate && cfg.PruneMode != controller.PruneTTL {
+		errs = append(errs, fmt.Errorf("--prune-mode must be %q or %q, got %q", controller.PruneImmediate, controller.PruneTTL, cfg.PruneMode))
+	} else if cfg.PruneMode == controller.PruneTTL {
+		if cfg.RowTTL <= 0 {
+			errs = append(errs, fmt.Errorf("--row-ttl must be > 0 with --prune-mode=ttl, got %s", cfg.RowTTL))
+		} else if cfg.HeartbeatInterval <= 0 || cfg.HeartbeatInterval >= cfg.RowTTL {
+			// Only writes refresh last_seen; without them a live endpoint's row expires too.
+			errs = append(errs, fmt.Errorf("--prune-mode=ttl needs a --heartbeat-interval below --row-ttl (%s), got %s", cfg.RowTTL, cfg.HeartbeatInterval))
+		}
+		if cfg.PruneGracePeriod > 0 {
+			errs = append(errs, errors.New("--prune-mode=ttl can't be used with --prune-grace-period, which prunes on write"))
+		}
+		if cfg.VerifyWrites {
+			errs = append(errs, errors.New("--prune-mode=ttl can't be used with --verify-writes, which would count the rows left to expire"))
+		}
+	}
+	if cfg.UseOwnerRef && cfg.Source == controller.SourceEndpoints {
+		errs = append(errs, errors.New("--use-owner-ref needs --source=endpointslices; Endpoints have no Service owner"))
+	}
+	if cfg.UseOwnerRef && cfg.ServiceName != "" {
+		errs = append(errs, errors.New("--use-owner-ref can't be used with --service-name, which narrows the cache by the service label"))
+	}
+	if cfg.WatchNamespaces && cfg.Namespace != "" {
+		errs = append(errs, errors.New("--watch-namespaces needs an empty --namespace"))
+	}
+	if cfg.OmitNamespace {
+		if cfg.Namespace == "" {
+			errs = append(errs, errors.New("--omit-namespace needs a --namespace to watch, the only one the table can hold"))
+		}
+		// These create or read the namespace column.
+		for _, o := range []struct {
+			flag string
+			set  bool
+		}{
+			{"--auto-migrate", cfg.AutoMigrate},
+			{"--gc-interval", cfg.GCInterval > 0},
+			{"--watch-nodes", cfg.WatchNodes},
+			{"--api-bind-address", cfg.APIBindAddress != "" && cfg.APIBindAddress != "0"},
+			{"--prune-mode=ttl", cfg.PruneMode == controller.PruneTTL},
+		} {
+			if o.set {
+				errs = append(errs, fmt.Errorf("--omit-namespace can't be used with %s, which needs the namespace column", o.flag))
+			}
+		}
+	}
+	if cfg.WatchNodes && cfg.RowFormat == controller.RowFormatJSONB {
+		errs = append(errs, errors.New("--watch-nodes needs the node_name column of --row-format=columns"))
+	}
+	if cfg.AddrColumn && cfg.RowFormat == controller.RowFormatJSONB {
+		errs = append(errs, errors.New("--addr-column needs --row-format=columns"))
+	}
+	if cfg.TrackInstance && cfg.RowFormat == controller.RowFormatJSONB {
+		errs = append(errs, errors.New("--track-instance needs --row-format=columns"))
+	}
+	if cfg.AddressSelect != controller.AddressSelectFirst && cfg.AddressSelect != controller.AddressSelectLowest {
+		errs = append(errs, fmt.Errorf("--address-select must be %q or %q, got %q", controller.AddressSelectFirst, controller.AddressSelectLowest, cfg.AddressSelect))
+	}
+	if _, err := controller.ParseReadinessExpr(cfg.ReadinessExpr); err != nil {
+		errs = append(errs, fmt.Errorf("--readiness-expr: %w", err))
+	}
+	if cfg.TimestampSource != timestampServer && cfg.TimestampSource != timestampClient {
+		errs = append(errs, fmt.Errorf("--timestamp-source must be %q or %q, got %q", timestampServer, timestampClient, cfg.TimestampSource))
+	}
+	if cfg.OutputFormat != controller.FileFormatJSON && cfg.OutputFormat != controller.FileFormatHosts {
+		errs = append(errs, fmt.Errorf("--output-format must be %q or %q, got %q", controller.FileFormatJSON, controller.FileFormatHosts, cfg.OutputFormat))
+	}
+	if n, err := strconv.Atoi(cfg.PortFilter); err == nil && (n < 1 || n > 65535) {
+		errs = append(errs, fmt.Errorf("--port-filter must be a port name or a number in 1-65535, got %d", n))
+	}
+	if cfg.BootstrapSync && (cfg.HealthProbeBindAddress == "" || cfg.HealthProbeBindAddress == "0") {
+		errs = append(errs, errors.New("--bootstrap-sync needs --health-probe-bind-address to serve /readyz"))
+	}
+	if cfg.KafkaBrokers != "" && cfg.KafkaTopic == "" {
+		errs = append(errs, errors.New("--kafka-topic is required with --kafka-brokers"))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// newPoolFromEnv opens a pool configured by pgConfigFromEnv. The pool
+// connects lazily, so bad credentials only show on first use.
+func newPoolFromEnv(ctx context.Context, c *config.Config) (*pgxpool.Pool, error) {
+	cfg, err := pgConfigFromEnv(c)
+	if err != nil {
+		return nil, err
+	}
+	return pgxpool.NewWithConfig(ctx, cfg)
+}
+
+// newMirrorPool opens the pool of --pg-mirror-dsn, with the same size and
+// session setup as the primary's. It connects lazily, so a mirror that is
+// down doesn't stop the observer from starting.
+func newMirrorPool(ctx context.Context, c *config.Config) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(c.PGMirrorDSN)
+	if err != nil {
+		return nil, fmt.Errorf("parse --pg-mirror-dsn: %w", err)
+	}
+	cfg.MaxConns = poolMaxConns
+	cfg.AfterConnect = afterConnect(c)
+	applyStatementCache(cfg.ConnConfig, c)
+	return pgxpool.NewWithConfig(ctx, cfg)
+}
+
+// pgConfigFromEnv builds the pool config from the PG* environment and c.
+// The password comes from --pg-password-file when set, else PGPASSWORD; it
+// is set on the parsed config rather than in the DSN so it needs no quoting.
+// The TLS files of --pg-sslrootcert, --pg-sslcert and --pg-sslkey go into
+// the DSN, quoted, and are read by ParseConfig.
+func pgConfigFromEnv(c *config.Config) (*pgxpool.Config, error) {
 	host := os.Getenv("PGHOST")
 	user := os.Getenv("PGUSER")
 	pass := os.Getenv("PGPASSWORD")
@@ -136,21 +1226,274 @@ func newPoolFromEnv(ctx context.Context) (*pgxpool.Pool, error) {
 	port := getenv("PGPORT", "5432")
 	ssl := getenv("PGSSLMODE", "require")
 
+	if c.PGPasswordFile != "" {
+		b, err := os.ReadFile(c.PGPasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("read --pg-password-file: %w", err)
+		}
+		if pass = strings.TrimRight(string(b), "\r\n"); pass == "" {
+			return nil, fmt.Errorf("--pg-password-file %s is empty", c.PGPasswordFile)
+		}
+	}
 	if host == "" || user == "" || pass == "" || db == "" {
 		return nil, fmt.Errorf("missing PG env vars (need PGHOST, PGUSER, PGPASSWORD, PGDATABASE)")
 	}
 
 	dsn := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s pool_max_conns=4",
-		host, port, user, pass, db, ssl,
+		"host=%s port=%s user=%s dbname=%s sslmode=%s pool_max_conns=%d",
+		host, port, user, db, ssl, poolMaxConns,
 	)
+	for _, f := range pgTLSFiles(c) {
+		if f.path != "" {
+			dsn += " " + f.key + "=" + quoteDSNValue(f.path)
+		}
+	}
 	cfg, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
 		return nil, err
 	}
-	return pgxpool.NewWithConfig(ctx, cfg)
+	cfg.ConnConfig.Password = pass
+	cfg.MinConns = int32(c.PGWarmupConns) //nolint:gosec // validated to be <= poolMaxConns
+	cfg.AfterConnect = afterConnect(c)
+	applyStatementCache(cfg.ConnConfig, c)
+	return cfg, nil
+}
+
+// applyStatementCache sets how cfg sends statements, and the size of its
+// cache, from --pg-statement-cache-mode and --pg-statement-cache-size.
+func applyStatementCache(cfg *pgx.ConnConfig, c *config.Config) {
+	cfg.DefaultQueryExecMode = statementCacheModes[c.StatementCacheMode]
+	cfg.StatementCacheCapacity = c.StatementCacheSize
+	cfg.DescriptionCacheCapacity = c.StatementCacheSize
+}
+
+// pgTLSFile is a TLS file of the Postgres connection: its DSN key, flag and
+// path.
+type pgTLSFile struct {
+	key, flag, path string
+}
+
+func pgTLSFiles(c *config.Config) []pgTLSFile {
+	return []pgTLSFile{
+		{"sslrootcert", "--pg-sslrootcert", c.PGSSLRootCert},
+		{"sslcert", "--pg-sslcert", c.PGSSLCert},
+		{"sslkey", "--pg-sslkey", c.PGSSLKey},
+	}
+}
+
+// quoteDSNValue quotes v as a keyword/value connection string value.
+func quoteDSNValue(v string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+// afterConnect is the pool hook running setupSession with c's settings.
+func afterConnect(c *config.Config) func(ctx context.Context, conn *pgx.Conn) error {
+	timeout, stmts := c.StatementTimeout, splitStatements(c.PGSessionSQL)
+	return func(ctx context.Context, conn *pgx.Conn) error {
+		return setupSession(ctx, conn, timeout, stmts)
+	}
+}
+
+// reconnectPool is how the pool supervisor opens a replacement pool. Each
+// attempt reads the environment and --pg-password-file afresh, so a rotated
+// password is picked up without a restart, and pings the new pool so one
+// that still can't log in is retried with backoff instead of swapped in.
+func reconnectPool(c *config.Config) func(ctx context.Context) (controller.Pool, error) {
+	return func(ctx context.Context) (controller.Pool, error) {
+		pool, err := newPoolFromEnv(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if err := pool.Ping(ctx); err != nil {
+			pool.Close()
+			return nil, err
+		}
+		return pool, nil
+	}
+}
+
+// sessionExecer is the part of *pgx.Conn used by setupSession.
+type sessionExecer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// setupSession runs on every new pool connection: it tags the session as
+// observer's in pg_stat_activity, applies the statement timeout and then
+// the --pg-session-sql statements.
+func setupSession(ctx context.Context, conn sessionExecer, timeout time.Duration, stmts []string) error {
+	if _, err := conn.Exec(ctx, "SET application_name = 'observer'"); err != nil {
+		return fmt.Errorf("set application_name: %w", err)
+	}
+	if timeout > 0 {
+		if _, err := conn.Exec(ctx, fmt.Sprintf("SET statement_timeout = %d", timeout.Milliseconds())); err != nil {
+			return fmt.Errorf("set statement_timeout: %w", err)
+		}
+	}
+	for _, stmt := range stmts {
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("--pg-session-sql %q: %w", stmt, err)
+		}
+	}
+	return nil
+}
+
+// warmPool opens n connections up front so the first reconciles don't pay
+// for the connection handshake.
+func warmPool(ctx context.Context, pool *pgxpool.Pool, n int) error {
+	conns := make([]*pgxpool.Conn, 0, n)
+	defer func() {
+		for _, c := range conns {
+			c.Release()
+		}
+	}()
+	for range n {
+		c, err := pool.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		conns = append(conns, c)
+	}
+	return nil
 }
 
+// splitStatements splits a ';'-separated --pg-session-sql value.
+func splitStatements(s string) []string {
+	var out []string
+	for _, stmt := range strings.Split(s, ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			out = append(out, stmt)
+		}
+	}
+	return out
+}
+
+// liveFilePrefix marks a --cluster, --table or --selector value naming a file to read
+// the setting from, e.g. --cluster=@/etc/observer/cluster.
+const liveFilePrefix = "@"
+
+// loadLiveSetting reads the file of a flag value of the form @path, or
+// returns nil for any other value.
+func loadLiveSetting(flagName, value string, validate func(string) error) (*controller.LiveValue, error) {
+	path, ok := strings.CutPrefix(value, liveFilePrefix)
+	if !ok {
+		return nil, nil
+	}
+	v, err := controller.LoadLiveValue(path, validate)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", flagName, err)
+	}
+	return v, nil
+}
+
+// checkSelector checks a --selector, given or read from a --selector=@file.
+func checkSelector(selector string) error {
+	if _, err := labels.Parse(selector); err != nil {
+		return fmt.Errorf("%q is not a valid label selector: %w", selector, err)
+	}
+	return nil
+}
+
+// checkClusterFile checks a cluster name read from a --cluster=@file. The
+// name is detected once at startup, so auto can't come from a file.
+func checkClusterFile(name, pattern string) error {
+	if name == controller.ClusterAuto {
+		return fmt.Errorf("%q is only accepted as --cluster itself", controller.ClusterAuto)
+	}
+	return checkClusterName(name, pattern)
+}
+
+// checkClusterName rejects cluster names that don't match pattern. Control
+// characters are refused whatever the pattern allows, since the name ends
+// up in logs, keys and file output as well as the table.
+func checkClusterName(name, pattern string) error {
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return fmt.Errorf("--cluster %q must not contain control characters", name)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("--cluster-name-pattern: %w", err)
+	}
+	if !re.MatchString(name) {
+		return fmt.Errorf("--cluster %q does not match --cluster-name-pattern %s", name, pattern)
+	}
+	return nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// resolveShard is the Shard of this replica. --shard-index=-1 is the
+// ordinal of hostname, a StatefulSet pod's name; a single shard needs no
+// index.
+func resolveShard(cfg *config.Config, hostname func() (string, error)) (controller.Shard, error) {
+	s := controller.Shard{Count: cfg.ShardCount, Index: cfg.ShardIndex}
+	if s.Count <= 1 || s.Index >= 0 {
+		return s, nil
+	}
+	h, err := hostname()
+	if err != nil {
+		return s, fmt.Errorf("derive --shard-index: %w", err)
+	}
+	if s.Index, err = controller.StatefulSetOrdinal(h); err != nil {
+		return s, fmt.Errorf("derive --shard-index: %w", err)
+	}
+	if s.Index >= s.Count {
+		return s, fmt.Errorf("derive --shard-index: ordinal %d of %q is past --shard-count=%d", s.Index, h, s.Count)
+	}
+	return s, nil
+}
+
+// healthStaleAfter is how long /healthz lets a service go unsynced: three
+// of its periodic reconciles, every --requeue-after or, without it, every
+// --heartbeat-interval. With neither, services are only synced on events,
+// however far apart, so none is ever flagged.
+func healthStaleAfter(cfg *config.Config) time.Duration {
+	if cfg.RequeueAfter > 0 {
+		return 3 * cfg.RequeueAfter
+	}
+	return 3 * cfg.HeartbeatInterval
+}
+
+// newClusterLease is the --cluster-lease of this process.
+func newClusterLease(cfg *config.Config, db controller.DB) *controller.ClusterLease {
+	return &controller.ClusterLease{
+		DB:         db,
+		Cluster:    cfg.Cluster,
+		InstanceID: processInstance(),
+		TTL:        cfg.ClusterLeaseTTL,
+		Log:        ctrl.Log.WithName("lease"),
+	}
+}
+
+// hostname is the Pod name, or a random ID if there's none.
+func hostname() string {
+	if h, err := os.Hostname(); err == nil && h != "" {
+		return h
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// processInstance identifies this process in the cluster lease and the
+// observer_instance column (--track-instance): the hostname and a random
+// suffix. The hostname alone isn't unique: StatefulSets of two clusters
+// both run an observer-0, which would then renew each other's claim of a
+// cluster name. It's drawn once and kept for the process lifetime.
+var processInstance = sync.OnceValue(func() string {
+	b := make([]byte, 3)
+	_, _ = rand.Read(b)
+	return hostname() + "-" + hex.EncodeToString(b)
+})
+
 func getenv(k, def string) string {
 	if v := os.Getenv(k); v != "" {
 		return v
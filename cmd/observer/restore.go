@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ealebed/observer/internal/config"
+	"github.com/ealebed/observer/internal/controller"
+)
+
+// restoreOptions is the parsed command line of observer restore.
+type restoreOptions struct {
+	cfg        config.Config
+	configPath string
+	from       string
+}
+
+// parseRestoreFlags registers the flags of observer restore on fs and
+// parses args. Like observer dump it binds only what's needed to reach the
+// table; the row options (--region, --enrich-pod-labels, ...) come from the
+// same file and env as the controller's, so the rows are written alike.
+func parseRestoreFlags(fs *flag.FlagSet, args []string) (*restoreOptions, error) {
+	o := &restoreOptions{cfg: config.Default()}
+	fs.StringVar(&o.configPath, "config", getenv("CONFIG_FILE", ""), "Path to a YAML config file (flags and env take precedence).")
+	fs.StringVar(&o.from, "from", "", "Snapshot to restore, as written by --output-file with --output-format=json.")
+	fs.StringVar(&o.cfg.Table, "table", o.cfg.Table, "Destination table to write, optionally schema-qualified. Env: TABLE_NAME.")
+	fs.StringVar(&o.cfg.RowFormat, "row-format", o.cfg.RowFormat, "Layout to write the rows in: columns or jsonb.")
+	fs.StringVar(&o.cfg.Cluster, "cluster", o.cfg.Cluster, "Cluster the snapshot must be of; its rows are written under it. Env: CLUSTER_NAME.")
+	fs.StringVar(&o.cfg.PGPasswordFile, "pg-password-file", o.cfg.PGPasswordFile, "Read the Postgres password from this file instead of PGPASSWORD.")
+	fs.StringVar(&o.cfg.PGSSLRootCert, "pg-sslrootcert", o.cfg.PGSSLRootCert, "CA certificate file to verify the Postgres server with. Env: PGSSLROOTCERT.")
+	fs.StringVar(&o.cfg.PGSSLCert, "pg-sslcert", o.cfg.PGSSLCert, "Client certificate file for Postgres mutual TLS. Env: PGSSLCERT.")
+	fs.StringVar(&o.cfg.PGSSLKey, "pg-sslkey", o.cfg.PGSSLKey, "Private key file of --pg-sslcert. Env: PGSSLKEY.")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := config.Resolve(fs, &o.cfg, o.configPath, os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := validateConfig(&o.cfg); err != nil {
+		return nil, err
+	}
+	if o.from == "" {
+		return nil, errors.New("--from is required")
+	}
+	if o.cfg.Cluster == controller.ClusterAuto {
+		return nil, errors.New("--cluster=auto needs the Kubernetes API; set --cluster to the snapshot's cluster")
+	}
+	return o, nil
+}
+
+// runRestore implements observer restore: it writes every service of the
+// --from snapshot to the table in one pass, then reports what it wrote to w.
+func runRestore(ctx context.Context, args []string, w io.Writer) error {
+	o, err := parseRestoreFlags(flag.NewFlagSet("observer restore", flag.ContinueOnError), args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(o.from)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	pool, err := newPoolFromEnv(ctx, &o.cfg)
+	if err != nil {
+		return fmt.Errorf("postgres: %w", err)
+	}
+	defer pool.Close()
+
+	sink := newPostgresSink(&o.cfg, pool, o.cfg.Table)
+	sink.FlushInterval = 0 // nothing follows to flush a held batch
+	stats, err := controller.Restore(ctx, sink, f, o.cfg.Cluster)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "restored %d endpoints of %d services into %s\n", stats.Endpoints, stats.Services, o.cfg.Table)
+	return err
+}
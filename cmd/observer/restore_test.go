@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestParseRestoreFlags(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		env         map[string]string
+		wantTable   string
+		wantCluster string
+		wantErr     string
+	}{
+		{
+			name:        "defaults",
+			args:        []string{"--from=snapshot.json"},
+			wantTable:   "server",
+			wantCluster: "default",
+		},
+		{
+			name:        "cluster and table from the env",
+			args:        []string{"--from=snapshot.json"},
+			env:         map[string]string{"CLUSTER_NAME": "prod", "TABLE_NAME": "observer.endpoints"},
+			wantTable:   "observer.endpoints",
+			wantCluster: "prod",
+		},
+		{
+			name:        "flag wins over the env",
+			args:        []string{"--from=snapshot.json", "--cluster=dev"},
+			env:         map[string]string{"CLUSTER_NAME": "prod"},
+			wantTable:   "server",
+			wantCluster: "dev",
+		},
+		{
+			name:    "no snapshot",
+			wantErr: "--from is required",
+		},
+		{
+			name:    "auto cluster",
+			args:    []string{"--from=snapshot.json", "--cluster=auto"},
+			wantErr: "--cluster=auto needs the Kubernetes API",
+		},
+		{
+			name:    "bad table",
+			args:    []string{"--from=snapshot.json", "--table=a..b"},
+			wantErr: "empty segment",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, k := range []string{"TABLE_NAME", "CLUSTER_NAME", "CONFIG_FILE"} {
+				t.Setenv(k, tt.env[k])
+			}
+			o, err := parseRestoreFlags(flag.NewFlagSet("observer restore", flag.ContinueOnError), tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseRestoreFlags(%v) error = %v, want %q", tt.args, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRestoreFlags(%v) error = %v", tt.args, err)
+			}
+			if o.cfg.Table != tt.wantTable || o.cfg.Cluster != tt.wantCluster || o.from != "snapshot.json" {
+				t.Errorf("parseRestoreFlags(%v) = table %q, cluster %q, from %q; want %q, %q, snapshot.json",
+					tt.args, o.cfg.Table, o.cfg.Cluster, o.from, tt.wantTable, tt.wantCluster)
+			}
+		})
+	}
+}
@@ -0,0 +1,403 @@
+// Package config holds the observer's runtime settings and merges them from
+// built-in defaults, an optional YAML file, the environment and flags (in
+// increasing order of precedence).
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// DefaultClusterPattern accepts DNS-label-like cluster names (lowercase
+// alphanumerics, '-' and '.', at most 63 characters).
+const DefaultClusterPattern = `^[a-z0-9]([-a-z0-9.]{0,61}[a-z0-9])?$`
+
+// Config is the full set of observer settings. YAML keys match flag names.
+type Config struct {
+	Once               bool          `yaml:"once"`
+	BootstrapSync      bool          `yaml:"bootstrap-sync"`
+	RequeueAfter       time.Duration `yaml:"requeue-after"`
+	RequeueJitter      float64       `yaml:"requeue-jitter"`
+	HeartbeatInterval  time.Duration `yaml:"heartbeat-interval"`
+	DebounceWindow     time.Duration `yaml:"debounce-window"`
+	Concurrency        int           `yaml:"max-concurrent-reconciles"`
+	ListRetries        int           `yaml:"list-retries"`
+	ListRetryBackoff   time.Duration `yaml:"list-retry-backoff"`
+	StatementTimeout   time.Duration `yaml:"db-statement-timeout"`
+	BreakerThreshold   int           `yaml:"db-breaker-threshold"`
+	BreakerCooldown    time.Duration `yaml:"db-breaker-cooldown"`
+	WriteFlushInterval time.Duration `yaml:"write-flush-interval"`
+	GCInterval         time.Duration `yaml:"gc-interval"`
+	PGSessionSQL       string        `yaml:"pg-session-sql"`
+	PGPasswordFile     string        `yaml:"pg-password-file"`
+	PGMirrorDSN        string        `yaml:"pg-mirror-dsn"`
+	PGNotifyChannel    string        `yaml:"pg-notify-channel"`
+	PGSSLRootCert      string        `yaml:"pg-sslrootcert"`
+	PGSSLCert          string        `yaml:"pg-sslcert"`
+	PGSSLKey           string        `yaml:"pg-sslkey"`
+	PGWarmupConns      int           `yaml:"pg-warmup-conns"`
+	StatementCacheMode string        `yaml:"pg-statement-cache-mode"`
+	StatementCacheSize int           `yaml:"pg-statement-cache-size"`
+	Source             string        `yaml:"source"`
+	GeneratedUIDFormat string        `yaml:"generated-uid-format"`
+	AddressFamily      string        `yaml:"address-family"`
+	AddressSelect      string        `yaml:"address-select"`
+	ReadinessExpr      string        `yaml:"readiness-expr"`
+	Selector           string        `yaml:"selector"`
+	ServiceLabel       string        `yaml:"service-label"`
+	ServiceName        string        `yaml:"service-name"`
+	Namespace          string        `yaml:"namespace"`
+	NamespaceAllow     string        `yaml:"namespace-allow"`
+	NamespaceDeny      string        `yaml:"namespace-deny"`
+	ServiceAllow       string        `yaml:"service-allow"`
+	ServiceDeny        string        `yaml:"service-deny"`
+	Table              string        `yaml:"table"`
+	TableAnnotation    string        `yaml:"table-annotation"`
+	PartitionByCluster bool          `yaml:"partition-by-cluster"`
+	AutoMigrate        bool          `yaml:"auto-migrate"`
+	CheckSchema        bool          `yaml:"check-schema"`
+	StrictTable        bool          `yaml:"strict-table"`
+	VerifyWrites       bool          `yaml:"verify-writes"`
+	SyncVersion        bool          `yaml:"sync-version"`
+	TimestampSource    string        `yaml:"timestamp-source"`
+	Cluster            string        `yaml:"cluster"`
+	Region             string        `yaml:"region"`
+	OmitNamespace      bool          `yaml:"omit-namespace"`
+	ClusterPattern     string        `yaml:"cluster-name-pattern"`
+	PortFilter         string        `yaml:"port-filter"`
+	MaxEndpoints       int           `yaml:"max-endpoints-per-service"`
+	UniqueIP           bool          `yaml:"unique-ip"`
+	ExcludeSelector    string        `yaml:"exclude-selector"`
+	RequireContainer   string        `yaml:"require-container"`
+	RequireFailClosed  bool          `yaml:"require-container-fail-closed"`
+	EnrichPodLabels    string        `yaml:"enrich-pod-labels"`
+	AddressTypeColumn  bool          `yaml:"address-type-column"`
+	AddrColumn         bool          `yaml:"addr-column"`
+	TrackInstance      bool          `yaml:"track-instance"`
+	RowFormat          string        `yaml:"row-format"`
+	ConflictAction     string        `yaml:"conflict-action"`
+	PruneGracePeriod   time.Duration `yaml:"prune-grace-period"`
+	PruneAction        string        `yaml:"prune-action"`
+	PruneMode          string        `yaml:"prune-mode"`
+	RowTTL             time.Duration `yaml:"row-ttl"`
+	ResolveOwner       bool          `yaml:"resolve-owner"`
+	TargetWorkload     string        `yaml:"target-workload"`
+	RecordSliceNames   bool          `yaml:"record-slice-names"`
+	WatchNodes         bool          `yaml:"watch-nodes"`
+	WatchNamespaces    bool          `yaml:"watch-namespaces"`
+	UseOwnerRef        bool          `yaml:"use-owner-ref"`
+	RecordServiceUID   bool          `yaml:"record-service-uid"`
+	ClusterLease       bool          `yaml:"cluster-lease"`
+	ClusterLeaseTTL    time.Duration `yaml:"cluster-lease-ttl"`
+	ShardCount         int           `yaml:"shard-count"`
+	ShardIndex         int           `yaml:"shard-index"`
+
+	HealthProbeBindAddress string `yaml:"health-probe-bind-address"`
+	MetricsBindAddress     string `yaml:"metrics-bind-address"`
+	APIBindAddress         string `yaml:"api-bind-address"`
+	GRPCBindAddress        string `yaml:"grpc-bind-address"`
+	PprofBindAddress       string `yaml:"pprof-bind-address"`
+
+	WebhookURL       string `yaml:"webhook-url"`
+	WebhookSecret    string `yaml:"webhook-secret"`
+	WebhookGzip      bool   `yaml:"webhook-gzip"`
+	WebhookBatchSize int    `yaml:"webhook-batch-size"`
+
+	RedisAddr        string `yaml:"redis-addr"`
+	RedisPassword    string `yaml:"redis-password"`
+	RedisKeyTemplate string `yaml:"redis-key-template"`
+
+	KafkaBrokers string `yaml:"kafka-brokers"`
+	KafkaTopic   string `yaml:"kafka-topic"`
+
+	OutputFile   string `yaml:"output-file"`
+	OutputFormat string `yaml:"output-format"`
+
+	PublishCRD bool `yaml:"publish-crd"`
+}
+
+// Default returns the configuration used when nothing else is set.
+func Default() Config {
+	return Config{
+		RequeueAfter:       60 * time.Second,
+		RequeueJitter:      0.1,
+		HeartbeatInterval:  5 * time.Minute,
+		DebounceWindow:     time.Second,
+		Concurrency:        1,
+		ListRetries:        3,
+		ListRetryBackoff:   100 * time.Millisecond,
+		StatementTimeout:   10 * time.Second,
+		StatementCacheMode: "statement",
+		StatementCacheSize: 512,
+		BreakerCooldown:    30 * time.Second,
+		ClusterLeaseTTL:    time.Minute,
+		ShardCount:         1,
+		ShardIndex:         -1,
+		Source:             "endpointslices",
+		GeneratedUIDFormat: "ip",
+		AddressFamily:      "all",
+		AddressSelect:      "first",
+		ReadinessExpr:      "ready",
+		RowFormat:          "columns",
+		ConflictAction:     "update",
+		PruneAction:        "delete",
+		PruneMode:          "immediate",
+		ServiceLabel:       "kubernetes.io/service-name",
+		TimestampSource:    "server",
+		Table:              "server",
+		Cluster:            "default",
+		ClusterPattern:     DefaultClusterPattern,
+
+		HealthProbeBindAddress: "0",
+		MetricsBindAddress:     "0",
+		APIBindAddress:         "0",
+		GRPCBindAddress:        "0",
+		PprofBindAddress:       "0",
+
+		RedisKeyTemplate: "{cluster}:{namespace}:{service}",
+		OutputFormat:     "json",
+	}
+}
+
+// BindFlags registers one flag per Config field on fs, writing into c.
+// The current values of c are used as flag defaults.
+func BindFlags(fs *flag.FlagSet, c *Config) {
+	fs.BoolVar(&c.Once, "once", c.Once, "Sync every service once and exit instead of watching (for CronJobs).")
+	fs.BoolVar(&c.BootstrapSync, "bootstrap-sync", c.BootstrapSync,
+		"Sync every service once at startup and fail /readyz until that pass is written.")
+	fs.DurationVar(&c.RequeueAfter, "requeue-after", c.RequeueAfter, "Periodic reconcile interval (0 = reconcile on events only).")
+	fs.Float64Var(&c.RequeueJitter, "requeue-jitter", c.RequeueJitter,
+		"Randomize each periodic requeue by up to ±this fraction of --requeue-after so reconciles spread out.")
+	fs.DurationVar(&c.HeartbeatInterval, "heartbeat-interval", c.HeartbeatInterval,
+		"Rewrite an unchanged endpoint set (refreshing last_seen) once the last write is this old (0 = never).")
+	fs.DurationVar(&c.DebounceWindow, "debounce-window", c.DebounceWindow,
+		"Coalesce a service's EndpointSlice events arriving within this window into one sync (0 = sync on every event).")
+	fs.IntVar(&c.Concurrency, "max-concurrent-reconciles", c.Concurrency,
+		"EndpointSlices reconciled at once; the syncs of one service are serialized regardless.")
+	fs.IntVar(&c.ListRetries, "list-retries", c.ListRetries,
+		"Retry a list of a service's slices failing while the cache starts or the API server throttles this many times before the reconcile fails (0 = never).")
+	fs.DurationVar(&c.ListRetryBackoff, "list-retry-backoff", c.ListRetryBackoff,
+		"Initial delay before retrying a list the API server throttled or failed, doubled after each attempt.")
+	fs.DurationVar(&c.StatementTimeout, "db-statement-timeout", c.StatementTimeout,
+		"Upper bound for each database transaction, enforced client- and server-side (0 = none).")
+	fs.IntVar(&c.BreakerThreshold, "db-breaker-threshold", c.BreakerThreshold,
+		"Hold writes back for --db-breaker-cooldown after this many consecutive transient database failures (0 = never).")
+	fs.DurationVar(&c.BreakerCooldown, "db-breaker-cooldown", c.BreakerCooldown,
+		"How long an open database breaker holds writes back before letting one through to probe.")
+	fs.DurationVar(&c.WriteFlushInterval, "write-flush-interval", c.WriteFlushInterval,
+		"Hold table writes for up to this long and commit those of all services in one transaction (0 = one transaction per write).")
+	fs.DurationVar(&c.GCInterval, "gc-interval", c.GCInterval,
+		"Every this long, delete the rows of services that no longer have endpoints; one replica per cluster at a time (0 = never).")
+	fs.StringVar(&c.PGPasswordFile, "pg-password-file", c.PGPasswordFile,
+		"File holding the DB password instead of PGPASSWORD; re-read whenever the pool is rebuilt, e.g. after a failed login.")
+	fs.StringVar(&c.PGSSLRootCert, "pg-sslrootcert", c.PGSSLRootCert,
+		"CA certificate file to verify the Postgres server with, e.g. for PGSSLMODE=verify-full. Env: PGSSLROOTCERT.")
+	fs.StringVar(&c.PGSSLCert, "pg-sslcert", c.PGSSLCert, "Client certificate file for Postgres mutual TLS; needs --pg-sslkey. Env: PGSSLCERT.")
+	fs.StringVar(&c.PGSSLKey, "pg-sslkey", c.PGSSLKey, "Private key file of --pg-sslcert. Env: PGSSLKEY.")
+	fs.StringVar(&c.PGMirrorDSN, "pg-mirror-dsn", c.PGMirrorDSN,
+		"Also write to the database at this DSN, e.g. during a migration; its failures are logged, not retried. Env: PG_MIRROR_DSN.")
+	fs.StringVar(&c.PGNotifyChannel, "pg-notify-channel", c.PGNotifyChannel,
+		"Send pg_notify on this channel, with a JSON {cluster,namespace,service,added,removed} of UIDs and their counts, in every write that changes a service's endpoints.")
+	fs.StringVar(&c.PGSessionSQL, "pg-session-sql", c.PGSessionSQL,
+		"';'-separated SQL run on every new database connection (e.g. \"SET search_path = observer\").")
+	fs.IntVar(&c.PGWarmupConns, "pg-warmup-conns", c.PGWarmupConns,
+		"Keep this many idle database connections and open them before starting (0 = connect lazily).")
+	fs.StringVar(&c.StatementCacheMode, "pg-statement-cache-mode", c.StatementCacheMode,
+		"How statements are sent: statement (prepared once per connection), describe (only their parameter types cached, "+
+			"for poolers like PgBouncer in transaction mode), exec (nothing prepared or cached) or off (described on every execution).")
+	fs.IntVar(&c.StatementCacheSize, "pg-statement-cache-size", c.StatementCacheSize,
+		"Statements (or descriptions, with describe) cached per database connection.")
+	fs.StringVar(&c.Source, "source", c.Source, "Object to read endpoints from: endpointslices or endpoints (legacy).")
+	fs.StringVar(&c.GeneratedUIDFormat, "generated-uid-format", c.GeneratedUIDFormat,
+		"UID of endpoints without a Pod targetRef: ip (ns/svc/ip), port (ns/svc/ip:port) or family (ns/svc/family/ip).")
+	fs.StringVar(&c.AddressFamily, "address-family", c.AddressFamily,
+		"Only write endpoints of this address family: ipv4, ipv6 or all (FQDN slices are only kept with all).")
+	fs.StringVar(&c.AddressSelect, "address-select", c.AddressSelect,
+		"Address written for an endpoint with several: first (as listed) or lowest (numerically, independent of order).")
+	fs.StringVar(&c.ReadinessExpr, "readiness-expr", c.ReadinessExpr,
+		"Endpoints written: an expression over ready, serving and terminating with !, && and ||, e.g. 'ready && !terminating'.")
+	fs.StringVar(&c.Selector, "selector", c.Selector, "EndpointSlice label selector (e.g. 'app=my-svc'), or @path of a file to read and watch it from. Env: ENDPOINT_SELECTOR.")
+	fs.StringVar(&c.ServiceLabel, "service-label", c.ServiceLabel, "Label key that names the Service an EndpointSlice belongs to.")
+	fs.StringVar(&c.ServiceName, "service-name", c.ServiceName,
+		"Only watch the endpoints of Services with this name (combine with --namespace for a single Service).")
+	fs.StringVar(&c.Namespace, "namespace", c.Namespace, "Namespace to watch (empty = all). Env: NAMESPACE.")
+	fs.StringVar(&c.NamespaceAllow, "namespace-allow", c.NamespaceAllow,
+		"Comma-separated namespace globs to write (e.g. 'team-*'); empty = all.")
+	fs.StringVar(&c.NamespaceDeny, "namespace-deny", c.NamespaceDeny,
+		"Comma-separated namespace globs never to write (e.g. 'kube-*'); wins over --namespace-allow.")
+	fs.StringVar(&c.ServiceAllow, "service-allow", c.ServiceAllow, "Comma-separated Service name globs to write; empty = all.")
+	fs.StringVar(&c.ServiceDeny, "service-deny", c.ServiceDeny,
+		"Comma-separated Service name globs never to write; wins over --service-allow.")
+	fs.StringVar(&c.Table, "table", c.Table,
+		"Destination Postgres table (optionally schema-qualified, e.g. 'public.server'). Env: TABLE_NAME.")
+	fs.StringVar(&c.TableAnnotation, "table-annotation", c.TableAnnotation,
+		"Service annotation (e.g. observer.io/table) naming a table to write that service to instead of --table.")
+	fs.BoolVar(&c.PartitionByCluster, "partition-by-cluster", c.PartitionByCluster,
+		"Write to the per-cluster partition <table>_<cluster> of a table partitioned BY LIST (cluster).")
+	fs.StringVar(&c.TimestampSource, "timestamp-source", c.TimestampSource,
+		"Where last_seen comes from: server (the database's now()) or client (this process's clock, UTC).")
+	fs.BoolVar(&c.AutoMigrate, "auto-migrate", c.AutoMigrate, "Create or migrate the table and create the cluster partition at startup, recording the schema version.")
+	fs.BoolVar(&c.CheckSchema, "check-schema", c.CheckSchema,
+		"Compare --table with the columns and unique index the observer writes, print the differences and exit (non-zero on mismatch).")
+	fs.BoolVar(&c.StrictTable, "strict-table", c.StrictTable,
+		"At startup, fail unless --table has every column (and the unique index) the configured options write.")
+	fs.BoolVar(&c.VerifyWrites, "verify-writes", c.VerifyWrites,
+		"After each write, count the service's rows again and report a mismatch (for testing; one extra query per write).")
+	fs.BoolVar(&c.SyncVersion, "sync-version", c.SyncVersion,
+		"Record when each write's endpoints were read in a bigint sync_version column and skip writes older than the stored ones.")
+	fs.StringVar(&c.Cluster, "cluster", c.Cluster, "Cluster name label to write with each row; 'auto' derives it from the kube-system namespace UID. Env: CLUSTER_NAME.")
+	fs.StringVar(&c.Region, "region", c.Region,
+		"Region to write into the region column with each row, which then leads the table's unique key (empty = no region column). Env: REGION.")
+	fs.BoolVar(&c.OmitNamespace, "omit-namespace", c.OmitNamespace,
+		"Write no namespace column, for a table of the single --namespace watched; the table's unique key is then (cluster, service, pod_uid).")
+	fs.StringVar(&c.ClusterPattern, "cluster-name-pattern", c.ClusterPattern, "Regular expression --cluster must match.")
+	fs.StringVar(&c.PortFilter, "port-filter", c.PortFilter,
+		"Only track endpoints of slices exposing this port, by name or number (empty = all).")
+	fs.BoolVar(&c.UniqueIP, "unique-ip", c.UniqueIP,
+		"Write at most one row per pod_ip: of two pods sharing an IP, keep the serving, non-terminating one and log the other.")
+	fs.IntVar(&c.MaxEndpoints, "max-endpoints-per-service", c.MaxEndpoints,
+		"Skip the sync of a service with more endpoints than this, logging an error (0 = unlimited).")
+	fs.StringVar(&c.ExcludeSelector, "exclude-selector", c.ExcludeSelector,
+		"Skip endpoints whose Pod labels or annotations match this selector (e.g. 'track=canary'); requires Pod read access.")
+	fs.StringVar(&c.RequireContainer, "require-container", c.RequireContainer,
+		"Only track endpoints whose Pod has a container of this name that is running and ready (empty = any); requires Pod read access.")
+	fs.BoolVar(&c.RequireFailClosed, "require-container-fail-closed", c.RequireFailClosed,
+		"With --require-container, drop endpoints whose Pod can't be read instead of keeping them.")
+	fs.StringVar(&c.EnrichPodLabels, "enrich-pod-labels", c.EnrichPodLabels,
+		"Comma-separated Pod label keys to copy into the jsonb pod_labels column (e.g. 'version,track'); requires Pod read access.")
+	fs.BoolVar(&c.ResolveOwner, "resolve-owner", c.ResolveOwner,
+		"Write each Pod's top-level controller (e.g. Deployment/web) into the text owner column; requires Pod and ReplicaSet read access.")
+	fs.StringVar(&c.TargetWorkload, "target-workload", c.TargetWorkload,
+		"Keep only endpoints whose Pod's top-level controller is of this kind (e.g. StatefulSet); requires Pod and ReplicaSet read access.")
+	fs.BoolVar(&c.RecordSliceNames, "record-slice-names", c.RecordSliceNames,
+		"Write the names of the EndpointSlices listing each endpoint into the text[] slice_names column.")
+	fs.BoolVar(&c.UseOwnerRef, "use-owner-ref", c.UseOwnerRef,
+		"Match EndpointSlices to their Service by its owner reference and UID instead of the service label.")
+	fs.BoolVar(&c.RecordServiceUID, "record-service-uid", c.RecordServiceUID,
+		"Write the UID of the Service owning each endpoint's slice into the text service_uid column.")
+	fs.BoolVar(&c.WatchNodes, "watch-nodes", c.WatchNodes,
+		"Write each endpoint's node into the text node_name column and delete a node's rows as soon as the Node is deleted.")
+	fs.BoolVar(&c.WatchNamespaces, "watch-namespaces", c.WatchNamespaces,
+		"Delete all rows of a namespace as soon as the Namespace is deleted, even of Services whose delete was missed. Needs an empty --namespace.")
+	fs.BoolVar(&c.AddressTypeColumn, "address-type-column", c.AddressTypeColumn,
+		"Also write each endpoint's address type (IPv4, IPv6, FQDN) into the text address_type column.")
+	fs.BoolVar(&c.AddrColumn, "addr-column", c.AddrColumn,
+		"Also write each endpoint's dialable address (ip:port, [ip]:port for IPv6; the bare IP without --port-filter) into the text addr column.")
+	fs.BoolVar(&c.TrackInstance, "track-instance", c.TrackInstance,
+		"Write this process's instance ID (hostname and a random suffix) into the text observer_instance column of every row it upserts.")
+	fs.StringVar(&c.RowFormat, "row-format", c.RowFormat,
+		"Table layout: columns (pod_name, pod_ip, ... columns) or jsonb (each row as JSON in a payload jsonb column).")
+	fs.StringVar(&c.ConflictAction, "conflict-action", c.ConflictAction,
+		"What writing an endpoint that already has a row does: update (overwrite it) or nothing (keep it as first written).")
+	fs.DurationVar(&c.PruneGracePeriod, "prune-grace-period", c.PruneGracePeriod,
+		"Mark endpoints that disappeared ready=false and delete them only once last_seen is this old (0 = delete at once).")
+	fs.StringVar(&c.PruneAction, "prune-action", c.PruneAction,
+		"What pruning does with the row of an endpoint that went away: delete it, or clear (keep it with pod_ip NULL and ready=false).")
+	fs.StringVar(&c.PruneMode, "prune-mode", c.PruneMode,
+		"When the row of an endpoint that went away is pruned: immediate (by the write of its service) or ttl (in the background, once last_seen is older than --row-ttl).")
+	fs.DurationVar(&c.RowTTL, "row-ttl", c.RowTTL,
+		"With --prune-mode=ttl, how old last_seen must be for a row to be pruned; must exceed --heartbeat-interval.")
+	fs.BoolVar(&c.ClusterLease, "cluster-lease", c.ClusterLease,
+		"Claim --cluster in the cluster_leases table and refuse to start if another live instance holds it.")
+	fs.DurationVar(&c.ClusterLeaseTTL, "cluster-lease-ttl", c.ClusterLeaseTTL, "How long a cluster lease stays valid without a heartbeat.")
+	fs.IntVar(&c.ShardCount, "shard-count", c.ShardCount,
+		"Split the services among this many replicas, each writing those whose hash(namespace/service) % count is its --shard-index.")
+	fs.IntVar(&c.ShardIndex, "shard-index", c.ShardIndex,
+		"This replica's shard with --shard-count, from 0 (-1 = the ordinal of its StatefulSet pod, from the hostname).")
+	fs.StringVar(&c.HealthProbeBindAddress, "health-probe-bind-address", c.HealthProbeBindAddress,
+		"Address for the /healthz sync-status endpoint (\"0\" = disabled).")
+	fs.StringVar(&c.MetricsBindAddress, "metrics-bind-address", c.MetricsBindAddress,
+		"Address for the Prometheus /metrics endpoint (\"0\" = disabled).")
+	fs.StringVar(&c.PprofBindAddress, "pprof-bind-address", c.PprofBindAddress,
+		"Address for the net/http/pprof endpoints, with an explicit host such as 127.0.0.1:6060 (\"0\" = disabled).")
+	fs.StringVar(&c.WebhookURL, "webhook-url", c.WebhookURL, "Also POST each service's desired rows as JSON to this URL. Env: WEBHOOK_URL.")
+	fs.StringVar(&c.WebhookSecret, "webhook-secret", c.WebhookSecret,
+		"HMAC-SHA256 key used to sign webhook bodies (X-Observer-Signature). Env: WEBHOOK_SECRET.")
+	fs.BoolVar(&c.WebhookGzip, "webhook-gzip", c.WebhookGzip, "Gzip webhook bodies (Content-Encoding: gzip).")
+	fs.IntVar(&c.WebhookBatchSize, "webhook-batch-size", c.WebhookBatchSize,
+		"Split a service's rows into webhook requests of at most this many, numbered in X-Observer-Batch (0 = one request).")
+	fs.StringVar(&c.RedisAddr, "redis-addr", c.RedisAddr, "Also keep a Redis SET of ready pod IPs per service at this host:port. Env: REDIS_ADDR.")
+	fs.StringVar(&c.RedisPassword, "redis-password", c.RedisPassword, "Redis password. Env: REDIS_PASSWORD.")
+	fs.StringVar(&c.RedisKeyTemplate, "redis-key-template", c.RedisKeyTemplate,
+		"Redis key per service; may use {cluster}, {namespace} and {service}.")
+	fs.StringVar(&c.KafkaBrokers, "kafka-brokers", c.KafkaBrokers,
+		"Comma-separated Kafka brokers; enables endpoint change events. Env: KAFKA_BROKERS.")
+	fs.StringVar(&c.KafkaTopic, "kafka-topic", c.KafkaTopic, "Kafka topic for endpoint change events. Env: KAFKA_TOPIC.")
+	fs.StringVar(&c.OutputFile, "output-file", c.OutputFile, "Also render all endpoints to this file, replaced atomically on every change.")
+	fs.StringVar(&c.OutputFormat, "output-format", c.OutputFormat, "Format of --output-file: json or hosts.")
+	fs.BoolVar(&c.PublishCRD, "publish-crd", c.PublishCRD,
+		"Also list each service's endpoints in the status of an ObservedService of the same name (needs the CRD in manifests/crd).")
+	fs.StringVar(&c.APIBindAddress, "api-bind-address", c.APIBindAddress, "Address for the read-only /services HTTP API (\"0\" = disabled).")
+	fs.StringVar(&c.GRPCBindAddress, "grpc-bind-address", c.GRPCBindAddress,
+		"Address for the gRPC Watch stream of endpoint changes (\"0\" = disabled).")
+}
+
+// ApplyEnv overlays settings found in the environment onto c.
+func ApplyEnv(c *Config, lookup func(string) (string, bool)) {
+	str := func(key string, dst *string) {
+		if v, ok := lookup(key); ok && v != "" {
+			*dst = v
+		}
+	}
+	str("ENDPOINT_SELECTOR", &c.Selector)
+	str("NAMESPACE", &c.Namespace)
+	str("TABLE_NAME", &c.Table)
+	str("CLUSTER_NAME", &c.Cluster)
+	str("REGION", &c.Region)
+	str("PG_MIRROR_DSN", &c.PGMirrorDSN)
+	str("PGSSLROOTCERT", &c.PGSSLRootCert)
+	str("PGSSLCERT", &c.PGSSLCert)
+	str("PGSSLKEY", &c.PGSSLKey)
+	str("WEBHOOK_URL", &c.WebhookURL)
+	str("WEBHOOK_SECRET", &c.WebhookSecret)
+	str("REDIS_ADDR", &c.RedisAddr)
+	str("REDIS_PASSWORD", &c.RedisPassword)
+	str("KAFKA_BROKERS", &c.KafkaBrokers)
+	str("KAFKA_TOPIC", &c.KafkaTopic)
+}
+
+// LoadFile overlays the YAML file at path onto c. Keys absent from the file
+// leave the corresponding fields untouched; unknown keys are an error.
+func LoadFile(path string, c *Config) error {
+	data, err := os.ReadFile(path) //nolint:gosec // path is operator-supplied
+	if err != nil {
+		return fmt.Errorf("read config %s: %w", path, err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return nil
+}
+
+// Resolve rebuilds c after fs has been parsed so that explicitly set flags
+// win over the environment, which wins over the file at path (if any), which
+// wins over Default(). c must be the Config the flags of fs are bound to:
+// the flags are re-set through fs.
+func Resolve(fs *flag.FlagSet, c *Config, path string, lookup func(string) (string, bool)) error {
+	set := map[string]string{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = f.Value.String() })
+
+	*c = Default()
+	if path != "" {
+		if err := LoadFile(path, c); err != nil {
+			return err
+		}
+	}
+	ApplyEnv(c, lookup)
+
+	for name, val := range set {
+		if err := fs.Set(name, val); err != nil {
+			return fmt.Errorf("flag --%s: %w", name, err)
+		}
+	}
+	return nil
+}
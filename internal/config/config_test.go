@@ -0,0 +1,173 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "observer.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func envMap(m map[string]string) func(string) (string, bool) {
+	return func(k string) (string, bool) {
+		v, ok := m[k]
+		return v, ok
+	}
+}
+
+func resolve(t *testing.T, args []string, path string, env map[string]string) (Config, error) {
+	t.Helper()
+	c := Default()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	BindFlags(fs, &c)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+	err := Resolve(fs, &c, path, envMap(env))
+	return c, err
+}
+
+func TestDefault(t *testing.T) {
+	c, err := resolve(t, nil, "", nil)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if c.RequeueAfter != 60*time.Second || c.Table != "server" || c.Cluster != "default" || c.Selector != "" || c.Namespace != "" {
+		t.Errorf("Resolve() = %+v, want defaults", c)
+	}
+	if !reflect.DeepEqual(c, Default()) {
+		t.Errorf("Resolve() = %+v, want %+v", c, Default())
+	}
+}
+
+func TestResolve_Precedence(t *testing.T) {
+	path := writeFile(t, `
+requeue-after: 15s
+selector: app=from-file
+namespace: file-ns
+table: public.file_table
+cluster: file-cluster
+`)
+	fromFile := func(mutate func(c *Config)) Config {
+		c := Default()
+		c.RequeueAfter = 15 * time.Second
+		c.Selector = "app=from-file"
+		c.Namespace = "file-ns"
+		c.Table = "public.file_table"
+		c.Cluster = "file-cluster"
+		mutate(&c)
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		env      map[string]string
+		expected Config
+	}{
+		{
+			name:     "file overrides defaults",
+			expected: fromFile(func(c *Config) {}),
+		},
+		{
+			name: "env overrides file",
+			env:  map[string]string{"CLUSTER_NAME": "env-cluster", "TABLE_NAME": "env_table"},
+			expected: fromFile(func(c *Config) {
+				c.Table = "env_table"
+				c.Cluster = "env-cluster"
+			}),
+		},
+		{
+			name:     "empty env value does not override file",
+			env:      map[string]string{"NAMESPACE": ""},
+			expected: fromFile(func(c *Config) {}),
+		},
+		{
+			name: "flags override env and file",
+			args: []string{"--cluster=flag-cluster", "--requeue-after=5s"},
+			env:  map[string]string{"CLUSTER_NAME": "env-cluster"},
+			expected: fromFile(func(c *Config) {
+				c.RequeueAfter = 5 * time.Second
+				c.Cluster = "flag-cluster"
+			}),
+		},
+		{
+			name:     "flag explicitly set to empty wins",
+			args:     []string{"--selector="},
+			env:      map[string]string{"ENDPOINT_SELECTOR": "app=from-env"},
+			expected: fromFile(func(c *Config) { c.Selector = "" }),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := resolve(t, tt.args, path, tt.env)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if !reflect.DeepEqual(c, tt.expected) {
+				t.Errorf("Resolve() = %+v, want %+v", c, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadFile_PartialKeepsDefaults(t *testing.T) {
+	path := writeFile(t, "cluster: only-cluster\n")
+	c := Default()
+	if err := LoadFile(path, &c); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	want := Default()
+	want.Cluster = "only-cluster"
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("LoadFile() = %+v, want %+v", c, want)
+	}
+}
+
+func TestLoadFile_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		errorMsg string
+	}{
+		{name: "unknown key", content: "clustr: typo\n", errorMsg: "field clustr not found"},
+		{name: "bad duration", content: "requeue-after: soon\n", errorMsg: "parse config"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Default()
+			err := LoadFile(writeFile(t, tt.content), &c)
+			if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+				t.Errorf("LoadFile() error = %v, want error containing %q", err, tt.errorMsg)
+			}
+		})
+	}
+
+	c := Default()
+	if err := LoadFile(filepath.Join(t.TempDir(), "missing.yaml"), &c); err == nil {
+		t.Error("LoadFile() on missing file expected error, got nil")
+	}
+}
+
+func TestLoadFile_Empty(t *testing.T) {
+	c := Default()
+	if err := LoadFile(writeFile(t, ""), &c); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if !reflect.DeepEqual(c, Default()) {
+		t.Errorf("LoadFile() = %+v, want defaults", c)
+	}
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+type serviceRef struct {
+	Namespace string `json:"namespace"`
+	Service   string `json:"service"`
+}
+
+// RowReader reads back what the observer has stored.
+type RowReader interface {
+	ListServices(ctx context.Context, cluster string, limit, offset int) ([]serviceRef, error)
+	ListRows(ctx context.Context, cluster, namespace, service string, limit, offset int) ([]endpointRow, error)
+}
+
+// PostgresReader implements RowReader on top of the destination table.
+type PostgresReader struct {
+	DB        DB
+	TableName string
+	// TableFile, if set, replaces TableName with its current value
+	// (--table=@file).
+	TableFile *LiveValue
+	// JSONB reads rows written with RowFormatJSONB.
+	JSONB bool
+}
+
+func (p *PostgresReader) ListServices(ctx context.Context, cluster string, limit, offset int) ([]serviceRef, error) {
+	tbl, err := sanitizeTableIdent(p.TableFile.Or(p.TableName))
+	if err != nil {
+		return nil, err
+	}
+	q := fmt.Sprintf(`
+	  SELECT DISTINCT namespace, service FROM %s
+	  WHERE cluster = $1
+	  ORDER BY namespace, service
+	  LIMIT $2 OFFSET $3`, tbl)
+	rows, err := p.DB.Query(ctx, q, cluster, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (serviceRef, error) {
+		var s serviceRef
+		err := row.Scan(&s.Namespace, &s.Service)
+		return s, err
+	})
+}
+
+func (p *PostgresReader) ListRows(ctx context.Context, cluster, namespace, service string, limit, offset int) ([]endpointRow, error) {
+	tbl, err := sanitizeTableIdent(p.TableFile.Or(p.TableName))
+	if err != nil {
+		return nil, err
+	}
+	fields := "COALESCE(pod_name, ''), COALESCE(host(pod_ip), '')"
+	if p.JSONB {
+		fields = "COALESCE(payload->>'name', ''), COALESCE(payload->>'ip', '')"
+	}
+	q := fmt.Sprintf(`
+	  SELECT pod_uid, %s FROM %s
+	  WHERE cluster = $1 AND namespace = $2 AND service = $3
+	  ORDER BY pod_uid
+	  LIMIT $4 OFFSET $5`, fields, tbl)
+	rows, err := p.DB.Query(ctx, q, cluster, namespace, service, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (endpointRow, error) {
+		var e endpointRow
+		err := row.Scan(&e.UID, &e.Name, &e.IP)
+		return e, err
+	})
+}
+
+type page[T any] struct {
+	Items      []T  `json:"items"`
+	Limit      int  `json:"limit"`
+	Offset     int  `json:"offset"`
+	NextOffset *int `json:"nextOffset,omitempty"`
+}
+
+// NewAPIHandler serves a read-only view of the stored rows:
+//
+//	GET /services                      -> distinct {namespace,service}
+//	GET /services/{namespace}/{service} -> rows for that service
+//
+// Both accept ?cluster= (default: defaultCluster) and ?limit=&offset=.
+func NewAPIHandler(reader RowReader, defaultCluster string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /services", func(w http.ResponseWriter, req *http.Request) {
+		cluster, limit, offset, err := parseListParams(req, defaultCluster)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		items, err := reader.ListServices(req.Context(), cluster, limit+1, offset)
+		if err != nil {
+			http.Error(w, "query failed", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, newPage(items, limit, offset))
+	})
+	mux.HandleFunc("GET /services/{namespace}/{service}", func(w http.ResponseWriter, req *http.Request) {
+		cluster, limit, offset, err := parseListParams(req, defaultCluster)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		items, err := reader.ListRows(req.Context(), cluster, req.PathValue("namespace"), req.PathValue("service"), limit+1, offset)
+		if err != nil {
+			http.Error(w, "query failed", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, newPage(items, limit, offset))
+	})
+	return mux
+}
+
+// newPage trims the extra look-ahead item (readers are asked for limit+1)
+// and uses its presence to decide whether there is a next page.
+func newPage[T any](items []T, limit, offset int) page[T] {
+	p := page[T]{Items: items, Limit: limit, Offset: offset}
+	if p.Items == nil {
+		p.Items = []T{}
+	}
+	if len(p.Items) > limit {
+		p.Items = p.Items[:limit]
+		next := offset + limit
+		p.NextOffset = &next
+	}
+	return p
+}
+
+func parseListParams(req *http.Request, defaultCluster string) (cluster string, limit, offset int, err error) {
+	q := req.URL.Query()
+	cluster = q.Get("cluster")
+	if cluster == "" {
+		cluster = defaultCluster
+	}
+	limit = defaultPageLimit
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxPageLimit {
+			return "", 0, 0, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return "", 0, 0, errors.New("offset must be a non-negative integer")
+		}
+	}
+	return cluster, limit, offset, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeReader is an in-memory RowReader keyed by cluster/namespace/service.
+type fakeReader struct {
+	rows map[string]map[serviceRef][]endpointRow
+	err  error
+}
+
+func pageOf[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return nil
+	}
+	end := min(offset+limit, len(items))
+	return items[offset:end]
+}
+
+func (f *fakeReader) ListServices(_ context.Context, cluster string, limit, offset int) ([]serviceRef, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	var refs []serviceRef
+	for _, ref := range []serviceRef{{"default", "a"}, {"default", "b"}, {"other", "c"}} {
+		if _, ok := f.rows[cluster][ref]; ok {
+			refs = append(refs, ref)
+		}
+	}
+	return pageOf(refs, limit, offset), nil
+}
+
+func (f *fakeReader) ListRows(_ context.Context, cluster, namespace, service string, limit, offset int) ([]endpointRow, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return pageOf(f.rows[cluster][serviceRef{namespace, service}], limit, offset), nil
+}
+
+func newFakeReader() *fakeReader {
+	return &fakeReader{rows: map[string]map[serviceRef][]endpointRow{
+		"dev": {
+			{"default", "a"}: {
+				{UID: "uid-1", Name: "pod-1", IP: "10.0.0.1"},
+				{UID: "uid-2", Name: "pod-2", IP: "10.0.0.2"},
+				{UID: "uid-3", Name: "pod-3", IP: "10.0.0.3"},
+			},
+			{"default", "b"}: {{UID: "uid-4", Name: "pod-4", IP: "10.0.0.4"}},
+			{"other", "c"}:   {{UID: "uid-5", Name: "pod-5", IP: "10.0.0.5"}},
+		},
+		"prod": {
+			{"default", "a"}: {{UID: "uid-9", Name: "pod-9", IP: "10.1.0.9"}},
+		},
+	}}
+}
+
+func TestAPIHandler_Rows(t *testing.T) {
+	handler := NewAPIHandler(newFakeReader(), "dev")
+
+	tests := []struct {
+		name       string
+		url        string
+		code       int
+		uids       []string
+		nextOffset *int
+	}{
+		{name: "default cluster", url: "/services/default/a", code: http.StatusOK, uids: []string{"uid-1", "uid-2", "uid-3"}},
+		{name: "explicit cluster", url: "/services/default/a?cluster=prod", code: http.StatusOK, uids: []string{"uid-9"}},
+		{name: "first page", url: "/services/default/a?limit=2", code: http.StatusOK, uids: []string{"uid-1", "uid-2"}, nextOffset: intPtr(2)},
+		{name: "last page", url: "/services/default/a?limit=2&offset=2", code: http.StatusOK, uids: []string{"uid-3"}},
+		{name: "unknown service is empty", url: "/services/default/missing", code: http.StatusOK, uids: []string{}},
+		{name: "bad limit", url: "/services/default/a?limit=0", code: http.StatusBadRequest},
+		{name: "limit too large", url: "/services/default/a?limit=5000", code: http.StatusBadRequest},
+		{name: "bad offset", url: "/services/default/a?offset=-1", code: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, http.NoBody))
+			if rec.Code != tt.code {
+				t.Fatalf("status code = %d, want %d (body %q)", rec.Code, tt.code, rec.Body.String())
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+			var p page[endpointRow]
+			if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if len(p.Items) != len(tt.uids) {
+				t.Fatalf("got %d items, want %d: %+v", len(p.Items), len(tt.uids), p.Items)
+			}
+			for i, uid := range tt.uids {
+				if p.Items[i].UID != uid {
+					t.Errorf("item %d uid = %q, want %q", i, p.Items[i].UID, uid)
+				}
+			}
+			switch {
+			case tt.nextOffset == nil && p.NextOffset != nil:
+				t.Errorf("nextOffset = %d, want none", *p.NextOffset)
+			case tt.nextOffset != nil && (p.NextOffset == nil || *p.NextOffset != *tt.nextOffset):
+				t.Errorf("nextOffset = %v, want %d", p.NextOffset, *tt.nextOffset)
+			}
+		})
+	}
+}
+
+func TestAPIHandler_Services(t *testing.T) {
+	handler := NewAPIHandler(newFakeReader(), "dev")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/services?limit=2", http.NoBody))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var p page[serviceRef]
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	want := []serviceRef{{"default", "a"}, {"default", "b"}}
+	if len(p.Items) != len(want) || p.Items[0] != want[0] || p.Items[1] != want[1] {
+		t.Errorf("items = %+v, want %+v", p.Items, want)
+	}
+	if p.NextOffset == nil || *p.NextOffset != 2 {
+		t.Errorf("nextOffset = %v, want 2", p.NextOffset)
+	}
+}
+
+func TestAPIHandler_Errors(t *testing.T) {
+	handler := NewAPIHandler(&fakeReader{err: errors.New("boom")}, "dev")
+
+	for _, url := range []string{"/services", "/services/default/a"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, http.NoBody))
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("GET %s status code = %d, want %d", url, rec.Code, http.StatusInternalServerError)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/services", http.NoBody))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /services status code = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+	"time"
+)
+
+// serviceKey identifies the rows of one service.
+type serviceKey struct {
+	cluster, namespace, service string
+}
+
+func (k serviceKey) compare(o serviceKey) int {
+	return cmp.Or(cmp.Compare(k.cluster, o.cluster), cmp.Compare(k.namespace, o.namespace), cmp.Compare(k.service, o.service))
+}
+
+// writeOp is a pending write of one service into tbl: rows replaces its set,
+// nil rows deletes it. A non-zero version is the op's sync version (see
+// PostgresSink.SyncVersion).
+type writeOp struct {
+	key     serviceKey
+	tbl     string
+	rows    map[string]endpointRow
+	version int64
+	// from, if set, is the table the service's rows move from: Tables
+	// picked it for the last write. Its rows are deleted along with op.
+	from   string
+	picked string // what Tables picked for tbl, empty for TableName
+}
+
+// writeBatch collects the writes queued during one FlushInterval. A later
+// write of a service replaces an earlier one, so each service is pruned
+// against its latest desired set only.
+type writeBatch struct {
+	ops  map[serviceKey]writeOp
+	done chan struct{}
+	err  error // set before done is closed
+}
+
+// enqueue adds op to the current batch, starting one (and its flush timer)
+// if needed, and waits for the batch to be committed. The batch succeeds or
+// fails as a whole, so every waiter gets the same error and retries. A
+// caller that gives up early still has its write flushed.
+func (p *PostgresSink) enqueue(ctx context.Context, op writeOp) error {
+	p.batchMu.Lock()
+	b := p.batch
+	if b == nil {
+		b = &writeBatch{ops: map[serviceKey]writeOp{}, done: make(chan struct{})}
+		p.batch = b
+		// The flush outlives this caller but keeps its logger.
+		flushCtx := context.WithoutCancel(ctx)
+		time.AfterFunc(p.FlushInterval, func() { p.flush(flushCtx, b) })
+	}
+	// A Sync read before the queued one doesn't replace it.
+	if prev, ok := b.ops[op.key]; !ok || op.rows == nil || op.version >= prev.version {
+		b.ops[op.key] = op
+	}
+	p.batchMu.Unlock()
+
+	select {
+	case <-b.done:
+		return b.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flush closes b to new writes and commits it.
+func (p *PostgresSink) flush(ctx context.Context, b *writeBatch) {
+	p.batchMu.Lock()
+	if p.batch == b {
+		p.batch = nil
+	}
+	p.batchMu.Unlock()
+
+	p.flushMu.Lock()
+	defer p.flushMu.Unlock()
+	ops := slices.SortedFunc(maps.Values(b.ops), func(a, b writeOp) int { return a.key.compare(b.key) })
+	b.err = p.write(ctx, ops)
+	close(b.done)
+}
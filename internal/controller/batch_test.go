@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// queued waits until the current batch of p satisfies cond and returns it.
+func queued(t *testing.T, p *PostgresSink, cond func(*writeBatch) bool) *writeBatch {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		p.batchMu.Lock()
+		b := p.batch
+		ok := b != nil && cond(b)
+		p.batchMu.Unlock()
+		if ok {
+			return b
+		}
+	}
+	t.Fatal("batch never reached the expected state")
+	return nil
+}
+
+func services(n int) func(*writeBatch) bool {
+	return func(b *writeBatch) bool { return len(b.ops) == n }
+}
+
+// prunedUIDs maps each service to the live UIDs its prune kept.
+func prunedUIDs(db *fakeDB) map[string][]string {
+	out := map[string][]string{}
+	for _, del := range db.statements("pod_uid <> ALL") {
+		uids, _ := del.args[3].([]string)
+		out[del.args[2].(string)] = slices.Sorted(slices.Values(uids))
+	}
+	return out
+}
+
+func TestPostgresSink_FlushIntervalBatchesServices(t *testing.T) {
+	db := &fakeDB{}
+	// The timer never fires during the test; batches are flushed by hand.
+	p := &PostgresSink{DB: db, TableName: "server", FlushInterval: time.Hour}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	run := func(i int, fn func() error) {
+		wg.Add(1)
+		go func() { defer wg.Done(); errs[i] = fn() }()
+	}
+	run(0, func() error {
+		return p.Sync(ctx, "dev", "default", "svc-a", map[string]endpointRow{
+			"uid-1": {UID: "uid-1", IP: "10.0.0.1"}, "uid-2": {UID: "uid-2", IP: "10.0.0.2"},
+		})
+	})
+	run(1, func() error {
+		return p.Sync(ctx, "dev", "default", "svc-b", map[string]endpointRow{"uid-3": {UID: "uid-3", IP: "10.0.0.3"}})
+	})
+	run(2, func() error { return p.Delete(ctx, "dev", "default", "svc-c") })
+	queued(t, p, services(3))
+	// A later write of svc-a replaces the queued one.
+	run(3, func() error {
+		return p.Sync(ctx, "dev", "default", "svc-a", map[string]endpointRow{"uid-1": {UID: "uid-1", IP: "10.0.0.1"}})
+	})
+	b := queued(t, p, func(b *writeBatch) bool { return len(b.ops[serviceKey{"dev", "default", "svc-a"}].rows) == 1 })
+	p.flush(ctx, b)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("write %d error = %v", i, err)
+		}
+	}
+	if db.commits != 1 {
+		t.Errorf("commits = %d, want 1", db.commits)
+	}
+	want := map[string][]string{"svc-a": {"uid-1"}, "svc-b": {"uid-3"}}
+	if got := prunedUIDs(db); len(got) != len(want) || !slices.Equal(got["svc-a"], want["svc-a"]) || !slices.Equal(got["svc-b"], want["svc-b"]) {
+		t.Errorf("pruned services = %v, want %v", got, want)
+	}
+	del := slices.DeleteFunc(db.statements("DELETE FROM"), func(e execCall) bool { return strings.Contains(e.sql, "pod_uid") })
+	if len(del) != 1 || del[0].args[2] != "svc-c" {
+		t.Errorf("deletes = %+v, want one for svc-c", del)
+	}
+	if ups := db.statements("INSERT INTO"); len(ups) != 2 {
+		t.Errorf("got %d upserts, want 2", len(ups))
+	}
+	for _, e := range db.execs {
+		if !e.inTx {
+			t.Errorf("statement outside the batch transaction: %s", e.sql)
+		}
+	}
+}
+
+func TestPostgresSink_FlushIntervalFailsWholeBatch(t *testing.T) {
+	db := &fakeDB{execFn: func(sql string, args []any) (pgconn.CommandTag, error) {
+		if strings.Contains(sql, "INSERT INTO") && args[2] == "svc-b" {
+			return pgconn.CommandTag{}, errFake
+		}
+		return pgconn.NewCommandTag("OK 1"), nil
+	}}
+	p := &PostgresSink{DB: db, TableName: "server", FlushInterval: time.Hour}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, svc := range []string{"svc-a", "svc-b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = p.Sync(ctx, "dev", "default", svc, map[string]endpointRow{"uid-" + svc: {UID: "uid-" + svc, IP: "10.0.0.1"}})
+		}()
+	}
+	p.flush(ctx, queued(t, p, services(2)))
+	wg.Wait()
+
+	for i, err := range errs {
+		if !errors.Is(err, errFake) {
+			t.Errorf("write %d error = %v, want %v", i, err, errFake)
+		}
+	}
+	if db.commits != 0 || db.rollbacks != 1 {
+		t.Errorf("commits = %d, rollbacks = %d; want 0, 1", db.commits, db.rollbacks)
+	}
+}
+
+func TestPostgresSink_FlushIntervalTimer(t *testing.T) {
+	db := &fakeDB{}
+	p := &PostgresSink{DB: db, TableName: "server", FlushInterval: 10 * time.Millisecond}
+	for range 2 { // the second write starts a new batch
+		if err := p.Sync(context.Background(), "dev", "default", "svc", map[string]endpointRow{"uid-1": {UID: "uid-1", IP: "10.0.0.1"}}); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+	}
+	if db.commits != 2 {
+		t.Errorf("commits = %d, want 2", db.commits)
+	}
+}
+
+func TestPostgresSink_FlushIntervalCallerGivesUp(t *testing.T) {
+	db := &fakeDB{}
+	p := &PostgresSink{DB: db, TableName: "server", FlushInterval: 50 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+	go func() {
+		done <- p.Sync(ctx, "dev", "default", "svc", map[string]endpointRow{"uid-1": {UID: "uid-1", IP: "10.0.0.1"}})
+	}()
+	b := queued(t, p, services(1))
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Sync() error = %v, want context.Canceled", err)
+	}
+
+	// The write was queued, so it still lands despite the canceled context.
+	<-b.done
+	if b.err != nil || db.commits != 1 {
+		t.Errorf("flush error = %v, commits = %d; want nil, 1", b.err, db.commits)
+	}
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/ealebed/observer/internal/testutil"
+)
+
+// benchEndpoints is the size of the service the benchmarks sync.
+const benchEndpoints = 10000
+
+// BenchmarkBuildDesiredRows builds a 10k-endpoint service spread over 100
+// slices, a tenth of them without a Pod targetRef.
+func BenchmarkBuildDesiredRows(b *testing.B) {
+	list := testutil.GenerateSlices("default", "web", benchEndpoints)
+	for s := range list.Items {
+		for i := range list.Items[s].Endpoints {
+			if i%10 == 0 {
+				list.Items[s].Endpoints[i].TargetRef = nil
+			}
+		}
+	}
+	r := &EndpointSliceReconciler{}
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := r.buildDesiredRows(ctx, list, "web"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkPostgresSink_Sync writes a 10k-endpoint service through the
+// statements of the table sink, against a database that only records them.
+func BenchmarkPostgresSink_Sync(b *testing.B) {
+	ctx := context.Background()
+	rows, err := (&EndpointSliceReconciler{}).buildDesiredRows(ctx, testutil.GenerateSlices("default", "web", benchEndpoints), "web")
+	if err != nil {
+		b.Fatal(err)
+	}
+	db := &fakeDB{}
+	sink := &PostgresSink{DB: db, TableName: "server"}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		db.execs = db.execs[:0]
+		if err := sink.Sync(ctx, "dev", "default", "web", rows); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkReconcile_10kEndpoints reconciles one slice of a 10k-endpoint
+// service: the list of its 100 slices from the cache, the build of its rows
+// and their write through the table sink, every time rather than only once
+// they change.
+func BenchmarkReconcile_10kEndpoints(b *testing.B) {
+	list := testutil.GenerateSlices("default", "web", benchEndpoints)
+	objs := make([]client.Object, len(list.Items))
+	for i := range list.Items {
+		objs[i] = &list.Items[i]
+	}
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(b)).WithObjects(objs...).Build()
+	db := &fakeDB{}
+	r := &EndpointSliceReconciler{
+		Client:            c,
+		Sink:              &PostgresSink{DB: db, TableName: "server"},
+		ClusterName:       "dev",
+		HeartbeatInterval: time.Nanosecond, // write every time, though nothing changed
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: list.Items[0].Name}}
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		db.execs = db.execs[:0]
+		if _, err := r.Reconcile(ctx, req); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if ups := len(db.statements("INSERT INTO")); ups != benchEndpoints {
+		b.Fatalf("last reconcile upserted %d rows, want %d", ups, benchEndpoints)
+	}
+}
@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// bootstrapRetryDelay is the wait before another bootstrap pass after one
+// failed.
+const bootstrapRetryDelay = 5 * time.Second
+
+// errBootstrapPending is reported by Bootstrap.Check until the initial
+// sync is written.
+var errBootstrapPending = errors.New("initial sync not finished")
+
+// Bootstrap is the initial full sync of --bootstrap-sync: it writes every
+// matching service once, like --once, while the controllers start, and
+// keeps the readiness check failing until that pass succeeded, so a pod
+// only turns Ready once the table holds the current snapshot. A failed
+// pass is retried whole. Services over --max-endpoints-per-service are
+// skipped (logged and counted) as in Reconcile and don't hold it up.
+// While the Reconciler's Pause is set, the pass waits for writes to resume.
+// A nil *Bootstrap is always done.
+type Bootstrap struct {
+	Reconciler *EndpointSliceReconciler
+	// Namespace limits the sync to one namespace; empty is all.
+	Namespace string
+	Log       logr.Logger
+
+	done        atomic.Bool
+	retryDelay  time.Duration // bootstrapRetryDelay if zero
+	pausedDelay time.Duration // pausedRequeueDelay if zero
+}
+
+// Start runs the initial sync until a pass succeeds or ctx is done. It's a
+// manager Runnable; the manager starts it once the caches have synced.
+func (b *Bootstrap) Start(ctx context.Context) error {
+	delay, pausedDelay := b.retryDelay, b.pausedDelay
+	if delay == 0 {
+		delay = bootstrapRetryDelay
+	}
+	if pausedDelay == 0 {
+		pausedDelay = pausedRequeueDelay
+	}
+	ctx = log.IntoContext(ctx, b.Log)
+	for waiting := false; ; {
+		if b.Reconciler.Pause.Paused() {
+			if !waiting {
+				b.Log.Info("writes are paused, starting the initial sync once they resume")
+				waiting = true
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(pausedDelay):
+			}
+			continue
+		}
+		waiting = false
+		err := b.Reconciler.SyncAll(ctx, b.Namespace)
+		if err == nil || onlyTooManyEndpoints(err) {
+			b.done.Store(true)
+			b.Log.Info("initial sync finished, reporting ready")
+			return nil
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		b.Log.Error(err, "initial sync failed, retrying", "after", delay)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Done reports whether the initial sync is written.
+func (b *Bootstrap) Done() bool {
+	return b == nil || b.done.Load()
+}
+
+// Check is a healthz.Checker failing until the initial sync is written.
+func (b *Bootstrap) Check(*http.Request) error {
+	if !b.Done() {
+		return errBootstrapPending
+	}
+	return nil
+}
+
+// onlyTooManyEndpoints reports whether every error joined into err by
+// SyncAll is errTooManyEndpoints.
+func onlyTooManyEndpoints(err error) bool {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return errors.Is(err, errTooManyEndpoints)
+	}
+	for _, e := range joined.Unwrap() {
+		if !onlyTooManyEndpoints(e) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// hookSink is a recordingSink calling onSync before each Sync and failing
+// it with the error that returns.
+type hookSink struct {
+	recordingSink
+	onSync func() error
+}
+
+func (s *hookSink) Sync(ctx context.Context, cluster, namespace, service string, rows map[string]endpointRow) error {
+	s.err = s.onSync()
+	return s.recordingSink.Sync(ctx, cluster, namespace, service, rows)
+}
+
+func TestBootstrap_GatesReadiness(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1")),
+	).Build()
+	b := &Bootstrap{Log: logr.Discard(), retryDelay: time.Millisecond}
+	srv := httptest.NewServer(healthz.CheckHandler{Checker: b.Check})
+	defer srv.Close()
+	readyz := func() int {
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// The first pass fails, so the pod must stay unready until the retry.
+	var codes []int
+	sink := &hookSink{onSync: func() error {
+		codes = append(codes, readyz())
+		if len(codes) == 1 {
+			return errors.New("database is down")
+		}
+		return nil
+	}}
+	b.Reconciler = &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev"}
+	if code := readyz(); code != http.StatusInternalServerError {
+		t.Errorf("/readyz before the sync = %d, want 500", code)
+	}
+	if err := b.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	if len(codes) != 2 || codes[0] != http.StatusInternalServerError || codes[1] != http.StatusInternalServerError {
+		t.Errorf("/readyz during the syncs = %v, want 500 for both passes", codes)
+	}
+	if code := readyz(); code != http.StatusOK {
+		t.Errorf("/readyz after the sync = %d, want 200", code)
+	}
+	if len(sink.syncs) != 2 || sink.syncs[1] != "dev/default/web" {
+		t.Errorf("syncs = %v, want dev/default/web twice", sink.syncs)
+	}
+}
+
+func TestBootstrap_SkipsServicesOverLimit(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1"), podEndpoint("uid-2", "web-2", "10.0.0.2")),
+		newSlice("default", "db-a", "db", podEndpoint("uid-3", "db-1", "10.0.0.3")),
+	).Build()
+	sink := &recordingSink{}
+	b := &Bootstrap{
+		Reconciler: &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", MaxEndpointsPerService: 1},
+		Log:        logr.Discard(),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := b.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if !b.Done() {
+		t.Error("Done() = false, want a service over the limit not to block readiness")
+	}
+	if len(sink.syncs) != 1 || sink.syncs[0] != "dev/default/db" {
+		t.Errorf("syncs = %v, want only dev/default/db", sink.syncs)
+	}
+}
+
+func TestBootstrap_WaitsWhilePaused(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1")),
+	).Build()
+	pause := &Pause{}
+	pause.Set(true)
+	defer pause.Set(false)
+	sink := &hookSink{onSync: func() error {
+		if pause.Paused() {
+			t.Error("initial sync wrote while writes are paused")
+		}
+		return nil
+	}}
+	b := &Bootstrap{
+		Reconciler: &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", Pause: pause},
+		Log: funcr.New(func(_, args string) {
+			if strings.Contains(args, "once they resume") {
+				time.AfterFunc(20*time.Millisecond, func() { pause.Set(false) })
+			}
+		}, funcr.Options{}),
+		pausedDelay: time.Millisecond,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := b.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if !b.Done() || len(sink.syncs) != 1 {
+		t.Errorf("Done() = %v with syncs %v, want the pass written once writes resumed", b.Done(), sink.syncs)
+	}
+}
+
+func TestBootstrap_Nil(t *testing.T) {
+	var b *Bootstrap
+	if err := b.Check(nil); err != nil {
+		t.Errorf("nil Check() = %v, want ready", err)
+	}
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Breaker stops the reconcilers from hammering a database that keeps
+// failing (--db-breaker-threshold). After Threshold consecutive sink
+// writes failed with a transient or read-only error it opens: writes are
+// refused for Cooldown, and their reconciles requeue until then instead of
+// each running into the outage. Once Cooldown has passed it is half-open
+// and lets one write through as a probe per Cooldown; the first write that
+// succeeds closes it, one that fails keeps it open. Any other outcome, such
+// as a permanent error, shows the database answering and counts as a
+// success. A nil *Breaker never opens.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+	Log       logr.Logger
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+	// next is when the next probe may go through while open.
+	next time.Time
+	now  func() time.Time
+}
+
+func (b *Breaker) clock() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+	return time.Now()
+}
+
+// errBreakerOpen fails the writes of a full pass that the Breaker refused.
+var errBreakerOpen = errors.New("database breaker open")
+
+// Allow reports whether a write may go to the database now. If not, it
+// also returns how long until the next probe.
+func (b *Breaker) Allow() (time.Duration, bool) {
+	if b == nil {
+		return 0, true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return 0, true
+	}
+	now := b.clock()
+	if wait := b.next.Sub(now); wait > 0 {
+		return wait, false
+	}
+	b.next = now.Add(b.Cooldown)
+	breakerState.Set(breakerHalfOpen)
+	b.Log.V(1).Info("database breaker half-open, probing")
+	return 0, true
+}
+
+// Record counts the outcome of a write that Allow let through.
+func (b *Breaker) Record(err error) {
+	if b == nil {
+		return
+	}
+	class := classifyDBError(err)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil || (class != dbErrorTransient && class != dbErrorReadOnly) {
+		if b.open {
+			b.Log.Info("database breaker closed, writes resume")
+			breakerState.Set(breakerClosed)
+		}
+		b.failures, b.open = 0, false
+		return
+	}
+	b.failures++
+	if b.open {
+		breakerState.Set(breakerOpen) // the probe failed
+		return
+	}
+	if b.failures >= b.Threshold {
+		b.open = true
+		b.next = b.clock().Add(b.Cooldown)
+		breakerState.Set(breakerOpen)
+		b.Log.Error(err, "database breaker open, holding writes back", "failures", b.failures, "cooldown", b.Cooldown)
+	}
+}
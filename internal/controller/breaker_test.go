@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestBreaker_Transitions(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := &Breaker{Threshold: 2, Cooldown: 30 * time.Second, Log: logr.Discard(), now: func() time.Time { return now }}
+	down := &pgconn.PgError{Code: "08006"}
+	defer breakerState.Set(breakerClosed)
+
+	// step checks the breaker after one action: whether the next write is
+	// allowed (wait is the time until the next probe if not) and the gauge.
+	step := func(name string, wantAllow bool, wantWait time.Duration, wantState float64) {
+		t.Helper()
+		wait, ok := b.Allow()
+		if ok != wantAllow || wait != wantWait {
+			t.Errorf("%s: Allow() = %s, %v, want %s, %v", name, wait, ok, wantWait, wantAllow)
+		}
+		if got := testutil.ToFloat64(breakerState); got != wantState {
+			t.Errorf("%s: observer_db_breaker_state = %v, want %v", name, got, wantState)
+		}
+	}
+
+	breakerState.Set(breakerClosed)
+	b.Record(down)
+	step("one failure", true, 0, breakerClosed)
+	b.Record(down)
+	step("threshold reached", false, 30*time.Second, breakerOpen)
+
+	now = now.Add(10 * time.Second)
+	step("cooling down", false, 20*time.Second, breakerOpen)
+
+	now = now.Add(20 * time.Second)
+	step("probe", true, 0, breakerHalfOpen)
+	step("second caller while probing", false, 30*time.Second, breakerHalfOpen)
+	b.Record(down)
+	step("probe failed", false, 30*time.Second, breakerOpen)
+
+	now = now.Add(30 * time.Second)
+	step("second probe", true, 0, breakerHalfOpen)
+	b.Record(nil)
+	step("probe succeeded", true, 0, breakerClosed)
+
+	// The count starts over once closed.
+	b.Record(down)
+	step("one failure after closing", true, 0, breakerClosed)
+}
+
+func TestBreaker_PermanentErrorsDontOpen(t *testing.T) {
+	b := &Breaker{Threshold: 2, Cooldown: time.Minute, Log: logr.Discard()}
+	down, badTable := &pgconn.PgError{Code: "08006"}, &pgconn.PgError{Code: "42P01"}
+	for _, err := range []error{down, badTable, down, badTable, down} {
+		b.Record(err)
+	}
+	if _, ok := b.Allow(); !ok {
+		t.Error("Allow() = false, want a database answering with permanent errors to reset the count")
+	}
+}
+
+func TestBreaker_Nil(t *testing.T) {
+	var b *Breaker
+	b.Record(&pgconn.PgError{Code: "08006"})
+	if _, ok := b.Allow(); !ok {
+		t.Error("nil Allow() = false, want true")
+	}
+}
+
+func TestEndpointSliceReconciler_BreakerShortCircuits(t *testing.T) {
+	slice := newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1"))
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(slice).Build()
+	sink := &recordingSink{err: &pgconn.PgError{Code: "08006"}}
+	breaker := &Breaker{Threshold: 1, Cooldown: time.Minute, Log: logr.Discard()}
+	defer breakerState.Set(breakerClosed)
+	r := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", Breaker: breaker}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web-a"}}
+
+	if res, err := r.Reconcile(context.Background(), req); err != nil || res.RequeueAfter != dbRetryBaseDelay {
+		t.Fatalf("first Reconcile() = %+v, %v, want the transient retry", res, err)
+	}
+	res, err := r.Reconcile(context.Background(), req)
+	if err != nil || res.RequeueAfter <= 55*time.Second || res.RequeueAfter > time.Minute {
+		t.Errorf("Reconcile() while open = %+v, %v, want a requeue after about the cooldown", res, err)
+	}
+	if len(sink.syncs) != 1 {
+		t.Errorf("syncs = %v, want none while the breaker is open", sink.syncs)
+	}
+
+	// A Service deleted meanwhile waits too.
+	s := &ServiceReconciler{Client: c, Sink: sink, ClusterName: "dev", Tracker: NewSyncTracker(), Breaker: breaker}
+	gone := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "gone"}}
+	if res, err := s.Reconcile(context.Background(), gone); err != nil || res.RequeueAfter == 0 || len(sink.deletes) != 0 {
+		t.Errorf("service Reconcile() while open = %+v, %v with deletes %v, want a requeue and no delete", res, err, sink.deletes)
+	}
+}
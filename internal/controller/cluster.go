@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ClusterAuto is the --cluster value that asks for DetectClusterName.
+const ClusterAuto = "auto"
+
+// DetectClusterName derives a stable cluster identity from the UID of the
+// kube-system namespace, which lives as long as the cluster does. If the
+// namespace can't be read it falls back to hostname; the returned error
+// then explains why the fallback was used.
+func DetectClusterName(ctx context.Context, reader client.Reader, hostname func() (string, error)) (string, error) {
+	var ns corev1.Namespace
+	err := reader.Get(ctx, types.NamespacedName{Name: "kube-system"}, &ns)
+	if err == nil && ns.UID != "" {
+		return string(ns.UID), nil
+	}
+	if err == nil {
+		err = fmt.Errorf("kube-system namespace has no UID")
+	}
+
+	host, herr := hostname()
+	if herr != nil || host == "" {
+		return "", fmt.Errorf("read kube-system namespace: %w; hostname fallback failed: %v", err, herr)
+	}
+	return host, fmt.Errorf("read kube-system namespace: %w", err)
+}
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDetectClusterName(t *testing.T) {
+	kubeSystem := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "3f1c2a9e-0000-4b7d-8c6e-1a2b3c4d5e6f"}}
+	host := func() (string, error) { return "node-1", nil }
+	noHost := func() (string, error) { return "", errors.New("no hostname") }
+
+	tests := []struct {
+		name     string
+		objects  int
+		hostname func() (string, error)
+		want     string
+		wantErr  bool
+	}{
+		{name: "namespace uid", objects: 1, hostname: host, want: string(kubeSystem.UID)},
+		{name: "hostname fallback", hostname: host, want: "node-1", wantErr: true},
+		{name: "nothing available", hostname: noHost, want: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := fake.NewClientBuilder().WithScheme(newTestScheme(t))
+			if tt.objects > 0 {
+				b = b.WithObjects(kubeSystem.DeepCopy())
+			}
+			got, err := DetectClusterName(context.Background(), b.Build(), tt.hostname)
+			if got != tt.want {
+				t.Errorf("DetectClusterName() = %q, want %q", got, tt.want)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DetectClusterName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
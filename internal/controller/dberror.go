@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jackc/pgx/v5/pgconn"
+	"k8s.io/apimachinery/pkg/types"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+type dbErrorClass int
+
+const (
+	// dbErrorUnknown leaves retrying to controller-runtime's rate limiter.
+	dbErrorUnknown dbErrorClass = iota
+	// dbErrorTransient covers lost connections, timeouts and aborted
+	// transactions; retrying soon is likely to succeed.
+	dbErrorTransient
+	// dbErrorPermanent covers schema, syntax and constraint problems that
+	// will fail the same way until someone fixes the table or the config.
+	dbErrorPermanent
+	// dbErrorReadOnly is a write refused by a read-only server, typically
+	// a primary during failover; it clears up, but not within seconds.
+	dbErrorReadOnly
+)
+
+func (c dbErrorClass) String() string {
+	switch c {
+	case dbErrorTransient:
+		return "transient"
+	case dbErrorPermanent:
+		return "permanent"
+	case dbErrorReadOnly:
+		return "read-only"
+	default:
+		return "unknown"
+	}
+}
+
+// Bounds for the per-service retry delay after a transient DB error.
+const (
+	dbRetryBaseDelay = 500 * time.Millisecond
+	dbRetryMaxDelay  = 30 * time.Second
+
+	readOnlyRetryBaseDelay = 5 * time.Second
+	readOnlyRetryMaxDelay  = 2 * time.Minute
+)
+
+// classifyDBError sorts err by how it should be retried. Joined errors take
+// the most retryable class among their parts: transient, then read-only,
+// unknown and permanent.
+func classifyDBError(err error) dbErrorClass {
+	if err == nil {
+		return dbErrorUnknown
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		parts := joined.Unwrap()
+		class := dbErrorPermanent
+		for _, e := range parts {
+			switch classifyDBError(e) {
+			case dbErrorTransient:
+				return dbErrorTransient
+			case dbErrorReadOnly:
+				class = dbErrorReadOnly
+			case dbErrorUnknown:
+				if class == dbErrorPermanent {
+					class = dbErrorUnknown
+				}
+			}
+		}
+		if len(parts) == 0 {
+			return dbErrorUnknown
+		}
+		return class
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return classifySQLState(pgErr.Code)
+	}
+	if errors.Is(err, errInvalidTable) {
+		return dbErrorPermanent
+	}
+	if errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err) || pgconn.SafeToRetry(err) {
+		return dbErrorTransient
+	}
+	var connErr *pgconn.ConnectError
+	if errors.As(err, &connErr) {
+		return dbErrorTransient
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return dbErrorTransient
+	}
+	return dbErrorUnknown
+}
+
+// classifySQLState maps a SQLSTATE to a class using its two-character class
+// prefix; see https://www.postgresql.org/docs/current/errcodes-appendix.html.
+func classifySQLState(code string) dbErrorClass {
+	if len(code) < 2 {
+		return dbErrorUnknown
+	}
+	if code == "25006" { // read_only_sql_transaction
+		return dbErrorReadOnly
+	}
+	switch code[:2] {
+	case "08", // connection exception
+		"40", // transaction rollback (serialization failure, deadlock)
+		"53", // insufficient resources
+		"57": // operator intervention (query_canceled, admin_shutdown, ...)
+		return dbErrorTransient
+	case "22", // data exception
+		"23", // integrity constraint violation
+		"42": // syntax error or access rule violation (undefined table/column, ...)
+		return dbErrorPermanent
+	default:
+		return dbErrorUnknown
+	}
+}
+
+// retryBackoff tracks consecutive transient failures per service and hands
+// out exponentially growing delays capped at dbRetryMaxDelay. The zero value
+// is ready to use.
+type retryBackoff struct {
+	mu       sync.Mutex
+	failures map[types.NamespacedName]int
+}
+
+func (b *retryBackoff) next(key types.NamespacedName) time.Duration {
+	return b.nextWithin(key, dbRetryBaseDelay, dbRetryMaxDelay)
+}
+
+// nextWithin is next with other bounds; the failure count is shared.
+func (b *retryBackoff) nextWithin(key types.NamespacedName, base, maxDelay time.Duration) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures == nil {
+		b.failures = map[types.NamespacedName]int{}
+	}
+	n := b.failures[key]
+	b.failures[key] = n + 1
+
+	delay := base
+	for i := 0; i < n && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+func (b *retryBackoff) reset(key types.NamespacedName) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.failures, key)
+}
+
+// resultForSinkError turns a failed sink write into a reconcile result:
+// transient errors requeue after a bounded backoff, a read-only database
+// after a longer one until writes succeed, permanent ones are logged and
+// dropped, anything else is returned to controller-runtime.
+func resultForSinkError(logger logr.Logger, backoff *retryBackoff, key types.NamespacedName, err error) (ctrl.Result, error) {
+	switch classifyDBError(err) {
+	case dbErrorTransient:
+		delay := backoff.next(key)
+		logger.Error(err, "transient sink error, retrying", "namespace", key.Namespace, "service", key.Name, "retryAfter", delay)
+		return ctrl.Result{RequeueAfter: delay}, nil
+	case dbErrorReadOnly:
+		delay := backoff.nextWithin(key, readOnlyRetryBaseDelay, readOnlyRetryMaxDelay)
+		logger.Error(err, "database read-only, backing off", "namespace", key.Namespace, "service", key.Name, "retryAfter", delay)
+		return ctrl.Result{RequeueAfter: delay}, nil
+	case dbErrorPermanent:
+		backoff.reset(key)
+		logger.Error(err, "permanent sink error, dropping until the next change", "namespace", key.Namespace, "service", key.Name)
+		return ctrl.Result{}, nil
+	default:
+		// controller-runtime logs it; the sinks name the service in err.
+		return ctrl.Result{}, err
+	}
+}
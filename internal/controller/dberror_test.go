@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jackc/pgx/v5/pgconn"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestClassifyDBError(t *testing.T) {
+	pg := func(code string) error { return &pgconn.PgError{Code: code, Message: "boom"} }
+
+	tests := []struct {
+		name string
+		err  error
+		want dbErrorClass
+	}{
+		{"nil", nil, dbErrorUnknown},
+		{"plain error", errors.New("boom"), dbErrorUnknown},
+		{"connection failure", pg("08006"), dbErrorTransient},
+		{"serialization failure", pg("40001"), dbErrorTransient},
+		{"deadlock", pg("40P01"), dbErrorTransient},
+		{"too many connections", pg("53300"), dbErrorTransient},
+		{"statement timeout", pg("57014"), dbErrorTransient},
+		{"undefined table", pg("42P01"), dbErrorPermanent},
+		{"syntax error", pg("42601"), dbErrorPermanent},
+		{"unique violation", pg("23505"), dbErrorPermanent},
+		{"invalid text representation", pg("22P02"), dbErrorPermanent},
+		{"unmapped sqlstate", pg("XX000"), dbErrorUnknown},
+		{"wrapped pg error", fmt.Errorf("upsert: %w", pg("42P01")), dbErrorPermanent},
+		{"context deadline", fmt.Errorf("begin: %w", context.DeadlineExceeded), dbErrorTransient},
+		{"connect error", &pgconn.ConnectError{}, dbErrorTransient},
+		{"invalid table annotation", fmt.Errorf("%w from annotation", errInvalidTable), dbErrorPermanent},
+		{"joined transient wins", errors.Join(pg("42P01"), pg("08006")), dbErrorTransient},
+		{"joined unknown beats permanent", errors.Join(pg("42P01"), errors.New("webhook 400")), dbErrorUnknown},
+		{"joined all permanent", errors.Join(pg("42P01"), pg("23505")), dbErrorPermanent},
+		{"read-only transaction", fmt.Errorf("upsert: %w", pg("25006")), dbErrorReadOnly},
+		{"other invalid transaction state", pg("25P02"), dbErrorUnknown},
+		{"joined read-only beats unknown", errors.Join(errors.New("webhook 400"), pg("25006"), pg("42P01")), dbErrorReadOnly},
+		{"joined transient beats read-only", errors.Join(pg("25006"), pg("08006")), dbErrorTransient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyDBError(tt.err); got != tt.want {
+				t.Errorf("classifyDBError(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	var b retryBackoff
+	key := types.NamespacedName{Namespace: "default", Name: "svc"}
+	other := types.NamespacedName{Namespace: "default", Name: "other"}
+
+	want := []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second}
+	for i, w := range want {
+		if got := b.next(key); got != w {
+			t.Errorf("attempt %d: next() = %s, want %s", i, got, w)
+		}
+	}
+	if got := b.next(other); got != dbRetryBaseDelay {
+		t.Errorf("other key next() = %s, want base delay (keys are independent)", got)
+	}
+
+	for range 20 {
+		b.next(key)
+	}
+	if got := b.next(key); got != dbRetryMaxDelay {
+		t.Errorf("next() after many failures = %s, want cap %s", got, dbRetryMaxDelay)
+	}
+
+	b.reset(key)
+	if got := b.next(key); got != dbRetryBaseDelay {
+		t.Errorf("next() after reset = %s, want %s", got, dbRetryBaseDelay)
+	}
+}
+
+func TestResultForSinkError(t *testing.T) {
+	key := types.NamespacedName{Namespace: "default", Name: "svc"}
+
+	tests := []struct {
+		name     string
+		err      error
+		wantErr  bool
+		wantWait time.Duration
+	}{
+		{"transient requeues quickly", &pgconn.PgError{Code: "08006"}, false, dbRetryBaseDelay},
+		{"permanent is dropped", &pgconn.PgError{Code: "42P01"}, false, 0},
+		{"read-only backs off longer", &pgconn.PgError{Code: "25006", Message: "cannot execute INSERT in a read-only transaction"}, false, readOnlyRetryBaseDelay},
+		{"unknown goes to the rate limiter", errors.New("boom"), true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b retryBackoff
+			res, err := resultForSinkError(logr.Discard(), &b, key, tt.err)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if res.RequeueAfter != tt.wantWait {
+				t.Errorf("RequeueAfter = %s, want %s", res.RequeueAfter, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestResultForSinkError_ReadOnlyBacksOff(t *testing.T) {
+	key := types.NamespacedName{Namespace: "default", Name: "svc"}
+	readOnly := fmt.Errorf("upsert default/svc uid=uid-1: %w", &pgconn.PgError{Code: "25006", Message: "cannot execute INSERT in a read-only transaction"})
+	ctx, logs := captureLogs()
+	logger := logr.FromContextOrDiscard(ctx)
+
+	var b retryBackoff
+	want := []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second, readOnlyRetryMaxDelay, readOnlyRetryMaxDelay}
+	for i, w := range want {
+		res, err := resultForSinkError(logger, &b, key, readOnly)
+		if err != nil || res.RequeueAfter != w {
+			t.Errorf("attempt %d: result = %+v, %v, want RequeueAfter %s", i, res, err, w)
+		}
+	}
+	if !strings.Contains((*logs)[0], "database read-only, backing off") {
+		t.Errorf("log = %q, want the read-only message", (*logs)[0])
+	}
+
+	// Once a write succeeds (the caller resets), the next failure starts over.
+	b.reset(key)
+	if res, _ := resultForSinkError(logger, &b, key, readOnly); res.RequeueAfter != readOnlyRetryBaseDelay {
+		t.Errorf("after reset RequeueAfter = %s, want %s", res.RequeueAfter, readOnlyRetryBaseDelay)
+	}
+}
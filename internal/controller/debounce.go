@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// debouncer coalesces the reconciles of a service that arrive within window
+// of the first one into a single sync at the end of the window. The sync
+// lists all slices of the service, so it sees every coalesced change.
+type debouncer struct {
+	mu     sync.Mutex
+	window time.Duration
+	now    func() time.Time
+	due    map[types.NamespacedName]time.Time
+}
+
+func newDebouncer(window time.Duration) *debouncer {
+	return &debouncer{window: window, now: time.Now, due: map[types.NamespacedName]time.Time{}}
+}
+
+// wait returns how long to hold off syncing key, opening a window on the
+// first call. Zero means sync now.
+func (d *debouncer) wait(key types.NamespacedName) time.Duration {
+	if d.window <= 0 {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	due, ok := d.due[key]
+	if !ok {
+		d.due[key] = now.Add(d.window)
+		return d.window
+	}
+	if now.Before(due) {
+		return due.Sub(now)
+	}
+	delete(d.due, key)
+	return 0
+}
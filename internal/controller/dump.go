@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Output formats of WriteDump (observer dump --output).
+const (
+	DumpFormatTable = "table"
+	DumpFormatJSON  = "json"
+)
+
+// DumpFilter narrows Dump down; an empty field matches any value.
+type DumpFilter struct {
+	Cluster   string
+	Namespace string
+	Service   string
+}
+
+// DumpRow is one stored row as printed by observer dump.
+type DumpRow struct {
+	Cluster   string    `json:"cluster"`
+	Namespace string    `json:"namespace"`
+	Service   string    `json:"service"`
+	PodUID    string    `json:"podUID"`
+	PodName   string    `json:"podName"`
+	PodIP     string    `json:"podIP"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// Dump reads every row of the table matching f, ordered by the conflict
+// key. Unlike ListRows it isn't paged: it's meant for a one-off look at
+// what was written, not for serving.
+func (p *PostgresReader) Dump(ctx context.Context, f DumpFilter) ([]DumpRow, error) {
+	tbl, err := sanitizeTableIdent(p.TableName)
+	if err != nil {
+		return nil, err
+	}
+	fields := "COALESCE(pod_name, ''), COALESCE(host(pod_ip), '')"
+	if p.JSONB {
+		fields = "COALESCE(payload->>'name', ''), COALESCE(payload->>'ip', '')"
+	}
+	q := fmt.Sprintf(`
+	  SELECT cluster, namespace, service, pod_uid, %s, last_seen FROM %s
+	  WHERE ($1 = '' OR cluster = $1) AND ($2 = '' OR namespace = $2) AND ($3 = '' OR service = $3)
+	  ORDER BY cluster, namespace, service, pod_uid`, fields, tbl)
+	rows, err := p.DB.Query(ctx, q, f.Cluster, f.Namespace, f.Service)
+	if err != nil {
+		return nil, fmt.Errorf("dump %s: %w", tbl, err)
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (DumpRow, error) {
+		var d DumpRow
+		err := row.Scan(&d.Cluster, &d.Namespace, &d.Service, &d.PodUID, &d.PodName, &d.PodIP, &d.LastSeen)
+		return d, err
+	})
+}
+
+// WriteDump prints rows to w as an aligned table with a header line, or as
+// a JSON array.
+func WriteDump(w io.Writer, rows []DumpRow, format string) error {
+	switch format {
+	case DumpFormatJSON:
+		if rows == nil {
+			rows = []DumpRow{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	case DumpFormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "CLUSTER\tNAMESPACE\tSERVICE\tPOD UID\tPOD NAME\tPOD IP\tLAST SEEN")
+		for _, r := range rows {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				r.Cluster, r.Namespace, r.Service, r.PodUID, r.PodName, r.PodIP, r.LastSeen.UTC().Format(time.RFC3339))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown dump format %q (want %s or %s)", format, DumpFormatTable, DumpFormatJSON)
+	}
+}
@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+var dumpSeen = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// dumpStore is a fakeDB holding rows that answers the dump query by
+// applying its cluster/namespace/service arguments the way the WHERE
+// clause does, so the tests check which filter reaches the database.
+func dumpStore(rows ...DumpRow) *fakeDB {
+	return &fakeDB{queryFn: func(_ string, args []any) ([][]any, error) {
+		match := func(arg any, v string) bool { return arg == "" || arg == v }
+		var out [][]any
+		for _, r := range rows {
+			if match(args[0], r.Cluster) && match(args[1], r.Namespace) && match(args[2], r.Service) {
+				out = append(out, []any{r.Cluster, r.Namespace, r.Service, r.PodUID, r.PodName, r.PodIP, r.LastSeen})
+			}
+		}
+		return out, nil
+	}}
+}
+
+func TestPostgresReader_Dump(t *testing.T) {
+	store := dumpStore(
+		DumpRow{"dev", "default", "web", "uid-1", "web-1", "10.0.0.1", dumpSeen},
+		DumpRow{"dev", "default", "db", "uid-2", "db-1", "10.0.0.2", dumpSeen},
+		DumpRow{"dev", "other", "web", "uid-3", "web-1", "10.0.1.1", dumpSeen},
+		DumpRow{"prod", "default", "web", "uid-4", "web-1", "10.1.0.1", dumpSeen},
+	)
+
+	tests := []struct {
+		name   string
+		filter DumpFilter
+		uids   []string
+	}{
+		{name: "no filter", uids: []string{"uid-1", "uid-2", "uid-3", "uid-4"}},
+		{name: "cluster", filter: DumpFilter{Cluster: "dev"}, uids: []string{"uid-1", "uid-2", "uid-3"}},
+		{name: "namespace", filter: DumpFilter{Namespace: "default"}, uids: []string{"uid-1", "uid-2", "uid-4"}},
+		{name: "service", filter: DumpFilter{Service: "web"}, uids: []string{"uid-1", "uid-3", "uid-4"}},
+		{name: "all three", filter: DumpFilter{Cluster: "dev", Namespace: "default", Service: "web"}, uids: []string{"uid-1"}},
+		{name: "no match", filter: DumpFilter{Cluster: "staging"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&PostgresReader{DB: store, TableName: "public.server"}).Dump(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("Dump() error = %v", err)
+			}
+			var uids []string
+			for _, r := range got {
+				uids = append(uids, r.PodUID)
+			}
+			if !slices.Equal(uids, tt.uids) {
+				t.Errorf("Dump() uids = %v, want %v", uids, tt.uids)
+			}
+		})
+	}
+}
+
+func TestPostgresReader_DumpQuery(t *testing.T) {
+	var queries []string
+	db := &fakeDB{queryFn: func(sql string, _ []any) ([][]any, error) {
+		queries = append(queries, sql)
+		return nil, nil
+	}}
+	ctx := context.Background()
+	if _, err := (&PostgresReader{DB: db, TableName: "public.server"}).Dump(ctx, DumpFilter{}); err != nil {
+		t.Fatalf("Dump() error = %v", err)
+	}
+	if _, err := (&PostgresReader{DB: db, TableName: "server", JSONB: true}).Dump(ctx, DumpFilter{}); err != nil {
+		t.Fatalf("Dump() error = %v", err)
+	}
+	if !strings.Contains(queries[0], `FROM "public"."server"`) || !strings.Contains(queries[0], "host(pod_ip)") {
+		t.Errorf("columns query = %s, want pod_ip read from the sanitized table", queries[0])
+	}
+	if !strings.Contains(queries[1], "payload->>'ip'") {
+		t.Errorf("jsonb query = %s, want the address read from payload", queries[1])
+	}
+
+	if _, err := (&PostgresReader{DB: db, TableName: "public..server"}).Dump(ctx, DumpFilter{}); err == nil {
+		t.Error("Dump() with a bad table name succeeded")
+	}
+	failing := &fakeDB{queryFn: func(string, []any) ([][]any, error) { return nil, errFake }}
+	if _, err := (&PostgresReader{DB: failing, TableName: "server"}).Dump(ctx, DumpFilter{}); !errors.Is(err, errFake) {
+		t.Errorf("Dump() error = %v, want %v", err, errFake)
+	}
+}
+
+func TestWriteDump(t *testing.T) {
+	rows := []DumpRow{
+		{"dev", "default", "web", "uid-1", "web-1", "10.0.0.1", dumpSeen},
+		{"dev", "kube-system", "dns", "uid-22", "coredns-7f9c", "10.0.0.22", dumpSeen},
+	}
+
+	tests := []struct {
+		name   string
+		rows   []DumpRow
+		format string
+		want   string
+	}{
+		{
+			name:   "table",
+			rows:   rows,
+			format: DumpFormatTable,
+			want: `CLUSTER  NAMESPACE    SERVICE  POD UID  POD NAME      POD IP     LAST SEEN
+dev      default      web      uid-1    web-1         10.0.0.1   2026-01-02T03:04:05Z
+dev      kube-system  dns      uid-22   coredns-7f9c  10.0.0.22  2026-01-02T03:04:05Z
+`,
+		},
+		{
+			name:   "empty table keeps the header",
+			format: DumpFormatTable,
+			want:   "CLUSTER  NAMESPACE  SERVICE  POD UID  POD NAME  POD IP  LAST SEEN\n",
+		},
+		{
+			name:   "json",
+			rows:   rows[:1],
+			format: DumpFormatJSON,
+			want: `[
+  {
+    "cluster": "dev",
+    "namespace": "default",
+    "service": "web",
+    "podUID": "uid-1",
+    "podName": "web-1",
+    "podIP": "10.0.0.1",
+    "lastSeen": "2026-01-02T03:04:05Z"
+  }
+]
+`,
+		},
+		{
+			name:   "empty json is an array",
+			format: DumpFormatJSON,
+			want:   "[]\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteDump(&buf, tt.rows, tt.format); err != nil {
+				t.Fatalf("WriteDump() error = %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("WriteDump() =\n%s\nwant\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+
+	if err := WriteDump(&bytes.Buffer{}, rows, "yaml"); err == nil {
+		t.Error("WriteDump() with an unknown format succeeded")
+	}
+}
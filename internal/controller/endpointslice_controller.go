@@ -2,107 +2,758 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	discoveryv1 "k8s.io/api/discovery/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	"github.com/go-logr/logr"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
+// Formats of the UID generated for an endpoint without a Pod targetRef.
+const (
+	GeneratedUIDIP     = "ip"     // namespace/service/ip
+	GeneratedUIDPort   = "port"   // namespace/service/ip:port
+	GeneratedUIDFamily = "family" // namespace/service/addressType/ip
+)
+
+// Address families the reconciler can be limited to.
+const (
+	AddressFamilyAll  = "all"
+	AddressFamilyIPv4 = "ipv4"
+	AddressFamilyIPv6 = "ipv6"
+)
+
+// Ways of choosing among the addresses of an endpoint.
+const (
+	AddressSelectFirst  = "first"  // the first address, canonical per the spec
+	AddressSelectLowest = "lowest" // the numerically lowest, whatever the order
+)
+
 type EndpointSliceReconciler struct {
 	client.Client
-	DB            *pgxpool.Pool
+	Sink          Sink
 	Log           logr.Logger
 	LabelSelector string
-	RequeueAfter  time.Duration
-	TableName     string
+	// SelectorFile, if set, replaces LabelSelector with its current value
+	// (--selector=@file).
+	SelectorFile *LiveValue
+	// RequeueAfter is the interval of periodic reconciles; zero turns them
+	// off, leaving events, the heartbeat and the Sweeper.
+	RequeueAfter time.Duration
+	// RequeueJitter spreads periodic reconciles by randomizing each
+	// RequeueAfter by up to ±RequeueJitter (a fraction, e.g. 0.1).
+	RequeueJitter float64
 	ClusterName   string
+	// ClusterFile, if set, replaces ClusterName with its current value
+	// (--cluster=@file).
+	ClusterFile *LiveValue
+	Tracker     *SyncTracker
+	// Status records the outcome of each sync of a service.
+	Status *SyncStatus
+	// Pause, while paused, makes every reconcile requeue without writing.
+	Pause *Pause
+	// Breaker, while open, makes a reconcile that would write requeue
+	// until its next probe instead.
+	Breaker *Breaker
+	// APIVersion selects the watched EndpointSlice version: EndpointSliceV1
+	// (default) or EndpointSliceV1beta1 for pre-1.21 clusters.
+	APIVersion string
+	// Source selects the watched object: SourceEndpointSlices (default) or
+	// SourceEndpoints for the legacy corev1.Endpoints.
+	Source string
+	// SnapshotTTL bounds how long the last desired set of a service is kept
+	// without being refreshed. Zero means 10× RequeueAfter, or no bound
+	// without periodic reconciles.
+	SnapshotTTL time.Duration
+	// HeartbeatInterval forces a write of an unchanged desired set once the
+	// last write is this old, refreshing last_seen. Zero never rewrites an
+	// unchanged set.
+	HeartbeatInterval time.Duration
+	// PortFilter, if set, keeps only slices exposing this port, given as a
+	// port name or number. The matched port number is recorded in each row.
+	PortFilter string
+	// ExcludeSelector, if set, drops endpoints whose Pod labels or
+	// annotations match it. Pods are read through PodReader (defaults to
+	// the embedded Client).
+	ExcludeSelector labels.Selector
+	// RequireContainer, if set, keeps only endpoints whose Pod has a
+	// container of this name that is running and ready. An endpoint whose
+	// Pod can't be read is kept, or dropped with RequireContainerFailClosed.
+	// Endpoints without a Pod are always kept.
+	RequireContainer           string
+	RequireContainerFailClosed bool
+	// EnrichPodLabels lists Pod label keys copied into each row's PodLabels.
+	EnrichPodLabels []string
+	// ResolveOwner fills each row's Owner by following the Pod's controller
+	// reference, through a ReplicaSet to its Deployment.
+	ResolveOwner bool
+	// TargetWorkload, if set, keeps only endpoints whose Pod's top-level
+	// controller, resolved as for ResolveOwner, is of this kind, e.g.
+	// StatefulSet. Endpoints without a Pod, or whose Pod can't be read,
+	// are dropped.
+	TargetWorkload string
+	PodReader      client.Reader
+	// LiveReader confirms, uncached, that a resynced service whose rows
+	// exist really has no slices before they're pruned (defaults to the
+	// embedded Client).
+	LiveReader client.Reader
+	// RecordSlices fills each row's Slices with the names of the slices
+	// listing its endpoint.
+	RecordSlices bool
+	// RecordNodeNames fills each row's NodeName with the endpoint's node,
+	// for the NodeReconciler.
+	RecordNodeNames bool
+	// UseOwnerRef resolves a slice's Service from its controller owner
+	// reference instead of the service label, which a hand-made slice may
+	// lack or get wrong. A service's slices are then those owned by the
+	// current UID of the Service, read through the Client.
+	UseOwnerRef bool
+	// RecordServiceUID fills each row's ServiceUID with the UID of the
+	// Service owning its slice.
+	RecordServiceUID bool
+	// ServiceLabel is the label key naming a slice's Service. Empty means
+	// discoveryv1.LabelServiceName.
+	ServiceLabel string
+	// ServiceName, if set, limits the reconciler to the endpoints of the
+	// Services with this name (one per namespace watched).
+	ServiceName string
+	// Namespaces and Services, if set, limit the reconciler to the services
+	// whose namespace and name they allow; the others are never written.
+	Namespaces NameFilter
+	Services   NameFilter
+	// Shard limits the reconciler to the services of one shard when
+	// replicas split them; the zero value is all.
+	Shard Shard
+	// GeneratedUIDFormat picks the UID of endpoints without a Pod
+	// targetRef: GeneratedUIDIP (default), GeneratedUIDPort or
+	// GeneratedUIDFamily.
+	GeneratedUIDFormat string
+	// AddressFamily, if AddressFamilyIPv4 or AddressFamilyIPv6, keeps only
+	// the slices of that address type (so FQDN slices are dropped too).
+	// Empty and AddressFamilyAll keep every family.
+	AddressFamily string
+	// AddressSelect picks the address of an endpoint with several:
+	// AddressSelectFirst (default) or AddressSelectLowest, for CNIs that
+	// don't keep them in a stable order.
+	AddressSelect string
+	// Readiness decides which endpoints are written (--readiness-expr); nil
+	// is DefaultReadinessExpr.
+	Readiness *ReadinessExpr
+	// MaxEndpointsPerService, if set, skips the sync of a service with
+	// more endpoints than this rather than write a runaway set.
+	MaxEndpointsPerService int
+	// UniqueIP keeps one row per pod_ip (--unique-ip): of two endpoints of
+	// different pods sharing an IP, e.g. while a reused IP moves from a
+	// terminating pod to a new one, the one preferred as for duplicates
+	// is kept and the other dropped and logged.
+	UniqueIP bool
+
+	// DebounceWindow delays the sync of a service until this long after the
+	// first of a burst of events, so the burst costs one write. Zero syncs
+	// on every event.
+	DebounceWindow time.Duration
+	// MaxConcurrentReconciles is how many slices are reconciled at once;
+	// zero means one. The syncs of one service are serialized regardless.
+	MaxConcurrentReconciles int
+	// ListRetries bounds how many times a failed list of slices is retried
+	// before the reconcile fails; ListRetryBackoff is the initial delay of
+	// a throttled or unavailable API server, doubled after each attempt.
+	// Lists before the cache has started are retried after a short fixed
+	// delay.
+	ListRetries      int
+	ListRetryBackoff time.Duration
+
+	initOnce  sync.Once
+	snapshots *serviceSnapshots
+	debounce  *debouncer
+	backoff   retryBackoff
+	versions  syncClock
+	locks     serviceLocks
 }
 
 type endpointRow struct {
-	UID  string
-	Name string
-	IP   string
+	UID  string `json:"uid"`
+	Name string `json:"name"`
+	IP   string `json:"ip"`
+	Port int32  `json:"port,omitempty"`
+	// AddressType is the slice's address type; for FQDN, IP holds a hostname.
+	AddressType discoveryv1.AddressType `json:"addressType,omitempty"`
+	// PodLabels holds the labels picked by EnrichPodLabels.
+	PodLabels labelSet `json:"podLabels,omitempty"`
+	// Owner is the Pod's top-level controller as "Kind/name" (see
+	// ResolveOwner), e.g. "Deployment/web".
+	Owner string `json:"owner,omitempty"`
+	// Slices names the EndpointSlices listing the endpoint (see RecordSlices).
+	Slices nameList `json:"slices,omitempty"`
+	// NodeName is the endpoint's node (see RecordNodeNames).
+	NodeName string `json:"nodeName,omitempty"`
+	// ServiceUID is the UID of the Service owning the slice (see
+	// RecordServiceUID).
+	ServiceUID string `json:"serviceUID,omitempty"`
+}
+
+// nameList is a sorted list of names (which never contain commas), kept
+// comma-joined so endpointRow stays comparable. The zero value is empty.
+type nameList string
+
+// add returns l with name inserted in order; l is left as is if it has name.
+func (l nameList) add(name string) nameList {
+	names := l.List()
+	i, found := slices.BinarySearch(names, name)
+	if found {
+		return l
+	}
+	return nameList(strings.Join(slices.Insert(names, i, name), ","))
+}
+
+// List returns the names; it returns nil for the zero value.
+func (l nameList) List() []string {
+	if l == "" {
+		return nil
+	}
+	return strings.Split(string(l), ",")
+}
+
+func (l nameList) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.List())
+}
+
+func (l *nameList) UnmarshalJSON(b []byte) error {
+	var names []string
+	if err := json.Unmarshal(b, &names); err != nil {
+		return err
+	}
+	*l = ""
+	for _, n := range names {
+		*l = l.add(n)
+	}
+	return nil
 }
 
 func (r *EndpointSliceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if r.Pause.Paused() {
+		log.FromContext(ctx).V(2).Info("writes paused, requeueing", "slice", req.NamespacedName)
+		return ctrl.Result{RequeueAfter: pausedRequeueDelay}, nil
+	}
+	if r.Source == SourceEndpoints {
+		return r.reconcileEndpoints(ctx, req)
+	}
 	logger := log.FromContext(ctx).WithValues("slice", req.NamespacedName)
 
 	// Try to get the slice; if it's gone, we can't know the service from the name alone.
 	// The Service controller will handle the full prune on service deletion.
 	var es discoveryv1.EndpointSlice
-	if err := r.Get(ctx, req.NamespacedName, &es); err != nil {
-		return ctrl.Result{RequeueAfter: r.RequeueAfter}, client.IgnoreNotFound(err)
+	if err := r.getSlice(ctx, req.NamespacedName, &es); err != nil {
+		return ctrl.Result{RequeueAfter: r.requeueAfter()}, client.IgnoreNotFound(err)
 	}
 
 	// Optional label filter "k=v[,k=v]" against the EndpointSlice labels
-	if r.LabelSelector != "" && !matchKV(es.Labels, r.LabelSelector) {
-		return ctrl.Result{RequeueAfter: r.RequeueAfter}, nil
+	if sel := r.selector(); sel != "" && !matchKV(es.Labels, sel) {
+		logger.V(2).Info("skipping slice not matching the selector", "selector", sel)
+		slicesFiltered.WithLabelValues(filterSelector).Inc()
+		return ctrl.Result{RequeueAfter: r.requeueAfter()}, nil
 	}
 
-	service := es.Labels[discoveryv1.LabelServiceName]
+	service := r.sliceService(&es)
+	if service == "" && r.UseOwnerRef {
+		logger.V(1).Info("skipping slice not owned by a Service")
+		slicesSkipped.WithLabelValues(skipNoServiceOwner).Inc()
+		return ctrl.Result{RequeueAfter: r.requeueAfter()}, nil
+	}
 	if service == "" {
-		return ctrl.Result{RequeueAfter: r.RequeueAfter}, nil
+		logger.V(1).Info("skipping slice without service label", "label", r.serviceLabel())
+		slicesSkipped.WithLabelValues(skipNoServiceLabel).Inc()
+		return ctrl.Result{RequeueAfter: r.requeueAfter()}, nil
+	}
+	if !r.Shard.Owns(es.Namespace, service) {
+		logger.V(2).Info("skipping slice of another shard's service", "service", service)
+		slicesFiltered.WithLabelValues(filterShard).Inc()
+		return ctrl.Result{}, nil
+	}
+
+	return r.syncSlicesOf(ctx, logger, &es, service)
+}
+
+// ResyncService syncs one service from all of its slices (or its Endpoints
+// object) as a slice event would. The ServiceReconciler calls it when a
+// Service changes, so a new selector or port shows without waiting for
+// the slices to be rewritten. A service with no slice matching
+// LabelSelector is left alone, as Reconcile would.
+//
+// An empty list for a service whose last sync wrote rows may be the cache
+// lagging behind, as in syncSlicesOf; unless LiveReader lists no slices
+// either, the resync is requeued rather than prune them.
+func (r *EndpointSliceReconciler) ResyncService(ctx context.Context, namespace, service string) (ctrl.Result, error) {
+	if r.ServiceName != "" && service != r.ServiceName {
+		return ctrl.Result{}, nil
+	}
+	if r.Source == SourceEndpoints {
+		return r.reconcileEndpoints(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: service}})
+	}
+	key := types.NamespacedName{Namespace: namespace, Name: service}
+	logger := log.FromContext(ctx).WithValues("service", key)
+	defer r.locks.lock(key)()
+	ctx = withSyncVersion(ctx, r.versions.next())
+	list, ok, err := r.serviceSlices(ctx, namespace, service)
+	if !ok || err != nil {
+		return ctrl.Result{}, err
+	}
+	if prev, known := r.serviceSnapshots().get(key); len(list.Items) == 0 && known && len(prev.rows) > 0 {
+		lagging, err := r.cacheLagging(ctx, namespace, service)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if lagging {
+			logger.Info("listed no slices of a service that has rows, but the API server has some, requeueing rather than prune",
+				"namespace", namespace, "service", service)
+			slicesSkipped.WithLabelValues(skipCacheLag).Inc()
+			return ctrl.Result{RequeueAfter: cacheLagRequeueDelay}, nil
+		}
+	}
+	if sel := r.selector(); sel != "" && !slices.ContainsFunc(list.Items, func(es discoveryv1.EndpointSlice) bool { return matchKV(es.Labels, sel) }) {
+		return ctrl.Result{}, nil
+	}
+	return r.syncService(ctx, logger, namespace, service, list)
+}
+
+// cacheLagRequeueDelay is how soon a reconcile that found the cache
+// lagging behind its own slice is retried.
+const cacheLagRequeueDelay = time.Second
+
+// cacheLagging reports whether LiveReader lists slices of service that the
+// cache doesn't.
+func (r *EndpointSliceReconciler) cacheLagging(ctx context.Context, namespace, service string) (bool, error) {
+	reader := r.LiveReader
+	if reader == nil {
+		reader = r.Client
+	}
+	list, _, err := r.serviceSlicesWith(ctx, reader.List, namespace, service)
+	if err != nil {
+		return false, err
 	}
+	return len(list.Items) > 0, nil
+}
 
-	// ---- NEW: union across *all* EndpointSlices for this service in this namespace ----
-	var list discoveryv1.EndpointSliceList
-	if err := r.List(ctx, &list,
-		client.InNamespace(es.Namespace),
-		client.MatchingLabels(map[string]string{discoveryv1.LabelServiceName: service}),
-	); err != nil {
+// syncSlicesOf syncs the service of es from the union of all of its slices
+// in its namespace. It holds the service's lock from the list to the write,
+// so a concurrent reconcile of another of its slices can't prune what this
+// one just wrote from an older list.
+//
+// A list of no slices at all while es itself has ready endpoints can only
+// be a cache lagging behind (e.g. right after startup); syncing it would
+// prune every row of the service, so the reconcile is requeued instead.
+func (r *EndpointSliceReconciler) syncSlicesOf(ctx context.Context, logger logr.Logger, es *discoveryv1.EndpointSlice, service string) (ctrl.Result, error) {
+	namespace := es.Namespace
+	defer r.locks.lock(types.NamespacedName{Namespace: namespace, Name: service})()
+	ctx = withSyncVersion(ctx, r.versions.next())
+	list, ok, err := r.serviceSlices(ctx, namespace, service)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
+	if !ok {
+		logger.V(1).Info("skipping slice of a Service that is gone", "namespace", namespace, "service", service)
+		return ctrl.Result{RequeueAfter: r.requeueAfter()}, nil
+	}
+	if len(list.Items) == 0 && r.hasReadyEndpoint(es) {
+		logger.Info("listed no slices of a service whose slice has ready endpoints, requeueing rather than prune",
+			"namespace", namespace, "service", service)
+		slicesSkipped.WithLabelValues(skipCacheLag).Inc()
+		return ctrl.Result{RequeueAfter: cacheLagRequeueDelay}, nil
+	}
+	return r.syncService(ctx, logger, namespace, service, list)
+}
 
-	desired := r.buildDesiredRows(&list, service)
+// hasReadyEndpoint reports whether an endpoint of es passes Readiness.
+func (r *EndpointSliceReconciler) hasReadyEndpoint(es *discoveryv1.EndpointSlice) bool {
+	for i := range es.Endpoints {
+		if r.Readiness.Ready(&es.Endpoints[i].Conditions) {
+			return true
+		}
+	}
+	return false
+}
 
-	if err := r.syncToDatabase(ctx, desired, es.Namespace, service); err != nil {
+// syncService builds the desired rows of a service from all of its slices
+// and writes them to the sink unless nothing changed since the last write.
+func (r *EndpointSliceReconciler) syncService(
+	ctx context.Context, logger logr.Logger, namespace, service string, list *discoveryv1.EndpointSliceList,
+) (ctrl.Result, error) {
+	key := types.NamespacedName{Namespace: namespace, Name: service}
+	if !r.inScope(namespace, service) {
+		logger.V(2).Info("skipping service excluded by the allow/deny lists", "namespace", namespace, "service", service)
+		return ctrl.Result{RequeueAfter: r.requeueAfter()}, nil
+	}
+	if !r.Shard.Owns(namespace, service) {
+		logger.V(2).Info("skipping service of another shard", "namespace", namespace, "service", service)
+		return ctrl.Result{}, nil
+	}
+	if wait := r.debouncer().wait(key); wait > 0 {
+		logger.V(2).Info("debouncing service", "namespace", namespace, "service", service, "wait", wait)
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+	r.Status.EndpointStates(namespace, service, r.countEndpointStates(list))
+	desired, err := r.buildDesiredRows(ctx, list, service)
+	if err != nil {
+		r.Status.Failed(namespace, service, err)
+	}
+	if errors.Is(err, errTooManyEndpoints) {
+		return ctrl.Result{RequeueAfter: r.requeueAfter()}, nil // logged and counted
+	}
+	if err != nil {
 		return ctrl.Result{}, err
 	}
+	r.applyPods(ctx, namespace, desired)
+	if err := ctx.Err(); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	snapshots := r.serviceSnapshots()
+	prev, known := snapshots.get(key)
+	if known && maps.Equal(prev.rows, desired) && !r.heartbeatDue(snapshots.now(), prev.synced) {
+		snapshots.touch(key)
+		r.Tracker.Record(namespace, service)
+		r.Status.Succeeded(namespace, service, len(desired))
+		logger.V(2).Info("endpoints unchanged, skipping write", "namespace", namespace, "service", service)
+		return ctrl.Result{RequeueAfter: r.resyncAfter(snapshots.now().Sub(prev.synced))}, nil
+	}
+
+	if wait, ok := r.Breaker.Allow(); !ok {
+		logger.V(2).Info("database breaker open, requeueing", "namespace", namespace, "service", service, "wait", wait)
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+	err = r.Sink.Sync(ctx, r.cluster(), namespace, service, desired)
+	r.Breaker.Record(err)
+	if err != nil {
+		r.Status.Failed(namespace, service, err)
+		return resultForSinkError(logger, &r.backoff, key, err)
+	}
+	r.backoff.reset(key)
+	r.Tracker.Record(namespace, service)
+	r.Status.Succeeded(namespace, service, len(desired))
+
+	if known {
+		if added, removed := diffRows(prev.rows, desired); len(added) > 0 || len(removed) > 0 {
+			logger.V(1).Info("endpoints changed",
+				"namespace", namespace, "service", service, "added", uids(added), "removed", uids(removed))
+		}
+	}
+	snapshots.put(key, desired)
 
 	logger.V(1).Info("synced endpoints",
-		"cluster", r.ClusterName, "namespace", es.Namespace, "service", service, "count", len(desired))
-	return ctrl.Result{RequeueAfter: r.RequeueAfter}, nil
+		"cluster", r.cluster(), "namespace", namespace, "service", service, "count", len(desired))
+	return ctrl.Result{RequeueAfter: r.resyncAfter(0)}, nil
+}
+
+func (r *EndpointSliceReconciler) init() {
+	r.initOnce.Do(func() {
+		ttl := r.SnapshotTTL
+		if ttl == 0 {
+			ttl = 10 * r.RequeueAfter
+		}
+		r.snapshots = newServiceSnapshots(ttl)
+		r.debounce = newDebouncer(r.DebounceWindow)
+	})
+}
+
+// ForgetService drops the set last written for namespace/service, so its
+// next sync writes even an unchanged set. Whatever deletes the service's
+// rows calls it, or a Service recreated with the same pods would be
+// skipped as unchanged and keep no rows.
+func (r *EndpointSliceReconciler) ForgetService(namespace, service string) {
+	if r == nil {
+		return
+	}
+	r.serviceSnapshots().forget(types.NamespacedName{Namespace: namespace, Name: service})
+}
+
+func (r *EndpointSliceReconciler) serviceSnapshots() *serviceSnapshots {
+	r.init()
+	return r.snapshots
+}
+
+// ForgetWrites drops the endpoint sets remembered as written, so the next
+// reconcile of every service writes it even if nothing changed, e.g. once
+// the cluster or table it's written to changed.
+func (r *EndpointSliceReconciler) ForgetWrites() {
+	r.serviceSnapshots().reset()
+}
+
+// selector returns the current LabelSelector.
+func (r *EndpointSliceReconciler) selector() string {
+	return r.SelectorFile.Or(r.LabelSelector)
+}
+
+// cluster returns the cluster name written into the rows.
+func (r *EndpointSliceReconciler) cluster() string {
+	return r.ClusterFile.Or(r.ClusterName)
+}
+
+func (r *EndpointSliceReconciler) debouncer() *debouncer {
+	r.init()
+	return r.debounce
+}
+
+// inScope reports whether the Namespaces and Services filters allow a
+// service.
+func (r *EndpointSliceReconciler) inScope(namespace, service string) bool {
+	return r.Namespaces.Allows(namespace) && r.Services.Allows(service)
+}
+
+// serviceLabel returns the label key that names a slice's Service.
+func (r *EndpointSliceReconciler) serviceLabel() string {
+	if r.ServiceLabel != "" {
+		return r.ServiceLabel
+	}
+	return discoveryv1.LabelServiceName
+}
+
+// requeueAfter is the delay of the next periodic reconcile. Zero (no
+// requeue) with RequeueAfter zero: reconciles then only follow events.
+func (r *EndpointSliceReconciler) requeueAfter() time.Duration {
+	if r.RequeueJitter <= 0 || r.RequeueAfter <= 0 {
+		return r.RequeueAfter
+	}
+	f := 1 + r.RequeueJitter*(2*rand.Float64()-1)
+	return time.Duration(float64(r.RequeueAfter) * f)
+}
+
+// resyncAfter is the requeue of a service last written age ago. Without
+// periodic reconciles it's the time left until the heartbeat is due, so
+// HeartbeatInterval still refreshes last_seen of a quiet service.
+func (r *EndpointSliceReconciler) resyncAfter(age time.Duration) time.Duration {
+	if r.RequeueAfter > 0 || r.HeartbeatInterval <= 0 {
+		return r.requeueAfter()
+	}
+	return r.HeartbeatInterval - age
+}
+
+func (r *EndpointSliceReconciler) heartbeatDue(now, lastSync time.Time) bool {
+	return r.HeartbeatInterval > 0 && now.Sub(lastSync) >= r.HeartbeatInterval
 }
 
-func (r *EndpointSliceReconciler) buildDesiredRows(list *discoveryv1.EndpointSliceList, service string) map[string]endpointRow {
-	desired := map[string]endpointRow{}
+// buildDesiredRows merges the endpoints of all slices of a service. A pod
+// listed more than once (e.g. while moving between slices) resolves to the
+// same row on every reconcile: serving, non-terminating endpoints win, and
+// among equals the last one wins with slices visited in name order. With
+// UniqueIP, endpoints of different pods sharing an IP are resolved by the
+// same rule.
+//
+// Slices of an unknown address type are skipped with a warning, those of
+// another family than AddressFamily silently. The build
+// stops with ctx's error once ctx is done, checked per slice and every
+// ctxCheckInterval endpoints, and with errTooManyEndpoints (logged and
+// counted here) as soon as the service exceeds MaxEndpointsPerService.
+func (r *EndpointSliceReconciler) buildDesiredRows(
+	ctx context.Context, list *discoveryv1.EndpointSliceList, service string,
+) (map[string]endpointRow, error) {
+	// Sized for every endpoint being distinct and ready, the common case,
+	// so the maps never grow while filling.
+	total := 0
+	slices := make([]*discoveryv1.EndpointSlice, 0, len(list.Items))
+	for i := range list.Items {
+		slices = append(slices, &list.Items[i])
+		total += len(list.Items[i].Endpoints)
+	}
+	if r.MaxEndpointsPerService > 0 {
+		total = min(total, r.MaxEndpointsPerService+1)
+	}
+	desired := make(map[string]endpointRow, total)
+	rank := make(map[string]int, total)
+	var byIP map[string]string // pod_ip -> UID of its row, with UniqueIP
+	if r.UniqueIP {
+		byIP = make(map[string]string, total)
+	}
+	sort.SliceStable(slices, func(i, j int) bool { return slices[i].Name < slices[j].Name })
 
-	for _, sl := range list.Items {
+	seen, sel := 0, r.selector()
+	for _, sl := range slices {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		// keep LabelSelector semantics: skip non-matching slices
-		if r.LabelSelector != "" && !matchKV(sl.Labels, r.LabelSelector) {
+		if sel != "" && !matchKV(sl.Labels, sel) {
 			continue
 		}
+		switch sl.AddressType {
+		case discoveryv1.AddressTypeIPv4, discoveryv1.AddressTypeIPv6, discoveryv1.AddressTypeFQDN:
+		default:
+			log.FromContext(ctx).Info("skipping slice with unsupported address type",
+				"slice", types.NamespacedName{Namespace: sl.Namespace, Name: sl.Name}, "addressType", sl.AddressType)
+			slicesSkipped.WithLabelValues(skipAddressType).Inc()
+			continue
+		}
+		if !r.wantsFamily(sl.AddressType) {
+			continue
+		}
+		var port int32
+		if r.PortFilter != "" {
+			p, ok := matchPort(sl.Ports, r.PortFilter)
+			if !ok {
+				continue
+			}
+			port = p
+		}
+		uidPort := port
+		if uidPort == 0 {
+			uidPort = firstPort(sl.Ports)
+		}
 		for _, ep := range sl.Endpoints {
-			row := r.endpointToRow(&ep, sl.Namespace, service)
-			if row != nil {
-				desired[row.UID] = *row
+			if seen++; seen%ctxCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+			}
+			row, ok := r.endpointToRow(&ep, sl.AddressType, sl.Namespace, service, uidPort)
+			if !ok {
+				continue
+			}
+			row.Port = port
+			if r.RecordNodeNames && ep.NodeName != nil {
+				row.NodeName = *ep.NodeName
+			}
+			if ref := serviceOwner(sl); r.RecordServiceUID && ref != nil {
+				row.ServiceUID = string(ref.UID)
+			}
+			if r.RecordSlices {
+				// Every slice listing the endpoint counts, not just the
+				// one whose copy wins below.
+				row.Slices = desired[row.UID].Slices.add(sl.Name)
+				if prev, ok := desired[row.UID]; ok {
+					prev.Slices = row.Slices
+					desired[row.UID] = prev
+				}
+			}
+			if prev, seen := rank[row.UID]; seen && endpointRank(&ep) < prev {
+				continue
+			}
+			if byIP != nil {
+				if other, ok := byIP[row.IP]; ok && other != row.UID && desired[other].IP == row.IP {
+					keep, drop := row.UID, other
+					if endpointRank(&ep) < rank[other] {
+						keep, drop = other, row.UID
+					}
+					log.FromContext(ctx).Info("endpoints share an IP, dropping one",
+						"namespace", sl.Namespace, "service", service, "ip", row.IP, "kept", keep, "dropped", drop)
+					if keep == other {
+						continue
+					}
+					delete(desired, other)
+					delete(rank, other)
+				}
+				byIP[row.IP] = row.UID
+			}
+			desired[row.UID] = row
+			rank[row.UID] = endpointRank(&ep)
+			if r.MaxEndpointsPerService > 0 && len(desired) > r.MaxEndpointsPerService {
+				err := fmt.Errorf("%w: service %s/%s has more than %d", errTooManyEndpoints, sl.Namespace, service, r.MaxEndpointsPerService)
+				log.FromContext(ctx).Error(err, "skipping sync of service over --max-endpoints-per-service")
+				endpointLimitExceeded.WithLabelValues(sl.Namespace, service).Inc()
+				return nil, err
 			}
 		}
 	}
 
-	return desired
+	return desired, nil
 }
 
-func (r *EndpointSliceReconciler) endpointToRow(ep *discoveryv1.Endpoint, namespace, service string) *endpointRow {
-	if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
-		return nil
+// countEndpointStates counts the endpoints of the slices buildDesiredRows
+// reads, per endpointState. An endpoint listed by two slices, e.g. while
+// moving between them, counts twice.
+func (r *EndpointSliceReconciler) countEndpointStates(list *discoveryv1.EndpointSliceList) map[string]int {
+	counts, sel := map[string]int{}, r.selector()
+	for i := range list.Items {
+		sl := &list.Items[i]
+		if sel != "" && !matchKV(sl.Labels, sel) {
+			continue
+		}
+		switch sl.AddressType {
+		case discoveryv1.AddressTypeIPv4, discoveryv1.AddressTypeIPv6, discoveryv1.AddressTypeFQDN:
+		default:
+			continue
+		}
+		if !r.wantsFamily(sl.AddressType) {
+			continue
+		}
+		if _, ok := matchPort(sl.Ports, r.PortFilter); r.PortFilter != "" && !ok {
+			continue
+		}
+		for j := range sl.Endpoints {
+			counts[endpointState(&sl.Endpoints[j].Conditions)]++
+		}
 	}
-	if len(ep.Addresses) == 0 {
-		return nil
+	return counts
+}
+
+// errTooManyEndpoints is returned by buildDesiredRows for a service over
+// MaxEndpointsPerService.
+var errTooManyEndpoints = errors.New("too many endpoints")
+
+// ctxCheckInterval is how many endpoints buildDesiredRows handles between
+// checks for cancellation.
+const ctxCheckInterval = 1024
+
+// endpointRank orders duplicate endpoints: higher is preferred.
+func endpointRank(ep *discoveryv1.Endpoint) int {
+	rank := 0
+	if ep.Conditions.Serving == nil || *ep.Conditions.Serving {
+		rank++
+	}
+	if ep.Conditions.Terminating == nil || !*ep.Conditions.Terminating {
+		rank++
 	}
+	return rank
+}
 
-	ip := ep.Addresses[0]
+// wantsFamily reports whether slices of addressType pass AddressFamily.
+func (r *EndpointSliceReconciler) wantsFamily(addressType discoveryv1.AddressType) bool {
+	switch r.AddressFamily {
+	case AddressFamilyIPv4:
+		return addressType == discoveryv1.AddressTypeIPv4
+	case AddressFamilyIPv6:
+		return addressType == discoveryv1.AddressTypeIPv6
+	}
+	return true
+}
+
+// endpointToRow returns the row for an endpoint passing Readiness, or
+// false. IPv4 and IPv6 addresses are parsed and written in canonical form,
+// so an address that doesn't parse drops the endpoint (see selectAddress);
+// FQDN addresses are kept as lowercase hostnames. port only goes into a UID
+// generated with GeneratedUIDPort.
+func (r *EndpointSliceReconciler) endpointToRow(
+	ep *discoveryv1.Endpoint, addressType discoveryv1.AddressType, namespace, service string, port int32,
+) (endpointRow, bool) {
+	if !r.Readiness.Ready(&ep.Conditions) {
+		return endpointRow{}, false
+	}
+	ip, ok := r.selectAddress(ep.Addresses, addressType)
+	if !ok {
+		return endpointRow{}, false
+	}
 	uid := ""
 	name := ""
 
@@ -111,68 +762,151 @@ func (r *EndpointSliceReconciler) endpointToRow(ep *discoveryv1.Endpoint, namesp
 		name = ep.TargetRef.Name
 	}
 	if uid == "" {
-		uid = fmt.Sprintf("%s/%s/%s", namespace, service, ip)
+		uid = r.generatedUID(namespace, service, addressType, ip, port)
 	}
 
-	return &endpointRow{UID: uid, Name: name, IP: ip}
+	return endpointRow{UID: uid, Name: name, IP: ip, AddressType: addressType}, true
 }
 
-func (r *EndpointSliceReconciler) syncToDatabase(ctx context.Context, desired map[string]endpointRow, namespace, service string) error {
-	tx, err := r.DB.Begin(ctx)
-	if err != nil {
-		return err
+// selectAddress returns the address of an endpoint per AddressSelect, in
+// canonical form. With AddressSelectFirst an unparseable first address
+// drops the endpoint; AddressSelectLowest ignores unparseable addresses and
+// orders hostnames as strings.
+func (r *EndpointSliceReconciler) selectAddress(addresses []string, addressType discoveryv1.AddressType) (string, bool) {
+	if len(addresses) == 0 {
+		return "", false
 	}
-	defer func() { _ = tx.Rollback(ctx) }()
-
-	tbl := sanitizeTableIdent(r.TableName)
-
-	if err := r.upsertRows(ctx, tx, tbl, desired, namespace, service); err != nil {
-		return err
+	if addressType == discoveryv1.AddressTypeFQDN {
+		if r.AddressSelect != AddressSelectLowest {
+			return strings.ToLower(strings.TrimSuffix(addresses[0], ".")), true
+		}
+		lowest := ""
+		for i, a := range addresses {
+			if a = strings.ToLower(strings.TrimSuffix(a, ".")); i == 0 || a < lowest {
+				lowest = a
+			}
+		}
+		return lowest, true
 	}
 
-	uids := make([]string, 0, len(desired))
-	for uid := range desired {
-		uids = append(uids, uid)
+	ip := addresses[0]
+	addr, err := netip.ParseAddr(ip)
+	if r.AddressSelect == AddressSelectLowest {
+		for _, a := range addresses[1:] {
+			if other, err2 := netip.ParseAddr(a); err2 == nil && (err != nil || other.Less(addr)) {
+				ip, addr, err = a, other, nil
+			}
+		}
 	}
-
-	if err := r.pruneRows(ctx, tx, tbl, namespace, service, uids); err != nil {
-		return err
+	if err != nil {
+		return "", false
 	}
-
-	return tx.Commit(ctx)
+	// Most addresses are canonical already; only allocate for the rest.
+	var buf [len("ffff:ffff:ffff:ffff:ffff:ffff:255.255.255.255")]byte
+	if canon := addr.AppendTo(buf[:0]); string(canon) != ip {
+		ip = string(canon)
+	}
+	return ip, true
 }
 
-func (r *EndpointSliceReconciler) upsertRows(ctx context.Context, tx pgx.Tx, tbl string, desired map[string]endpointRow, namespace, service string) error {
-	for _, e := range desired {
-		q := fmt.Sprintf(`
-		  INSERT INTO %s (cluster, namespace, service, pod_uid, pod_name, pod_ip, ready, last_seen)
-		  VALUES ($1,$2,$3,$4,$5,$6,true, now())
-		  ON CONFLICT (cluster, namespace, service, pod_uid)
-		  DO UPDATE SET pod_ip = EXCLUDED.pod_ip, ready = true, last_seen = now()`, tbl)
-		if _, err := tx.Exec(ctx, q,
-			r.ClusterName, namespace, service, e.UID, e.Name, e.IP); err != nil {
-			return err
+// generatedUID names an endpoint without a Pod targetRef. The default
+// namespace/service/ip collides when a headless service reuses an IP for
+// another backend; the other formats tell such backends apart by port or
+// address family. A port of 0 (the slice has none) is left out.
+func (r *EndpointSliceReconciler) generatedUID(namespace, service string, addressType discoveryv1.AddressType, ip string, port int32) string {
+	switch r.GeneratedUIDFormat {
+	case GeneratedUIDPort:
+		if port != 0 {
+			ip = net.JoinHostPort(ip, strconv.Itoa(int(port)))
 		}
+	case GeneratedUIDFamily:
+		return namespace + "/" + service + "/" + string(addressType) + "/" + ip
 	}
-	return nil
+	return namespace + "/" + service + "/" + ip // one allocation, unlike Sprintf
 }
 
-func (r *EndpointSliceReconciler) pruneRows(ctx context.Context, tx pgx.Tx, tbl, namespace, service string, uids []string) error {
-	qDel := fmt.Sprintf(`
-	  DELETE FROM %s
-	  WHERE cluster = $1 AND namespace = $2 AND service = $3
-	    AND pod_uid <> ALL($4)`, tbl)
-	_, err := tx.Exec(ctx, qDel, r.ClusterName, namespace, service, uids)
-	return err
+// firstPort returns the first numbered port of a slice, or 0.
+func firstPort(ports []discoveryv1.EndpointPort) int32 {
+	for _, p := range ports {
+		if p.Port != nil {
+			return *p.Port
+		}
+	}
+	return 0
 }
 
 func (r *EndpointSliceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&discoveryv1.EndpointSlice{}, builder.WithPredicates()).
-		WithOptions(controller.Options{MaxConcurrentReconciles: 1}).
+		Named(endpointSliceControllerName).
+		For(r.watchedObject(), builder.WithPredicates(r.servicePredicate(), endpointsChanged())).
+		WithOptions(controller.Options{MaxConcurrentReconciles: max(r.MaxConcurrentReconciles, 1)}).
 		Complete(r)
 }
 
+// servicePredicate drops the events of objects not belonging to ServiceName:
+// slices are matched by their service label (or owner with UseOwnerRef),
+// Endpoints by name. main also narrows the cache so those objects aren't
+// fetched in the first place.
+func (r *EndpointSliceReconciler) servicePredicate() predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		if r.ServiceName == "" {
+			return true
+		}
+		if r.Source == SourceEndpoints {
+			return obj.GetName() == r.ServiceName
+		}
+		return r.sliceService(obj) == r.ServiceName
+	})
+}
+
+// endpointsChanged drops updates that leave everything buildDesiredRows
+// reads untouched, such as resourceVersion bumps and annotation changes.
+// Those would only rewrite an unchanged set; periodic requeues still run.
+func endpointsChanged() predicate.Predicate {
+	return predicate.Funcs{UpdateFunc: func(e event.UpdateEvent) bool {
+		if e.ObjectOld == nil || e.ObjectNew == nil {
+			return true
+		}
+		if !maps.Equal(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels()) {
+			return true
+		}
+		switch old := e.ObjectOld.(type) {
+		case *discoveryv1.EndpointSlice:
+			cur, ok := e.ObjectNew.(*discoveryv1.EndpointSlice)
+			return !ok || old.AddressType != cur.AddressType ||
+				!equality.Semantic.DeepEqual(old.Endpoints, cur.Endpoints) || !equality.Semantic.DeepEqual(old.Ports, cur.Ports)
+		case *discoveryv1beta1.EndpointSlice:
+			cur, ok := e.ObjectNew.(*discoveryv1beta1.EndpointSlice)
+			return !ok || old.AddressType != cur.AddressType ||
+				!equality.Semantic.DeepEqual(old.Endpoints, cur.Endpoints) || !equality.Semantic.DeepEqual(old.Ports, cur.Ports)
+		case *corev1.Endpoints: //nolint:staticcheck // see reconcileEndpoints
+			cur, ok := e.ObjectNew.(*corev1.Endpoints) //nolint:staticcheck // see reconcileEndpoints
+			return !ok || !equality.Semantic.DeepEqual(old.Subsets, cur.Subsets)
+		default:
+			return true
+		}
+	}}
+}
+
+// matchPort looks for filter among ports, by number if filter is numeric and
+// by name otherwise, and returns the matched port number.
+func matchPort(ports []discoveryv1.EndpointPort, filter string) (int32, bool) {
+	num, err := strconv.ParseInt(filter, 10, 32)
+	byNumber := err == nil
+	for _, p := range ports {
+		if p.Port == nil {
+			continue
+		}
+		if byNumber && int64(*p.Port) == num {
+			return *p.Port, true
+		}
+		if !byNumber && p.Name != nil && *p.Name == filter {
+			return *p.Port, true
+		}
+	}
+	return 0, false
+}
+
 func matchKV(lbls map[string]string, sel string) bool {
 	for _, p := range strings.Split(sel, ",") {
 		p = strings.TrimSpace(p)
@@ -189,5 +923,3 @@ func matchKV(lbls map[string]string, sel string) bool {
 	}
 	return true
 }
-
-var _ = types.NamespacedName{}
@@ -1,11 +1,34 @@
 package controller
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	corev1 "k8s.io/api/core/v1"
 	discoveryv1 "k8s.io/api/discovery/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 func TestEndpointSliceReconciler_endpointToRow(t *testing.T) {
@@ -34,9 +57,10 @@ func TestEndpointSliceReconciler_endpointToRow(t *testing.T) {
 			namespace: "default",
 			service:   "my-service",
 			expected: &endpointRow{
-				UID:  "pod-uid-123",
-				Name: "pod-name-123",
-				IP:   "10.0.0.1",
+				UID:         "pod-uid-123",
+				Name:        "pod-name-123",
+				IP:          "10.0.0.1",
+				AddressType: discoveryv1.AddressTypeIPv4,
 			},
 		},
 		{
@@ -51,9 +75,10 @@ func TestEndpointSliceReconciler_endpointToRow(t *testing.T) {
 			namespace: "default",
 			service:   "my-service",
 			expected: &endpointRow{
-				UID:  "default/my-service/10.0.0.2",
-				Name: "",
-				IP:   "10.0.0.2",
+				UID:         "default/my-service/10.0.0.2",
+				Name:        "",
+				IP:          "10.0.0.2",
+				AddressType: discoveryv1.AddressTypeIPv4,
 			},
 		},
 		{
@@ -72,9 +97,10 @@ func TestEndpointSliceReconciler_endpointToRow(t *testing.T) {
 			namespace: "default",
 			service:   "my-service",
 			expected: &endpointRow{
-				UID:  "default/my-service/10.0.0.3",
-				Name: "",
-				IP:   "10.0.0.3",
+				UID:         "default/my-service/10.0.0.3",
+				Name:        "",
+				IP:          "10.0.0.3",
+				AddressType: discoveryv1.AddressTypeIPv4,
 			},
 		},
 		{
@@ -110,9 +136,10 @@ func TestEndpointSliceReconciler_endpointToRow(t *testing.T) {
 			namespace: "default",
 			service:   "my-service",
 			expected: &endpointRow{
-				UID:  "pod-uid-789",
-				Name: "pod-name-789",
-				IP:   "10.0.0.5",
+				UID:         "pod-uid-789",
+				Name:        "pod-name-789",
+				IP:          "10.0.0.5",
+				AddressType: discoveryv1.AddressTypeIPv4,
 			},
 		},
 		{
@@ -148,9 +175,10 @@ func TestEndpointSliceReconciler_endpointToRow(t *testing.T) {
 			namespace: "default",
 			service:   "my-service",
 			expected: &endpointRow{
-				UID:  "pod-uid-multi",
-				Name: "pod-name-multi",
-				IP:   "10.0.0.6",
+				UID:         "pod-uid-multi",
+				Name:        "pod-name-multi",
+				IP:          "10.0.0.6",
+				AddressType: discoveryv1.AddressTypeIPv4,
 			},
 		},
 		{
@@ -169,24 +197,25 @@ func TestEndpointSliceReconciler_endpointToRow(t *testing.T) {
 			namespace: "default",
 			service:   "my-service",
 			expected: &endpointRow{
-				UID:  "default/my-service/10.0.0.8",
-				Name: "pod-name-empty-uid",
-				IP:   "10.0.0.8",
+				UID:         "default/my-service/10.0.0.8",
+				Name:        "pod-name-empty-uid",
+				IP:          "10.0.0.8",
+				AddressType: discoveryv1.AddressTypeIPv4,
 			},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := reconciler.endpointToRow(tt.ep, tt.namespace, tt.service)
+			result, ok := reconciler.endpointToRow(tt.ep, discoveryv1.AddressTypeIPv4, tt.namespace, tt.service, 0)
 			if tt.expected == nil {
-				if result != nil {
-					t.Errorf("endpointToRow() = %v, want nil", result)
+				if ok {
+					t.Errorf("endpointToRow() = %v, want none", result)
 				}
 			} else {
-				if result == nil {
-					t.Errorf("endpointToRow() = nil, want %v", tt.expected)
-				} else if *result != *tt.expected {
+				if !ok {
+					t.Errorf("endpointToRow() = none, want %v", tt.expected)
+				} else if result != *tt.expected {
 					t.Errorf("endpointToRow() = %v, want %v", result, tt.expected)
 				}
 			}
@@ -194,6 +223,156 @@ func TestEndpointSliceReconciler_endpointToRow(t *testing.T) {
 	}
 }
 
+func TestEndpointSliceReconciler_selectAddress(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		addressType discoveryv1.AddressType
+		addresses   []string
+		want        string // "" = endpoint dropped
+	}{
+		{name: "first", addresses: []string{"10.0.0.9", "10.0.0.1"}, want: "10.0.0.9"},
+		{name: "first explicitly", mode: AddressSelectFirst, addresses: []string{"10.0.0.9", "10.0.0.1"}, want: "10.0.0.9"},
+		{name: "first unparseable", addresses: []string{"bogus", "10.0.0.1"}},
+		{name: "lowest", mode: AddressSelectLowest, addresses: []string{"10.0.0.9", "10.0.0.10", "10.0.0.1"}, want: "10.0.0.1"},
+		{name: "lowest is numeric", mode: AddressSelectLowest, addresses: []string{"10.0.0.10", "9.0.0.1"}, want: "9.0.0.1"},
+		{name: "lowest skips unparseable", mode: AddressSelectLowest, addresses: []string{"bogus", "10.0.0.2", "10.0.0.3"}, want: "10.0.0.2"},
+		{name: "lowest of none parseable", mode: AddressSelectLowest, addresses: []string{"bogus"}},
+		{
+			name: "lowest IPv6 is canonical", mode: AddressSelectLowest, addressType: discoveryv1.AddressTypeIPv6,
+			addresses: []string{"fd00::0:2", "FD00:0::1"}, want: "fd00::1",
+		},
+		{
+			name: "lowest hostname", mode: AddressSelectLowest, addressType: discoveryv1.AddressTypeFQDN,
+			addresses: []string{"b.example.com", "A.example.com."}, want: "a.example.com",
+		},
+		{name: "no addresses", mode: AddressSelectLowest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addressType := tt.addressType
+			if addressType == "" {
+				addressType = discoveryv1.AddressTypeIPv4
+			}
+			r := &EndpointSliceReconciler{AddressSelect: tt.mode}
+			got, ok := r.selectAddress(tt.addresses, addressType)
+			if got != tt.want || ok != (tt.want != "") {
+				t.Errorf("selectAddress(%v) = %q, %v, want %q", tt.addresses, got, ok, tt.want)
+			}
+
+			// The choice doesn't depend on the order of the addresses.
+			if tt.mode == AddressSelectLowest && len(tt.addresses) > 1 {
+				reversed := slices.Clone(tt.addresses)
+				slices.Reverse(reversed)
+				if again, _ := r.selectAddress(reversed, addressType); again != got {
+					t.Errorf("selectAddress(%v) = %q, want %q", reversed, again, got)
+				}
+			}
+		})
+	}
+}
+
+func TestEndpointSliceReconciler_AddressFamily(t *testing.T) {
+	ready := func(ip string) discoveryv1.Endpoint {
+		return discoveryv1.Endpoint{Addresses: []string{ip}, Conditions: discoveryv1.EndpointConditions{Ready: boolPtr(true)}}
+	}
+	v4 := newSlice("default", "svc-v4", "svc", podEndpoint("uid-1", "pod-1", "10.0.0.1"), ready("10.0.0.9"))
+	v6 := newSlice("default", "svc-v6", "svc", podEndpoint("uid-1", "pod-1", "fd00::1"), podEndpoint("uid-2", "pod-2", "fd00::2"))
+	v6.AddressType = discoveryv1.AddressTypeIPv6
+	fqdn := newSlice("default", "svc-fqdn", "svc", ready("db.example.com"))
+	fqdn.AddressType = discoveryv1.AddressTypeFQDN
+	dualStack := &discoveryv1.EndpointSliceList{Items: []discoveryv1.EndpointSlice{*v4, *v6, *fqdn}}
+
+	tests := []struct {
+		family string
+		want   map[string]string // uid -> ip
+	}{
+		{family: "", want: map[string]string{
+			"uid-1": "fd00::1", "uid-2": "fd00::2", "default/svc/10.0.0.9": "10.0.0.9", "default/svc/db.example.com": "db.example.com",
+		}},
+		{family: AddressFamilyAll, want: map[string]string{
+			"uid-1": "fd00::1", "uid-2": "fd00::2", "default/svc/10.0.0.9": "10.0.0.9", "default/svc/db.example.com": "db.example.com",
+		}},
+		{family: AddressFamilyIPv4, want: map[string]string{"uid-1": "10.0.0.1", "default/svc/10.0.0.9": "10.0.0.9"}},
+		{family: AddressFamilyIPv6, want: map[string]string{"uid-1": "fd00::1", "uid-2": "fd00::2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.family, func(t *testing.T) {
+			r := &EndpointSliceReconciler{AddressFamily: tt.family}
+			got, err := r.buildDesiredRows(context.Background(), dualStack, "svc")
+			if err != nil {
+				t.Fatalf("buildDesiredRows() error = %v", err)
+			}
+			ips := map[string]string{}
+			for uid, row := range got {
+				ips[uid] = row.IP
+			}
+			if !maps.Equal(ips, tt.want) {
+				t.Errorf("buildDesiredRows() = %v, want %v", ips, tt.want)
+			}
+		})
+	}
+}
+
+func TestEndpointSliceReconciler_GeneratedUIDFormat(t *testing.T) {
+	port := func(n int32) discoveryv1.EndpointPort { return discoveryv1.EndpointPort{Port: &n} }
+	headless := func(addressType discoveryv1.AddressType, ip string, ports ...discoveryv1.EndpointPort) discoveryv1.EndpointSlice {
+		sl := newSlice("default", "svc-"+strings.ToLower(string(addressType)), "svc",
+			discoveryv1.Endpoint{Addresses: []string{ip}, Conditions: discoveryv1.EndpointConditions{Ready: boolPtr(true)}})
+		sl.AddressType = addressType
+		sl.Ports = ports
+		return *sl
+	}
+
+	tests := []struct {
+		name   string
+		format string
+		slice  discoveryv1.EndpointSlice
+		want   string
+	}{
+		{name: "default", slice: headless(discoveryv1.AddressTypeIPv4, "10.0.0.1", port(8080)), want: "default/svc/10.0.0.1"},
+		{name: "ip", format: GeneratedUIDIP, slice: headless(discoveryv1.AddressTypeIPv4, "10.0.0.1", port(8080)), want: "default/svc/10.0.0.1"},
+		{name: "port", format: GeneratedUIDPort, slice: headless(discoveryv1.AddressTypeIPv4, "10.0.0.1", port(8080)), want: "default/svc/10.0.0.1:8080"},
+		{
+			name:   "port of IPv6",
+			format: GeneratedUIDPort,
+			slice:  headless(discoveryv1.AddressTypeIPv6, "fd00::1", discoveryv1.EndpointPort{}, port(9090)),
+			want:   "default/svc/[fd00::1]:9090",
+		},
+		{name: "port without ports", format: GeneratedUIDPort, slice: headless(discoveryv1.AddressTypeIPv4, "10.0.0.1"), want: "default/svc/10.0.0.1"},
+		{name: "family", format: GeneratedUIDFamily, slice: headless(discoveryv1.AddressTypeIPv6, "fd00::1", port(8080)), want: "default/svc/IPv6/fd00::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &EndpointSliceReconciler{GeneratedUIDFormat: tt.format}
+			got, err := r.buildDesiredRows(context.Background(), &discoveryv1.EndpointSliceList{Items: []discoveryv1.EndpointSlice{tt.slice}}, "svc")
+			if err != nil {
+				t.Fatalf("buildDesiredRows() error = %v", err)
+			}
+			if _, ok := got[tt.want]; !ok || len(got) != 1 {
+				t.Errorf("buildDesiredRows() = %v, want one row %s", got, tt.want)
+			}
+		})
+	}
+
+	// The --port-filter port is used rather than the slice's first port,
+	// and Pod endpoints keep their UID.
+	sl := newSlice("default", "svc-abc", "svc", podEndpoint("uid-1", "pod-1", "10.0.0.1"),
+		discoveryv1.Endpoint{Addresses: []string{"10.0.0.2"}, Conditions: discoveryv1.EndpointConditions{Ready: boolPtr(true)}})
+	metrics := "metrics"
+	sl.Ports = []discoveryv1.EndpointPort{port(8080), {Name: &metrics, Port: port(9090).Port}}
+	r := &EndpointSliceReconciler{GeneratedUIDFormat: GeneratedUIDPort, PortFilter: "metrics"}
+	got, err := r.buildDesiredRows(context.Background(), &discoveryv1.EndpointSliceList{Items: []discoveryv1.EndpointSlice{*sl}}, "svc")
+	if err != nil {
+		t.Fatalf("buildDesiredRows() error = %v", err)
+	}
+	for _, uid := range []string{"uid-1", "default/svc/10.0.0.2:9090"} {
+		if _, ok := got[uid]; !ok {
+			t.Errorf("buildDesiredRows() = %v, want a row %s", got, uid)
+		}
+	}
+}
+
 func TestEndpointSliceReconciler_buildDesiredRows(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -221,6 +400,7 @@ func TestEndpointSliceReconciler_buildDesiredRows(t *testing.T) {
 							Name:      "slice-1",
 							Labels:    map[string]string{},
 						},
+						AddressType: discoveryv1.AddressTypeIPv4,
 						Endpoints: []discoveryv1.Endpoint{
 							{
 								Addresses: []string{"10.0.0.1"},
@@ -241,9 +421,10 @@ func TestEndpointSliceReconciler_buildDesiredRows(t *testing.T) {
 			labelSelector: "",
 			expected: map[string]endpointRow{
 				"pod-uid-1": {
-					UID:  "pod-uid-1",
-					Name: "pod-name-1",
-					IP:   "10.0.0.1",
+					UID:         "pod-uid-1",
+					Name:        "pod-name-1",
+					IP:          "10.0.0.1",
+					AddressType: discoveryv1.AddressTypeIPv4,
 				},
 			},
 		},
@@ -257,6 +438,7 @@ func TestEndpointSliceReconciler_buildDesiredRows(t *testing.T) {
 							Name:      "slice-1",
 							Labels:    map[string]string{},
 						},
+						AddressType: discoveryv1.AddressTypeIPv4,
 						Endpoints: []discoveryv1.Endpoint{
 							{
 								Addresses: []string{"10.0.0.1"},
@@ -288,6 +470,7 @@ func TestEndpointSliceReconciler_buildDesiredRows(t *testing.T) {
 							Name:      "slice-2",
 							Labels:    map[string]string{},
 						},
+						AddressType: discoveryv1.AddressTypeIPv4,
 						Endpoints: []discoveryv1.Endpoint{
 							{
 								Addresses: []string{"10.0.0.3"},
@@ -308,19 +491,22 @@ func TestEndpointSliceReconciler_buildDesiredRows(t *testing.T) {
 			labelSelector: "",
 			expected: map[string]endpointRow{
 				"pod-uid-1": {
-					UID:  "pod-uid-1",
-					Name: "pod-name-1",
-					IP:   "10.0.0.1",
+					UID:         "pod-uid-1",
+					Name:        "pod-name-1",
+					IP:          "10.0.0.1",
+					AddressType: discoveryv1.AddressTypeIPv4,
 				},
 				"pod-uid-2": {
-					UID:  "pod-uid-2",
-					Name: "pod-name-2",
-					IP:   "10.0.0.2",
+					UID:         "pod-uid-2",
+					Name:        "pod-name-2",
+					IP:          "10.0.0.2",
+					AddressType: discoveryv1.AddressTypeIPv4,
 				},
 				"pod-uid-3": {
-					UID:  "pod-uid-3",
-					Name: "pod-name-3",
-					IP:   "10.0.0.3",
+					UID:         "pod-uid-3",
+					Name:        "pod-name-3",
+					IP:          "10.0.0.3",
+					AddressType: discoveryv1.AddressTypeIPv4,
 				},
 			},
 		},
@@ -334,6 +520,7 @@ func TestEndpointSliceReconciler_buildDesiredRows(t *testing.T) {
 							Name:      "slice-1",
 							Labels:    map[string]string{},
 						},
+						AddressType: discoveryv1.AddressTypeIPv4,
 						Endpoints: []discoveryv1.Endpoint{
 							{
 								Addresses: []string{"10.0.0.1"},
@@ -365,9 +552,10 @@ func TestEndpointSliceReconciler_buildDesiredRows(t *testing.T) {
 			labelSelector: "",
 			expected: map[string]endpointRow{
 				"pod-uid-1": {
-					UID:  "pod-uid-1",
-					Name: "pod-name-1",
-					IP:   "10.0.0.1",
+					UID:         "pod-uid-1",
+					Name:        "pod-name-1",
+					IP:          "10.0.0.1",
+					AddressType: discoveryv1.AddressTypeIPv4,
 				},
 			},
 		},
@@ -383,6 +571,7 @@ func TestEndpointSliceReconciler_buildDesiredRows(t *testing.T) {
 								"app": "my-app",
 							},
 						},
+						AddressType: discoveryv1.AddressTypeIPv4,
 						Endpoints: []discoveryv1.Endpoint{
 							{
 								Addresses: []string{"10.0.0.1"},
@@ -405,6 +594,7 @@ func TestEndpointSliceReconciler_buildDesiredRows(t *testing.T) {
 								"app": "other-app",
 							},
 						},
+						AddressType: discoveryv1.AddressTypeIPv4,
 						Endpoints: []discoveryv1.Endpoint{
 							{
 								Addresses: []string{"10.0.0.2"},
@@ -425,14 +615,15 @@ func TestEndpointSliceReconciler_buildDesiredRows(t *testing.T) {
 			labelSelector: "app=my-app",
 			expected: map[string]endpointRow{
 				"pod-uid-1": {
-					UID:  "pod-uid-1",
-					Name: "pod-name-1",
-					IP:   "10.0.0.1",
+					UID:         "pod-uid-1",
+					Name:        "pod-name-1",
+					IP:          "10.0.0.1",
+					AddressType: discoveryv1.AddressTypeIPv4,
 				},
 			},
 		},
 		{
-			name: "duplicate UIDs overwrite (last wins)",
+			name: "duplicate UIDs within a slice: last wins",
 			list: &discoveryv1.EndpointSliceList{
 				Items: []discoveryv1.EndpointSlice{
 					{
@@ -441,6 +632,7 @@ func TestEndpointSliceReconciler_buildDesiredRows(t *testing.T) {
 							Name:      "slice-1",
 							Labels:    map[string]string{},
 						},
+						AddressType: discoveryv1.AddressTypeIPv4,
 						Endpoints: []discoveryv1.Endpoint{
 							{
 								Addresses: []string{"10.0.0.1"},
@@ -472,11 +664,45 @@ func TestEndpointSliceReconciler_buildDesiredRows(t *testing.T) {
 			labelSelector: "",
 			expected: map[string]endpointRow{
 				"pod-uid-1": {
-					UID:  "pod-uid-1",
-					Name: "pod-name-2",
-					IP:   "10.0.0.2",
+					UID:         "pod-uid-1",
+					Name:        "pod-name-2",
+					IP:          "10.0.0.2",
+					AddressType: discoveryv1.AddressTypeIPv4,
+				},
+			},
+		},
+		{
+			name: "duplicate UIDs across slices: last slice by name wins regardless of list order",
+			list: &discoveryv1.EndpointSliceList{
+				Items: []discoveryv1.EndpointSlice{
+					*newSlice("default", "slice-b", "my-service", podEndpoint("pod-uid-1", "pod-name-1", "10.0.0.2")),
+					*newSlice("default", "slice-a", "my-service", podEndpoint("pod-uid-1", "pod-name-1", "10.0.0.1")),
+				},
+			},
+			service: "my-service",
+			expected: map[string]endpointRow{
+				"pod-uid-1": {UID: "pod-uid-1", Name: "pod-name-1", IP: "10.0.0.2", AddressType: discoveryv1.AddressTypeIPv4},
+			},
+		},
+		{
+			name: "duplicate UIDs: serving endpoint preferred over terminating one",
+			list: &discoveryv1.EndpointSliceList{
+				Items: []discoveryv1.EndpointSlice{
+					*newSlice("default", "slice-a", "my-service", podEndpoint("pod-uid-1", "pod-name-1", "10.0.0.1")),
+					*newSlice("default", "slice-b", "my-service", discoveryv1.Endpoint{
+						Addresses: []string{"10.0.0.2"},
+						Conditions: discoveryv1.EndpointConditions{
+							Serving:     boolPtr(false),
+							Terminating: boolPtr(true),
+						},
+						TargetRef: &corev1.ObjectReference{Kind: "Pod", UID: "pod-uid-1", Name: "pod-name-1"},
+					}),
 				},
 			},
+			service: "my-service",
+			expected: map[string]endpointRow{
+				"pod-uid-1": {UID: "pod-uid-1", Name: "pod-name-1", IP: "10.0.0.1", AddressType: discoveryv1.AddressTypeIPv4},
+			},
 		},
 		{
 			name: "endpoints without target ref use generated UID",
@@ -488,6 +714,7 @@ func TestEndpointSliceReconciler_buildDesiredRows(t *testing.T) {
 							Name:      "slice-1",
 							Labels:    map[string]string{},
 						},
+						AddressType: discoveryv1.AddressTypeIPv4,
 						Endpoints: []discoveryv1.Endpoint{
 							{
 								Addresses: []string{"10.0.0.1"},
@@ -504,9 +731,10 @@ func TestEndpointSliceReconciler_buildDesiredRows(t *testing.T) {
 			labelSelector: "",
 			expected: map[string]endpointRow{
 				"default/my-service/10.0.0.1": {
-					UID:  "default/my-service/10.0.0.1",
-					Name: "",
-					IP:   "10.0.0.1",
+					UID:         "default/my-service/10.0.0.1",
+					Name:        "",
+					IP:          "10.0.0.1",
+					AddressType: discoveryv1.AddressTypeIPv4,
 				},
 			},
 		},
@@ -517,7 +745,10 @@ func TestEndpointSliceReconciler_buildDesiredRows(t *testing.T) {
 			reconciler := &EndpointSliceReconciler{
 				LabelSelector: tt.labelSelector,
 			}
-			result := reconciler.buildDesiredRows(tt.list, tt.service)
+			result, err := reconciler.buildDesiredRows(context.Background(), tt.list, tt.service)
+			if err != nil {
+				t.Fatalf("buildDesiredRows() error = %v", err)
+			}
 
 			if len(result) != len(tt.expected) {
 				t.Errorf("buildDesiredRows() returned %d rows, want %d", len(result), len(tt.expected))
@@ -541,3 +772,1193 @@ func TestEndpointSliceReconciler_buildDesiredRows(t *testing.T) {
 func boolPtr(b bool) *bool {
 	return &b
 }
+
+func newTestScheme(t testing.TB) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return scheme
+}
+
+func newSlice(namespace, name, service string, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   endpoints,
+	}
+}
+
+func podEndpoint(uid, name, ip string) discoveryv1.Endpoint {
+	return discoveryv1.Endpoint{
+		Addresses:  []string{ip},
+		Conditions: discoveryv1.EndpointConditions{Ready: boolPtr(true)},
+		TargetRef:  &corev1.ObjectReference{Kind: "Pod", UID: types.UID(uid), Name: name},
+	}
+}
+
+// captureLogs returns a context whose logger appends every line, at any
+// verbosity, to the returned slice.
+func captureLogs() (context.Context, *[]string) {
+	var lines []string
+	logger := funcr.New(func(prefix, args string) {
+		lines = append(lines, prefix+" "+args)
+	}, funcr.Options{Verbosity: 10})
+	return log.IntoContext(context.Background(), logger), &lines
+}
+
+func TestEndpointSliceReconciler_LogsEndpointDiff(t *testing.T) {
+	slice := newSlice("default", "svc-abc", "svc",
+		podEndpoint("uid-1", "pod-1", "10.0.0.1"),
+		podEndpoint("uid-2", "pod-2", "10.0.0.2"),
+	)
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(slice).Build()
+	sink := &recordingSink{}
+	r := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", RequeueAfter: time.Minute}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "svc-abc"}}
+
+	ctx, lines := captureLogs()
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	for _, l := range *lines {
+		if strings.Contains(l, "endpoints changed") {
+			t.Errorf("first reconcile logged a diff without prior state: %s", l)
+		}
+	}
+
+	slice.Endpoints = []discoveryv1.Endpoint{
+		podEndpoint("uid-2", "pod-2", "10.0.0.2"),
+		podEndpoint("uid-3", "pod-3", "10.0.0.3"),
+	}
+	if err := c.Update(context.Background(), slice); err != nil {
+		t.Fatal(err)
+	}
+	*lines = nil
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	var diff string
+	for _, l := range *lines {
+		if strings.Contains(l, "endpoints changed") {
+			diff = l
+		}
+	}
+	if !strings.Contains(diff, `"added"=["uid-3"]`) || !strings.Contains(diff, `"removed"=["uid-1"]`) {
+		t.Errorf("diff log = %q, want uid-3 added and uid-1 removed", diff)
+	}
+	if len(sink.syncs) != 2 {
+		t.Errorf("sink got %d syncs, want 2", len(sink.syncs))
+	}
+
+	*lines = nil
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	for _, l := range *lines {
+		if strings.Contains(l, "endpoints changed") {
+			t.Errorf("unchanged reconcile logged a diff: %s", l)
+		}
+	}
+}
+
+func TestEndpointSliceReconciler_SkipsUnchangedWrites(t *testing.T) {
+	slice := newSlice("default", "svc-abc", "svc", podEndpoint("uid-1", "pod-1", "10.0.0.1"))
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(slice).Build()
+	sink := &recordingSink{}
+	r := &EndpointSliceReconciler{
+		Client: c, Sink: sink, ClusterName: "dev", RequeueAfter: time.Minute,
+		HeartbeatInterval: 10 * time.Minute,
+	}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.serviceSnapshots().now = func() time.Time { return now }
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "svc-abc"}}
+	ctx := context.Background()
+
+	reconcile := func() {
+		t.Helper()
+		res, err := r.Reconcile(ctx, req)
+		if err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+		if res.RequeueAfter != time.Minute {
+			t.Errorf("RequeueAfter = %v, want %v", res.RequeueAfter, time.Minute)
+		}
+	}
+
+	reconcile()
+	if len(sink.syncs) != 1 {
+		t.Fatalf("first reconcile: %d syncs, want 1", len(sink.syncs))
+	}
+
+	now = now.Add(time.Minute)
+	reconcile()
+	if len(sink.syncs) != 1 {
+		t.Errorf("unchanged set within heartbeat: %d syncs, want 1", len(sink.syncs))
+	}
+
+	now = now.Add(10 * time.Minute)
+	reconcile()
+	if len(sink.syncs) != 2 {
+		t.Errorf("unchanged set after heartbeat interval: %d syncs, want 2", len(sink.syncs))
+	}
+
+	slice.Endpoints = append(slice.Endpoints, podEndpoint("uid-2", "pod-2", "10.0.0.2"))
+	if err := c.Update(ctx, slice); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Second)
+	reconcile()
+	if len(sink.syncs) != 3 {
+		t.Errorf("changed set: %d syncs, want 3", len(sink.syncs))
+	}
+}
+
+func TestEndpointSliceReconciler_Debounce(t *testing.T) {
+	var objs []client.Object
+	for i, name := range []string{"svc-a", "svc-b", "svc-c"} {
+		objs = append(objs, newSlice("default", name, "svc", podEndpoint(fmt.Sprintf("uid-%d", i), "pod", fmt.Sprintf("10.0.0.%d", i))))
+	}
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(objs...).Build()
+	sink := &recordingSink{}
+	r := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", RequeueAfter: time.Minute, DebounceWindow: time.Second}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.debouncer().now = func() time.Time { return now }
+	r.serviceSnapshots().now = func() time.Time { return now }
+
+	reconcile := func(slice string) time.Duration {
+		t.Helper()
+		res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: slice}})
+		if err != nil {
+			t.Fatalf("Reconcile(%s) error = %v", slice, err)
+		}
+		return res.RequeueAfter
+	}
+
+	// A burst of 6 events over 3 slices within the window: nothing written,
+	// each is requeued for the end of the window.
+	for i := range 6 {
+		slice := objs[i%3].GetName()
+		if got, want := reconcile(slice), time.Second-time.Duration(i)*100*time.Millisecond; got != want {
+			t.Errorf("event %d: RequeueAfter = %v, want %v", i, got, want)
+		}
+		now = now.Add(100 * time.Millisecond)
+	}
+	if len(sink.syncs) != 0 {
+		t.Fatalf("%d syncs during the window, want 0", len(sink.syncs))
+	}
+
+	// The requeued events fire: one writes the union, the rest find it
+	// unchanged once their own window has passed.
+	now = now.Add(400 * time.Millisecond)
+	if got := reconcile("svc-a"); got != time.Minute {
+		t.Errorf("RequeueAfter after the window = %v, want %v", got, time.Minute)
+	}
+	reconcile("svc-b")
+	now = now.Add(time.Second)
+	reconcile("svc-c")
+	if len(sink.syncs) != 1 || len(sink.last) != 3 {
+		t.Errorf("got %d syncs with %d rows, want 1 sync of all 3 endpoints", len(sink.syncs), len(sink.last))
+	}
+}
+
+func TestEndpointSliceReconciler_FailedWriteIsRetried(t *testing.T) {
+	slice := newSlice("default", "svc-abc", "svc", podEndpoint("uid-1", "pod-1", "10.0.0.1"))
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(slice).Build()
+	sink := &recordingSink{err: errors.New("db down")}
+	r := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", RequeueAfter: time.Minute, HeartbeatInterval: time.Hour}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "svc-abc"}}
+
+	if _, err := r.Reconcile(context.Background(), req); err == nil {
+		t.Fatal("Reconcile() expected error, got nil")
+	}
+	sink.err = nil
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(sink.syncs) != 2 {
+		t.Errorf("sink got %d syncs, want 2 (a failed write must not be remembered as synced)", len(sink.syncs))
+	}
+}
+
+func TestEndpointSliceReconciler_PortFilter(t *testing.T) {
+	port := func(name string, num int32) discoveryv1.EndpointPort {
+		return discoveryv1.EndpointPort{Name: &name, Port: &num}
+	}
+	withPorts := func(sl *discoveryv1.EndpointSlice, ports ...discoveryv1.EndpointPort) discoveryv1.EndpointSlice {
+		sl.Ports = ports
+		return *sl
+	}
+	list := &discoveryv1.EndpointSliceList{Items: []discoveryv1.EndpointSlice{
+		withPorts(newSlice("default", "slice-a", "svc", podEndpoint("uid-1", "pod-1", "10.0.0.1")),
+			port("http", 8080), port("grpc", 9090)),
+		withPorts(newSlice("default", "slice-b", "svc", podEndpoint("uid-2", "pod-2", "10.0.0.2")),
+			port("http", 8080)),
+	}}
+
+	tests := []struct {
+		name   string
+		filter string
+		want   map[string]endpointRow
+	}{
+		{
+			name:   "no filter keeps every endpoint",
+			filter: "",
+			want: map[string]endpointRow{
+				"uid-1": {UID: "uid-1", Name: "pod-1", IP: "10.0.0.1", AddressType: discoveryv1.AddressTypeIPv4},
+				"uid-2": {UID: "uid-2", Name: "pod-2", IP: "10.0.0.2", AddressType: discoveryv1.AddressTypeIPv4},
+			},
+		},
+		{
+			name:   "by name keeps only slices exposing it",
+			filter: "grpc",
+			want: map[string]endpointRow{
+				"uid-1": {UID: "uid-1", Name: "pod-1", IP: "10.0.0.1", Port: 9090, AddressType: discoveryv1.AddressTypeIPv4},
+			},
+		},
+		{
+			name:   "by number",
+			filter: "8080",
+			want: map[string]endpointRow{
+				"uid-1": {UID: "uid-1", Name: "pod-1", IP: "10.0.0.1", Port: 8080, AddressType: discoveryv1.AddressTypeIPv4},
+				"uid-2": {UID: "uid-2", Name: "pod-2", IP: "10.0.0.2", Port: 8080, AddressType: discoveryv1.AddressTypeIPv4},
+			},
+		},
+		{
+			name:   "no match drops everything",
+			filter: "metrics",
+			want:   map[string]endpointRow{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &EndpointSliceReconciler{PortFilter: tt.filter}
+			if got, _ := r.buildDesiredRows(context.Background(), list, "svc"); !maps.Equal(got, tt.want) {
+				t.Errorf("buildDesiredRows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEndpointSliceReconciler_ServiceLabel(t *testing.T) {
+	const custom = "example.com/service"
+	labelled := func(name string, lbls map[string]string, eps ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+		sl := newSlice("default", name, "", eps...)
+		sl.Labels = lbls
+		return sl
+	}
+	objs := []client.Object{
+		labelled("custom-a", map[string]string{custom: "web"}, podEndpoint("uid-1", "pod-1", "10.0.0.1")),
+		labelled("custom-b", map[string]string{custom: "web"}, podEndpoint("uid-2", "pod-2", "10.0.0.2")),
+		labelled("default-label", map[string]string{discoveryv1.LabelServiceName: "web"}, podEndpoint("uid-3", "pod-3", "10.0.0.3")),
+	}
+
+	tests := []struct {
+		name     string
+		label    string
+		slice    string
+		wantUIDs []string
+		wantSkip float64
+	}{
+		{name: "default label", slice: "default-label", wantUIDs: []string{"uid-3"}},
+		{name: "default label ignores custom key", slice: "custom-a", wantSkip: 1},
+		{name: "override unions slices by the custom key", label: custom, slice: "custom-a", wantUIDs: []string{"uid-1", "uid-2"}},
+		{name: "override ignores default key", label: custom, slice: "default-label", wantSkip: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(objs...).Build()
+			sink := &recordingSink{}
+			r := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", RequeueAfter: time.Minute, ServiceLabel: tt.label}
+			ctx, lines := captureLogs()
+			skipped := slicesSkipped.WithLabelValues(skipNoServiceLabel)
+			before := testutil.ToFloat64(skipped)
+
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: tt.slice}}
+			if _, err := r.Reconcile(ctx, req); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if tt.wantUIDs == nil {
+				if len(sink.syncs) != 0 {
+					t.Errorf("syncs = %v, want none", sink.syncs)
+				}
+			} else {
+				if len(sink.syncs) != 1 || sink.syncs[0] != "dev/default/web" {
+					t.Fatalf("syncs = %v, want [dev/default/web]", sink.syncs)
+				}
+				got := slices.Sorted(maps.Keys(sink.last))
+				if !slices.Equal(got, tt.wantUIDs) {
+					t.Errorf("synced UIDs = %v, want %v", got, tt.wantUIDs)
+				}
+			}
+			if got := testutil.ToFloat64(skipped) - before; got != tt.wantSkip {
+				t.Errorf("observer_slices_skipped_total{reason=%q} grew by %v, want %v", skipNoServiceLabel, got, tt.wantSkip)
+			}
+			if tt.wantSkip > 0 && !strings.Contains(strings.Join(*lines, "\n"), `"skipping slice without service label"`) {
+				t.Errorf("logs = %v, want a skip message", *lines)
+			}
+		})
+	}
+}
+
+func TestEndpointSliceReconciler_SelectorFiltered(t *testing.T) {
+	slice := newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1"))
+	slice.Labels["tier"] = "backend"
+	tests := []struct {
+		name       string
+		selector   string
+		wantSyncs  int
+		wantFilter float64
+	}{
+		{name: "matching", selector: "tier=backend", wantSyncs: 1},
+		{name: "other value", selector: "tier=frontend", wantFilter: 1},
+		{name: "missing key", selector: "tier=backend,team=shop", wantFilter: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(slice).Build()
+			sink := &recordingSink{}
+			r := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", LabelSelector: tt.selector}
+			ctx, lines := captureLogs()
+			filtered := slicesFiltered.WithLabelValues(filterSelector)
+			before := testutil.ToFloat64(filtered)
+
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web-a"}}
+			if _, err := r.Reconcile(ctx, req); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if len(sink.syncs) != tt.wantSyncs {
+				t.Errorf("syncs = %v, want %d", sink.syncs, tt.wantSyncs)
+			}
+			if got := testutil.ToFloat64(filtered) - before; got != tt.wantFilter {
+				t.Errorf("observer_slices_filtered_total{reason=%q} grew by %v, want %v", filterSelector, got, tt.wantFilter)
+			}
+			logged := slices.ContainsFunc(*lines, func(l string) bool {
+				return strings.Contains(l, `"skipping slice not matching the selector"`) &&
+					strings.Contains(l, `"web-a"`) && strings.Contains(l, fmt.Sprintf(`"selector"=%q`, tt.selector))
+			})
+			if logged != (tt.wantFilter > 0) {
+				t.Errorf("logs = %v, want a skip message with the slice and selector: %v", *lines, tt.wantFilter > 0)
+			}
+		})
+	}
+}
+
+func TestEndpointSliceReconciler_AddressTypes(t *testing.T) {
+	typed := func(name string, addressType discoveryv1.AddressType, eps ...discoveryv1.Endpoint) discoveryv1.EndpointSlice {
+		sl := newSlice("default", name, "svc", eps...)
+		sl.AddressType = addressType
+		return *sl
+	}
+	generated := discoveryv1.Endpoint{Addresses: []string{"Backend.Example.COM."}, Conditions: discoveryv1.EndpointConditions{Ready: boolPtr(true)}}
+
+	tests := []struct {
+		name     string
+		slice    discoveryv1.EndpointSlice
+		want     map[string]endpointRow
+		wantSkip float64
+	}{
+		{
+			name:  "FQDN is kept as a lowercase hostname",
+			slice: typed("fqdn", discoveryv1.AddressTypeFQDN, podEndpoint("uid-1", "pod-1", "pod-1.web.example.com")),
+			want: map[string]endpointRow{
+				"uid-1": {UID: "uid-1", Name: "pod-1", IP: "pod-1.web.example.com", AddressType: discoveryv1.AddressTypeFQDN},
+			},
+		},
+		{
+			name:  "FQDN without target ref gets a hostname-based UID",
+			slice: typed("fqdn", discoveryv1.AddressTypeFQDN, generated),
+			want: map[string]endpointRow{
+				"default/svc/backend.example.com": {
+					UID: "default/svc/backend.example.com", IP: "backend.example.com", AddressType: discoveryv1.AddressTypeFQDN,
+				},
+			},
+		},
+		{
+			name:  "IPv6 is canonicalized",
+			slice: typed("v6", discoveryv1.AddressTypeIPv6, podEndpoint("uid-1", "pod-1", "2001:DB8:0:0::1")),
+			want: map[string]endpointRow{
+				"uid-1": {UID: "uid-1", Name: "pod-1", IP: "2001:db8::1", AddressType: discoveryv1.AddressTypeIPv6},
+			},
+		},
+		{
+			name:  "unparseable IP is dropped",
+			slice: typed("v4", discoveryv1.AddressTypeIPv4, podEndpoint("uid-1", "pod-1", "pod-1.example.com")),
+			want:  map[string]endpointRow{},
+		},
+		{
+			name:     "unknown address type is skipped",
+			slice:    typed("other", "CIDR", podEndpoint("uid-1", "pod-1", "10.0.0.0/24")),
+			want:     map[string]endpointRow{},
+			wantSkip: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, lines := captureLogs()
+			skipped := slicesSkipped.WithLabelValues(skipAddressType)
+			before := testutil.ToFloat64(skipped)
+
+			r := &EndpointSliceReconciler{}
+			list := &discoveryv1.EndpointSliceList{Items: []discoveryv1.EndpointSlice{tt.slice}}
+			if got, _ := r.buildDesiredRows(ctx, list, "svc"); !maps.Equal(got, tt.want) {
+				t.Errorf("buildDesiredRows() = %v, want %v", got, tt.want)
+			}
+			if got := testutil.ToFloat64(skipped) - before; got != tt.wantSkip {
+				t.Errorf("observer_slices_skipped_total{reason=%q} grew by %v, want %v", skipAddressType, got, tt.wantSkip)
+			}
+			if tt.wantSkip > 0 && !strings.Contains(strings.Join(*lines, "\n"), `"addressType"="CIDR"`) {
+				t.Errorf("logs = %v, want a warning naming the address type", *lines)
+			}
+		})
+	}
+}
+
+// cancelAfter is a context that reports itself canceled from the n-th
+// call to Err on, so a test can cancel at a precise point of a loop.
+type cancelAfter struct {
+	context.Context
+	n, calls int
+}
+
+func (c *cancelAfter) Err() error {
+	if c.calls++; c.calls >= c.n {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestEndpointSliceReconciler_buildDesiredRowsCanceled(t *testing.T) {
+	list := &discoveryv1.EndpointSliceList{}
+	for s := range 3 {
+		sl := newSlice("default", fmt.Sprintf("slice-%d", s), "svc")
+		for i := range 2 * ctxCheckInterval {
+			uid := fmt.Sprintf("uid-%d-%d", s, i)
+			sl.Endpoints = append(sl.Endpoints, podEndpoint(uid, uid, "10.0.0.1"))
+		}
+		list.Items = append(list.Items, *sl)
+	}
+
+	tests := []struct {
+		name string
+		n    int // Err call that first reports cancellation
+	}{
+		{name: "before the first slice", n: 1},
+		{name: "within a slice", n: 2},
+		{name: "at the second slice", n: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &cancelAfter{Context: context.Background(), n: tt.n}
+			got, err := (&EndpointSliceReconciler{}).buildDesiredRows(ctx, list, "svc")
+			if !errors.Is(err, context.Canceled) || got != nil {
+				t.Fatalf("buildDesiredRows() = %d rows, %v; want nil, context.Canceled", len(got), err)
+			}
+			if ctx.calls != tt.n {
+				t.Errorf("build went on for %d more checks after cancellation", ctx.calls-tt.n)
+			}
+		})
+	}
+
+	rows, err := (&EndpointSliceReconciler{}).buildDesiredRows(context.Background(), list, "svc")
+	if err != nil || len(rows) != 3*2*ctxCheckInterval {
+		t.Errorf("uncanceled buildDesiredRows() = %d rows, %v", len(rows), err)
+	}
+}
+
+func TestEndpointSliceReconciler_buildDesiredRowsSliceNames(t *testing.T) {
+	terminating := podEndpoint("uid-1", "pod-1", "10.0.0.1")
+	terminating.Conditions.Terminating = boolPtr(true)
+	list := &discoveryv1.EndpointSliceList{Items: []discoveryv1.EndpointSlice{
+		*newSlice("default", "svc-b", "svc", podEndpoint("uid-1", "pod-1", "10.0.0.1"), podEndpoint("uid-2", "pod-2", "10.0.0.2")),
+		*newSlice("default", "svc-a", "svc", terminating),
+		*newSlice("default", "svc-c", "svc", podEndpoint("uid-2", "pod-2", "10.0.0.2")),
+	}}
+
+	tests := []struct {
+		name   string
+		record bool
+		want   map[string][]string
+	}{
+		{name: "disabled", want: map[string][]string{"uid-1": nil, "uid-2": nil}},
+		{
+			name:   "every listing slice, sorted",
+			record: true,
+			want:   map[string][]string{"uid-1": {"svc-a", "svc-b"}, "uid-2": {"svc-b", "svc-c"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&EndpointSliceReconciler{RecordSlices: tt.record}).buildDesiredRows(context.Background(), list, "svc")
+			if err != nil {
+				t.Fatalf("buildDesiredRows() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("buildDesiredRows() = %d rows, want %d", len(got), len(tt.want))
+			}
+			for uid, want := range tt.want {
+				if names := got[uid].Slices.List(); !slices.Equal(names, want) {
+					t.Errorf("slices of %s = %v, want %v", uid, names, want)
+				}
+			}
+			if got["uid-1"].Name != "pod-1" {
+				t.Errorf("uid-1 = %+v, want the row of the serving endpoint", got["uid-1"])
+			}
+		})
+	}
+}
+
+func TestEndpointSliceReconciler_buildDesiredRowsUniqueIP(t *testing.T) {
+	// A terminating pod still lists the IP its replacement now has; with
+	// --readiness-expr=serving both are written unless --unique-ip.
+	terminating := podEndpoint("uid-old", "web-old", "10.0.0.1")
+	terminating.Conditions = discoveryv1.EndpointConditions{Ready: boolPtr(false), Serving: boolPtr(true), Terminating: boolPtr(true)}
+	readiness, err := ParseReadinessExpr("serving")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		slices   []discoveryv1.EndpointSlice
+		uniqueIP bool
+		want     []string
+		wantLog  bool
+	}{
+		{
+			name:   "disabled keeps both",
+			slices: []discoveryv1.EndpointSlice{*newSlice("default", "web-a", "web", terminating, podEndpoint("uid-new", "web-new", "10.0.0.1"))},
+			want:   []string{"uid-new", "uid-old"},
+		},
+		{
+			name:     "ready endpoint wins over a terminating one listed later",
+			slices:   []discoveryv1.EndpointSlice{*newSlice("default", "web-a", "web", podEndpoint("uid-new", "web-new", "10.0.0.1"), terminating)},
+			uniqueIP: true,
+			want:     []string{"uid-new"},
+			wantLog:  true,
+		},
+		{
+			name:     "ready endpoint replaces a terminating one listed earlier",
+			slices:   []discoveryv1.EndpointSlice{*newSlice("default", "web-a", "web", terminating), *newSlice("default", "web-b", "web", podEndpoint("uid-new", "web-new", "10.0.0.1"))},
+			uniqueIP: true,
+			want:     []string{"uid-new"},
+			wantLog:  true,
+		},
+		{
+			name: "equal endpoints: the last in slice name order wins",
+			slices: []discoveryv1.EndpointSlice{
+				*newSlice("default", "web-b", "web", podEndpoint("uid-2", "web-2", "10.0.0.1")),
+				*newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1")),
+			},
+			uniqueIP: true,
+			want:     []string{"uid-2"},
+			wantLog:  true,
+		},
+		{
+			name:     "a pod listed twice is no collision",
+			slices:   []discoveryv1.EndpointSlice{*newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1")), *newSlice("default", "web-b", "web", podEndpoint("uid-1", "web-1", "10.0.0.1"), podEndpoint("uid-2", "web-2", "10.0.0.2"))},
+			uniqueIP: true,
+			want:     []string{"uid-1", "uid-2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, lines := captureLogs()
+			r := &EndpointSliceReconciler{Readiness: readiness, UniqueIP: tt.uniqueIP}
+			got, err := r.buildDesiredRows(ctx, &discoveryv1.EndpointSliceList{Items: tt.slices}, "web")
+			if err != nil {
+				t.Fatalf("buildDesiredRows() error = %v", err)
+			}
+			if uids := slices.Sorted(maps.Keys(got)); !slices.Equal(uids, tt.want) {
+				t.Errorf("buildDesiredRows() = %v, want %v", uids, tt.want)
+			}
+			logged := slices.ContainsFunc(*lines, func(l string) bool { return strings.Contains(l, "endpoints share an IP") })
+			if logged != tt.wantLog {
+				t.Errorf("collision logged = %v, want %v: %v", logged, tt.wantLog, *lines)
+			}
+		})
+	}
+}
+
+func TestNameList_JSON(t *testing.T) {
+	row := endpointRow{UID: "uid-1", Slices: nameList("").add("svc-b").add("svc-a").add("svc-b")}
+	b, err := json.Marshal(row)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if want := `"slices":["svc-a","svc-b"]`; !strings.Contains(string(b), want) {
+		t.Errorf("Marshal() = %s, want it to contain %s", b, want)
+	}
+	var back endpointRow
+	if err := json.Unmarshal(b, &back); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if back != row {
+		t.Errorf("round trip = %+v, want %+v", back, row)
+	}
+	if b, _ := json.Marshal(endpointRow{UID: "uid-2"}); strings.Contains(string(b), "slices") {
+		t.Errorf("Marshal() = %s, want no slices", b)
+	}
+}
+
+func TestEndpointSliceReconciler_MaxEndpointsPerService(t *testing.T) {
+	list := &discoveryv1.EndpointSliceList{Items: []discoveryv1.EndpointSlice{
+		*newSlice("limit-ns", "big-a", "big", podEndpoint("uid-1", "pod-1", "10.0.0.1"), podEndpoint("uid-2", "pod-2", "10.0.0.2")),
+		// Duplicates count once.
+		*newSlice("limit-ns", "big-b", "big", podEndpoint("uid-2", "pod-2", "10.0.0.2"), podEndpoint("uid-3", "pod-3", "10.0.0.3")),
+	}}
+
+	tests := []struct {
+		name  string
+		limit int
+		skip  bool
+	}{
+		{name: "unlimited", limit: 0},
+		{name: "at the limit", limit: 3},
+		{name: "over the limit", limit: 2, skip: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &recordingSink{}
+			r := &EndpointSliceReconciler{Sink: sink, ClusterName: "dev", RequeueAfter: time.Minute, MaxEndpointsPerService: tt.limit}
+			counter := endpointLimitExceeded.WithLabelValues("limit-ns", "big")
+			before := testutil.ToFloat64(counter)
+			ctx, logs := captureLogs()
+
+			res, err := r.syncService(ctx, logr.Discard(), "limit-ns", "big", list)
+			if err != nil {
+				t.Fatalf("syncService() error = %v", err)
+			}
+			if res.RequeueAfter != time.Minute {
+				t.Errorf("RequeueAfter = %v, want %v", res.RequeueAfter, time.Minute)
+			}
+			if got := len(sink.syncs) == 0; got != tt.skip {
+				t.Errorf("sync skipped = %v, want %v", got, tt.skip)
+			}
+			want := 0.0
+			if tt.skip {
+				want = 1
+			}
+			if got := testutil.ToFloat64(counter) - before; got != want {
+				t.Errorf("observer_endpoint_limit_exceeded_total grew by %v, want %v", got, want)
+			}
+			if logged := strings.Contains(strings.Join(*logs, "\n"), "more than 2"); logged != tt.skip {
+				t.Errorf("limit error logged = %v, want %v: %v", logged, tt.skip, *logs)
+			}
+		})
+	}
+}
+
+func TestEndpointSliceReconciler_SinkErrorsNameTheService(t *testing.T) {
+	list := &discoveryv1.EndpointSliceList{Items: []discoveryv1.EndpointSlice{
+		*newSlice("default", "svc-abc", "svc", podEndpoint("uid-1", "pod-1", "10.0.0.1")),
+	}}
+	failWith := func(err error) *fakeDB {
+		return &fakeDB{execFn: func(string, []any) (pgconn.CommandTag, error) { return pgconn.CommandTag{}, err }}
+	}
+
+	// Unclassified errors go back to controller-runtime, which logs them.
+	r := &EndpointSliceReconciler{Sink: &PostgresSink{DB: failWith(errFake), TableName: "server"}, ClusterName: "dev"}
+	_, err := r.syncService(context.Background(), logr.Discard(), "default", "svc", list)
+	if want := "upsert default/svc uid=uid-1: " + errFake.Error(); err == nil || err.Error() != want {
+		t.Errorf("syncService() error = %v, want %q", err, want)
+	}
+
+	// Classified ones are logged here, with the service.
+	r = &EndpointSliceReconciler{Sink: &PostgresSink{DB: failWith(&pgconn.PgError{Code: "42P01"}), TableName: "server"}, ClusterName: "dev"}
+	ctx, logs := captureLogs()
+	if _, err := r.syncService(ctx, log.FromContext(ctx), "default", "svc", list); err != nil {
+		t.Fatalf("syncService() error = %v", err)
+	}
+	got := strings.Join(*logs, "\n")
+	for _, want := range []string{`"namespace"="default"`, `"service"="svc"`, "upsert default/svc uid=uid-1"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("logs = %s, want %s", got, want)
+		}
+	}
+}
+
+func TestEndpointSliceReconciler_ServicePredicate(t *testing.T) {
+	slice := func(lbls map[string]string) client.Object {
+		return &discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-abc", Labels: lbls}}
+	}
+	endpoints := func(name string) client.Object {
+		return &corev1.Endpoints{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+	}
+
+	tests := []struct {
+		name string
+		r    *EndpointSliceReconciler
+		obj  client.Object
+		want bool
+	}{
+		{name: "unscoped", r: &EndpointSliceReconciler{}, obj: slice(map[string]string{discoveryv1.LabelServiceName: "db"}), want: true},
+		{name: "slice of the service", r: &EndpointSliceReconciler{ServiceName: "web"}, obj: slice(map[string]string{discoveryv1.LabelServiceName: "web"}), want: true},
+		{name: "slice of another service", r: &EndpointSliceReconciler{ServiceName: "web"}, obj: slice(map[string]string{discoveryv1.LabelServiceName: "db"})},
+		{name: "slice without service label", r: &EndpointSliceReconciler{ServiceName: "web"}, obj: slice(nil)},
+		{
+			name: "custom service label",
+			r:    &EndpointSliceReconciler{ServiceName: "web", ServiceLabel: "example.com/service"},
+			obj:  slice(map[string]string{"example.com/service": "web", discoveryv1.LabelServiceName: "db"}),
+			want: true,
+		},
+		{name: "endpoints of the service", r: &EndpointSliceReconciler{ServiceName: "web", Source: SourceEndpoints}, obj: endpoints("web"), want: true},
+		{name: "endpoints of another service", r: &EndpointSliceReconciler{ServiceName: "web", Source: SourceEndpoints}, obj: endpoints("db")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.r.servicePredicate()
+			if got := p.Create(event.CreateEvent{Object: tt.obj}); got != tt.want {
+				t.Errorf("Create() = %v, want %v", got, tt.want)
+			}
+			if got := p.Update(event.UpdateEvent{ObjectOld: tt.obj, ObjectNew: tt.obj}); got != tt.want {
+				t.Errorf("Update() = %v, want %v", got, tt.want)
+			}
+			if got := p.Delete(event.DeleteEvent{Object: tt.obj}); got != tt.want {
+				t.Errorf("Delete() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEndpointsChanged(t *testing.T) {
+	base := newSlice("default", "web-abc", "web", podEndpoint("uid-1", "web-1", "10.0.0.1"))
+	base.ResourceVersion = "1"
+	edit := func(fn func(*discoveryv1.EndpointSlice)) client.Object {
+		sl := base.DeepCopy()
+		sl.ResourceVersion = "2"
+		fn(sl)
+		return sl
+	}
+	endpoints := func(ip string) client.Object {
+		return &corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", Annotations: map[string]string{"ip": ip}},
+			Subsets:    []corev1.EndpointSubset{{Addresses: []corev1.EndpointAddress{{IP: ip}}}},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		old, new client.Object
+		want     bool
+	}{
+		{name: "resourceVersion bump", old: base, new: edit(func(*discoveryv1.EndpointSlice) {})},
+		{name: "annotation change", old: base, new: edit(func(sl *discoveryv1.EndpointSlice) {
+			sl.Annotations = map[string]string{"endpoints.kubernetes.io/last-change-trigger-time": "now"}
+		})},
+		{name: "endpoint added", old: base, new: edit(func(sl *discoveryv1.EndpointSlice) {
+			sl.Endpoints = append(sl.Endpoints, podEndpoint("uid-2", "web-2", "10.0.0.2"))
+		}), want: true},
+		{name: "endpoint turned unready", old: base, new: edit(func(sl *discoveryv1.EndpointSlice) {
+			sl.Endpoints[0].Conditions.Ready = boolPtr(false)
+		}), want: true},
+		{name: "port changed", old: base, new: edit(func(sl *discoveryv1.EndpointSlice) {
+			port := int32(8080)
+			sl.Ports = []discoveryv1.EndpointPort{{Port: &port}}
+		}), want: true},
+		{name: "label changed", old: base, new: edit(func(sl *discoveryv1.EndpointSlice) {
+			sl.Labels[discoveryv1.LabelServiceName] = "db"
+		}), want: true},
+		{name: "address type changed", old: base, new: edit(func(sl *discoveryv1.EndpointSlice) {
+			sl.AddressType = discoveryv1.AddressTypeIPv6
+		}), want: true},
+		{name: "v1beta1 unchanged", old: &discoveryv1beta1.EndpointSlice{}, new: &discoveryv1beta1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{ResourceVersion: "2"}}},
+		{name: "endpoints unchanged", old: endpoints("10.0.0.1"), new: func() client.Object {
+			ep := endpoints("10.0.0.1")
+			ep.SetAnnotations(nil)
+			return ep
+		}()},
+		{name: "endpoints address changed", old: endpoints("10.0.0.1"), new: endpoints("10.0.0.2"), want: true},
+	}
+	p := endpointsChanged()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Update(event.UpdateEvent{ObjectOld: tt.old, ObjectNew: tt.new}); got != tt.want {
+				t.Errorf("Update() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if !p.Create(event.CreateEvent{Object: base}) || !p.Delete(event.DeleteEvent{Object: base}) || !p.Generic(event.GenericEvent{Object: base}) {
+		t.Error("non-update events were dropped")
+	}
+}
+
+func TestEndpointSliceReconciler_CanceledBeforeWrite(t *testing.T) {
+	slice := newSlice("default", "svc-abc", "svc", podEndpoint("uid-1", "pod-1", "10.0.0.1"))
+	began := 0
+	db := &fakeDB{beginFn: func(context.Context) error { began++; return nil }}
+	r := &EndpointSliceReconciler{Sink: &PostgresSink{DB: db, TableName: "server"}, ClusterName: "dev", RequeueAfter: time.Minute}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	list := &discoveryv1.EndpointSliceList{Items: []discoveryv1.EndpointSlice{*slice}}
+	if _, err := r.syncService(ctx, logr.Discard(), "default", "svc", list); !errors.Is(err, context.Canceled) {
+		t.Fatalf("syncService() error = %v, want context.Canceled", err)
+	}
+	if err := r.Sink.Sync(ctx, "dev", "default", "svc", nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Sync() error = %v, want context.Canceled", err)
+	}
+	if began != 0 {
+		t.Errorf("%d transactions opened on a canceled context, want 0", began)
+	}
+}
+
+// countingReader counts Get calls made through it.
+type countingReader struct {
+	client.Reader
+	gets int
+}
+
+func (c *countingReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	c.gets++
+	return c.Reader.Get(ctx, key, obj, opts...)
+}
+
+func TestEndpointSliceReconciler_ExcludeSelector(t *testing.T) {
+	pod := func(name string, lbls, annotations map[string]string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Labels: lbls, Annotations: annotations}}
+	}
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newSlice("default", "svc-a", "svc",
+			podEndpoint("uid-1", "web-1", "10.0.0.1"),
+			podEndpoint("uid-2", "canary-1", "10.0.0.2"),
+			podEndpoint("uid-4", "gone", "10.0.0.4"),
+		),
+		// canary-1 again in a second slice: the Pod must only be fetched once.
+		newSlice("default", "svc-b", "svc",
+			podEndpoint("uid-2", "canary-1", "10.0.0.2"),
+			podEndpoint("uid-3", "debug-1", "10.0.0.3"),
+		),
+		pod("web-1", map[string]string{"track": "stable"}, nil),
+		pod("canary-1", map[string]string{"track": "canary"}, nil),
+		pod("debug-1", nil, map[string]string{"track": "canary"}),
+	).Build()
+
+	selector, err := labels.Parse("track=canary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := &countingReader{Reader: c}
+	sink := &recordingSink{}
+	r := &EndpointSliceReconciler{
+		Client:          c,
+		Sink:            sink,
+		ClusterName:     "dev",
+		RequeueAfter:    time.Minute,
+		ExcludeSelector: selector,
+		PodReader:       reader,
+	}
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "svc-a"}}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	prev, ok := r.serviceSnapshots().get(types.NamespacedName{Namespace: "default", Name: "svc"})
+	if !ok {
+		t.Fatal("no snapshot stored after sync")
+	}
+	want := map[string]endpointRow{
+		"uid-1": {UID: "uid-1", Name: "web-1", IP: "10.0.0.1", AddressType: discoveryv1.AddressTypeIPv4},
+		// The Pod behind uid-4 doesn't exist; the endpoint is kept.
+		"uid-4": {UID: "uid-4", Name: "gone", IP: "10.0.0.4", AddressType: discoveryv1.AddressTypeIPv4},
+	}
+	if !maps.Equal(prev.rows, want) {
+		t.Errorf("synced rows = %v, want %v", prev.rows, want)
+	}
+	if reader.gets != 4 {
+		t.Errorf("pod gets = %d, want 4 (one per distinct pod)", reader.gets)
+	}
+}
+
+func TestEndpointSliceReconciler_RequeueJitter(t *testing.T) {
+	if got := (&EndpointSliceReconciler{RequeueAfter: time.Minute}).requeueAfter(); got != time.Minute {
+		t.Errorf("requeueAfter() without jitter = %s, want exactly 1m", got)
+	}
+
+	r := &EndpointSliceReconciler{RequeueAfter: time.Minute, RequeueJitter: 0.1}
+	lo, hi := 54*time.Second, 66*time.Second
+	distinct := map[time.Duration]bool{}
+	for range 1000 {
+		got := r.requeueAfter()
+		if got < lo || got > hi {
+			t.Fatalf("requeueAfter() = %s, want within [%s, %s]", got, lo, hi)
+		}
+		distinct[got] = true
+	}
+	if len(distinct) < 2 {
+		t.Error("requeueAfter() returned the same value every time; jitter not applied")
+	}
+
+	// Filtered-out slices are jittered too.
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(newSlice("default", "svc-abc", "svc")).Build()
+	r = &EndpointSliceReconciler{Client: c, LabelSelector: "app=other", RequeueAfter: time.Minute, RequeueJitter: 0.1}
+	res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "svc-abc"}})
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if res.RequeueAfter < lo || res.RequeueAfter > hi {
+		t.Errorf("filtered Reconcile() RequeueAfter = %s, want within [%s, %s]", res.RequeueAfter, lo, hi)
+	}
+}
+
+func TestEndpointSliceReconciler_NoPeriodicRequeue(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newSlice("default", "svc-abc", "svc", podEndpoint("uid-1", "pod-1", "10.0.0.1")),
+		newSlice("default", "unlabeled", ""),
+		newSlice("kube-system", "dns-abc", "dns", podEndpoint("uid-2", "dns-1", "10.0.0.2")),
+	).Build()
+	r := &EndpointSliceReconciler{
+		Client: c, Sink: &recordingSink{}, ClusterName: "dev", RequeueJitter: 0.1,
+		Namespaces: NameFilter{Deny: []string{"kube-*"}},
+	}
+
+	tests := []struct {
+		name  string
+		slice types.NamespacedName
+	}{
+		{name: "synced", slice: types.NamespacedName{Namespace: "default", Name: "svc-abc"}},
+		{name: "unchanged", slice: types.NamespacedName{Namespace: "default", Name: "svc-abc"}},
+		{name: "slice gone", slice: types.NamespacedName{Namespace: "default", Name: "missing"}},
+		{name: "no service label", slice: types.NamespacedName{Namespace: "default", Name: "unlabeled"}},
+		{name: "denied namespace", slice: types.NamespacedName{Namespace: "kube-system", Name: "dns-abc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: tt.slice})
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if res != (ctrl.Result{}) {
+				t.Errorf("Reconcile() = %+v, want no requeue", res)
+			}
+		})
+	}
+
+	// The label filter is checked before the service label.
+	r = &EndpointSliceReconciler{Client: c, LabelSelector: "app=other"}
+	if res, _ := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: tests[0].slice}); res != (ctrl.Result{}) {
+		t.Errorf("filtered Reconcile() = %+v, want no requeue", res)
+	}
+}
+
+func TestEndpointSliceReconciler_NoPeriodicRequeueHeartbeat(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newSlice("default", "svc-abc", "svc", podEndpoint("uid-1", "pod-1", "10.0.0.1")),
+	).Build()
+	sink := &recordingSink{}
+	r := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", HeartbeatInterval: time.Hour}
+	now := time.Now()
+	r.serviceSnapshots().now = func() time.Time { return now }
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "svc-abc"}}
+
+	// Without periodic reconciles a synced service still comes back when its
+	// heartbeat is due, and an unchanged one once the rest has elapsed.
+	for _, step := range []struct {
+		elapsed time.Duration
+		want    time.Duration
+		syncs   int
+	}{
+		{elapsed: 0, want: time.Hour, syncs: 1},
+		{elapsed: 20 * time.Minute, want: 40 * time.Minute, syncs: 1},
+		{elapsed: time.Hour, want: time.Hour, syncs: 2},
+	} {
+		now = now.Add(step.elapsed)
+		res, err := r.Reconcile(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+		if res.RequeueAfter != step.want || len(sink.syncs) != step.syncs {
+			t.Errorf("after %s: RequeueAfter = %s with %d syncs, want %s with %d", step.elapsed, res.RequeueAfter, len(sink.syncs), step.want, step.syncs)
+		}
+	}
+}
+
+func TestEndpointSliceReconciler_AllowDenyLists(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1")),
+		newSlice("default", "web-canary-a", "web-canary", podEndpoint("uid-2", "web-2", "10.0.0.2")),
+		newSlice("kube-system", "dns-a", "kube-dns", podEndpoint("uid-3", "dns-1", "10.0.1.1")),
+		newSlice("team-a", "api-a", "api", podEndpoint("uid-4", "api-1", "10.0.2.1")),
+	).Build()
+	reqs := []types.NamespacedName{
+		{Namespace: "default", Name: "web-a"},
+		{Namespace: "default", Name: "web-canary-a"},
+		{Namespace: "kube-system", Name: "dns-a"},
+		{Namespace: "team-a", Name: "api-a"},
+	}
+
+	tests := []struct {
+		name       string
+		namespaces NameFilter
+		services   NameFilter
+		want       []string
+	}{
+		{name: "no lists", want: []string{"dev/default/web", "dev/default/web-canary", "dev/kube-system/kube-dns", "dev/team-a/api"}},
+		{
+			name:       "deny system namespaces",
+			namespaces: NameFilter{Deny: []string{"kube-*"}},
+			want:       []string{"dev/default/web", "dev/default/web-canary", "dev/team-a/api"},
+		},
+		{
+			name:       "namespace deny wins over allow",
+			namespaces: NameFilter{Allow: []string{"*"}, Deny: []string{"kube-*", "team-?"}},
+			want:       []string{"dev/default/web", "dev/default/web-canary"},
+		},
+		{
+			name:     "service allow with a deny carve-out",
+			services: NameFilter{Allow: []string{"web*", "api"}, Deny: []string{"*-canary"}},
+			want:     []string{"dev/default/web", "dev/team-a/api"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &recordingSink{}
+			r := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", RequeueAfter: time.Minute, Namespaces: tt.namespaces, Services: tt.services}
+			for _, sl := range reqs {
+				res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: sl})
+				if err != nil || res.RequeueAfter != time.Minute {
+					t.Fatalf("Reconcile(%s) = %+v, %v", sl, res, err)
+				}
+			}
+			if !slices.Equal(sink.syncs, tt.want) {
+				t.Errorf("Reconcile() synced %v, want %v", sink.syncs, tt.want)
+			}
+
+			// SyncAll applies the same lists.
+			sink.syncs = nil
+			if err := r.SyncAll(context.Background(), ""); err != nil {
+				t.Fatalf("SyncAll() error = %v", err)
+			}
+			if !slices.Equal(sink.syncs, tt.want) {
+				t.Errorf("SyncAll() synced %v, want %v", sink.syncs, tt.want)
+			}
+		})
+	}
+}
+
+// TestEndpointSliceReconciler_CacheLag lists no slices at all, as a cache
+// lagging behind right after startup may, while the reconciled slice has a
+// ready endpoint: the reconcile is requeued rather than prune the service.
+func TestEndpointSliceReconciler_CacheLag(t *testing.T) {
+	notReady := podEndpoint("uid-2", "web-2", "10.0.0.2")
+	notReady.Conditions.Ready = boolPtr(false)
+
+	tests := []struct {
+		name     string
+		slice    *discoveryv1.EndpointSlice
+		wantSync bool
+	}{
+		{name: "ready endpoint", slice: newSlice("default", "web-abc", "web", podEndpoint("uid-1", "web-1", "10.0.0.1"))},
+		// Without a ready endpoint nothing tells lag from a service whose
+		// endpoints all went away, so the empty set is written as before.
+		{name: "no ready endpoint", slice: newSlice("default", "web-abc", "web", notReady), wantSync: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lagging := true
+			c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(tt.slice).
+				WithInterceptorFuncs(interceptor.Funcs{List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+					if lagging {
+						return nil
+					}
+					return c.List(ctx, list, opts...)
+				}}).Build()
+			sink := &recordingSink{}
+			r := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev"}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web-abc"}}
+			skipped := slicesSkipped.WithLabelValues(skipCacheLag)
+			before := testutil.ToFloat64(skipped)
+
+			res, err := r.Reconcile(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if synced := len(sink.syncs) > 0; synced != tt.wantSync {
+				t.Fatalf("synced %v of a lagging list, want %v", sink.syncs, tt.wantSync)
+			}
+			if tt.wantSync {
+				return
+			}
+			if res.RequeueAfter != cacheLagRequeueDelay {
+				t.Errorf("RequeueAfter = %s, want %s", res.RequeueAfter, cacheLagRequeueDelay)
+			}
+			if got := testutil.ToFloat64(skipped) - before; got != 1 {
+				t.Errorf("observer_slices_skipped_total{reason=%q} grew by %v, want 1", skipCacheLag, got)
+			}
+
+			// Once the cache has caught up, the requeued reconcile syncs.
+			lagging = false
+			if _, err := r.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if want := []string{"dev/default/web"}; !slices.Equal(sink.syncs, want) || len(sink.last) != 1 {
+				t.Errorf("syncs = %v of %d rows, want %v with its endpoint", sink.syncs, len(sink.last), want)
+			}
+		})
+	}
+}
+
+// TestEndpointSliceReconciler_ResyncServiceCacheLag keeps a resync from
+// pruning the rows of a service whose slices the cache doesn't list yet,
+// while one whose slices are gone from the API server too is pruned.
+func TestEndpointSliceReconciler_ResyncServiceCacheLag(t *testing.T) {
+	tests := []struct {
+		name      string
+		liveSlice bool
+		wantPrune bool
+	}{
+		{name: "slices live", liveSlice: true},
+		{name: "slices gone", wantPrune: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slice := newSlice("default", "web-abc", "web", podEndpoint("uid-1", "web-1", "10.0.0.1"))
+			lagging := false
+			c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(slice.DeepCopy()).
+				WithInterceptorFuncs(interceptor.Funcs{List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+					if lagging {
+						return nil
+					}
+					return c.List(ctx, list, opts...)
+				}}).Build()
+			live := fake.NewClientBuilder().WithScheme(newTestScheme(t))
+			if tt.liveSlice {
+				live = live.WithObjects(slice.DeepCopy())
+			}
+			sink := &recordingSink{}
+			r := &EndpointSliceReconciler{Client: c, LiveReader: live.Build(), Sink: sink, ClusterName: "dev"}
+			if _, err := r.ResyncService(context.Background(), "default", "web"); err != nil || len(sink.last) != 1 {
+				t.Fatalf("ResyncService() = %v, %d rows, want its endpoint synced", err, len(sink.last))
+			}
+			skipped := slicesSkipped.WithLabelValues(skipCacheLag)
+			before := testutil.ToFloat64(skipped)
+
+			lagging = true
+			res, err := r.ResyncService(context.Background(), "default", "web")
+			if err != nil {
+				t.Fatalf("ResyncService() error = %v", err)
+			}
+			if tt.wantPrune {
+				if len(sink.syncs) != 2 || len(sink.last) != 0 {
+					t.Errorf("syncs = %v of %d rows, want the rows pruned", sink.syncs, len(sink.last))
+				}
+				return
+			}
+			if len(sink.syncs) != 1 {
+				t.Errorf("syncs = %v, want no sync of a lagging list", sink.syncs)
+			}
+			if res.RequeueAfter != cacheLagRequeueDelay {
+				t.Errorf("RequeueAfter = %s, want %s", res.RequeueAfter, cacheLagRequeueDelay)
+			}
+			if got := testutil.ToFloat64(skipped) - before; got != 1 {
+				t.Errorf("observer_slices_skipped_total{reason=%q} grew by %v, want 1", skipCacheLag, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type execCall struct {
+	sql  string
+	args []any
+	inTx bool
+}
+
+// fakeDB is an in-memory DB that records every statement. Hooks let tests
+// inject errors, block, or return canned query results.
+type fakeDB struct {
+	mu        sync.Mutex
+	execs     []execCall
+	commits   int
+	rollbacks int
+
+	// beginFn, if set, runs on Begin and may block or fail.
+	beginFn func(ctx context.Context) error
+	// execFn, if set, decides the result of each Exec.
+	execFn func(sql string, args []any) (pgconn.CommandTag, error)
+	// queryFn, if set, answers Query and QueryRow.
+	queryFn func(sql string, args []any) ([][]any, error)
+}
+
+func (f *fakeDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	if f.beginFn != nil {
+		if err := f.beginFn(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return &fakeTx{db: f}, nil
+}
+
+func (f *fakeDB) exec(ctx context.Context, inTx bool, sql string, args []any) (pgconn.CommandTag, error) {
+	if err := ctx.Err(); err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	f.mu.Lock()
+	f.execs = append(f.execs, execCall{sql: sql, args: args, inTx: inTx})
+	fn := f.execFn
+	f.mu.Unlock()
+	if fn != nil {
+		return fn(sql, args)
+	}
+	return pgconn.NewCommandTag("OK 0"), nil
+}
+
+func (f *fakeDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return f.exec(ctx, false, sql, args)
+}
+
+func (f *fakeDB) query(ctx context.Context, sql string, args []any) (pgx.Rows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if f.queryFn == nil {
+		return &fakeRows{}, nil
+	}
+	rows, err := f.queryFn(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{rows: rows}, nil
+}
+
+func (f *fakeDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return f.query(ctx, sql, args)
+}
+
+func (f *fakeDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	rows, err := f.query(ctx, sql, args)
+	return &fakeRow{rows: rows, err: err}
+}
+
+// statements returns the recorded SQL whose text contains substr.
+func (f *fakeDB) statements(substr string) []execCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []execCall
+	for _, e := range f.execs {
+		if strings.Contains(e.sql, substr) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+type fakeTx struct {
+	pgx.Tx
+	db   *fakeDB
+	done bool
+}
+
+func (t *fakeTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return t.db.exec(ctx, true, sql, args)
+}
+
+func (t *fakeTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return t.db.query(ctx, sql, args)
+}
+
+func (t *fakeTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return t.db.QueryRow(ctx, sql, args...)
+}
+
+func (t *fakeTx) Commit(ctx context.Context) error {
+	if t.done {
+		return pgx.ErrTxClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	t.done = true
+	t.db.mu.Lock()
+	t.db.commits++
+	t.db.mu.Unlock()
+	return nil
+}
+
+func (t *fakeTx) Rollback(context.Context) error {
+	if t.done {
+		return pgx.ErrTxClosed
+	}
+	t.done = true
+	t.db.mu.Lock()
+	t.db.rollbacks++
+	t.db.mu.Unlock()
+	return nil
+}
+
+// fakeRows serves canned rows; Scan assigns by reflection.
+type fakeRows struct {
+	pgx.Rows
+	rows [][]any
+	cur  []any
+	err  error
+}
+
+func (r *fakeRows) Next() bool {
+	if len(r.rows) == 0 {
+		return false
+	}
+	r.cur, r.rows = r.rows[0], r.rows[1:]
+	return true
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	if len(dest) != len(r.cur) {
+		return fmt.Errorf("scan: %d destinations for %d values", len(dest), len(r.cur))
+	}
+	for i, d := range dest {
+		dv := reflect.ValueOf(d).Elem()
+		sv := reflect.ValueOf(r.cur[i])
+		if !sv.IsValid() {
+			dv.SetZero()
+			continue
+		}
+		if !sv.Type().AssignableTo(dv.Type()) {
+			return fmt.Errorf("scan column %d: cannot assign %T to %s", i, r.cur[i], dv.Type())
+		}
+		dv.Set(sv)
+	}
+	return nil
+}
+
+func (r *fakeRows) Err() error                    { return r.err }
+func (r *fakeRows) Close()                        {}
+func (r *fakeRows) CommandTag() pgconn.CommandTag { return pgconn.NewCommandTag("SELECT") }
+
+type fakeRow struct {
+	rows pgx.Rows
+	err  error
+}
+
+func (r *fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	if !r.rows.Next() {
+		return pgx.ErrNoRows
+	}
+	return r.rows.Scan(dest...)
+}
+
+var errFake = errors.New("fake db error")
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// SyncTracker remembers when each {namespace,service} was last synced
+// successfully. A nil *SyncTracker is valid and records nothing.
+type SyncTracker struct {
+	// Pause, if set, is reported in the response.
+	Pause *Pause
+
+	mu   sync.RWMutex
+	last map[types.NamespacedName]time.Time
+	now  func() time.Time
+}
+
+func NewSyncTracker() *SyncTracker {
+	return &SyncTracker{last: map[types.NamespacedName]time.Time{}, now: time.Now}
+}
+
+// Record marks namespace/service as synced now.
+func (t *SyncTracker) Record(namespace, service string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last[types.NamespacedName{Namespace: namespace, Name: service}] = t.now()
+}
+
+// Forget drops namespace/service, e.g. once the Service is deleted.
+func (t *SyncTracker) Forget(namespace, service string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.last, types.NamespacedName{Namespace: namespace, Name: service})
+}
+
+// services returns the services recorded, in no particular order.
+func (t *SyncTracker) services() []types.NamespacedName {
+	if t == nil {
+		return nil
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return slices.Collect(maps.Keys(t.last))
+}
+
+type serviceSyncStatus struct {
+	Namespace string    `json:"namespace"`
+	Service   string    `json:"service"`
+	LastSync  time.Time `json:"lastSync"`
+	Stale     bool      `json:"stale"`
+}
+
+type healthResponse struct {
+	Status   string              `json:"status"`
+	Paused   bool                `json:"paused"`
+	Services []serviceSyncStatus `json:"services"`
+}
+
+func (t *SyncTracker) snapshot(staleAfter time.Duration) healthResponse {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	now := t.now()
+	resp := healthResponse{Status: "ok", Paused: t.Pause.Paused(), Services: make([]serviceSyncStatus, 0, len(t.last))}
+	for key, ts := range t.last {
+		stale := staleAfter > 0 && now.Sub(ts) > staleAfter
+		if stale {
+			resp.Status = "stale"
+		}
+		resp.Services = append(resp.Services, serviceSyncStatus{
+			Namespace: key.Namespace, Service: key.Name, LastSync: ts, Stale: stale,
+		})
+	}
+	sort.Slice(resp.Services, func(i, j int) bool {
+		a, b := resp.Services[i], resp.Services[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Service < b.Service
+	})
+	return resp
+}
+
+// Handler serves the per-service sync times as JSON. Services not synced
+// within staleAfter are flagged and flip the top-level status to "stale".
+func (t *SyncTracker) Handler(staleAfter time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, t.snapshot(staleAfter))
+	})
+}
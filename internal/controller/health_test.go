@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSyncTracker_Handler(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewSyncTracker()
+	tracker.now = func() time.Time { return now }
+
+	tracker.Record("default", "fresh")
+	now = now.Add(-10 * time.Minute)
+	tracker.Record("default", "old")
+	tracker.Record("other", "gone")
+	now = now.Add(10 * time.Minute)
+	tracker.Forget("other", "gone")
+
+	tests := []struct {
+		name       string
+		staleAfter time.Duration
+		status     string
+		stale      map[string]bool
+	}{
+		{
+			name:       "old service flagged as stale",
+			staleAfter: 3 * time.Minute,
+			status:     "stale",
+			stale:      map[string]bool{"fresh": false, "old": true},
+		},
+		{
+			name:       "nothing stale within window",
+			staleAfter: time.Hour,
+			status:     "ok",
+			stale:      map[string]bool{"fresh": false, "old": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tracker.Handler(tt.staleAfter).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", http.NoBody))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status code = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			var resp healthResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if resp.Status != tt.status {
+				t.Errorf("status = %q, want %q", resp.Status, tt.status)
+			}
+			if len(resp.Services) != len(tt.stale) {
+				t.Fatalf("got %d services, want %d: %+v", len(resp.Services), len(tt.stale), resp.Services)
+			}
+			for _, s := range resp.Services {
+				want, ok := tt.stale[s.Service]
+				if !ok {
+					t.Errorf("unexpected service %s/%s", s.Namespace, s.Service)
+					continue
+				}
+				if s.Stale != want {
+					t.Errorf("service %s stale = %v, want %v", s.Service, s.Stale, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncTracker_NilIsNoop(t *testing.T) {
+	var tracker *SyncTracker
+	tracker.Record("default", "svc")
+	tracker.Forget("default", "svc")
+}
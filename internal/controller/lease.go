@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultLeaseTable holds one row per cluster name claimed by a live observer.
+const DefaultLeaseTable = "cluster_leases"
+
+// LeaseHeldError is returned by ClusterLease.Claim when another instance
+// renewed the same cluster name within the TTL.
+type LeaseHeldError struct {
+	Cluster       string
+	Holder        string
+	LastHeartbeat time.Time
+}
+
+func (e *LeaseHeldError) Error() string {
+	return fmt.Sprintf("cluster %q is already claimed by instance %q (last heartbeat %s); is --cluster set to the same value in two clusters?",
+		e.Cluster, e.Holder, e.LastHeartbeat.Format(time.RFC3339))
+}
+
+// ClusterLease claims Cluster for InstanceID in a shared lease table so two
+// deployments can't silently write under the same cluster name. Claim once
+// at startup, then add the lease to the manager to keep it renewed; the
+// claim is released on shutdown.
+type ClusterLease struct {
+	DB         DB
+	Table      string // DefaultLeaseTable if empty
+	Cluster    string
+	InstanceID string
+	TTL        time.Duration
+	Log        logr.Logger
+}
+
+func (l *ClusterLease) table() (string, error) {
+	if l.Table == "" {
+		return sanitizeTableIdent(DefaultLeaseTable)
+	}
+	return sanitizeTableIdent(l.Table)
+}
+
+// Claim takes or renews the lease. It fails with *LeaseHeldError when a
+// different instance holds a lease that hasn't expired yet.
+func (l *ClusterLease) Claim(ctx context.Context) error {
+	tbl, err := l.table()
+	if err != nil {
+		return err
+	}
+	q := fmt.Sprintf(`
+	  INSERT INTO %[1]s (cluster, instance_id, last_heartbeat)
+	  VALUES ($1, $2, now())
+	  ON CONFLICT (cluster) DO UPDATE
+	    SET instance_id = EXCLUDED.instance_id, last_heartbeat = now()
+	    WHERE %[1]s.instance_id = EXCLUDED.instance_id
+	       OR %[1]s.last_heartbeat < now() - make_interval(secs => $3)
+	  RETURNING instance_id`, tbl)
+
+	var holder string
+	err = l.DB.QueryRow(ctx, q, l.Cluster, l.InstanceID, l.TTL.Seconds()).Scan(&holder)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("claim cluster lease: %w", err)
+	}
+
+	held := &LeaseHeldError{Cluster: l.Cluster}
+	q = fmt.Sprintf(`SELECT instance_id, last_heartbeat FROM %s WHERE cluster = $1`, tbl)
+	if err := l.DB.QueryRow(ctx, q, l.Cluster).Scan(&held.Holder, &held.LastHeartbeat); err != nil {
+		return fmt.Errorf("claim cluster lease: held by another instance (lookup failed: %w)", err)
+	}
+	return held
+}
+
+// Release drops the lease if this instance still holds it.
+func (l *ClusterLease) Release(ctx context.Context) error {
+	tbl, err := l.table()
+	if err != nil {
+		return err
+	}
+	q := fmt.Sprintf(`DELETE FROM %s WHERE cluster = $1 AND instance_id = $2`, tbl)
+	_, err = l.DB.Exec(ctx, q, l.Cluster, l.InstanceID)
+	return err
+}
+
+// Start renews the lease every TTL/3 until ctx is done, then releases it.
+// Losing the lease to another instance stops the manager; transient renewal
+// errors are logged and retried on the next tick.
+func (l *ClusterLease) Start(ctx context.Context) error {
+	ticker := time.NewTicker(l.TTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			relCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := l.Release(relCtx); err != nil {
+				l.Log.Error(err, "release cluster lease")
+			}
+			return nil
+		case <-ticker.C:
+			err := l.Claim(ctx)
+			var held *LeaseHeldError
+			switch {
+			case errors.As(err, &held):
+				return err
+			case err != nil && ctx.Err() == nil:
+				l.Log.Error(err, "renew cluster lease")
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func TestClusterLease_Claim(t *testing.T) {
+	heartbeat := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		queryFn func(sql string, args []any) ([][]any, error)
+		wantErr func(error) bool
+	}{
+		{
+			name: "free or ours",
+			queryFn: func(string, []any) ([][]any, error) {
+				return [][]any{{"pod-a"}}, nil
+			},
+			wantErr: func(err error) bool { return err == nil },
+		},
+		{
+			name: "held by a live instance",
+			queryFn: func(sql string, _ []any) ([][]any, error) {
+				if strings.Contains(sql, "INSERT") {
+					return nil, nil // the conditional update matched nothing
+				}
+				return [][]any{{"pod-b", heartbeat}}, nil
+			},
+			wantErr: func(err error) bool {
+				var held *LeaseHeldError
+				return errors.As(err, &held) && held.Holder == "pod-b" && held.LastHeartbeat.Equal(heartbeat) &&
+					strings.Contains(err.Error(), `"default"`)
+			},
+		},
+		{
+			name: "database error",
+			queryFn: func(string, []any) ([][]any, error) {
+				return nil, errFake
+			},
+			wantErr: func(err error) bool {
+				var held *LeaseHeldError
+				return errors.Is(err, errFake) && !errors.As(err, &held)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var claimArgs []any
+			db := &fakeDB{queryFn: func(sql string, args []any) ([][]any, error) {
+				if strings.Contains(sql, "INSERT") {
+					claimArgs = args
+				}
+				return tt.queryFn(sql, args)
+			}}
+			l := &ClusterLease{DB: db, Cluster: "default", InstanceID: "pod-a", TTL: time.Minute, Log: logr.Discard()}
+
+			err := l.Claim(context.Background())
+			if !tt.wantErr(err) {
+				t.Errorf("Claim() error = %v", err)
+			}
+			if len(claimArgs) != 3 || claimArgs[0] != "default" || claimArgs[1] != "pod-a" || claimArgs[2] != 60.0 {
+				t.Errorf("claim args = %v, want [default pod-a 60]", claimArgs)
+			}
+		})
+	}
+}
+
+func TestClusterLease_StartRenewsAndReleases(t *testing.T) {
+	var claims int
+	db := &fakeDB{queryFn: func(string, []any) ([][]any, error) {
+		claims++
+		return [][]any{{"pod-a"}}, nil
+	}}
+	l := &ClusterLease{DB: db, Cluster: "default", InstanceID: "pod-a", TTL: 30 * time.Millisecond, Log: logr.Discard()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := l.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if claims < 2 {
+		t.Errorf("lease renewed %d times, want several", claims)
+	}
+	if rel := db.statements("DELETE FROM"); len(rel) != 1 || rel[0].args[1] != "pod-a" {
+		t.Errorf("release statements = %+v, want one for pod-a", rel)
+	}
+}
+
+func TestClusterLease_StartStopsWhenLeaseIsLost(t *testing.T) {
+	db := &fakeDB{queryFn: func(sql string, _ []any) ([][]any, error) {
+		if strings.Contains(sql, "INSERT") {
+			return nil, nil
+		}
+		return [][]any{{"pod-b", time.Now()}}, nil
+	}}
+	l := &ClusterLease{DB: db, Cluster: "default", InstanceID: "pod-a", TTL: 15 * time.Millisecond, Log: logr.Discard()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var held *LeaseHeldError
+	if err := l.Start(ctx); !errors.As(err, &held) {
+		t.Errorf("Start() error = %v, want *LeaseHeldError", err)
+	}
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// listNotSyncedDelay is the wait before listing again while the cache
+// hasn't started, which takes well under a second once the manager runs.
+const listNotSyncedDelay = 50 * time.Millisecond
+
+// Reasons recorded in observer_list_retries_total.
+const (
+	listRetryNotSynced = "not_synced"
+	listRetryAPIError  = "api_error"
+)
+
+// listFunc lists objects as client.Reader.List does.
+type listFunc func(ctx context.Context, obj client.ObjectList, opts ...client.ListOption) error
+
+// list is r.List retried up to ListRetries times: quickly while the cache
+// hasn't started, after ListRetryBackoff (doubled each time, or the server's
+// Retry-After) when the API server throttles or is unavailable. Other
+// errors, and the end of ctx, are returned at once, as is the last error
+// once the retries are spent, so a failed list never reads as an empty one.
+func (r *EndpointSliceReconciler) list(ctx context.Context, obj client.ObjectList, opts ...client.ListOption) error {
+	backoff := r.ListRetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := r.List(ctx, obj, opts...)
+		if err == nil || attempt >= r.ListRetries || ctx.Err() != nil {
+			return err
+		}
+		reason, delay := listRetryDelay(err, backoff)
+		if reason == "" {
+			return err
+		}
+		log.FromContext(ctx).V(1).Info("list failed, retrying", "reason", reason, "attempt", attempt+1, "after", delay, "error", err.Error())
+		listRetries.WithLabelValues(reason).Inc()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		if reason == listRetryAPIError {
+			backoff *= 2
+		}
+	}
+}
+
+// listRetryDelay classifies a failed list: the reason to retry it and the
+// wait before, or no reason if it isn't worth retrying.
+func listRetryDelay(err error, backoff time.Duration) (reason string, delay time.Duration) {
+	var notStarted *cache.ErrCacheNotStarted
+	if errors.As(err, &notStarted) {
+		return listRetryNotSynced, listNotSyncedDelay
+	}
+	if apierrors.IsTooManyRequests(err) || apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) ||
+		apierrors.IsServiceUnavailable(err) || apierrors.IsInternalError(err) {
+		if seconds, ok := apierrors.SuggestsClientDelay(err); ok && time.Duration(seconds)*time.Second > backoff {
+			return listRetryAPIError, time.Duration(seconds) * time.Second
+		}
+		return listRetryAPIError, backoff
+	}
+	return "", 0
+}
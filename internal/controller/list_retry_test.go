@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// TestEndpointSliceReconciler_ListRetry reconciles through a client whose
+// first lists fail with errs, one per call.
+func TestEndpointSliceReconciler_ListRetry(t *testing.T) {
+	resource := schema.GroupResource{Group: "discovery.k8s.io", Resource: "endpointslices"}
+	throttled := apierrors.NewTooManyRequests("slow down", 0)
+
+	tests := []struct {
+		name      string
+		errs      []error
+		retries   int
+		wantLists int
+		wantErr   metav1.StatusReason
+	}{
+		{name: "no error", retries: 3, wantLists: 1},
+		{name: "cache not started", errs: []error{&cache.ErrCacheNotStarted{}, &cache.ErrCacheNotStarted{}}, retries: 3, wantLists: 3},
+		{name: "throttled", errs: []error{throttled}, retries: 3, wantLists: 2},
+		{name: "unavailable", errs: []error{apierrors.NewServiceUnavailable("down"), apierrors.NewInternalError(errors.New("etcd"))}, retries: 3, wantLists: 3},
+		{name: "retries spent", errs: []error{throttled, throttled, throttled}, retries: 2, wantLists: 3, wantErr: metav1.StatusReasonTooManyRequests},
+		{name: "never retried", errs: []error{throttled}, retries: 0, wantLists: 1, wantErr: metav1.StatusReasonTooManyRequests},
+		{name: "forbidden", errs: []error{apierrors.NewForbidden(resource, "", errors.New("rbac"))}, retries: 3, wantLists: 1, wantErr: metav1.StatusReasonForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lists := 0
+			c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).
+				WithObjects(newSlice("default", "web-abc", "web", podEndpoint("uid-1", "web-1", "10.0.0.1"))).
+				WithInterceptorFuncs(interceptor.Funcs{List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+					lists++
+					if lists <= len(tt.errs) {
+						return tt.errs[lists-1]
+					}
+					return c.List(ctx, list, opts...)
+				}}).Build()
+			sink := &recordingSink{}
+			r := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", ListRetries: tt.retries, ListRetryBackoff: time.Millisecond}
+
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web-abc"}})
+			if (err != nil) != (tt.wantErr != "") || apierrors.ReasonForError(err) != tt.wantErr {
+				t.Fatalf("Reconcile() error = %v, want reason %q", err, tt.wantErr)
+			}
+			if lists != tt.wantLists {
+				t.Errorf("listed %d times, want %d", lists, tt.wantLists)
+			}
+			// A failed list syncs nothing, so it can't prune the rows.
+			switch {
+			case tt.wantErr != "" && len(sink.syncs) != 0:
+				t.Errorf("syncs = %v after a failed list, want none", sink.syncs)
+			case tt.wantErr == "" && (len(sink.syncs) != 1 || len(sink.last) != 1):
+				t.Errorf("syncs = %v of %d rows, want dev/default/web with its endpoint", sink.syncs, len(sink.last))
+			}
+		})
+	}
+}
+
+func TestListRetryDelay(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantReason string
+		wantDelay  time.Duration
+	}{
+		{name: "cache not started", err: &cache.ErrCacheNotStarted{}, wantReason: listRetryNotSynced, wantDelay: listNotSyncedDelay},
+		{name: "throttled", err: apierrors.NewTooManyRequests("slow down", 0), wantReason: listRetryAPIError, wantDelay: time.Second},
+		{name: "retry after", err: apierrors.NewTooManyRequests("slow down", 5), wantReason: listRetryAPIError, wantDelay: 5 * time.Second},
+		{name: "timeout", err: apierrors.NewTimeoutError("slow", 0), wantReason: listRetryAPIError, wantDelay: time.Second},
+		{name: "not found", err: apierrors.NewNotFound(schema.GroupResource{}, "web")},
+		{name: "other", err: errors.New("boom")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, delay := listRetryDelay(tt.err, time.Second)
+			if reason != tt.wantReason || delay != tt.wantDelay {
+				t.Errorf("listRetryDelay(%v) = %q, %s; want %q, %s", tt.err, reason, delay, tt.wantReason, tt.wantDelay)
+			}
+		})
+	}
+}
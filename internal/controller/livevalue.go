@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// liveValueInterval is how often a LiveValue re-reads its file. Kubelet
+// only refreshes a mounted ConfigMap about once a minute anyway.
+const liveValueInterval = 10 * time.Second
+
+// LiveValue is a setting read from a file that may change while the
+// observer runs, e.g. a mounted ConfigMap (--cluster=@/path,
+// --table=@/path). Start re-reads the file; Get returns the latest content
+// that passed Validate, trimmed of surrounding whitespace. A file that is
+// missing, empty or invalid keeps the previous value. A nil *LiveValue has
+// no value; see Or.
+type LiveValue struct {
+	Path string
+	// Validate, if set, rejects content that can't be used.
+	Validate func(string) error
+	// OnChange, if set, is called after the value changed.
+	OnChange func(value string)
+	Log      logr.Logger
+
+	value    atomic.Pointer[string]
+	interval time.Duration // liveValueInterval if zero
+}
+
+// LoadLiveValue reads the first value of the file at path.
+func LoadLiveValue(path string, validate func(string) error) (*LiveValue, error) {
+	v := &LiveValue{Path: path, Validate: validate}
+	value, err := v.read()
+	if err != nil {
+		return nil, err
+	}
+	v.value.Store(&value)
+	return v, nil
+}
+
+func (v *LiveValue) read() (string, error) {
+	b, err := os.ReadFile(v.Path)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSpace(string(b))
+	if value == "" {
+		return "", fmt.Errorf("%s is empty", v.Path)
+	}
+	if v.Validate != nil {
+		if err := v.Validate(value); err != nil {
+			return "", fmt.Errorf("%s: %w", v.Path, err)
+		}
+	}
+	return value, nil
+}
+
+// Get returns the current value.
+func (v *LiveValue) Get() string {
+	return *v.value.Load()
+}
+
+// Or returns the current value, or fallback for a nil v.
+func (v *LiveValue) Or(fallback string) string {
+	if v == nil {
+		return fallback
+	}
+	return v.Get()
+}
+
+// Start re-reads the file until ctx is done. It's a manager Runnable.
+func (v *LiveValue) Start(ctx context.Context) error {
+	interval := v.interval
+	if interval == 0 {
+		interval = liveValueInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			v.reload()
+		}
+	}
+}
+
+// reload reads the file once and stores a changed value.
+func (v *LiveValue) reload() {
+	value, err := v.read()
+	if err != nil {
+		v.Log.Error(err, "keeping the previous value", "value", v.Get())
+		return
+	}
+	if old := v.Get(); value != old {
+		v.value.Store(&value)
+		v.Log.Info("value changed", "path", v.Path, "old", old, "new", value)
+		if v.OnChange != nil {
+			v.OnChange(value)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func writeLiveFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLiveValue_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cluster")
+	writeLiveFile(t, path, "  dev\n")
+	noSpaces := func(s string) error {
+		if s == "bad name" {
+			return errors.New("bad")
+		}
+		return nil
+	}
+	v, err := LoadLiveValue(path, noSpaces)
+	if err != nil {
+		t.Fatalf("LoadLiveValue() error = %v", err)
+	}
+	v.Log = logr.Discard()
+	var changes []string
+	v.OnChange = func(value string) { changes = append(changes, value) }
+
+	tests := []struct {
+		name    string
+		content string // "" removes the file
+		want    string
+	}{
+		{name: "unchanged", content: "dev", want: "dev"},
+		{name: "changed", content: "prod\n", want: "prod"},
+		{name: "invalid keeps the value", content: "bad name", want: "prod"},
+		{name: "empty keeps the value", content: "\n", want: "prod"},
+		{name: "missing keeps the value", want: "prod"},
+		{name: "changed again", content: "staging", want: "staging"},
+	}
+	for _, tt := range tests {
+		if tt.content == "" {
+			os.Remove(path)
+		} else {
+			writeLiveFile(t, path, tt.content)
+		}
+		v.reload()
+		if got := v.Get(); got != tt.want {
+			t.Errorf("%s: Get() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if want := []string{"prod", "staging"}; !slices.Equal(changes, want) {
+		t.Errorf("OnChange values = %q, want %q", changes, want)
+	}
+}
+
+func TestLoadLiveValue_Errors(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty")
+	writeLiveFile(t, empty, " \n")
+	for _, path := range []string{filepath.Join(dir, "missing"), empty} {
+		if _, err := LoadLiveValue(path, nil); err == nil {
+			t.Errorf("LoadLiveValue(%s) = nil error, want one", path)
+		}
+	}
+}
+
+func TestLiveValue_NilOr(t *testing.T) {
+	var v *LiveValue
+	if got := v.Or("dev"); got != "dev" {
+		t.Errorf("nil Or() = %q, want the fallback", got)
+	}
+}
+
+func TestEndpointSliceReconciler_ClusterFileChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cluster")
+	writeLiveFile(t, path, "dev")
+	clusterFile, err := LoadLiveValue(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clusterFile.Log = logr.Discard()
+
+	slice := newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1"))
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(slice).Build()
+	sink := &recordingSink{}
+	r := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "ignored", ClusterFile: clusterFile}
+	clusterFile.OnChange = func(string) { r.ForgetWrites() }
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web-a"}}
+
+	for range 2 {
+		if _, err := r.Reconcile(context.Background(), req); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+	}
+	writeLiveFile(t, path, "prod")
+	clusterFile.reload()
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if want := []string{"dev/default/web", "prod/default/web"}; !slices.Equal(sink.syncs, want) {
+		t.Errorf("syncs = %v, want %v: unchanged endpoints written once, then again under the new name", sink.syncs, want)
+	}
+}
@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/ealebed/observer/internal/version"
+)
+
+// Names of the controllers, the controller label of controller-runtime's
+// controller_runtime_* and workqueue_* metrics, which it registers in the
+// same registry. They are fixed so dashboards don't depend on --source.
+const (
+	endpointSliceControllerName = "endpointslice"
+	serviceControllerName       = "service"
+	nodeControllerName          = "node"
+	namespaceControllerName     = "namespace"
+)
+
+var rowsDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "observer_rows_deleted_total",
+	Help: "Rows pruned from the destination table because their endpoint went away.",
+}, []string{"namespace", "service"})
+
+var rowsCleared = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "observer_rows_cleared_total",
+	Help: "Rows kept with pod_ip cleared because their endpoint went away (--prune-action=clear).",
+}, []string{"namespace", "service"})
+
+// prunedRows is the counter of the rows pruned by action.
+func prunedRows(action string) *prometheus.CounterVec {
+	if action == PruneClear {
+		return rowsCleared
+	}
+	return rowsDeleted
+}
+
+var grpcWatchers = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "observer_grpc_watchers",
+	Help: "gRPC Watch streams currently subscribed (--grpc-bind-address).",
+})
+
+var grpcWatchersDropped = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "observer_grpc_watchers_dropped_total",
+	Help: "gRPC Watch streams ended because the subscriber fell too far behind.",
+})
+
+var listRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "observer_list_retries_total",
+	Help: "Lists of EndpointSlices or Endpoints retried by the reconciler, by reason.",
+}, []string{"reason"})
+
+// Reasons recorded in observer_slices_skipped_total.
+const (
+	skipNoServiceLabel = "no_service_label"
+	skipNoServiceOwner = "no_service_owner"
+	skipAddressType    = "unsupported_address_type"
+	skipCacheLag       = "cache_lag"
+)
+
+var slicesSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "observer_slices_skipped_total",
+	Help: "EndpointSlices ignored by the reconciler, by reason.",
+}, []string{"reason"})
+
+// Filters recorded in observer_slices_filtered_total.
+const (
+	filterSelector = "selector"
+	filterShard    = "shard"
+)
+
+var slicesFiltered = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "observer_slices_filtered_total",
+	Help: "EndpointSlices left out by a configured filter, by filter.",
+}, []string{"reason"})
+
+var endpointLimitExceeded = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "observer_endpoint_limit_exceeded_total",
+	Help: "Syncs skipped because the service had more endpoints than --max-endpoints-per-service.",
+}, []string{"namespace", "service"})
+
+var writeVerifyMismatch = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "observer_write_verify_mismatch_total",
+	Help: "Writes after which the service's row count differed from the rows written (--verify-writes).",
+}, []string{"namespace", "service"})
+
+var staleWritesSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "observer_stale_writes_skipped_total",
+	Help: "Writes skipped because the table already held rows of a newer sync of the service (--sync-version).",
+}, []string{"namespace", "service"})
+
+// Operations recorded in observer_mirror_write_errors_total.
+const (
+	mirrorOpSync   = "sync"
+	mirrorOpDelete = "delete"
+	mirrorOpPrune  = "prune" // of a deleted node or namespace; namespace and service may be empty
+)
+
+var mirrorWriteErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "observer_mirror_write_errors_total",
+	Help: "Writes to the mirror database (--pg-mirror-dsn) that failed, by operation.",
+}, []string{"namespace", "service", "op"})
+
+// Operations of observer_sink_errors_total.
+const (
+	sinkOpSync   = "sync"
+	sinkOpDelete = "delete"
+)
+
+var auxSinkErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "observer_sink_errors_total",
+	Help: "Writes to an auxiliary sink (webhook, Redis, Kafka, file, gRPC, CRD) that failed, first attempts and retries, by sink and operation.",
+}, []string{"sink", "op"})
+
+var pausedGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "observer_paused",
+	Help: "1 while writes are paused with POST /pause, else 0.",
+})
+
+// States recorded in observer_db_breaker_state.
+const (
+	breakerClosed   = 0
+	breakerOpen     = 1
+	breakerHalfOpen = 2
+)
+
+var breakerState = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "observer_db_breaker_state",
+	Help: "State of the database circuit breaker (--db-breaker-threshold): 0 closed, 1 open, 2 half-open (probing).",
+})
+
+var poolRecreations = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "observer_db_pool_recreations_total",
+	Help: "Postgres pools replaced after an error that left the previous one unusable.",
+})
+
+// Per-service gauges of the SyncStatus registry; a Service's series are
+// removed once it's deleted.
+var (
+	serviceEndpoints = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "observer_service_endpoints",
+		Help: "Endpoints written by the latest successful sync of the service.",
+	}, []string{"namespace", "service"})
+	serviceLastSync = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "observer_service_last_sync_timestamp_seconds",
+		Help: "Unix time of the latest successful sync of the service.",
+	}, []string{"namespace", "service"})
+	serviceSyncFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "observer_service_consecutive_sync_failures",
+		Help: "Syncs of the service that failed in a row since its latest successful one.",
+	}, []string{"namespace", "service"})
+	serviceEndpointStates = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "observer_endpoints",
+		Help: "Endpoints listed by the slices of the service at its latest sync, by state: ready, not_ready or terminating.",
+	}, []string{"namespace", "service", "state"})
+)
+
+// States of observer_endpoints.
+const (
+	stateReady       = "ready"
+	stateNotReady    = "not_ready"
+	stateTerminating = "terminating"
+)
+
+// buildInfo is always 1; its labels say what is running.
+var buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "observer_build_info",
+	Help: "Version of the running observer and the Go release it was built with.",
+}, []string{"version", "goversion"})
+
+func init() {
+	buildInfo.WithLabelValues(version.Version, version.GoVersion()).Set(1)
+	metrics.Registry.MustRegister(rowsDeleted, rowsCleared, slicesSkipped, slicesFiltered, endpointLimitExceeded, writeVerifyMismatch, staleWritesSkipped,
+		mirrorWriteErrors, auxSinkErrors, pausedGauge, breakerState, poolRecreations, serviceEndpoints, serviceLastSync, serviceSyncFailures, serviceEndpointStates, grpcWatchers, grpcWatchersDropped, listRetries, buildInfo)
+}
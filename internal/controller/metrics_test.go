@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// TestControllerRuntimeMetrics scrapes the registry the metrics server
+// serves after each controller has reconciled once, and expects
+// controller-runtime's per-controller metrics next to the observer's.
+func TestControllerRuntimeMetrics(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()
+	sink := &recordingSink{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := func(name string, r reconcile.Reconciler, obj client.Object) {
+		ctl, err := controller.NewUnmanaged(name, controller.Options{Reconciler: r, SkipNameValidation: boolPtr(true)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		events := make(chan event.GenericEvent, 1)
+		if err := ctl.Watch(source.Channel(events, &handler.EnqueueRequestForObject{})); err != nil {
+			t.Fatal(err)
+		}
+		go func() { _ = ctl.Start(ctx) }()
+		events <- event.GenericEvent{Object: obj}
+	}
+	start(endpointSliceControllerName, &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev"},
+		&discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-abc"}})
+	start(serviceControllerName, &ServiceReconciler{Client: c, Sink: sink, ClusterName: "dev", Tracker: NewSyncTracker()},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gone"}})
+
+	srv := httptest.NewServer(promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+	defer srv.Close()
+	scrape := func() string {
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	var want []string
+	for _, name := range []string{endpointSliceControllerName, serviceControllerName} {
+		label := `{controller="` + name + `"`
+		want = append(want,
+			"controller_runtime_reconcile_total"+label,
+			"controller_runtime_reconcile_time_seconds_count"+label,
+			"controller_runtime_reconcile_errors_total"+label,
+			"workqueue_depth"+label,
+			"workqueue_adds_total"+label,
+			"workqueue_retries_total"+label,
+			"workqueue_queue_duration_seconds_count"+label,
+		)
+	}
+	want = append(want, "observer_build_info{")
+
+	var body string
+	var missing []string
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		body, missing = scrape(), nil
+		for _, w := range want {
+			if !strings.Contains(body, w) {
+				missing = append(missing, w)
+			}
+		}
+		if len(missing) == 0 || time.Now().After(deadline) {
+			break
+		}
+	}
+	if len(missing) > 0 {
+		t.Errorf("scrape lacks %v", missing)
+	}
+}
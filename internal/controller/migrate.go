@@ -0,0 +1,243 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// migrationsTable records the schema version of each destination table, in
+// the table's schema.
+const migrationsTable = "observer_schema_migrations"
+
+// ErrSchemaTooNew is returned by Migrator when the table was migrated by a
+// newer observer than this one.
+var ErrSchemaTooNew = errors.New("table schema is newer than this observer")
+
+// migrationTarget is what a migration renders its statements for.
+type migrationTarget struct {
+	table       string // quoted identifier
+	base        string // unquoted table name, for index names
+	jsonb       bool
+	partitioned bool
+	region      bool
+}
+
+// migration is one numbered schema change. Its statements may differ with
+// the options (a JSONB table has no pod_ip), but each version means the
+// same change for every table.
+type migration struct {
+	version int
+	name    string
+	sql     func(t migrationTarget) []string
+}
+
+// addColumn adds a column of the columns row format; a JSONB table keeps it
+// in the payload.
+func addColumn(name, typ string) func(migrationTarget) []string {
+	return func(t migrationTarget) []string {
+		if t.jsonb {
+			return nil
+		}
+		return []string{fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s`, t.table, name, typ)}
+	}
+}
+
+// migrations are applied in order. Never change a released one; append.
+var migrations = []migration{
+	{1, "create table", createTable},
+	{2, "add pod_labels", addColumn("pod_labels", "jsonb")},
+	{3, "add owner", addColumn("owner", "text")},
+	{4, "add slice_names", addColumn("slice_names", "text[]")},
+	{5, "add address_type", addColumn("address_type", "text")},
+	{6, "add node_name", addColumn("node_name", "text")},
+	{7, "add sync_version", func(t migrationTarget) []string {
+		return []string{fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS sync_version bigint`, t.table)}
+	}},
+	{8, "add service_uid", addColumn("service_uid", "text")},
+	{9, "allow NULL pod_ip", func(t migrationTarget) []string {
+		if t.jsonb {
+			return nil
+		}
+		return []string{fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN pod_ip DROP NOT NULL`, t.table)}
+	}},
+	{10, "add addr", addColumn("addr", "text")},
+	{11, "add observer_instance", addColumn("observer_instance", "text")},
+}
+
+// SchemaVersion is the latest migration this observer knows.
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// createTable creates the table as the Readme describes it, if missing.
+func createTable(t migrationTarget) []string {
+	var cols []string
+	key := "cluster, namespace, service, pod_uid"
+	if t.region {
+		cols = append(cols, "region text NOT NULL")
+		key = "region, " + key
+	}
+	cols = append(cols, "cluster text NOT NULL", "namespace text NOT NULL", "service text NOT NULL", "pod_uid text NOT NULL")
+	if t.jsonb {
+		cols = append(cols, "payload jsonb NOT NULL")
+	} else {
+		cols = append(cols, "pod_name text", "pod_ip inet NOT NULL", "ready boolean NOT NULL DEFAULT true")
+	}
+	cols = append(cols, "first_seen timestamptz NOT NULL DEFAULT now()", "last_seen timestamptz NOT NULL DEFAULT now()",
+		"PRIMARY KEY ("+key+")")
+	create := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", t.table, strings.Join(cols, ", "))
+	if t.partitioned {
+		create += " PARTITION BY LIST (cluster)"
+	}
+	stmts := []string{
+		create,
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (namespace, service)`, pgx.Identifier{t.base + "_ns_svc"}.Sanitize(), t.table),
+	}
+	if !t.jsonb {
+		stmts = append(stmts, fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (pod_ip)`, pgx.Identifier{t.base + "_pod_ip"}.Sanitize(), t.table))
+	}
+	return stmts
+}
+
+// Migrator keeps TableName at the schema version of this observer
+// (--auto-migrate): it applies the migrations the table hasn't had yet, in
+// order, recording each in observer_schema_migrations. It refuses a table
+// already migrated past SchemaVersion, whose writes this observer might
+// get wrong. The options shape the statements: the columns (or JSONB) row
+// format, a region-led key and a table partitioned by cluster.
+type Migrator struct {
+	DB          DB
+	TableName   string
+	RowFormat   string
+	Region      bool
+	Partitioned bool
+	Log         logr.Logger
+}
+
+func (m *Migrator) target() (migrationTarget, string, error) {
+	ident, err := sanitizeTableIdent(m.TableName)
+	if err != nil {
+		return migrationTarget{}, "", err
+	}
+	schema, base := splitTableName(m.TableName)
+	versions := pgx.Identifier{migrationsTable}
+	if schema != nil {
+		versions = pgx.Identifier{*schema, migrationsTable}
+	}
+	t := migrationTarget{table: ident, base: base, jsonb: m.RowFormat == RowFormatJSONB, partitioned: m.Partitioned, region: m.Region}
+	return t, versions.Sanitize(), nil
+}
+
+// migrateLockKey is the advisory lock serializing the migrations of table
+// across replicas.
+func migrateLockKey(table string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte("observer/migrate/" + table))
+	return int64(h.Sum64())
+}
+
+// Migrate applies the pending migrations in one transaction.
+func (m *Migrator) Migrate(ctx context.Context) error {
+	t, versions, err := m.target()
+	if err != nil {
+		return err
+	}
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, migrateLockKey(t.table)); err != nil {
+		return fmt.Errorf("lock migrations of %s: %w", t.table, err)
+	}
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	  table_name text        NOT NULL,
+	  version    integer     NOT NULL,
+	  name       text        NOT NULL,
+	  applied_at timestamptz NOT NULL DEFAULT now(),
+	  PRIMARY KEY (table_name, version)
+	)`, versions)); err != nil {
+		return fmt.Errorf("create %s: %w", versions, err)
+	}
+	current, err := currentVersion(ctx, tx, versions, t.table)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(t.table, current); err != nil {
+		return err
+	}
+
+	for _, mg := range migrations {
+		if mg.version <= current {
+			continue
+		}
+		for _, stmt := range mg.sql(t) {
+			if _, err := tx.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("migration %d (%s) of %s: %w", mg.version, mg.name, t.table, err)
+			}
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (table_name, version, name) VALUES ($1, $2, $3)`, versions),
+			t.table, mg.version, mg.name); err != nil {
+			return fmt.Errorf("record migration %d of %s: %w", mg.version, t.table, err)
+		}
+		m.Log.Info("applied schema migration", "table", t.table, "version", mg.version, "name", mg.name)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	if current == SchemaVersion() {
+		m.Log.V(1).Info("schema up to date", "table", t.table, "version", current)
+	}
+	return nil
+}
+
+// Check only refuses a table migrated past SchemaVersion; it changes
+// nothing. A database without observer_schema_migrations was never
+// migrated and passes.
+func (m *Migrator) Check(ctx context.Context) error {
+	t, versions, err := m.target()
+	if err != nil {
+		return err
+	}
+	current, err := currentVersion(ctx, m.DB, versions, t.table)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "42P01" { // undefined_table
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return checkVersion(t.table, current)
+}
+
+// querier is the part of DB and pgx.Tx that currentVersion needs.
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// currentVersion reads the latest migration recorded for table; 0 is none.
+func currentVersion(ctx context.Context, q querier, versions, table string) (int, error) {
+	var v *int
+	if err := q.QueryRow(ctx, fmt.Sprintf(`SELECT max(version) FROM %s WHERE table_name = $1`, versions), table).Scan(&v); err != nil {
+		return 0, fmt.Errorf("read schema version of %s: %w", table, err)
+	}
+	if v == nil {
+		return 0, nil
+	}
+	return *v, nil
+}
+
+func checkVersion(table string, current int) error {
+	if current > SchemaVersion() {
+		return fmt.Errorf("%w: %s is at version %d, this observer knows up to %d", ErrSchemaTooNew, table, current, SchemaVersion())
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// versionDB is a fakeDB whose observer_schema_migrations holds version, or
+// is missing with a nil version.
+func versionDB(version *int) *fakeDB {
+	return &fakeDB{queryFn: func(sql string, _ []any) ([][]any, error) {
+		if !strings.Contains(sql, "max(version)") {
+			return nil, nil
+		}
+		if version == nil {
+			return nil, &pgconn.PgError{Code: "42P01"}
+		}
+		if *version == 0 {
+			return [][]any{{nil}}, nil
+		}
+		return [][]any{{version}}, nil
+	}}
+}
+
+func TestMigrator_Migrate(t *testing.T) {
+	tests := []struct {
+		name      string
+		migrator  Migrator
+		current   int
+		wantDDL   []string // statements after the lock and the versions table
+		wantSaved []int    // versions recorded
+	}{
+		{
+			name:     "fresh table",
+			migrator: Migrator{TableName: "public.server"},
+			wantDDL: []string{
+				`CREATE TABLE IF NOT EXISTS "public"."server" (cluster text NOT NULL, namespace text NOT NULL, service text NOT NULL, ` +
+					`pod_uid text NOT NULL, pod_name text, pod_ip inet NOT NULL, ready boolean NOT NULL DEFAULT true, ` +
+					`first_seen timestamptz NOT NULL DEFAULT now(), last_seen timestamptz NOT NULL DEFAULT now(), ` +
+					`PRIMARY KEY (cluster, namespace, service, pod_uid))`,
+				`CREATE INDEX IF NOT EXISTS "server_ns_svc" ON "public"."server" (namespace, service)`,
+				`CREATE INDEX IF NOT EXISTS "server_pod_ip" ON "public"."server" (pod_ip)`,
+				`ALTER TABLE "public"."server" ADD COLUMN IF NOT EXISTS pod_labels jsonb`,
+				`ALTER TABLE "public"."server" ADD COLUMN IF NOT EXISTS owner text`,
+				`ALTER TABLE "public"."server" ADD COLUMN IF NOT EXISTS slice_names text[]`,
+				`ALTER TABLE "public"."server" ADD COLUMN IF NOT EXISTS address_type text`,
+				`ALTER TABLE "public"."server" ADD COLUMN IF NOT EXISTS node_name text`,
+				`ALTER TABLE "public"."server" ADD COLUMN IF NOT EXISTS sync_version bigint`,
+				`ALTER TABLE "public"."server" ADD COLUMN IF NOT EXISTS service_uid text`,
+				`ALTER TABLE "public"."server" ALTER COLUMN pod_ip DROP NOT NULL`,
+				`ALTER TABLE "public"."server" ADD COLUMN IF NOT EXISTS addr text`,
+				`ALTER TABLE "public"."server" ADD COLUMN IF NOT EXISTS observer_instance text`,
+			},
+			wantSaved: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+		},
+		{
+			name:     "partly migrated",
+			migrator: Migrator{TableName: "public.server"},
+			current:  5,
+			wantDDL: []string{
+				`ALTER TABLE "public"."server" ADD COLUMN IF NOT EXISTS node_name text`,
+				`ALTER TABLE "public"."server" ADD COLUMN IF NOT EXISTS sync_version bigint`,
+				`ALTER TABLE "public"."server" ADD COLUMN IF NOT EXISTS service_uid text`,
+				`ALTER TABLE "public"."server" ALTER COLUMN pod_ip DROP NOT NULL`,
+				`ALTER TABLE "public"."server" ADD COLUMN IF NOT EXISTS addr text`,
+				`ALTER TABLE "public"."server" ADD COLUMN IF NOT EXISTS observer_instance text`,
+			},
+			wantSaved: []int{6, 7, 8, 9, 10, 11},
+		},
+		{
+			name:     "up to date",
+			migrator: Migrator{TableName: "public.server"},
+			current:  SchemaVersion(),
+		},
+		{
+			name:     "jsonb, region and partitioned",
+			migrator: Migrator{TableName: "server", RowFormat: RowFormatJSONB, Region: true, Partitioned: true},
+			wantDDL: []string{
+				`CREATE TABLE IF NOT EXISTS "server" (region text NOT NULL, cluster text NOT NULL, namespace text NOT NULL, ` +
+					`service text NOT NULL, pod_uid text NOT NULL, payload jsonb NOT NULL, ` +
+					`first_seen timestamptz NOT NULL DEFAULT now(), last_seen timestamptz NOT NULL DEFAULT now(), ` +
+					`PRIMARY KEY (region, cluster, namespace, service, pod_uid)) PARTITION BY LIST (cluster)`,
+				`CREATE INDEX IF NOT EXISTS "server_ns_svc" ON "server" (namespace, service)`,
+				`ALTER TABLE "server" ADD COLUMN IF NOT EXISTS sync_version bigint`,
+			},
+			// The column migrations are no-ops for JSONB but still recorded.
+			wantSaved: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := versionDB(&tt.current)
+			m := tt.migrator
+			m.DB, m.Log = db, logr.Discard()
+			if err := m.Migrate(context.Background()); err != nil {
+				t.Fatalf("Migrate() error = %v", err)
+			}
+
+			var ddl []string
+			var saved []int
+			for i, e := range db.execs {
+				switch {
+				case !e.inTx:
+					t.Errorf("statement %s outside the transaction", e.sql)
+				case i == 0:
+					if !strings.Contains(e.sql, "pg_advisory_xact_lock") {
+						t.Errorf("first statement = %s, want the advisory lock", e.sql)
+					}
+				case i == 1:
+					if !strings.Contains(e.sql, "observer_schema_migrations") {
+						t.Errorf("second statement = %s, want the versions table", e.sql)
+					}
+				case strings.HasPrefix(e.sql, "INSERT INTO"):
+					saved = append(saved, e.args[1].(int))
+				default:
+					ddl = append(ddl, e.sql)
+				}
+			}
+			if !slices.Equal(ddl, tt.wantDDL) {
+				t.Errorf("DDL =\n%s\nwant\n%s", strings.Join(ddl, "\n"), strings.Join(tt.wantDDL, "\n"))
+			}
+			if !slices.Equal(saved, tt.wantSaved) {
+				t.Errorf("recorded versions = %v, want %v", saved, tt.wantSaved)
+			}
+			if db.commits != 1 {
+				t.Errorf("commits = %d, want 1", db.commits)
+			}
+		})
+	}
+}
+
+func TestMigrator_VersionsTableInTableSchema(t *testing.T) {
+	db := versionDB(new(int))
+	m := &Migrator{DB: db, TableName: "team.endpoints", Log: logr.Discard()}
+	if err := m.Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if got := db.statements(`INSERT INTO "team"."observer_schema_migrations"`); len(got) != SchemaVersion() || got[0].args[0] != `"team"."endpoints"` {
+		t.Errorf("recorded = %+v, want every version of team.endpoints in team.observer_schema_migrations", got)
+	}
+}
+
+func TestMigrator_RefusesNewerSchema(t *testing.T) {
+	newer := SchemaVersion() + 1
+	db := versionDB(&newer)
+	m := &Migrator{DB: db, TableName: "public.server", Log: logr.Discard()}
+
+	err := m.Migrate(context.Background())
+	if !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("Migrate() error = %v, want ErrSchemaTooNew", err)
+	}
+	if ddl := db.statements("ALTER TABLE"); len(ddl) != 0 || db.commits != 0 || db.rollbacks != 1 {
+		t.Errorf("ALTERs %v, commits %d, rollbacks %d; want nothing applied and the transaction rolled back", ddl, db.commits, db.rollbacks)
+	}
+	if err := m.Check(context.Background()); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Check() error = %v, want ErrSchemaTooNew", err)
+	}
+}
+
+func TestMigrator_Check(t *testing.T) {
+	current, older := SchemaVersion(), 1
+	for name, version := range map[string]*int{"never migrated": nil, "current": &current, "older": &older} {
+		t.Run(name, func(t *testing.T) {
+			db := versionDB(version)
+			m := &Migrator{DB: db, TableName: "public.server", Log: logr.Discard()}
+			if err := m.Check(context.Background()); err != nil {
+				t.Errorf("Check() error = %v", err)
+			}
+			if len(db.execs) != 0 {
+				t.Errorf("Check() ran %+v, want no writes", db.execs)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"fmt"
+	"path"
+)
+
+// NameFilter admits names by allow and deny lists of glob patterns (see
+// path.Match), e.g. "kube-*". Deny takes precedence over Allow, and an
+// empty Allow admits every name not denied. The zero value admits all.
+type NameFilter struct {
+	Allow []string
+	Deny  []string
+}
+
+// Allows reports whether name passes the filter.
+func (f NameFilter) Allows(name string) bool {
+	if matchAny(f.Deny, name) {
+		return false
+	}
+	return len(f.Allow) == 0 || matchAny(f.Allow, name)
+}
+
+// Validate reports the first malformed pattern.
+func (f NameFilter) Validate() error {
+	for _, p := range append(append([]string{}, f.Allow...), f.Deny...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
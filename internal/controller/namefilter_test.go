@@ -0,0 +1,59 @@
+package controller
+
+import "testing"
+
+func TestNameFilter_Allows(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter NameFilter
+		want   map[string]bool
+	}{
+		{
+			name: "zero value allows all",
+			want: map[string]bool{"default": true, "kube-system": true},
+		},
+		{
+			name:   "deny only",
+			filter: NameFilter{Deny: []string{"kube-*"}},
+			want:   map[string]bool{"default": true, "kube-system": false, "kube-public": false, "my-kube-ns": true},
+		},
+		{
+			name:   "allow only",
+			filter: NameFilter{Allow: []string{"team-*", "default"}},
+			want:   map[string]bool{"default": true, "team-a": true, "team-": true, "other": false},
+		},
+		{
+			name:   "deny wins over allow",
+			filter: NameFilter{Allow: []string{"team-*"}, Deny: []string{"team-legacy*"}},
+			want:   map[string]bool{"team-a": true, "team-legacy": false, "team-legacy-2": false, "default": false},
+		},
+		{
+			name:   "exact deny of an allowed name",
+			filter: NameFilter{Allow: []string{"web"}, Deny: []string{"web"}},
+			want:   map[string]bool{"web": false},
+		},
+		{
+			name:   "single character and class globs",
+			filter: NameFilter{Allow: []string{"web-?", "db-[0-9]"}},
+			want:   map[string]bool{"web-a": true, "web-ab": false, "db-1": true, "db-x": false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, want := range tt.want {
+				if got := tt.filter.Allows(name); got != want {
+					t.Errorf("Allows(%q) = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNameFilter_Validate(t *testing.T) {
+	if err := (NameFilter{Allow: []string{"team-*"}, Deny: []string{"kube-?", "[a-c]*"}}).Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	if err := (NameFilter{Deny: []string{"ok", "[a-"}}).Validate(); err == nil {
+		t.Error("Validate() accepted a malformed pattern")
+	}
+}
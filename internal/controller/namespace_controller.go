@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// NamespaceReconciler deletes every row of a Namespace once it is deleted
+// (--watch-namespaces). The ServiceReconciler prunes each Service as its
+// delete event comes in, but one missed while the observer was down isn't
+// replayed, and the Sweeper only catches such rows on its next pass, if at
+// all. This prunes them as soon as their whole namespace is gone. Like the
+// NodeReconciler, only TableName is pruned.
+type NamespaceReconciler struct {
+	client.Client
+	DB DB
+	// Mirror, if set, is pruned the same way once DB is (--pg-mirror-dsn).
+	// A failed mirror prune is counted and retried like a failed one of DB.
+	Mirror    DB
+	TableName string
+	// TableFile, if set, replaces TableName with its current value
+	// (--table=@file).
+	TableFile   *LiveValue
+	ClusterName string
+	// ClusterFile, if set, replaces ClusterName with its current value.
+	ClusterFile *LiveValue
+	// Region, if set, limits pruning to the rows of this region, the
+	// PostgresSink.Region of the reconcilers.
+	Region string
+	// StatementTimeout bounds each prune; zero is no limit.
+	StatementTimeout time.Duration
+	// PruneAction is the PostgresSink.PruneAction of the reconcilers.
+	PruneAction string
+	// Tracker and Status, if set, forget the services pruned, as does
+	// Slices, so they are written again if recreated.
+	Tracker *SyncTracker
+	Status  *SyncStatus
+	Slices  *EndpointSliceReconciler
+	// Pause, while paused, makes every reconcile requeue without writing.
+	Pause *Pause
+}
+
+func (r *NamespaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithValues("namespace", req.Name)
+	if r.Pause.Paused() {
+		logger.V(2).Info("writes paused, requeueing")
+		return ctrl.Result{RequeueAfter: pausedRequeueDelay}, nil
+	}
+
+	var ns corev1.Namespace
+	err := r.Get(ctx, req.NamespacedName, &ns)
+	if client.IgnoreNotFound(err) != nil {
+		return ctrl.Result{}, fmt.Errorf("get namespace %s: %w", req.Name, err)
+	}
+	if err == nil { // created again under the same name
+		return ctrl.Result{}, nil
+	}
+
+	deleted, err := r.pruneNamespace(ctx, r.DB, req.Name)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("prune rows of namespace %s: %w", req.Name, err)
+	}
+	for key, n := range deleted {
+		prunedRows(r.PruneAction).WithLabelValues(key.Namespace, key.Name).Add(float64(n))
+		r.Tracker.Forget(key.Namespace, key.Name)
+		r.Status.Forget(key.Namespace, key.Name)
+		r.Slices.ForgetService(key.Namespace, key.Name)
+		logger.Info("pruned rows of a deleted namespace", "service", key.Name, "pruned", n)
+	}
+	if r.Mirror == nil {
+		return ctrl.Result{}, nil
+	}
+	// A retry prunes DB again, which by then finds nothing.
+	if deleted, err = r.pruneNamespace(ctx, r.Mirror, req.Name); err != nil {
+		mirrorWriteErrors.WithLabelValues(req.Name, "", mirrorOpPrune).Inc()
+		return ctrl.Result{}, fmt.Errorf("prune mirror rows of namespace %s: %w", req.Name, err)
+	}
+	for key, n := range deleted {
+		logger.Info("pruned mirror rows of a deleted namespace", "service", key.Name, "pruned", n)
+	}
+	return ctrl.Result{}, nil
+}
+
+// pruneNamespace prunes the rows of namespace in db and returns how many it
+// pruned per {namespace,service}.
+func (r *NamespaceReconciler) pruneNamespace(ctx context.Context, db DB, namespace string) (map[types.NamespacedName]int, error) {
+	tbl, err := sanitizeTableIdent(r.TableFile.Or(r.TableName))
+	if err != nil {
+		return nil, err
+	}
+	if r.StatementTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.StatementTimeout)
+		defer cancel()
+	}
+	region, rargs := regionCond(r.Region, 3)
+	q := pruneStatement(r.PruneAction, tbl, "cluster = $1 AND namespace = $2"+region, "namespace, service")
+	rows, err := db.Query(ctx, q, append([]any{r.ClusterFile.Or(r.ClusterName), namespace}, rargs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deleted := map[types.NamespacedName]int{}
+	for rows.Next() {
+		var key types.NamespacedName
+		if err := rows.Scan(&key.Namespace, &key.Name); err != nil {
+			return nil, err
+		}
+		deleted[key]++
+	}
+	return deleted, rows.Err()
+}
+
+func (r *NamespaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(namespaceControllerName).
+		For(&corev1.Namespace{}, builder.WithPredicates(deletionsOnly())).
+		WithOptions(controller.Options{MaxConcurrentReconciles: 1}).
+		Complete(r)
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestNamespaceReconciler_PrunesDeletedNamespace(t *testing.T) {
+	tests := []struct {
+		name     string
+		region   string
+		wantSQL  string
+		wantArgs []any
+	}{
+		{
+			name:     "cluster",
+			wantSQL:  `DELETE FROM "public"."server" WHERE cluster = $1 AND namespace = $2 RETURNING namespace, service`,
+			wantArgs: []any{"dev", "shop"},
+		},
+		{
+			name:     "region",
+			region:   "eu-west",
+			wantSQL:  `DELETE FROM "public"."server" WHERE cluster = $1 AND namespace = $2 AND region = $3 RETURNING namespace, service`,
+			wantArgs: []any{"dev", "shop", "eu-west"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()
+			var queries []execCall
+			db := &fakeDB{queryFn: func(sql string, args []any) ([][]any, error) {
+				queries = append(queries, execCall{sql: sql, args: args})
+				return [][]any{{"shop", "web"}, {"shop", "web"}, {"shop", "cart"}}, nil
+			}}
+			tracker, status := NewSyncTracker(), NewSyncStatus()
+			for _, svc := range []string{"web", "cart"} {
+				tracker.Record("shop", svc)
+				status.Succeeded("shop", svc, 1)
+			}
+			tracker.Record("other", "db")
+			sliceReconciler := &EndpointSliceReconciler{}
+			web := types.NamespacedName{Namespace: "shop", Name: "web"}
+			sliceReconciler.serviceSnapshots().put(web, map[string]endpointRow{"uid-1": {UID: "uid-1"}})
+			r := &NamespaceReconciler{
+				Client: c, DB: db, TableName: "public.server", ClusterName: "dev", Region: tt.region,
+				Tracker: tracker, Status: status, Slices: sliceReconciler,
+			}
+			before := testutil.ToFloat64(rowsDeleted.WithLabelValues("shop", "web"))
+
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "shop"}}); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if len(queries) != 1 || queries[0].sql != tt.wantSQL || !slices.Equal(queries[0].args, tt.wantArgs) {
+				t.Fatalf("queries = %+v, want %s with %v", queries, tt.wantSQL, tt.wantArgs)
+			}
+			if got := testutil.ToFloat64(rowsDeleted.WithLabelValues("shop", "web")) - before; got != 2 {
+				t.Errorf("observer_rows_deleted_total{shop,web} grew by %v, want 2", got)
+			}
+			if got := tracker.snapshot(0).Services; len(got) != 1 || got[0].Namespace != "other" {
+				t.Errorf("tracked services = %+v, want only other/db", got)
+			}
+			if got := status.snapshot(); len(got) != 0 {
+				t.Errorf("service status = %+v, want the pruned services forgotten", got)
+			}
+			if _, known := sliceReconciler.serviceSnapshots().get(web); known {
+				t.Errorf("snapshot of %s kept, want it forgotten so a recreated service is written", web)
+			}
+		})
+	}
+}
+
+func TestNamespaceReconciler_Mirror(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()
+	var pruned []string
+	prune := func(name string) *fakeDB {
+		return &fakeDB{queryFn: func(_ string, args []any) ([][]any, error) {
+			pruned = append(pruned, name+"/"+args[1].(string))
+			return [][]any{{"shop", "web"}}, nil
+		}}
+	}
+	r := &NamespaceReconciler{Client: c, DB: prune("primary"), Mirror: prune("mirror"), TableName: "server", ClusterName: "dev"}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "shop"}}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if want := []string{"primary/shop", "mirror/shop"}; !slices.Equal(pruned, want) {
+		t.Errorf("pruned %v, want %v", pruned, want)
+	}
+}
+
+func TestNamespaceReconciler_Skips(t *testing.T) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop"}}
+	paused := &Pause{}
+	paused.Set(true)
+	defer paused.Set(false)
+
+	tests := []struct {
+		name        string
+		objects     []client.Object
+		pause       *Pause
+		wantRequeue bool
+	}{
+		{name: "namespace created again", objects: []client.Object{ns}},
+		{name: "paused", pause: paused, wantRequeue: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(tt.objects...).Build()
+			db := &fakeDB{queryFn: func(sql string, _ []any) ([][]any, error) {
+				t.Errorf("unexpected query %s", sql)
+				return nil, nil
+			}}
+			r := &NamespaceReconciler{Client: c, DB: db, TableName: "server", ClusterName: "dev", Pause: tt.pause}
+			res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "shop"}})
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if (res.RequeueAfter > 0) != tt.wantRequeue {
+				t.Errorf("RequeueAfter = %v, want requeue: %v", res.RequeueAfter, tt.wantRequeue)
+			}
+		})
+	}
+}
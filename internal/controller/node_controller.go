@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// NodeReconciler deletes the rows of the endpoints on a Node as soon as the
+// Node is deleted (--watch-nodes). After an ungraceful node loss its pods'
+// endpoints can linger in the slices for a while; this prunes them without
+// waiting for the EndpointSlice controller. Rows carry their node in the
+// node_name column (PostgresSink.NodeName). Like the Sweeper, only
+// TableName is pruned, not per-service tables.
+type NodeReconciler struct {
+	client.Client
+	DB DB
+	// Mirror, if set, is pruned the same way once DB is (--pg-mirror-dsn).
+	// A failed mirror prune is counted and retried like a failed one of DB.
+	Mirror    DB
+	TableName string
+	// TableFile, if set, replaces TableName with its current value
+	// (--table=@file).
+	TableFile   *LiveValue
+	ClusterName string
+	// ClusterFile, if set, replaces ClusterName with its current value.
+	ClusterFile *LiveValue
+	// Region, if set, limits pruning to the rows of this region, the
+	// PostgresSink.Region of the reconcilers.
+	Region string
+	// StatementTimeout bounds each prune; zero is no limit.
+	StatementTimeout time.Duration
+	// PruneAction is the PostgresSink.PruneAction of the reconcilers.
+	PruneAction string
+	// Pause, while paused, makes every reconcile requeue without writing.
+	Pause *Pause
+}
+
+func (r *NodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithValues("node", req.Name)
+	if r.Pause.Paused() {
+		logger.V(2).Info("writes paused, requeueing")
+		return ctrl.Result{RequeueAfter: pausedRequeueDelay}, nil
+	}
+
+	var node corev1.Node
+	err := r.Get(ctx, req.NamespacedName, &node)
+	if client.IgnoreNotFound(err) != nil {
+		return ctrl.Result{}, fmt.Errorf("get node %s: %w", req.Name, err)
+	}
+	if err == nil { // registered again under the same name
+		return ctrl.Result{}, nil
+	}
+
+	deleted, err := r.pruneNode(ctx, r.DB, req.Name)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("prune rows of node %s: %w", req.Name, err)
+	}
+	for key, n := range deleted {
+		prunedRows(r.PruneAction).WithLabelValues(key.Namespace, key.Name).Add(float64(n))
+		logger.Info("pruned rows of a deleted node", "namespace", key.Namespace, "service", key.Name, "pruned", n)
+	}
+	if r.Mirror == nil {
+		return ctrl.Result{}, nil
+	}
+	// A retry prunes DB again, which by then finds nothing.
+	if deleted, err = r.pruneNode(ctx, r.Mirror, req.Name); err != nil {
+		mirrorWriteErrors.WithLabelValues("", "", mirrorOpPrune).Inc()
+		return ctrl.Result{}, fmt.Errorf("prune mirror rows of node %s: %w", req.Name, err)
+	}
+	for key, n := range deleted {
+		logger.Info("pruned mirror rows of a deleted node", "namespace", key.Namespace, "service", key.Name, "pruned", n)
+	}
+	return ctrl.Result{}, nil
+}
+
+// pruneNode prunes the rows of node in db and returns how many it pruned
+// per {namespace,service}.
+func (r *NodeReconciler) pruneNode(ctx context.Context, db DB, node string) (map[types.NamespacedName]int, error) {
+	tbl, err := sanitizeTableIdent(r.TableFile.Or(r.TableName))
+	if err != nil {
+		return nil, err
+	}
+	if r.StatementTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.StatementTimeout)
+		defer cancel()
+	}
+	region, rargs := regionCond(r.Region, 3)
+	q := pruneStatement(r.PruneAction, tbl, "cluster = $1 AND node_name = $2"+region, "namespace, service")
+	rows, err := db.Query(ctx, q, append([]any{r.ClusterFile.Or(r.ClusterName), node}, rargs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deleted := map[types.NamespacedName]int{}
+	for rows.Next() {
+		var key types.NamespacedName
+		if err := rows.Scan(&key.Namespace, &key.Name); err != nil {
+			return nil, err
+		}
+		deleted[key]++
+	}
+	return deleted, rows.Err()
+}
+
+func (r *NodeReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(nodeControllerName).
+		For(&corev1.Node{}, builder.WithPredicates(deletionsOnly())).
+		WithOptions(controller.Options{MaxConcurrentReconciles: 1}).
+		Complete(r)
+}
+
+// deletionsOnly keeps only deletions; the rows of a Node or Namespace that
+// still exists are the EndpointSlice controller's business.
+func deletionsOnly() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc:  func(event.CreateEvent) bool { return false },
+		UpdateFunc:  func(event.UpdateEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+}
@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestNodeReconciler_PrunesDeletedNode(t *testing.T) {
+	tests := []struct {
+		name     string
+		region   string
+		wantSQL  string
+		wantArgs []any
+	}{
+		{
+			name:     "cluster",
+			wantSQL:  `DELETE FROM "public"."server" WHERE cluster = $1 AND node_name = $2 RETURNING namespace, service`,
+			wantArgs: []any{"dev", "node-1"},
+		},
+		{
+			name:     "region",
+			region:   "eu-west",
+			wantSQL:  `DELETE FROM "public"."server" WHERE cluster = $1 AND node_name = $2 AND region = $3 RETURNING namespace, service`,
+			wantArgs: []any{"dev", "node-1", "eu-west"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()
+			var queries []execCall
+			db := &fakeDB{queryFn: func(sql string, args []any) ([][]any, error) {
+				queries = append(queries, execCall{sql: sql, args: args})
+				return [][]any{{"default", "web"}, {"default", "web"}, {"other", "db"}}, nil
+			}}
+			r := &NodeReconciler{Client: c, DB: db, TableName: "public.server", ClusterName: "dev", Region: tt.region}
+			before := testutil.ToFloat64(rowsDeleted.WithLabelValues("default", "web"))
+
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "node-1"}}); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if len(queries) != 1 || queries[0].sql != tt.wantSQL || !slices.Equal(queries[0].args, tt.wantArgs) {
+				t.Fatalf("queries = %+v, want %s with %v", queries, tt.wantSQL, tt.wantArgs)
+			}
+			if got := testutil.ToFloat64(rowsDeleted.WithLabelValues("default", "web")) - before; got != 2 {
+				t.Errorf("observer_rows_deleted_total{default,web} grew by %v, want 2", got)
+			}
+		})
+	}
+}
+
+// TestNodeReconciler_Mirror prunes the mirror after the primary, and retries
+// the reconcile if the mirror fails.
+func TestNodeReconciler_Mirror(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()
+	var primaryQueries, mirrorQueries int
+	db := &fakeDB{queryFn: func(string, []any) ([][]any, error) {
+		primaryQueries++
+		return nil, nil
+	}}
+	mirrorErr := errors.New("mirror down")
+	mirror := &fakeDB{queryFn: func(sql string, _ []any) ([][]any, error) {
+		if mirrorQueries++; mirrorErr != nil {
+			return nil, mirrorErr
+		}
+		if !strings.Contains(sql, "node_name = $2") {
+			t.Errorf("mirror prune = %s, want the node's rows", sql)
+		}
+		return [][]any{{"default", "web"}}, nil
+	}}
+	r := &NodeReconciler{Client: c, DB: db, Mirror: mirror, TableName: "server", ClusterName: "dev"}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "node-1"}}
+	before := testutil.ToFloat64(mirrorWriteErrors.WithLabelValues("", "", mirrorOpPrune))
+
+	if _, err := r.Reconcile(context.Background(), req); err == nil || !strings.Contains(err.Error(), "mirror") {
+		t.Fatalf("Reconcile() error = %v, want the mirror's", err)
+	}
+	if got := testutil.ToFloat64(mirrorWriteErrors.WithLabelValues("", "", mirrorOpPrune)) - before; got != 1 {
+		t.Errorf("observer_mirror_write_errors_total{op=prune} grew by %v, want 1", got)
+	}
+	mirrorErr = nil
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if primaryQueries != 2 || mirrorQueries != 2 {
+		t.Errorf("prunes: primary %d, mirror %d, want 2 of each", primaryQueries, mirrorQueries)
+	}
+}
+
+func TestNodeReconciler_Skips(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	paused := &Pause{}
+	paused.Set(true)
+	defer paused.Set(false)
+
+	tests := []struct {
+		name        string
+		objects     []client.Object
+		pause       *Pause
+		wantRequeue bool
+	}{
+		{name: "node registered again", objects: []client.Object{node}},
+		{name: "paused", pause: paused, wantRequeue: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(tt.objects...).Build()
+			db := &fakeDB{queryFn: func(sql string, _ []any) ([][]any, error) {
+				t.Errorf("unexpected query %s", sql)
+				return nil, nil
+			}}
+			r := &NodeReconciler{Client: c, DB: db, TableName: "server", ClusterName: "dev", Pause: tt.pause}
+			res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "node-1"}})
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if (res.RequeueAfter > 0) != tt.wantRequeue {
+				t.Errorf("RequeueAfter = %v, want requeue: %v", res.RequeueAfter, tt.wantRequeue)
+			}
+		})
+	}
+}
+
+func TestEndpointSliceReconciler_RecordNodeNames(t *testing.T) {
+	node := "node-1"
+	onNode := podEndpoint("uid-1", "web-1", "10.0.0.1")
+	onNode.NodeName = &node
+	slice := newSlice("default", "web-a", "web", onNode, podEndpoint("uid-2", "web-2", "10.0.0.2"))
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(slice).Build()
+	db := &fakeDB{}
+	r := &EndpointSliceReconciler{
+		Client:          c,
+		Sink:            &PostgresSink{DB: db, TableName: "server", NodeName: true},
+		ClusterName:     "dev",
+		RecordNodeNames: true,
+	}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web-a"}}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	ups := db.statements("INSERT INTO")
+	if len(ups) != 2 {
+		t.Fatalf("upserts = %+v, want one per endpoint", ups)
+	}
+	got := map[any]string{}
+	for _, u := range ups {
+		if !strings.Contains(u.sql, "last_seen, node_name)") {
+			t.Fatalf("upsert = %s, want node_name written", u.sql)
+		}
+		name := "NULL"
+		if s := u.args[len(u.args)-1].(*string); s != nil {
+			name = *s
+		}
+		got[u.args[3]] = name
+	}
+	if got["uid-1"] != "node-1" || got["uid-2"] != "NULL" {
+		t.Errorf("node_name by pod_uid = %v, want uid-1 on node-1 and uid-2 without a node", got)
+	}
+}
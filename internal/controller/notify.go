@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxNotifyPayload is the limit of a pg_notify payload: it must be
+// shorter than this many bytes.
+const maxNotifyPayload = 8000
+
+// endpointNotification is the payload of the pg_notify of a write, see
+// PostgresSink.NotifyChannel. Added lists the UIDs of the endpoints that
+// are new or changed and Removed those that went away, both in UID order;
+// the counts are always set. Truncated says the lists don't cover the
+// counts: they are left out of a payload that would be too long, and the
+// UIDs of rows pruned without a set to diff against aren't known.
+type endpointNotification struct {
+	Cluster      string   `json:"cluster"`
+	Namespace    string   `json:"namespace"`
+	Service      string   `json:"service"`
+	Added        []string `json:"added"`
+	Removed      []string `json:"removed"`
+	AddedCount   int      `json:"added_count"`
+	RemovedCount int      `json:"removed_count"`
+	Truncated    bool     `json:"truncated,omitempty"`
+}
+
+// notify sends the notification of op in tx if NotifyChannel is set,
+// unless op leaves the set of its service as last notified. A Delete
+// reports the pruned rows as removed. The first Sync of a service since
+// start-up has nothing to diff against: it reports all of its endpoints as
+// added and the pruned rows as removed.
+func (p *PostgresSink) notify(ctx context.Context, tx pgx.Tx, op writeOp, pruned int64) error {
+	if p.NotifyChannel == "" {
+		return nil
+	}
+	k := op.key
+	p.notifiedMu.Lock()
+	prev, known := p.notified[k]
+	p.notifiedMu.Unlock()
+	added, removed := diffRows(prev, op.rows)
+	n := endpointNotification{
+		Cluster: k.cluster, Namespace: k.namespace, Service: k.service,
+		Added: uids(added), Removed: uids(removed), AddedCount: len(added), RemovedCount: len(removed),
+	}
+	if !known || op.rows == nil {
+		n.RemovedCount = max(n.RemovedCount, int(pruned))
+	}
+	if n.AddedCount == 0 && n.RemovedCount == 0 {
+		return nil
+	}
+	n.Truncated = len(n.Removed) < n.RemovedCount
+	payload, err := json.Marshal(&n)
+	if err != nil {
+		return err
+	}
+	if len(payload) >= maxNotifyPayload {
+		n.Added, n.Removed, n.Truncated = []string{}, []string{}, true
+		if payload, err = json.Marshal(&n); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(ctx, `SELECT pg_notify($1, $2)`, p.NotifyChannel, string(payload))
+	return err
+}
+
+// recordNotified records the sets of the committed ops, except the stale ones,
+// as the last notified.
+func (p *PostgresSink) recordNotified(ops []writeOp, stale []bool) {
+	p.notifiedMu.Lock()
+	defer p.notifiedMu.Unlock()
+	for i, op := range ops {
+		switch {
+		case stale[i]:
+		case op.rows == nil:
+			delete(p.notified, op.key)
+		default:
+			if p.notified == nil {
+				p.notified = map[serviceKey]map[string]endpointRow{}
+			}
+			p.notified[op.key] = maps.Clone(op.rows)
+		}
+	}
+}
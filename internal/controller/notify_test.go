@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// notifications returns the payloads of the pg_notify calls db recorded.
+func notifications(t *testing.T, db *fakeDB) []endpointNotification {
+	t.Helper()
+	var out []endpointNotification
+	for _, e := range db.statements("pg_notify") {
+		if !e.inTx || len(e.args) != 2 || e.args[0] != "endpoints" {
+			t.Fatalf("pg_notify call %+v, want one on channel endpoints in the write's transaction", e)
+		}
+		var n endpointNotification
+		if err := json.Unmarshal([]byte(e.args[1].(string)), &n); err != nil {
+			t.Fatalf("payload %v: %v", e.args[1], err)
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+func TestPostgresSink_Notify(t *testing.T) {
+	db := &fakeDB{execFn: func(sql string, _ []any) (pgconn.CommandTag, error) {
+		if strings.HasPrefix(sql, "DELETE FROM") {
+			return pgconn.NewCommandTag("DELETE 1"), nil
+		}
+		return pgconn.NewCommandTag("OK 0"), nil
+	}}
+	sink := &PostgresSink{DB: db, TableName: "server", NotifyChannel: "endpoints"}
+	ctx := context.Background()
+	a := endpointRow{UID: "uid-a", IP: "10.0.0.1"}
+	b := endpointRow{UID: "uid-b", IP: "10.0.0.2"}
+	c := endpointRow{UID: "uid-c", IP: "10.0.0.3"}
+
+	steps := []struct {
+		name string
+		rows map[string]endpointRow // nil deletes the service
+		want *endpointNotification
+	}{
+		// Nothing to diff against yet: the rows pruned are the removed, of
+		// unknown UIDs.
+		{
+			name: "first sync", rows: map[string]endpointRow{a.UID: a, b.UID: b},
+			want: &endpointNotification{Added: []string{"uid-a", "uid-b"}, Removed: []string{}, AddedCount: 2, RemovedCount: 1, Truncated: true},
+		},
+		{name: "unchanged", rows: map[string]endpointRow{a.UID: a, b.UID: b}},
+		{
+			name: "one replaced", rows: map[string]endpointRow{a.UID: a, c.UID: c},
+			want: &endpointNotification{Added: []string{"uid-c"}, Removed: []string{"uid-b"}, AddedCount: 1, RemovedCount: 1},
+		},
+		{
+			name: "one moved", rows: map[string]endpointRow{a.UID: a, c.UID: {UID: c.UID, IP: "10.0.0.9"}},
+			want: &endpointNotification{Added: []string{"uid-c"}, Removed: []string{}, AddedCount: 1},
+		},
+		{
+			name: "deleted",
+			want: &endpointNotification{Added: []string{}, Removed: []string{"uid-a", "uid-c"}, RemovedCount: 2},
+		},
+	}
+	for _, step := range steps {
+		before := len(notifications(t, db))
+		var err error
+		if step.rows == nil {
+			err = sink.Delete(ctx, "dev", "default", "web")
+		} else {
+			err = sink.Sync(ctx, "dev", "default", "web", step.rows)
+		}
+		if err != nil {
+			t.Fatalf("%s: error = %v", step.name, err)
+		}
+		got := notifications(t, db)[before:]
+		if step.want == nil {
+			if len(got) != 0 {
+				t.Errorf("%s: notified %+v, want nothing", step.name, got)
+			}
+			continue
+		}
+		want := *step.want
+		want.Cluster, want.Namespace, want.Service = "dev", "default", "web"
+		if len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+			t.Errorf("%s: notified %+v, want %+v", step.name, got, want)
+		}
+	}
+}
+
+func TestPostgresSink_NotifyOff(t *testing.T) {
+	db := &fakeDB{}
+	sink := &PostgresSink{DB: db, TableName: "server"}
+	rows := map[string]endpointRow{"uid-a": {UID: "uid-a", IP: "10.0.0.1"}}
+	if err := sink.Sync(context.Background(), "dev", "default", "web", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := db.statements("pg_notify"); len(got) != 0 {
+		t.Errorf("pg_notify calls = %+v without a channel, want none", got)
+	}
+}
+
+// TestPostgresSink_NotifyFails checks a failed notify fails the write, and
+// that the set isn't taken as notified, so the retry notifies it.
+func TestPostgresSink_NotifyFails(t *testing.T) {
+	failing := true
+	db := &fakeDB{execFn: func(sql string, _ []any) (pgconn.CommandTag, error) {
+		if failing && strings.Contains(sql, "pg_notify") {
+			return pgconn.CommandTag{}, errFake
+		}
+		return pgconn.NewCommandTag("OK 0"), nil
+	}}
+	sink := &PostgresSink{DB: db, TableName: "server", NotifyChannel: "endpoints"}
+	rows := map[string]endpointRow{"uid-a": {UID: "uid-a", IP: "10.0.0.1"}}
+
+	err := sink.Sync(context.Background(), "dev", "default", "web", rows)
+	if err == nil || !strings.Contains(err.Error(), "notify default/web: ") {
+		t.Fatalf("Sync() error = %v, want the notify's", err)
+	}
+	if db.commits != 0 {
+		t.Errorf("commits = %d, want the write rolled back", db.commits)
+	}
+	failing = false
+	if err := sink.Sync(context.Background(), "dev", "default", "web", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := notifications(t, db); len(got) != 2 || !slices.Equal(got[1].Added, []string{"uid-a"}) {
+		t.Errorf("notified %+v, want the retry to notify the endpoint again", got)
+	}
+}
+
+// TestPostgresSink_NotifyTruncates changes more endpoints than their UIDs
+// fit in a payload: only the counts are sent.
+func TestPostgresSink_NotifyTruncates(t *testing.T) {
+	db := &fakeDB{}
+	sink := &PostgresSink{DB: db, TableName: "server", NotifyChannel: "endpoints"}
+	rows := map[string]endpointRow{}
+	for i := range 500 {
+		uid := fmt.Sprintf("0b3c5d1e-7f2a-4c6b-9d8e-%012d", i)
+		rows[uid] = endpointRow{UID: uid, IP: fmt.Sprintf("10.0.%d.%d", i/256, i%256)}
+	}
+	if err := sink.Sync(context.Background(), "dev", "default", "web", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	calls := db.statements("pg_notify")
+	if len(calls) != 1 || len(calls[0].args[1].(string)) >= maxNotifyPayload {
+		t.Fatalf("pg_notify calls = %d, want one with a payload under %d bytes", len(calls), maxNotifyPayload)
+	}
+	want := endpointNotification{Cluster: "dev", Namespace: "default", Service: "web", Added: []string{}, Removed: []string{}, AddedCount: 500, Truncated: true}
+	if got := notifications(t, db); !reflect.DeepEqual(got[0], want) {
+		t.Errorf("notified %+v, want %+v", got[0], want)
+	}
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// serviceOwner returns the Service controlling obj, the owner reference the
+// EndpointSlice controller sets on the slices it manages, or nil.
+func serviceOwner(obj metav1.Object) *metav1.OwnerReference {
+	ref := metav1.GetControllerOf(obj)
+	if ref == nil || ref.Kind != "Service" || ref.APIVersion != corev1.SchemeGroupVersion.String() {
+		return nil
+	}
+	return ref
+}
+
+// sliceService returns the name of the Service obj belongs to: its owner
+// with UseOwnerRef, else its service label. Empty means none.
+func (r *EndpointSliceReconciler) sliceService(obj metav1.Object) string {
+	if r.UseOwnerRef {
+		if ref := serviceOwner(obj); ref != nil {
+			return ref.Name
+		}
+		return ""
+	}
+	return obj.GetLabels()[r.serviceLabel()]
+}
+
+// serviceSlices lists the slices of service in namespace. By default those
+// are the slices carrying its service label. With UseOwnerRef they are the
+// slices owned by the Service's current UID, so leftovers of a Service
+// deleted and recreated under the same name don't count; ok is false if
+// the Service doesn't exist, in which case the ServiceReconciler deletes
+// its rows.
+func (r *EndpointSliceReconciler) serviceSlices(ctx context.Context, namespace, service string) (list *discoveryv1.EndpointSliceList, ok bool, err error) {
+	return r.serviceSlicesWith(ctx, r.list, namespace, service)
+}
+
+// serviceSlicesWith is serviceSlices with the slices listed through from.
+func (r *EndpointSliceReconciler) serviceSlicesWith(ctx context.Context, from listFunc, namespace, service string) (list *discoveryv1.EndpointSliceList, ok bool, err error) {
+	list = &discoveryv1.EndpointSliceList{}
+	if !r.UseOwnerRef {
+		err := r.listSlicesWith(ctx, from, list, client.InNamespace(namespace), client.MatchingLabels{r.serviceLabel(): service})
+		return list, true, err
+	}
+	uid, ok, err := r.serviceUID(ctx, types.NamespacedName{Namespace: namespace, Name: service})
+	if !ok || err != nil {
+		return list, ok, err
+	}
+	var all discoveryv1.EndpointSliceList
+	if err := r.listSlicesWith(ctx, from, &all, client.InNamespace(namespace)); err != nil {
+		return list, true, err
+	}
+	list.Items = ownedBy(all.Items, uid)
+	return list, true, nil
+}
+
+// serviceUID reads the UID of the Service key; ok is false if it doesn't
+// exist.
+func (r *EndpointSliceReconciler) serviceUID(ctx context.Context, key types.NamespacedName) (uid types.UID, ok bool, err error) {
+	var svc corev1.Service
+	if err := r.Get(ctx, key, &svc); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("get service %s: %w", key, err)
+	}
+	return svc.UID, true, nil
+}
+
+// ownedBy keeps the slices controlled by the Service of uid.
+func ownedBy(slices []discoveryv1.EndpointSlice, uid types.UID) []discoveryv1.EndpointSlice {
+	var out []discoveryv1.EndpointSlice
+	for i := range slices {
+		if ref := serviceOwner(&slices[i]); ref != nil && ref.UID == uid {
+			out = append(out, slices[i])
+		}
+	}
+	return out
+}
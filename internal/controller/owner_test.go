@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func newService(namespace, name, uid string) *corev1.Service {
+	return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: types.UID(uid)}}
+}
+
+// ownedSlice is a slice controlled by the Service name of uid. Unless label
+// is set it carries no service label, as a hand-crafted slice might.
+func ownedSlice(namespace, name, service, uid string, label bool, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	sl := newSlice(namespace, name, service, endpoints...)
+	if !label {
+		sl.Labels = nil
+	}
+	sl.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: "v1", Kind: "Service", Name: service, UID: types.UID(uid), Controller: boolPtr(true),
+	}}
+	return sl
+}
+
+func TestEndpointSliceReconciler_UseOwnerRef(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newService("default", "web", "web-uid"),
+		ownedSlice("default", "web-a", "web", "web-uid", false, podEndpoint("uid-1", "web-1", "10.0.0.1")),
+		// Claims web by label only.
+		newSlice("default", "spoofed", "web", podEndpoint("uid-2", "evil-1", "10.0.0.2")),
+		// Left over from a web deleted and recreated under the same name.
+		ownedSlice("default", "web-old", "web", "old-uid", true, podEndpoint("uid-3", "web-0", "10.0.0.3")),
+		// Owned by a Service that is gone.
+		ownedSlice("default", "db-a", "db", "db-uid", true, podEndpoint("uid-4", "db-1", "10.0.0.4")),
+	).Build()
+
+	tests := []struct {
+		name     string
+		slice    string
+		wantSync bool
+		wantSkip float64
+	}{
+		{name: "owned slice without label", slice: "web-a", wantSync: true},
+		{name: "slice of an older Service of the same name", slice: "web-old", wantSync: true},
+		{name: "label without owner", slice: "spoofed", wantSkip: 1},
+		{name: "owner gone", slice: "db-a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &recordingSink{}
+			r := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", UseOwnerRef: true}
+			skipped := slicesSkipped.WithLabelValues(skipNoServiceOwner)
+			before := testutil.ToFloat64(skipped)
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: tt.slice}}); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if got := testutil.ToFloat64(skipped) - before; got != tt.wantSkip {
+				t.Errorf("observer_slices_skipped_total{reason=%q} grew by %v, want %v", skipNoServiceOwner, got, tt.wantSkip)
+			}
+
+			if !tt.wantSync {
+				if len(sink.syncs) != 0 || len(sink.deletes) != 0 {
+					t.Errorf("syncs = %v, deletes = %v, want the slice skipped", sink.syncs, sink.deletes)
+				}
+				return
+			}
+			if !slices.Equal(sink.syncs, []string{"dev/default/web"}) {
+				t.Fatalf("syncs = %v, want dev/default/web", sink.syncs)
+			}
+			// Only the slice owned by the current web counts: neither the
+			// spoofed label nor the old UID's leftover.
+			if len(sink.last) != 1 || sink.last["uid-1"].Name != "web-1" {
+				t.Errorf("rows = %+v, want only uid-1", sink.last)
+			}
+		})
+	}
+}
+
+func TestEndpointSliceReconciler_SyncAllUseOwnerRef(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newService("default", "web", "web-uid"),
+		ownedSlice("default", "web-a", "web", "web-uid", false, podEndpoint("uid-1", "web-1", "10.0.0.1")),
+		ownedSlice("default", "web-b", "web", "web-uid", true, podEndpoint("uid-2", "web-2", "10.0.0.2")),
+		ownedSlice("default", "web-old", "web", "old-uid", true, podEndpoint("uid-3", "web-0", "10.0.0.3")),
+		newSlice("default", "spoofed", "api", podEndpoint("uid-4", "evil-1", "10.0.0.4")),
+		ownedSlice("default", "db-a", "db", "db-uid", true, podEndpoint("uid-5", "db-1", "10.0.0.5")),
+	).Build()
+	sink := &recordingSink{}
+	r := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", UseOwnerRef: true}
+
+	if err := r.SyncAll(context.Background(), ""); err != nil {
+		t.Fatalf("SyncAll() error = %v", err)
+	}
+	if !slices.Equal(sink.syncs, []string{"dev/default/web"}) {
+		t.Fatalf("syncs = %v, want only dev/default/web", sink.syncs)
+	}
+	if _, ok := sink.last["uid-3"]; len(sink.last) != 2 || ok {
+		t.Errorf("rows = %+v, want uid-1 and uid-2 of the current web", sink.last)
+	}
+}
+
+func TestEndpointSliceReconciler_RecordServiceUID(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newService("default", "web", "web-uid"),
+		ownedSlice("default", "web-a", "web", "web-uid", true, podEndpoint("uid-1", "web-1", "10.0.0.1")),
+		// The service label alone records no UID.
+		newSlice("default", "web-b", "web", podEndpoint("uid-2", "web-2", "10.0.0.2")),
+	).Build()
+	db := &fakeDB{}
+	r := &EndpointSliceReconciler{
+		Client:           c,
+		Sink:             &PostgresSink{DB: db, TableName: "server", ServiceUID: true},
+		ClusterName:      "dev",
+		RecordServiceUID: true,
+	}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web-a"}}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	ups := db.statements("INSERT INTO")
+	if len(ups) != 2 {
+		t.Fatalf("upserts = %+v, want one per endpoint", ups)
+	}
+	got := map[any]string{}
+	for _, u := range ups {
+		if !strings.Contains(u.sql, "last_seen, service_uid)") {
+			t.Fatalf("upsert = %s, want service_uid written", u.sql)
+		}
+		uid := "NULL"
+		if s := u.args[len(u.args)-1].(*string); s != nil {
+			uid = *s
+		}
+		got[u.args[3]] = uid
+	}
+	if got["uid-1"] != "web-uid" || got["uid-2"] != "NULL" {
+		t.Errorf("service_uid by pod_uid = %v, want web-uid for the owned slice only", got)
+	}
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// maxIdentLen is Postgres' NAMEDATALEN-1; longer identifiers are truncated
+// silently by the server, so we shorten them ourselves.
+const maxIdentLen = 63
+
+// PartitionTableName derives the per-cluster partition of table, e.g.
+// "public.server" and "eu-west.prod" give "public.server_eu_west_prod".
+// Characters outside [a-z0-9_] become '_' so the result stays a plain
+// identifier; names too long for Postgres are cut and suffixed with a hash
+// of the full name. Clusters differing only in such characters, like
+// "eu-west" and "eu_west", still share a name; EnsurePartition refuses the
+// partition of the second.
+func PartitionTableName(table, cluster string) (string, error) {
+	if table == "" {
+		table = "public.server"
+	}
+	if _, err := sanitizeTableIdent(table); err != nil {
+		return "", err
+	}
+	if cluster == "" {
+		return "", errors.New("partition needs a cluster name")
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(cluster) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+
+	dot := strings.LastIndexByte(table, '.')
+	prefix, base := table[:dot+1], table[dot+1:]
+	name := base + "_" + b.String()
+	if len(name) > maxIdentLen {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(base + "\x00" + cluster))
+		suffix := fmt.Sprintf("_%08x", h.Sum32())
+		name = name[:maxIdentLen-len(suffix)] + suffix
+	}
+	return prefix + name, nil
+}
+
+// EnsurePartition creates partition as the LIST partition of parent holding
+// cluster's rows, if it doesn't exist yet. parent must already be declared
+// PARTITION BY LIST (cluster). A partition that exists already must hold
+// cluster: one of another cluster whose name maps to the same partition
+// name is an error, not shared.
+func EnsurePartition(ctx context.Context, db DB, parent, partition, cluster string) error {
+	parentIdent, err := sanitizeTableIdent(parent)
+	if err != nil {
+		return err
+	}
+	partIdent, err := sanitizeTableIdent(partition)
+	if err != nil {
+		return err
+	}
+	lit, err := quoteLiteral(cluster)
+	if err != nil {
+		return err
+	}
+	// DDL takes no bind parameters, hence the quoted literal.
+	q := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES IN (%s)`, partIdent, parentIdent, lit)
+	if _, err := db.Exec(ctx, q); err != nil {
+		return fmt.Errorf("create partition %s: %w", partition, err)
+	}
+	var bound *string
+	q = `SELECT pg_get_expr(relpartbound, oid) FROM pg_class WHERE oid = to_regclass($1)`
+	if err := db.QueryRow(ctx, q, partIdent).Scan(&bound); err != nil {
+		return fmt.Errorf("check partition %s: %w", partition, err)
+	}
+	if want := "FOR VALUES IN (" + lit + ")"; bound == nil || *bound != want {
+		held := "no partition bound"
+		if bound != nil {
+			held = *bound
+		}
+		return fmt.Errorf("partition %s exists with %s, not %s: --cluster=%q maps to the partition name of another cluster", partition, held, want, cluster)
+	}
+	return nil
+}
+
+// quoteLiteral renders s as a standard-conforming SQL string literal.
+func quoteLiteral(s string) (string, error) {
+	if strings.ContainsRune(s, 0) {
+		return "", errors.New("literal must not contain NUL bytes")
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'", nil
+}
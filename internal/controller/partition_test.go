@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPartitionTableName(t *testing.T) {
+	long := strings.Repeat("c", 80)
+
+	tests := []struct {
+		name        string
+		table       string
+		cluster     string
+		expected    string
+		expectError bool
+	}{
+		{name: "simple", table: "server", cluster: "prod", expected: "server_prod"},
+		{name: "schema kept", table: "public.server", cluster: "prod", expected: "public.server_prod"},
+		{name: "default table", table: "", cluster: "prod", expected: "public.server_prod"},
+		{name: "three parts", table: "db.public.server", cluster: "prod", expected: "db.public.server_prod"},
+		{name: "dashes and dots replaced", table: "public.server", cluster: "eu-west.prod", expected: "public.server_eu_west_prod"},
+		{name: "lowercased", table: "public.server", cluster: "Prod", expected: "public.server_prod"},
+		{name: "quote replaced", table: "server", cluster: "o'brien", expected: "server_o_brien"},
+		{name: "empty cluster", table: "server", cluster: "", expectError: true},
+		{name: "invalid table", table: "public.", cluster: "prod", expectError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PartitionTableName(tt.table, tt.cluster)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("PartitionTableName(%q, %q) error = %v, expectError %v", tt.table, tt.cluster, err, tt.expectError)
+			}
+			if got != tt.expected {
+				t.Errorf("PartitionTableName(%q, %q) = %q, want %q", tt.table, tt.cluster, got, tt.expected)
+			}
+		})
+	}
+
+	t.Run("long names are cut with a distinguishing hash", func(t *testing.T) {
+		a, err := PartitionTableName("public.server", long+"a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := PartitionTableName("public.server", long+"b")
+		base := strings.TrimPrefix(a, "public.")
+		if len(base) != maxIdentLen {
+			t.Errorf("partition name %q is %d bytes, want %d", base, len(base), maxIdentLen)
+		}
+		if a == b {
+			t.Errorf("clusters differing only past the cut share partition %q", a)
+		}
+		if again, _ := PartitionTableName("public.server", long+"a"); again != a {
+			t.Errorf("derivation not stable: %q then %q", a, again)
+		}
+	})
+}
+
+// partitionDB answers the bound check of EnsurePartition with bound.
+func partitionDB(bound string) *fakeDB {
+	return &fakeDB{queryFn: func(sql string, _ []any) ([][]any, error) {
+		if !strings.Contains(sql, "pg_get_expr") {
+			return nil, nil
+		}
+		return [][]any{{&bound}}, nil
+	}}
+}
+
+func TestEnsurePartition(t *testing.T) {
+	db := partitionDB(`FOR VALUES IN ('o''brien')`)
+	if err := EnsurePartition(context.Background(), db, "public.server", "public.server_o_brien", "o'brien"); err != nil {
+		t.Fatalf("EnsurePartition() error = %v", err)
+	}
+	want := `CREATE TABLE IF NOT EXISTS "public"."server_o_brien" PARTITION OF "public"."server" FOR VALUES IN ('o''brien')`
+	if got := db.statements("CREATE TABLE"); len(got) != 1 || got[0].sql != want {
+		t.Errorf("statements = %+v, want %s", got, want)
+	}
+
+	if err := EnsurePartition(context.Background(), &fakeDB{}, "public.server", "public.server_x", "x\x00"); err == nil {
+		t.Error("EnsurePartition() with NUL in cluster expected error, got nil")
+	}
+}
+
+// TestEnsurePartition_Collision refuses the partition of eu-west when
+// eu_west, which maps to the same name, created it first.
+func TestEnsurePartition_Collision(t *testing.T) {
+	name, err := PartitionTableName("public.server", "eu-west")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := PartitionTableName("public.server", "eu_west"); other != name {
+		t.Fatalf("partitions %q and %q, want the names to collide", name, other)
+	}
+	err = EnsurePartition(context.Background(), partitionDB(`FOR VALUES IN ('eu_west')`), "public.server", name, "eu-west")
+	if err == nil || !strings.Contains(err.Error(), "another cluster") {
+		t.Errorf("EnsurePartition() error = %v, want the collision named", err)
+	}
+}
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// pausedRequeueDelay is how soon a reconcile skipped while paused is
+// retried, so writes resume shortly after POST /resume.
+const pausedRequeueDelay = 10 * time.Second
+
+// Pause stops the reconcilers and the Sweeper from writing during database
+// maintenance, without restarting the pod. A nil *Pause is never paused.
+type Pause struct {
+	paused atomic.Bool
+}
+
+// Paused reports whether writes are paused.
+func (p *Pause) Paused() bool {
+	return p != nil && p.paused.Load()
+}
+
+// Set pauses or resumes writes.
+func (p *Pause) Set(paused bool) {
+	p.paused.Store(paused)
+	if paused {
+		pausedGauge.Set(1)
+	} else {
+		pausedGauge.Set(0)
+	}
+}
+
+type pauseResponse struct {
+	Paused bool `json:"paused"`
+}
+
+// Register adds POST /pause and POST /resume to mux. Both answer with the
+// resulting state and are idempotent.
+func (p *Pause) Register(mux *http.ServeMux) {
+	handle := func(paused bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, _ *http.Request) {
+			p.Set(paused)
+			writeJSON(w, pauseResponse{Paused: paused})
+		}
+	}
+	mux.HandleFunc("POST /pause", handle(true))
+	mux.HandleFunc("POST /resume", handle(false))
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPause_Handler(t *testing.T) {
+	pause := &Pause{}
+	mux := http.NewServeMux()
+	pause.Register(mux)
+	tracker := NewSyncTracker()
+	tracker.Pause = pause
+
+	tests := []struct {
+		method, path string
+		code         int
+		paused       bool
+	}{
+		{method: http.MethodPost, path: "/pause", code: http.StatusOK, paused: true},
+		{method: http.MethodPost, path: "/pause", code: http.StatusOK, paused: true},
+		{method: http.MethodGet, path: "/resume", code: http.StatusMethodNotAllowed, paused: true},
+		{method: http.MethodPost, path: "/resume", code: http.StatusOK},
+		{method: http.MethodPost, path: "/resume", code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, http.NoBody))
+		if rec.Code != tt.code {
+			t.Fatalf("%s %s: status code = %d, want %d", tt.method, tt.path, rec.Code, tt.code)
+		}
+		if tt.code == http.StatusOK {
+			var resp pauseResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Paused != tt.paused {
+				t.Errorf("%s %s: response = %s, want paused %v", tt.method, tt.path, rec.Body, tt.paused)
+			}
+		}
+		if pause.Paused() != tt.paused {
+			t.Errorf("%s %s: Paused() = %v, want %v", tt.method, tt.path, pause.Paused(), tt.paused)
+		}
+		if got, want := testutil.ToFloat64(pausedGauge), map[bool]float64{true: 1}[tt.paused]; got != want {
+			t.Errorf("%s %s: observer_paused = %v, want %v", tt.method, tt.path, got, want)
+		}
+		if tracker.snapshot(0).Paused != tt.paused {
+			t.Errorf("%s %s: health response paused = %v, want %v", tt.method, tt.path, !tt.paused, tt.paused)
+		}
+	}
+
+	var none *Pause
+	if none.Paused() {
+		t.Error("nil Pause is paused")
+	}
+}
+
+func TestPause_Reconcilers(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newSlice("default", "svc-abc", "svc", podEndpoint("uid-1", "pod-1", "10.0.0.1")),
+	).Build()
+	pause := &Pause{}
+	pause.Set(true)
+	defer pause.Set(false)
+	sink := &recordingSink{}
+	ctx := context.Background()
+
+	sliceReconciler := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", RequeueAfter: time.Minute, Pause: pause}
+	services := &ServiceReconciler{Client: c, Sink: sink, ClusterName: "dev", Pause: pause}
+	for name, reconcile := range map[string]func() (ctrl.Result, error){
+		"EndpointSliceReconciler": func() (ctrl.Result, error) {
+			return sliceReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "svc-abc"}})
+		},
+		// The Service is gone, which would otherwise prune its rows.
+		"ServiceReconciler": func() (ctrl.Result, error) {
+			return services.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "svc"}})
+		},
+	} {
+		res, err := reconcile()
+		if err != nil || res.RequeueAfter != pausedRequeueDelay {
+			t.Errorf("%s paused: result = %+v, %v, want a requeue after %s", name, res, err, pausedRequeueDelay)
+		}
+	}
+	if len(sink.syncs) != 0 || len(sink.deletes) != 0 {
+		t.Fatalf("paused reconciles wrote: syncs %v, deletes %v", sink.syncs, sink.deletes)
+	}
+
+	pause.Set(false)
+	if _, err := sliceReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "svc-abc"}}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if _, err := services.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "svc"}}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(sink.syncs) != 1 || len(sink.deletes) != 1 {
+		t.Errorf("resumed reconciles: syncs %v, deletes %v, want one of each", sink.syncs, sink.deletes)
+	}
+}
+
+func TestPause_Sweeper(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()
+	db, queries := sweepDB(true)
+	pause := &Pause{}
+	pause.Set(true)
+	defer pause.Set(false)
+	s := &Sweeper{DB: db, TableName: "server", Reconciler: &EndpointSliceReconciler{Client: c, ClusterName: "dev"}, Interval: time.Hour, Pause: pause}
+	if err := s.Sweep(context.Background()); err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+	if len(*queries) != 0 {
+		t.Errorf("paused Sweep() queried %+v", *queries)
+	}
+}
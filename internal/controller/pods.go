@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// labelSet is a label map kept as its canonical JSON encoding (sorted keys),
+// so endpointRow stays comparable. The zero value means no labels.
+type labelSet string
+
+func newLabelSet(m map[string]string) labelSet {
+	if len(m) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(m) // map[string]string always encodes
+	return labelSet(b)
+}
+
+// Map decodes the set; it returns nil for the zero value.
+func (l labelSet) Map() map[string]string {
+	if l == "" {
+		return nil
+	}
+	var m map[string]string
+	_ = json.Unmarshal([]byte(l), &m)
+	return m
+}
+
+func (l labelSet) MarshalJSON() ([]byte, error) {
+	if l == "" {
+		return []byte("null"), nil
+	}
+	return []byte(l), nil
+}
+
+func (l *labelSet) UnmarshalJSON(b []byte) error {
+	var m map[string]string
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	*l = newLabelSet(m)
+	return nil
+}
+
+// applyPods applies the Pod-based options (ExcludeSelector,
+// RequireContainer, EnrichPodLabels, ResolveOwner, TargetWorkload) to rows.
+// Each Pod and ReplicaSet is fetched at most once per call; an endpoint
+// whose Pod can't be read is kept without enrichment, unless
+// RequireContainerFailClosed or TargetWorkload drops it.
+func (r *EndpointSliceReconciler) applyPods(ctx context.Context, namespace string, rows map[string]endpointRow) {
+	exclude := r.ExcludeSelector != nil && !r.ExcludeSelector.Empty()
+	require := r.RequireContainer != ""
+	target := r.TargetWorkload != ""
+	if !exclude && !require && len(r.EnrichPodLabels) == 0 && !r.ResolveOwner && !target {
+		return
+	}
+	reader := r.PodReader
+	if reader == nil {
+		reader = r.Client
+	}
+	logger := log.FromContext(ctx)
+
+	pods := map[string]*corev1.Pod{}
+	owners := map[string]string{} // ReplicaSet name -> owner
+	for uid, row := range rows {
+		if ctx.Err() != nil {
+			return // the caller sees ctx's error
+		}
+		if row.Name == "" { // no Pod behind this endpoint
+			if target {
+				delete(rows, uid)
+			}
+			continue
+		}
+		pod, cached := pods[row.Name]
+		if !cached {
+			pod = &corev1.Pod{}
+			if err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: row.Name}, pod); err != nil {
+				logger.V(1).Info("could not fetch pod, keeping endpoint as is",
+					"namespace", namespace, "pod", row.Name, "err", err.Error())
+				pod = nil
+			}
+			pods[row.Name] = pod
+		}
+		if pod == nil {
+			if (require && r.RequireContainerFailClosed) || target {
+				delete(rows, uid)
+			}
+			continue
+		}
+
+		if exclude && (r.ExcludeSelector.Matches(labels.Set(pod.Labels)) || r.ExcludeSelector.Matches(labels.Set(pod.Annotations))) {
+			delete(rows, uid)
+			continue
+		}
+		if require && !containerReady(pod, r.RequireContainer) {
+			logger.V(2).Info("dropping endpoint, container not running and ready",
+				"namespace", namespace, "pod", row.Name, "container", r.RequireContainer)
+			delete(rows, uid)
+			continue
+		}
+		if len(r.EnrichPodLabels) > 0 {
+			picked := map[string]string{}
+			for _, k := range r.EnrichPodLabels {
+				if v, ok := pod.Labels[k]; ok {
+					picked[k] = v
+				}
+			}
+			row.PodLabels = newLabelSet(picked)
+		}
+		var owner string
+		if r.ResolveOwner || target {
+			owner = resolveOwner(ctx, reader, pod, owners)
+		}
+		if kind, _, _ := strings.Cut(owner, "/"); target && kind != r.TargetWorkload {
+			logger.V(2).Info("dropping endpoint, not owned by the target workload",
+				"namespace", namespace, "pod", row.Name, "owner", owner, "targetWorkload", r.TargetWorkload)
+			delete(rows, uid)
+			continue
+		}
+		if r.ResolveOwner {
+			row.Owner = owner
+		}
+		rows[uid] = row
+	}
+}
+
+// containerReady reports whether pod has a container named name that is
+// running and ready. A pod without such a container doesn't qualify.
+func containerReady(pod *corev1.Pod, name string) bool {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == name {
+			return cs.State.Running != nil && cs.Ready
+		}
+	}
+	return false
+}
+
+// resolveOwner returns the top-level controller of pod as "Kind/name", or ""
+// if it has none. A ReplicaSet is followed to its Deployment; if it can't be
+// read, or has no controller, the ReplicaSet itself is the owner. owners
+// caches ReplicaSet lookups.
+func resolveOwner(ctx context.Context, reader client.Reader, pod *corev1.Pod, owners map[string]string) string {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return ""
+	}
+	owner := ref.Kind + "/" + ref.Name
+	if ref.Kind != "ReplicaSet" || ref.APIVersion != appsv1.SchemeGroupVersion.String() {
+		return owner
+	}
+	if cached, ok := owners[ref.Name]; ok {
+		return cached
+	}
+	var rs appsv1.ReplicaSet
+	if err := reader.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: ref.Name}, &rs); err != nil {
+		log.FromContext(ctx).V(1).Info("could not fetch replicaset, using it as the owner",
+			"namespace", pod.Namespace, "replicaset", ref.Name, "err", err.Error())
+	} else if top := metav1.GetControllerOf(&rs); top != nil {
+		owner = top.Kind + "/" + top.Name
+	}
+	owners[ref.Name] = owner
+	return owner
+}
@@ -0,0 +1,252 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"slices"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestApplyPods_EnrichLabels(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-1",
+			Labels: map[string]string{"version": "v2", "track": "canary", "app": "web"}}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-2",
+			Labels: map[string]string{"app": "web"}}},
+	).Build()
+	reader := &countingReader{Reader: c}
+	r := &EndpointSliceReconciler{Client: c, PodReader: reader, EnrichPodLabels: []string{"version", "track"}}
+
+	rows := map[string]endpointRow{
+		"uid-1": {UID: "uid-1", Name: "web-1", IP: "10.0.0.1"},
+		"uid-2": {UID: "uid-2", Name: "web-2", IP: "10.0.0.2"},
+		"uid-3": {UID: "uid-3", Name: "missing", IP: "10.0.0.3"},
+		"gen":   {UID: "gen", IP: "10.0.0.4"},
+	}
+	r.applyPods(context.Background(), "default", rows)
+
+	want := map[string]endpointRow{
+		"uid-1": {UID: "uid-1", Name: "web-1", IP: "10.0.0.1", PodLabels: `{"track":"canary","version":"v2"}`},
+		// No requested label present, so nothing to record.
+		"uid-2": {UID: "uid-2", Name: "web-2", IP: "10.0.0.2"},
+		// A missing Pod keeps the endpoint, just without labels.
+		"uid-3": {UID: "uid-3", Name: "missing", IP: "10.0.0.3"},
+		"gen":   {UID: "gen", IP: "10.0.0.4"},
+	}
+	if !maps.Equal(rows, want) {
+		t.Errorf("rows = %v, want %v", rows, want)
+	}
+	if reader.gets != 3 {
+		t.Errorf("pod gets = %d, want 3 (endpoints without a Pod are not looked up)", reader.gets)
+	}
+}
+
+func TestApplyPods_ResolveOwner(t *testing.T) {
+	controlledBy := func(apiVersion, kind, name string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{APIVersion: apiVersion, Kind: kind, Name: name, Controller: boolPtr(true)}}
+	}
+	pod := func(name string, owners []metav1.OwnerReference) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, OwnerReferences: owners}}
+	}
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-7d9f",
+			OwnerReferences: controlledBy("apps/v1", "Deployment", "web")}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "bare-rs"}},
+		pod("web-7d9f-a", controlledBy("apps/v1", "ReplicaSet", "web-7d9f")),
+		pod("web-7d9f-b", controlledBy("apps/v1", "ReplicaSet", "web-7d9f")),
+		pod("db-0", controlledBy("apps/v1", "StatefulSet", "db")),
+		pod("bare-rs-a", controlledBy("apps/v1", "ReplicaSet", "bare-rs")),
+		pod("orphan-a", controlledBy("apps/v1", "ReplicaSet", "gone")),
+		pod("static", []metav1.OwnerReference{{APIVersion: "v1", Kind: "Node", Name: "node-1"}}),
+	).Build()
+	reader := &countingReader{Reader: c}
+	r := &EndpointSliceReconciler{Client: c, PodReader: reader, ResolveOwner: true}
+
+	rows := map[string]endpointRow{
+		"uid-1": {UID: "uid-1", Name: "web-7d9f-a"},
+		"uid-2": {UID: "uid-2", Name: "web-7d9f-b"},
+		"uid-3": {UID: "uid-3", Name: "db-0"},
+		"uid-4": {UID: "uid-4", Name: "bare-rs-a"},
+		"uid-5": {UID: "uid-5", Name: "orphan-a"},
+		"uid-6": {UID: "uid-6", Name: "static"},
+		"uid-7": {UID: "uid-7", Name: "missing"},
+	}
+	r.applyPods(context.Background(), "default", rows)
+
+	want := map[string]endpointRow{
+		"uid-1": {UID: "uid-1", Name: "web-7d9f-a", Owner: "Deployment/web"},
+		"uid-2": {UID: "uid-2", Name: "web-7d9f-b", Owner: "Deployment/web"},
+		"uid-3": {UID: "uid-3", Name: "db-0", Owner: "StatefulSet/db"},
+		// A ReplicaSet without a controller, or one that is gone, owns its Pods.
+		"uid-4": {UID: "uid-4", Name: "bare-rs-a", Owner: "ReplicaSet/bare-rs"},
+		"uid-5": {UID: "uid-5", Name: "orphan-a", Owner: "ReplicaSet/gone"},
+		// Non-controller references and missing Pods leave the owner empty.
+		"uid-6": {UID: "uid-6", Name: "static"},
+		"uid-7": {UID: "uid-7", Name: "missing"},
+	}
+	if !maps.Equal(rows, want) {
+		t.Errorf("rows = %v, want %v", rows, want)
+	}
+	if reader.gets != 7+3 {
+		t.Errorf("gets = %d, want 10 (7 Pods, each of 3 ReplicaSets once)", reader.gets)
+	}
+}
+
+func TestApplyPods_TargetWorkload(t *testing.T) {
+	controlledBy := func(apiVersion, kind, name string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{APIVersion: apiVersion, Kind: kind, Name: name, Controller: boolPtr(true)}}
+	}
+	pod := func(name string, owners []metav1.OwnerReference) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, OwnerReferences: owners}}
+	}
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-7d9f",
+			OwnerReferences: controlledBy("apps/v1", "Deployment", "web")}},
+		pod("db-0", controlledBy("apps/v1", "StatefulSet", "db")),
+		pod("db-1", controlledBy("apps/v1", "StatefulSet", "db")),
+		pod("web-7d9f-a", controlledBy("apps/v1", "ReplicaSet", "web-7d9f")),
+		pod("web-7d9f-b", controlledBy("apps/v1", "ReplicaSet", "web-7d9f")),
+		pod("agent-x", controlledBy("apps/v1", "DaemonSet", "agent")),
+		pod("bare", nil),
+	).Build()
+	rows := func() map[string]endpointRow {
+		return map[string]endpointRow{
+			"uid-1": {UID: "uid-1", Name: "db-0"},
+			"uid-2": {UID: "uid-2", Name: "db-1"},
+			"uid-3": {UID: "uid-3", Name: "web-7d9f-a"},
+			"uid-4": {UID: "uid-4", Name: "web-7d9f-b"},
+			"uid-5": {UID: "uid-5", Name: "agent-x"},
+			"uid-6": {UID: "uid-6", Name: "bare"},
+			"uid-7": {UID: "uid-7", Name: "missing"},
+			"gen":   {UID: "gen", IP: "10.0.0.9"},
+		}
+	}
+
+	tests := []struct {
+		kind    string
+		owner   bool
+		want    []string
+		wantOwn string // Owner of the kept rows with ResolveOwner
+	}{
+		{kind: "StatefulSet", want: []string{"uid-1", "uid-2"}},
+		// Followed through the ReplicaSet, which is read once.
+		{kind: "Deployment", owner: true, want: []string{"uid-3", "uid-4"}, wantOwn: "Deployment/web"},
+		{kind: "DaemonSet", want: []string{"uid-5"}},
+		{kind: "ReplicaSet"},
+		{kind: "Job"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			reader := &countingReader{Reader: c}
+			r := &EndpointSliceReconciler{Client: c, PodReader: reader, TargetWorkload: tt.kind, ResolveOwner: tt.owner}
+			got := rows()
+			r.applyPods(context.Background(), "default", got)
+
+			if kept := slices.Sorted(maps.Keys(got)); !slices.Equal(kept, tt.want) {
+				t.Errorf("kept %v, want %v", kept, tt.want)
+			}
+			for uid, row := range got {
+				if row.Owner != tt.wantOwn {
+					t.Errorf("%s: Owner = %q, want %q", uid, row.Owner, tt.wantOwn)
+				}
+			}
+			if reader.gets != 7+1 {
+				t.Errorf("gets = %d, want 8 (7 Pods, the ReplicaSet once)", reader.gets)
+			}
+		})
+	}
+}
+
+func TestApplyPods_NoOptionsSkipsLookups(t *testing.T) {
+	reader := &countingReader{Reader: fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()}
+	r := &EndpointSliceReconciler{PodReader: reader}
+	r.applyPods(context.Background(), "default", map[string]endpointRow{"uid-1": {UID: "uid-1", Name: "web-1"}})
+	if reader.gets != 0 {
+		t.Errorf("pod gets = %d, want 0 without exclusion or enrichment", reader.gets)
+	}
+}
+
+func TestLabelSet_JSON(t *testing.T) {
+	row := endpointRow{UID: "u", IP: "10.0.0.1", PodLabels: newLabelSet(map[string]string{"version": "v1"})}
+	b, err := json.Marshal(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"uid":"u","name":"","ip":"10.0.0.1","podLabels":{"version":"v1"}}`; string(b) != want {
+		t.Errorf("Marshal() = %s, want %s", b, want)
+	}
+
+	var back endpointRow
+	if err := json.Unmarshal(b, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back != row {
+		t.Errorf("round trip = %+v, want %+v", back, row)
+	}
+	if got := back.PodLabels.Map()["version"]; got != "v1" {
+		t.Errorf("Map()[version] = %q, want v1", got)
+	}
+
+	b, _ = json.Marshal(endpointRow{UID: "u"})
+	if want := `{"uid":"u","name":"","ip":""}`; string(b) != want {
+		t.Errorf("Marshal() without labels = %s, want %s", b, want)
+	}
+}
+
+func TestApplyPods_RequireContainer(t *testing.T) {
+	pod := func(name string, statuses ...corev1.ContainerStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Status:     corev1.PodStatus{ContainerStatuses: statuses},
+		}
+	}
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	waiting := corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}
+	sidecar := corev1.ContainerStatus{Name: "proxy", State: running, Ready: true}
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		pod("ready", sidecar, corev1.ContainerStatus{Name: "app", State: running, Ready: true}),
+		pod("not-ready", sidecar, corev1.ContainerStatus{Name: "app", State: running}),
+		pod("crashing", sidecar, corev1.ContainerStatus{Name: "app", State: waiting, Ready: true}),
+		pod("no-app", sidecar),
+	).Build()
+	rows := func() map[string]endpointRow {
+		return map[string]endpointRow{
+			"uid-1": {UID: "uid-1", Name: "ready"},
+			"uid-2": {UID: "uid-2", Name: "not-ready"},
+			"uid-3": {UID: "uid-3", Name: "crashing"},
+			"uid-4": {UID: "uid-4", Name: "no-app"},
+			"uid-5": {UID: "uid-5", Name: "missing"},
+			"uid-6": {UID: "uid-6", Name: "ready"}, // second endpoint of the same Pod
+			"gen":   {UID: "gen"},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		failClosed bool
+		want       []string
+	}{
+		{name: "fail open", want: []string{"gen", "uid-1", "uid-5", "uid-6"}},
+		{name: "fail closed", failClosed: true, want: []string{"gen", "uid-1", "uid-6"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := &countingReader{Reader: c}
+			r := &EndpointSliceReconciler{Client: c, PodReader: reader, RequireContainer: "app", RequireContainerFailClosed: tt.failClosed}
+			got := rows()
+			r.applyPods(context.Background(), "default", got)
+			if keys := slices.Sorted(maps.Keys(got)); !slices.Equal(keys, tt.want) {
+				t.Errorf("kept %v, want %v", keys, tt.want)
+			}
+			if reader.gets != 5 {
+				t.Errorf("pod gets = %d, want 5 (each Pod once)", reader.gets)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+// DefaultReadinessExpr admits the endpoints whose Ready condition is unset
+// or true, which is what the observer has always written.
+const DefaultReadinessExpr = "ready"
+
+// ReadinessExpr is a parsed --readiness-expr: a boolean expression over the
+// endpoint conditions ready, serving and terminating, combined with !, &&,
+// || and parentheses, e.g. "ready && serving && !terminating". && binds
+// tighter than ||. An unset ready or serving counts as true and an unset
+// terminating as false, as the EndpointSlice API documents.
+type ReadinessExpr struct {
+	src  string
+	eval readinessFunc
+}
+
+type readinessFunc func(c *discoveryv1.EndpointConditions) bool
+
+// ParseReadinessExpr compiles s, reporting the first syntax error with its
+// byte offset.
+func ParseReadinessExpr(s string) (*ReadinessExpr, error) {
+	p := &readinessParser{src: s}
+	eval, err := p.or()
+	if err == nil && p.peek() != "" {
+		err = p.errorf("unexpected %q", p.peek())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("readiness expression %q: %w", s, err)
+	}
+	return &ReadinessExpr{src: s, eval: eval}, nil
+}
+
+// Ready reports whether an endpoint with conditions c is usable. A nil
+// expression is DefaultReadinessExpr.
+func (e *ReadinessExpr) Ready(c *discoveryv1.EndpointConditions) bool {
+	if e == nil {
+		return c.Ready == nil || *c.Ready
+	}
+	return e.eval(c)
+}
+
+func (e *ReadinessExpr) String() string {
+	if e == nil {
+		return DefaultReadinessExpr
+	}
+	return e.src
+}
+
+// endpointState classifies an endpoint for observer_endpoints by its own
+// conditions, regardless of the readiness expression: terminating wins,
+// then ready (a nil condition is ready), else not_ready.
+func endpointState(c *discoveryv1.EndpointConditions) string {
+	switch {
+	case c.Terminating != nil && *c.Terminating:
+		return stateTerminating
+	case c.Ready == nil || *c.Ready:
+		return stateReady
+	default:
+		return stateNotReady
+	}
+}
+
+var readinessConditions = map[string]readinessFunc{
+	"ready":       func(c *discoveryv1.EndpointConditions) bool { return c.Ready == nil || *c.Ready },
+	"serving":     func(c *discoveryv1.EndpointConditions) bool { return c.Serving == nil || *c.Serving },
+	"terminating": func(c *discoveryv1.EndpointConditions) bool { return c.Terminating != nil && *c.Terminating },
+}
+
+// readinessParser is a recursive-descent parser over src; pos is the offset
+// of the next unread byte.
+type readinessParser struct {
+	src string
+	pos int
+}
+
+func (p *readinessParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("at offset %d: "+format, append([]any{p.pos}, args...)...)
+}
+
+// peek skips blanks and returns the next token without consuming it: an
+// operator, a parenthesis, a word, or "" at the end.
+func (p *readinessParser) peek() string {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+	rest := p.src[p.pos:]
+	switch {
+	case rest == "":
+		return ""
+	case strings.HasPrefix(rest, "&&"), strings.HasPrefix(rest, "||"):
+		return rest[:2]
+	case rest[0] == '!' || rest[0] == '(' || rest[0] == ')':
+		return rest[:1]
+	}
+	end := strings.IndexAny(rest, " \t&|!()")
+	if end < 0 {
+		end = len(rest)
+	}
+	if end == 0 {
+		return rest[:1]
+	}
+	return rest[:end]
+}
+
+func (p *readinessParser) next() string {
+	tok := p.peek()
+	p.pos += len(tok)
+	return tok
+}
+
+// or := and { "||" and }
+func (p *readinessParser) or() (readinessFunc, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(c *discoveryv1.EndpointConditions) bool { return l(c) || right(c) }
+	}
+	return left, nil
+}
+
+// and := unary { "&&" unary }
+func (p *readinessParser) and() (readinessFunc, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(c *discoveryv1.EndpointConditions) bool { return l(c) && right(c) }
+	}
+	return left, nil
+}
+
+// unary := "!" unary | "(" or ")" | condition
+func (p *readinessParser) unary() (readinessFunc, error) {
+	tok := p.peek()
+	switch tok {
+	case "":
+		return nil, p.errorf("expected a condition, got the end")
+	case "!":
+		p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(c *discoveryv1.EndpointConditions) bool { return !operand(c) }, nil
+	case "(":
+		p.next()
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, p.errorf("expected \")\"")
+		}
+		p.next()
+		return inner, nil
+	}
+	cond, ok := readinessConditions[tok]
+	if !ok {
+		return nil, p.errorf("unknown condition %q (want ready, serving or terminating)", tok)
+	}
+	p.next()
+	return cond, nil
+}
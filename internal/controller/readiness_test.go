@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+func TestReadinessExpr_Ready(t *testing.T) {
+	conds := map[string]discoveryv1.EndpointConditions{
+		"unset":               {},
+		"ready":               {Ready: boolPtr(true), Serving: boolPtr(true), Terminating: boolPtr(false)},
+		"not ready":           {Ready: boolPtr(false), Serving: boolPtr(false), Terminating: boolPtr(false)},
+		"terminating serving": {Ready: boolPtr(false), Serving: boolPtr(true), Terminating: boolPtr(true)},
+		"terminating drained": {Ready: boolPtr(false), Serving: boolPtr(false), Terminating: boolPtr(true)},
+		"ready terminating":   {Ready: boolPtr(true), Serving: boolPtr(true), Terminating: boolPtr(true)},
+	}
+
+	tests := []struct {
+		expr string
+		// want lists the conditions that pass expr; the others must not.
+		want []string
+	}{
+		{expr: DefaultReadinessExpr, want: []string{"unset", "ready", "ready terminating"}},
+		{expr: "ready && serving && !terminating", want: []string{"unset", "ready"}},
+		{expr: "serving", want: []string{"unset", "ready", "terminating serving", "ready terminating"}},
+		{expr: "ready || serving && terminating", want: []string{"unset", "ready", "terminating serving", "ready terminating"}},
+		{expr: "(ready || serving) && !terminating", want: []string{"unset", "ready"}},
+		{expr: "!!ready", want: []string{"unset", "ready", "ready terminating"}},
+		{expr: "  terminating&&!serving ", want: []string{"terminating drained"}},
+		{expr: "!(ready || serving)", want: []string{"not ready", "terminating drained"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := ParseReadinessExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseReadinessExpr(%q) error = %v", tt.expr, err)
+			}
+			if e.String() != tt.expr {
+				t.Errorf("String() = %q, want %q", e.String(), tt.expr)
+			}
+			for name, c := range conds {
+				want := false
+				for _, w := range tt.want {
+					want = want || w == name
+				}
+				if got := e.Ready(&c); got != want {
+					t.Errorf("Ready(%s) = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+
+	// A nil expression is the default one.
+	var none *ReadinessExpr
+	def, _ := ParseReadinessExpr(DefaultReadinessExpr)
+	for name, c := range conds {
+		if none.Ready(&c) != def.Ready(&c) {
+			t.Errorf("nil Ready(%s) = %v, want %v", name, none.Ready(&c), def.Ready(&c))
+		}
+	}
+}
+
+func TestParseReadinessExpr_Errors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: "", want: "at offset 0: expected a condition, got the end"},
+		{expr: "ready &&", want: "at offset 8: expected a condition, got the end"},
+		{expr: "ready & serving", want: `at offset 6: unexpected "&"`},
+		{expr: "healthy", want: `at offset 0: unknown condition "healthy"`},
+		{expr: "(ready || serving", want: `at offset 17: expected ")"`},
+		{expr: "ready serving", want: `at offset 6: unexpected "serving"`},
+		{expr: "ready)", want: `at offset 5: unexpected ")"`},
+		{expr: "Ready", want: `unknown condition "Ready"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseReadinessExpr(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseReadinessExpr(%q) error = %v, want %q", tt.expr, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEndpointSliceReconciler_endpointToRowReadiness(t *testing.T) {
+	expr, err := ParseReadinessExpr("ready && serving && !terminating")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &EndpointSliceReconciler{Readiness: expr}
+	ep := &discoveryv1.Endpoint{
+		Addresses:  []string{"10.0.0.1"},
+		Conditions: discoveryv1.EndpointConditions{Ready: boolPtr(true), Serving: boolPtr(true), Terminating: boolPtr(true)},
+	}
+	if row, ok := r.endpointToRow(ep, discoveryv1.AddressTypeIPv4, "default", "web", 0); ok {
+		t.Errorf("endpointToRow() = %v, want a terminating endpoint dropped", row)
+	}
+	ep.Conditions.Terminating = boolPtr(false)
+	if _, ok := r.endpointToRow(ep, discoveryv1.AddressTypeIPv4, "default", "web", 0); !ok {
+		t.Error("endpointToRow() dropped a ready, serving endpoint")
+	}
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Reaper periodically prunes the rows of this cluster whose last_seen is
+// older than TTL (--prune-mode=ttl, --row-ttl). With PruneTTL the writes
+// of a service no longer prune, so consumers treat a row not seen within
+// the TTL as stale and the Reaper catches up with deleting it; the rows of
+// live endpoints stay fresh through the heartbeat.
+//
+// Replicas may reap at the same time: the statement is the same for all of
+// them, so only one deletes a given row. Only TableName is reaped, not
+// per-service tables.
+type Reaper struct {
+	DB        DB
+	TableName string
+	// TableFile, if set, replaces TableName with its current value
+	// (--table=@file).
+	TableFile   *LiveValue
+	ClusterName string
+	// ClusterFile, if set, replaces ClusterName with its current value.
+	ClusterFile *LiveValue
+	// Namespace limits reaping to one namespace; empty is all.
+	Namespace string
+	// Region, if set, limits reaping to the rows of this region, the
+	// PostgresSink.Region of the reconcilers.
+	Region string
+	// PruneAction is the PostgresSink.PruneAction of the reconcilers.
+	PruneAction string
+	// TTL is how old last_seen must be for a row to be reaped.
+	TTL time.Duration
+	// Interval is the time between reaps.
+	Interval time.Duration
+	// Now, if set, is the clock of last_seen (the PostgresSink.Now of the
+	// reconcilers); nil is the database's now().
+	Now func() time.Time
+	// Pause, while paused, skips reaps.
+	Pause *Pause
+	Log   logr.Logger
+}
+
+// Start reaps every Interval until ctx is done. It's a manager Runnable.
+func (r *Reaper) Start(ctx context.Context) error {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	ctx = log.IntoContext(ctx, r.Log)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := r.Reap(ctx); err != nil && ctx.Err() == nil {
+				r.Log.Error(err, "reap expired rows")
+			}
+		}
+	}
+}
+
+// Reap prunes the expired rows once. It returns nil without pruning
+// anything while writes are paused.
+func (r *Reaper) Reap(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+	if r.Pause.Paused() {
+		logger.V(1).Info("skipping reap, writes are paused")
+		return nil
+	}
+	tbl, err := sanitizeTableIdent(r.TableFile.Or(r.TableName))
+	if err != nil {
+		return err
+	}
+	q, args := r.statement(tbl)
+	rows, err := r.DB.Query(ctx, q, args...)
+	if err != nil {
+		return fmt.Errorf("reap %s: %w", tbl, err)
+	}
+	defer rows.Close()
+	reaped := map[types.NamespacedName]int{}
+	for rows.Next() {
+		var key types.NamespacedName
+		if err := rows.Scan(&key.Namespace, &key.Name); err != nil {
+			return err
+		}
+		reaped[key]++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("reap %s: %w", tbl, err)
+	}
+
+	for key, n := range reaped {
+		prunedRows(r.PruneAction).WithLabelValues(key.Namespace, key.Name).Add(float64(n))
+		logger.V(1).Info("reaped expired rows", "namespace", key.Namespace, "service", key.Name, "pruned", n)
+	}
+	logger.V(1).Info("reap finished", "cluster", r.ClusterFile.Or(r.ClusterName), "services", len(reaped))
+	return nil
+}
+
+// statement is the prune of the expired rows of tbl and its args. The
+// cutoff comes from the same clock as last_seen.
+func (r *Reaper) statement(tbl string) (string, []any) {
+	cutoff, arg := "now() - make_interval(secs => $2)", any(r.TTL.Seconds())
+	if r.Now != nil {
+		cutoff, arg = "$2", r.Now().UTC().Add(-r.TTL)
+	}
+	where, args := "cluster = $1 AND last_seen < "+cutoff, []any{r.ClusterFile.Or(r.ClusterName), arg}
+	if r.Namespace != "" {
+		args = append(args, r.Namespace)
+		where += fmt.Sprintf(" AND namespace = $%d", len(args))
+	}
+	region, rargs := regionCond(r.Region, len(args)+1)
+	return pruneStatement(r.PruneAction, tbl, where+region, "namespace, service"), append(args, rargs...)
+}
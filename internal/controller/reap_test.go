@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReaper_Reap(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name     string
+		reaper   Reaper
+		wantSQL  string
+		wantArgs []any
+	}{
+		{
+			name:     "cluster",
+			reaper:   Reaper{TTL: time.Hour},
+			wantSQL:  `DELETE FROM "server" WHERE cluster = $1 AND last_seen < now() - make_interval(secs => $2) RETURNING namespace, service`,
+			wantArgs: []any{"dev", 3600.0},
+		},
+		{
+			name:     "namespace and region",
+			reaper:   Reaper{TTL: time.Hour, Namespace: "shop", Region: "eu-west"},
+			wantSQL:  `DELETE FROM "server" WHERE cluster = $1 AND last_seen < now() - make_interval(secs => $2) AND namespace = $3 AND region = $4 RETURNING namespace, service`,
+			wantArgs: []any{"dev", 3600.0, "shop", "eu-west"},
+		},
+		{
+			name:     "client clock",
+			reaper:   Reaper{TTL: time.Hour, Now: func() time.Time { return now }},
+			wantSQL:  `DELETE FROM "server" WHERE cluster = $1 AND last_seen < $2 RETURNING namespace, service`,
+			wantArgs: []any{"dev", now.Add(-time.Hour)},
+		},
+		{
+			name:     "clear",
+			reaper:   Reaper{TTL: time.Hour, PruneAction: PruneClear},
+			wantSQL:  `UPDATE "server" SET pod_ip = NULL, ready = false WHERE cluster = $1 AND last_seen < now() - make_interval(secs => $2) AND pod_ip IS NOT NULL RETURNING namespace, service`,
+			wantArgs: []any{"dev", 3600.0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var queries []execCall
+			db := &fakeDB{queryFn: func(sql string, args []any) ([][]any, error) {
+				queries = append(queries, execCall{sql: sql, args: args})
+				return [][]any{{"shop", "reaped"}, {"shop", "reaped"}}, nil
+			}}
+			r := tt.reaper
+			r.DB, r.TableName, r.ClusterName = db, "server", "dev"
+			pruned := prunedRows(r.PruneAction).WithLabelValues("shop", "reaped")
+			before := testutil.ToFloat64(pruned)
+
+			if err := r.Reap(context.Background()); err != nil {
+				t.Fatalf("Reap() error = %v", err)
+			}
+			if len(queries) != 1 || queries[0].sql != tt.wantSQL || !slices.Equal(queries[0].args, tt.wantArgs) {
+				t.Fatalf("queries = %+v, want %s with %v", queries, tt.wantSQL, tt.wantArgs)
+			}
+			if got := testutil.ToFloat64(pruned) - before; got != 2 {
+				t.Errorf("pruned rows of shop/reaped grew by %v, want 2", got)
+			}
+		})
+	}
+}
+
+func TestReaper_Paused(t *testing.T) {
+	db := &fakeDB{queryFn: func(sql string, _ []any) ([][]any, error) {
+		t.Errorf("unexpected query %s", sql)
+		return nil, nil
+	}}
+	pause := &Pause{}
+	pause.Set(true)
+	defer pause.Set(false)
+	r := &Reaper{DB: db, TableName: "server", ClusterName: "dev", TTL: time.Hour, Pause: pause}
+	if err := r.Reap(context.Background()); err != nil {
+		t.Fatalf("Reap() error = %v", err)
+	}
+}
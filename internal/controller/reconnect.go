@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Pool is a DB that can be closed, like *pgxpool.Pool.
+type Pool interface {
+	DB
+	Close()
+}
+
+// fatalPoolCodes are SQLSTATEs after which a pool may not recover on its
+// own: the server is going away or refusing us, or the credentials changed.
+var fatalPoolCodes = map[string]bool{
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+	"53300": true, // too_many_connections
+	"28P01": true, // invalid_password
+	"28000": true, // invalid_authorization_specification
+}
+
+func isFatalPoolError(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && fatalPoolCodes[pgErr.Code]
+}
+
+// ReconnectingDB forwards to its current pool. An error that can leave the
+// pool unusable (see fatalPoolCodes) wakes Start, which opens a new pool
+// with Connect, retrying with exponential backoff, and swaps it in; the old
+// pool is closed once its connections are released.
+type ReconnectingDB struct {
+	// Connect opens a replacement pool.
+	Connect func(ctx context.Context) (Pool, error)
+	// MinBackoff and MaxBackoff bound the delay between failed Connect
+	// attempts. Zero means dbRetryBaseDelay and dbRetryMaxDelay.
+	MinBackoff, MaxBackoff time.Duration
+	Log                    logr.Logger
+
+	mu     sync.RWMutex
+	pool   Pool
+	broken chan struct{}
+}
+
+// NewReconnectingDB returns a DB serving from pool until it breaks.
+func NewReconnectingDB(pool Pool, connect func(ctx context.Context) (Pool, error)) *ReconnectingDB {
+	return &ReconnectingDB{Connect: connect, pool: pool, broken: make(chan struct{}, 1)}
+}
+
+// current returns the pool in use.
+func (r *ReconnectingDB) current() Pool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pool
+}
+
+// observe wakes Start if err broke the pool.
+func (r *ReconnectingDB) observe(err error) {
+	if !isFatalPoolError(err) {
+		return
+	}
+	select {
+	case r.broken <- struct{}{}:
+	default: // a reconnect is already pending
+	}
+}
+
+func (r *ReconnectingDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := r.current().Begin(ctx)
+	r.observe(err)
+	if err != nil {
+		return nil, err
+	}
+	return &reportingTx{Tx: tx, db: r}, nil
+}
+
+func (r *ReconnectingDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	tag, err := r.current().Exec(ctx, sql, args...)
+	r.observe(err)
+	return tag, err
+}
+
+func (r *ReconnectingDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	rows, err := r.current().Query(ctx, sql, args...)
+	r.observe(err)
+	return rows, err
+}
+
+func (r *ReconnectingDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return &reportingRow{Row: r.current().QueryRow(ctx, sql, args...), db: r}
+}
+
+// Close closes the current pool.
+func (r *ReconnectingDB) Close() {
+	r.current().Close()
+}
+
+// Start replaces the pool each time it breaks, until ctx is done.
+func (r *ReconnectingDB) Start(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-r.broken:
+		}
+		r.reconnect(ctx)
+	}
+}
+
+func (r *ReconnectingDB) reconnect(ctx context.Context) {
+	backoff, maxBackoff := r.MinBackoff, r.MaxBackoff
+	if backoff <= 0 {
+		backoff = dbRetryBaseDelay
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = dbRetryMaxDelay
+	}
+	for {
+		pool, err := r.Connect(ctx)
+		if err == nil {
+			r.mu.Lock()
+			old := r.pool
+			r.pool = pool
+			r.mu.Unlock()
+			// Errors of calls still running on the old pool don't count.
+			select {
+			case <-r.broken:
+			default:
+			}
+			poolRecreations.Inc()
+			r.Log.Info("recreated postgres pool")
+			go old.Close() // waits for connections in use
+			return
+		}
+		r.Log.Error(err, "recreate postgres pool", "retryIn", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// reportingTx passes the errors of a transaction to its ReconnectingDB.
+type reportingTx struct {
+	pgx.Tx
+	db *ReconnectingDB
+}
+
+func (t *reportingTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	tag, err := t.Tx.Exec(ctx, sql, args...)
+	t.db.observe(err)
+	return tag, err
+}
+
+func (t *reportingTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	rows, err := t.Tx.Query(ctx, sql, args...)
+	t.db.observe(err)
+	return rows, err
+}
+
+func (t *reportingTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return &reportingRow{Row: t.Tx.QueryRow(ctx, sql, args...), db: t.db}
+}
+
+func (t *reportingTx) Commit(ctx context.Context) error {
+	err := t.Tx.Commit(ctx)
+	t.db.observe(err)
+	return err
+}
+
+type reportingRow struct {
+	pgx.Row
+	db *ReconnectingDB
+}
+
+func (r *reportingRow) Scan(dest ...any) error {
+	err := r.Row.Scan(dest...)
+	r.db.observe(err)
+	return err
+}
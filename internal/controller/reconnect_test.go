@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakePool is a fakeDB that records being closed.
+type fakePool struct {
+	*fakeDB
+	closed atomic.Bool
+}
+
+func (p *fakePool) Close() { p.closed.Store(true) }
+
+// failingPool fails every statement with err.
+func failingPool(err error) *fakePool {
+	return &fakePool{fakeDB: &fakeDB{execFn: func(string, []any) (pgconn.CommandTag, error) { return pgconn.CommandTag{}, err }}}
+}
+
+// waitForPool waits until db serves from want.
+func waitForPool(t *testing.T, db *ReconnectingDB, want Pool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if db.current() == want {
+			return
+		}
+	}
+	t.Fatal("new pool was never installed")
+}
+
+func TestIsFatalPoolError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: &pgconn.PgError{Code: "57P01"}, want: true},
+		{err: &pgconn.PgError{Code: "53300"}, want: true},
+		{err: fmt.Errorf("connect: %w", &pgconn.PgError{Code: "28P01"}), want: true},
+		{err: &pgconn.PgError{Code: "23505"}},
+		{err: context.DeadlineExceeded},
+		{err: nil},
+	}
+	for _, tt := range tests {
+		if got := isFatalPoolError(tt.err); got != tt.want {
+			t.Errorf("isFatalPoolError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestReconnectingDB_RecreatesPoolOnFatalError(t *testing.T) {
+	shutdown := &pgconn.PgError{Code: "57P01", Message: "terminating connection due to administrator command"}
+	old := failingPool(shutdown)
+	fresh := &fakePool{fakeDB: &fakeDB{}}
+	attempts := 0
+	db := NewReconnectingDB(old, func(context.Context) (Pool, error) {
+		if attempts++; attempts < 3 {
+			return nil, errors.New("connection refused")
+		}
+		return fresh, nil
+	})
+	db.MinBackoff, db.MaxBackoff = time.Millisecond, 2*time.Millisecond
+	before := testutil.ToFloat64(poolRecreations)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = db.Start(ctx) }()
+
+	// The error comes from inside a transaction, as in PostgresSink.
+	sink := &PostgresSink{DB: db, TableName: "server"}
+	if err := sink.Sync(ctx, "dev", "default", "svc", nil); !errors.Is(err, shutdown) {
+		t.Fatalf("Sync() error = %v, want %v", err, shutdown)
+	}
+	waitForPool(t, db, fresh)
+	if attempts != 3 {
+		t.Errorf("Connect called %d times, want 3", attempts)
+	}
+	if got := testutil.ToFloat64(poolRecreations) - before; got != 1 {
+		t.Errorf("observer_db_pool_recreations_total grew by %v, want 1", got)
+	}
+	for deadline := time.Now().Add(5 * time.Second); !old.closed.Load() && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if !old.closed.Load() {
+		t.Error("old pool was not closed")
+	}
+
+	if err := sink.Sync(ctx, "dev", "default", "svc", nil); err != nil {
+		t.Fatalf("Sync() on the new pool error = %v", err)
+	}
+	if len(fresh.execs) == 0 {
+		t.Error("new pool received no statements")
+	}
+}
+
+func TestReconnectingDB_KeepsPoolOnOtherErrors(t *testing.T) {
+	old := failingPool(&pgconn.PgError{Code: "42P01"}) // undefined_table
+	db := NewReconnectingDB(old, func(context.Context) (Pool, error) {
+		t.Error("Connect called for a non-fatal error")
+		return nil, errors.New("unexpected")
+	})
+	if _, err := db.Exec(context.Background(), "SELECT 1"); err == nil {
+		t.Fatal("Exec() error = nil")
+	}
+	select {
+	case <-db.broken:
+		t.Error("non-fatal error woke the supervisor")
+	default:
+	}
+	if db.current() != old {
+		t.Error("pool was replaced")
+	}
+}
@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestPostgresSink_Region(t *testing.T) {
+	rows := map[string]endpointRow{"uid-1": {UID: "uid-1", Name: "web-1", IP: "10.0.0.1"}}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		now   func() time.Time
+		grace time.Duration
+		// wantArgs are the trailing arguments of the prune, after the
+		// cluster, namespace, service and live UIDs.
+		wantPrune string
+		wantArgs  []any
+	}{
+		{
+			name:      "prune",
+			wantPrune: "AND pod_uid <> ALL($4) AND region = $5",
+			wantArgs:  []any{"eu-west"},
+		},
+		{
+			name:      "client clock",
+			now:       func() time.Time { return now },
+			wantPrune: "AND pod_uid <> ALL($4) AND region = $5",
+			wantArgs:  []any{"eu-west"},
+		},
+		{
+			name:      "grace period",
+			grace:     time.Minute,
+			wantPrune: "last_seen < now() - make_interval(secs => $5) AND region = $6",
+			wantArgs:  []any{60.0, "eu-west"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeDB{}
+			sink := &PostgresSink{DB: db, TableName: "server", Region: "eu-west", Now: tt.now, PruneGracePeriod: tt.grace}
+			if err := sink.Sync(context.Background(), "dev", "default", "web", rows); err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+
+			ups := db.statements("INSERT INTO")
+			if len(ups) != 1 || !strings.Contains(ups[0].sql, "ON CONFLICT (region, cluster, namespace, service, pod_uid)") {
+				t.Fatalf("upserts = %+v, want one keyed by region", ups)
+			}
+			if !strings.Contains(ups[0].sql, "last_seen, region)") || ups[0].args[len(ups[0].args)-1] != "eu-west" {
+				t.Errorf("upsert = %+v, want region eu-west written last", ups[0])
+			}
+
+			prunes := db.statements("DELETE FROM")
+			if len(prunes) != 1 || !strings.Contains(prunes[0].sql, tt.wantPrune) {
+				t.Fatalf("prunes = %+v, want one containing %q", prunes, tt.wantPrune)
+			}
+			if !slices.Equal(prunes[0].args[4:], tt.wantArgs) {
+				t.Errorf("prune args = %v, want %v after the live UIDs", prunes[0].args, tt.wantArgs)
+			}
+			if mark := db.statements("SET ready = false"); sink.PruneGracePeriod > 0 &&
+				(len(mark) != 1 || !strings.Contains(mark[0].sql, "AND ready AND region = $5") || mark[0].args[4] != "eu-west") {
+				t.Errorf("marks = %+v, want one scoped to region $5", mark)
+			}
+		})
+	}
+}
+
+func TestPostgresSink_NoRegion(t *testing.T) {
+	db := &fakeDB{}
+	sink := &PostgresSink{DB: db, TableName: "server", VerifyWrites: true}
+	if err := sink.Sync(context.Background(), "dev", "default", "web", map[string]endpointRow{"uid-1": {UID: "uid-1"}}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if err := sink.Delete(context.Background(), "dev", "default", "gone"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	for _, e := range db.execs {
+		if strings.Contains(e.sql, "region") {
+			t.Errorf("statement without --region mentions it: %s", e.sql)
+		}
+	}
+	if ups := db.statements("INSERT INTO"); len(ups) != 1 || !strings.Contains(ups[0].sql, "ON CONFLICT (cluster, namespace, service, pod_uid)") {
+		t.Errorf("upserts = %+v, want the four-column key", ups)
+	}
+}
+
+func TestServiceReconciler_DeletesRegionRows(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()
+	db := &fakeDB{}
+	r := &ServiceReconciler{Client: c, Sink: &PostgresSink{DB: db, TableName: "server", Region: "eu-west"}, ClusterName: "dev", Tracker: NewSyncTracker()}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "gone"}}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	del := db.statements("DELETE FROM")
+	if len(del) != 1 || !strings.HasSuffix(del[0].sql, "service = $3 AND region = $4") || len(del[0].args) != 4 || del[0].args[3] != "eu-west" {
+		t.Errorf("deletes = %+v, want the rows of default/gone in region eu-west", del)
+	}
+}
+
+func TestSweeper_Region(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()
+	db, queries := sweepDB(true)
+	s := &Sweeper{
+		DB:         db,
+		TableName:  "server",
+		Reconciler: &EndpointSliceReconciler{Client: c, ClusterName: "dev"},
+		Region:     "eu-west",
+		Interval:   time.Hour,
+	}
+	if err := s.Sweep(context.Background()); err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+	if len(*queries) != 2 {
+		t.Fatalf("queries = %+v, want the lock and the sweep", *queries)
+	}
+	lock, sweep := (*queries)[0], (*queries)[1]
+	if lock.args[0] == sweepLockKey("dev") {
+		t.Error("lock key is the one of cluster dev without a region")
+	}
+	if !strings.Contains(sweep.sql, "AND region = $7") || len(sweep.args) != 7 || sweep.args[6] != "eu-west" {
+		t.Errorf("sweep = %+v, want it limited to region eu-west", sweep)
+	}
+}
+
+func TestCheckSchema_Region(t *testing.T) {
+	pk := []string{"cluster", "namespace", "pod_uid", "service"}
+	regionPK := []string{"cluster", "namespace", "pod_uid", "region", "service"}
+	withRegion := withColumn(serverColumns, "region", "text")
+
+	tests := []struct {
+		name           string
+		db             *fakeDB
+		wantMissing    bool
+		wantNoConflict bool
+	}{
+		{name: "region key", db: schemaDB(withRegion, regionPK)},
+		{name: "missing region column", db: schemaDB(serverColumns, pk), wantMissing: true, wantNoConflict: true},
+		{name: "unique index without region", db: schemaDB(withRegion, pk), wantNoConflict: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&PostgresSink{DB: tt.db, TableName: "server", Region: "eu-west"}).CheckSchema(context.Background())
+			if err != nil {
+				t.Fatalf("CheckSchema() error = %v", err)
+			}
+			if missing := len(got.Missing) == 1 && got.Missing[0] == "region text"; missing != tt.wantMissing {
+				t.Errorf("Missing = %v, want region text: %v", got.Missing, tt.wantMissing)
+			}
+			if got.NoConflictKey != tt.wantNoConflict {
+				t.Errorf("NoConflictKey = %v, want %v", got.NoConflictKey, tt.wantNoConflict)
+			}
+			if tt.wantNoConflict && !strings.Contains(got.String(), "+ unique index on (region, cluster, namespace, service, pod_uid)") {
+				t.Errorf("String() =\n%s\nwant the region key", got.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// RestoreStats is what Restore wrote.
+type RestoreStats struct {
+	Services  int
+	Endpoints int
+}
+
+// Restore writes every service of a JSON snapshot, as FileSink renders it,
+// read from r to sink in one pass (observer restore), e.g. to refill a
+// wiped table before the controller takes over again. The snapshot must be
+// of snapshotVersion and of cluster, so another cluster's state is never
+// written under this one's name; nothing is written otherwise. Like a
+// reconcile, each Sync also prunes the service's rows the snapshot lacks.
+func Restore(ctx context.Context, sink Sink, r io.Reader, cluster string) (RestoreStats, error) {
+	var snap snapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return RestoreStats{}, fmt.Errorf("read snapshot: %w", err)
+	}
+	if snap.Version != snapshotVersion {
+		return RestoreStats{}, fmt.Errorf("snapshot version %d is not supported, want %d", snap.Version, snapshotVersion)
+	}
+	if snap.Cluster != cluster {
+		return RestoreStats{}, fmt.Errorf("snapshot is of cluster %q, want %q", snap.Cluster, cluster)
+	}
+
+	var stats RestoreStats
+	for _, svc := range snap.Services {
+		rows := make(map[string]endpointRow, len(svc.Endpoints))
+		for _, e := range svc.Endpoints {
+			rows[e.UID] = e
+		}
+		if err := sink.Sync(ctx, cluster, svc.Namespace, svc.Service, rows); err != nil {
+			return stats, fmt.Errorf("restore %s/%s: %w", svc.Namespace, svc.Service, err)
+		}
+		stats.Services++
+		stats.Endpoints += len(rows)
+	}
+	return stats, nil
+}
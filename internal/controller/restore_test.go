@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+func TestRestore_RoundTrip(t *testing.T) {
+	web := map[string]endpointRow{
+		"uid-1": {UID: "uid-1", Name: "web-1", IP: "10.0.0.1", Port: 8080, PodLabels: `{"version":"v2"}`, Owner: "Deployment/web"},
+		"uid-2": {UID: "uid-2", Name: "web-2", IP: "fd00::2", AddressType: discoveryv1.AddressTypeIPv6, Slices: "web-a,web-b"},
+	}
+	db := map[string]endpointRow{
+		"gen": {UID: "gen", IP: "10.0.1.1", NodeName: "node-1"},
+	}
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	file := &FileSink{Path: path}
+	ctx := context.Background()
+	for svc, rows := range map[string]map[string]endpointRow{"web": web, "db": db, "empty": {}} {
+		if err := file.Sync(ctx, "dev", "default", svc, rows); err != nil {
+			t.Fatalf("Sync() of %s error = %v", svc, err)
+		}
+	}
+
+	restore := func(sink Sink) RestoreStats {
+		t.Helper()
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = f.Close() }()
+		stats, err := Restore(ctx, sink, f, "dev")
+		if err != nil {
+			t.Fatalf("Restore() error = %v", err)
+		}
+		return stats
+	}
+
+	var syncs []string
+	got := map[string]map[string]endpointRow{}
+	if stats := restore(syncFunc(func(cluster, namespace, service string, rows map[string]endpointRow) error {
+		syncs = append(syncs, cluster+"/"+namespace+"/"+service)
+		got[service] = rows
+		return nil
+	})); stats != (RestoreStats{Services: 3, Endpoints: 3}) {
+		t.Errorf("stats = %+v, want 3 services with 3 endpoints", stats)
+	}
+	if want := []string{"dev/default/db", "dev/default/empty", "dev/default/web"}; !slices.Equal(syncs, want) {
+		t.Errorf("syncs = %v, want %v", syncs, want)
+	}
+	if !maps.Equal(got["web"], web) || !maps.Equal(got["db"], db) || len(got["empty"]) != 0 {
+		t.Errorf("restored rows = %v, want the synced ones", got)
+	}
+
+	// Into the table: an upsert per endpoint, enriched columns included,
+	// and a prune per service.
+	fake := &fakeDB{}
+	restore(&PostgresSink{DB: fake, TableName: "server", PodLabels: true, Owner: true})
+	ups := fake.statements("INSERT INTO")
+	if len(ups) != 3 {
+		t.Fatalf("upserts = %+v, want one per endpoint", ups)
+	}
+	for _, u := range ups {
+		if u.args[0] != "dev" || !strings.Contains(u.sql, "pod_labels, owner)") {
+			t.Errorf("upsert %s %v, want dev with pod_labels and owner", u.sql, u.args)
+		}
+		if u.args[3] == "uid-1" {
+			if l, o := u.args[6].(*string), u.args[7].(*string); l == nil || *l != `{"version":"v2"}` || o == nil || *o != "Deployment/web" {
+				t.Errorf("uid-1 written with pod_labels %v owner %v", l, o)
+			}
+		}
+	}
+	if prunes := fake.statements("DELETE FROM"); len(prunes) != 3 || fake.commits != 3 {
+		t.Errorf("prunes = %d, commits = %d, want one of each per service", len(prunes), fake.commits)
+	}
+}
+
+// syncFunc is a Sink handing each Sync to a function.
+type syncFunc func(cluster, namespace, service string, rows map[string]endpointRow) error
+
+func (f syncFunc) Sync(_ context.Context, cluster, namespace, service string, rows map[string]endpointRow) error {
+	return f(cluster, namespace, service, rows)
+}
+
+func (f syncFunc) Delete(context.Context, string, string, string) error { return nil }
+
+func TestRestore_RejectsSnapshot(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name:    "other cluster",
+			data:    `{"version": 1, "cluster": "prod", "services": [{"namespace": "default", "service": "web", "endpoints": []}]}`,
+			wantErr: `snapshot is of cluster "prod", want "dev"`,
+		},
+		{
+			name:    "newer version",
+			data:    `{"version": 2, "cluster": "dev", "services": []}`,
+			wantErr: "snapshot version 2 is not supported, want 1",
+		},
+		{
+			name:    "not a snapshot",
+			data:    `[{"cluster": "dev"}]`,
+			wantErr: "read snapshot",
+		},
+		{
+			name:    "hosts file",
+			data:    "# generated by observer for cluster dev\n10.0.0.1\tweb.default\n",
+			wantErr: "read snapshot",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &recordingSink{}
+			_, err := Restore(context.Background(), sink, strings.NewReader(tt.data), "dev")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Restore() error = %v, want %q", err, tt.wantErr)
+			}
+			if len(sink.syncs) != 0 {
+				t.Errorf("syncs = %v, want nothing written", sink.syncs)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// HangupResync runs a full sync of every matching service, like --once,
+// each time a signal arrives on Signals (SIGHUP), while the controllers
+// keep running. It forces a rewrite without a restart, e.g. after rows were
+// edited by hand. A signal arriving during a pass queues at most one more
+// pass, given a Signals buffer of one.
+type HangupResync struct {
+	Reconciler *EndpointSliceReconciler
+	// Namespace limits the sync to one namespace; empty is all.
+	Namespace string
+	Signals   <-chan os.Signal
+	Log       logr.Logger
+}
+
+// Start waits for signals until ctx is done. It's a manager Runnable.
+func (h *HangupResync) Start(ctx context.Context) error {
+	ctx = log.IntoContext(ctx, h.Log)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case sig := <-h.Signals:
+			h.resync(ctx, sig)
+		}
+	}
+}
+
+// resync runs one full sync pass, unless writes are paused. The writes of
+// the pass go through the reconciler's Breaker: while it's open they fail
+// and the pass reports them.
+func (h *HangupResync) resync(ctx context.Context, sig os.Signal) {
+	if h.Reconciler.Pause.Paused() {
+		h.Log.Info("full resync requested, skipping it, writes are paused", "signal", sig.String())
+		return
+	}
+	h.Log.Info("full resync requested", "signal", sig.String())
+	start := time.Now()
+	if err := h.Reconciler.SyncAll(ctx, h.Namespace); err != nil {
+		h.Log.Error(err, "full resync failed", "duration", time.Since(start))
+		return
+	}
+	h.Log.Info("full resync finished", "duration", time.Since(start))
+}
+
+// SelectorResync runs SyncAllSelected each time Changes fires, i.e. once the
+// --selector=@file changed, so the services it now selects are written and
+// those it no longer does are deleted without waiting for their next event.
+// A change arriving during a pass queues at most one more pass, given a
+// Changes buffer of one. A change while writes are paused is kept pending
+// and synced once they resume.
+type SelectorResync struct {
+	Reconciler *EndpointSliceReconciler
+	// Namespace limits the sync to one namespace; empty is all.
+	Namespace string
+	Changes   <-chan struct{}
+	Log       logr.Logger
+
+	pausedDelay time.Duration // pausedRequeueDelay if zero
+}
+
+// Start waits for changes until ctx is done. It's a manager Runnable.
+func (s *SelectorResync) Start(ctx context.Context) error {
+	delay := s.pausedDelay
+	if delay == 0 {
+		delay = pausedRequeueDelay
+	}
+	ctx = log.IntoContext(ctx, s.Log)
+	var pending <-chan time.Time // polls for the resume while a change waits
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.Changes:
+		case <-pending:
+		}
+		if s.Reconciler.Pause.Paused() {
+			if pending == nil {
+				s.Log.Info("selector changed, resyncing once writes resume", "selector", s.Reconciler.selector())
+			}
+			pending = time.After(delay)
+			continue
+		}
+		pending = nil
+		s.resync(ctx)
+	}
+}
+
+// resync runs one full sync pass with the current selector.
+func (s *SelectorResync) resync(ctx context.Context) {
+	s.Log.Info("selector changed, resyncing", "selector", s.Reconciler.selector())
+	start := time.Now()
+	if err := s.Reconciler.SyncAllSelected(ctx, s.Namespace); err != nil {
+		s.Log.Error(err, "selector resync failed", "duration", time.Since(start))
+		return
+	}
+	s.Log.Info("selector resync finished", "duration", time.Since(start))
+}
@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"github.com/jackc/pgx/v5/pgconn"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestHangupResync(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1")),
+		newSlice("other", "db-a", "db", podEndpoint("uid-2", "db-1", "10.0.0.2")),
+	).Build()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A second signal arrives during the first pass; the second pass ends the
+	// run.
+	signals := make(chan os.Signal, 1)
+	sink := &hookSink{}
+	sink.onSync = func() error {
+		switch len(sink.syncs) {
+		case 1: // the last service of the first pass is being written
+			signals <- syscall.SIGHUP
+		case 3:
+			cancel()
+		}
+		return nil
+	}
+	var lines []string
+	h := &HangupResync{
+		Reconciler: &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev"},
+		Signals:    signals,
+		Log:        funcr.New(func(prefix, args string) { lines = append(lines, args) }, funcr.Options{}),
+	}
+	signals <- syscall.SIGHUP
+	if err := h.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	want := []string{"dev/default/web", "dev/other/db", "dev/default/web", "dev/other/db"}
+	if !slices.Equal(sink.syncs, want) {
+		t.Errorf("syncs = %v, want every service written on each signal: %v", sink.syncs, want)
+	}
+	logs := strings.Join(lines, "\n")
+	for _, msg := range []string{`"msg"="full resync requested" "signal"="hangup"`, `"msg"="full sync finished" "services"=2 "failed"=0`} {
+		if !strings.Contains(logs, msg) {
+			t.Errorf("logs = %s, want %s", logs, msg)
+		}
+	}
+}
+
+func TestHangupResync_PausedAndBreaker(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1")),
+		newSlice("other", "db-a", "db", podEndpoint("uid-2", "db-1", "10.0.0.2")),
+	).Build()
+	sink := &recordingSink{err: &pgconn.PgError{Code: "08006"}}
+	pause := &Pause{}
+	pause.Set(true)
+	breaker := &Breaker{Threshold: 1, Cooldown: time.Minute, Log: logr.Discard()}
+	defer breakerState.Set(breakerClosed)
+	var lines []string
+	h := &HangupResync{
+		Reconciler: &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", Pause: pause, Breaker: breaker},
+		Log:        funcr.New(func(prefix, args string) { lines = append(lines, args) }, funcr.Options{}),
+	}
+
+	h.resync(context.Background(), syscall.SIGHUP)
+	if len(sink.syncs) != 0 {
+		t.Errorf("syncs = %v while paused, want none", sink.syncs)
+	}
+	if logs := strings.Join(lines, "\n"); !strings.Contains(logs, "writes are paused") {
+		t.Errorf("logs = %s, want the skipped resync logged", logs)
+	}
+
+	// The first write fails and opens the breaker, which refuses the next.
+	pause.Set(false)
+	h.resync(context.Background(), syscall.SIGHUP)
+	if want := []string{"dev/default/web"}; !slices.Equal(sink.syncs, want) {
+		t.Errorf("syncs = %v, want %v only, the breaker open after it", sink.syncs, want)
+	}
+	if logs := strings.Join(lines, "\n"); !strings.Contains(logs, errBreakerOpen.Error()) {
+		t.Errorf("logs = %s, want other/db failed on the open breaker", logs)
+	}
+}
+
+func TestSelectorResync(t *testing.T) {
+	front := newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1"))
+	front.Labels["tier"] = "front"
+	back := newSlice("default", "db-a", "db", podEndpoint("uid-2", "db-1", "10.0.0.2"))
+	back.Labels["tier"] = "back"
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(front, back).Build()
+
+	path := filepath.Join(t.TempDir(), "selector")
+	writeLiveFile(t, path, "tier=front\n")
+	selector, err := LoadLiveValue(path, nil)
+	if err != nil {
+		t.Fatalf("LoadLiveValue() error = %v", err)
+	}
+	selector.Log = logr.Discard()
+	changes := make(chan struct{}, 1)
+	selector.OnChange = func(string) { changes <- struct{}{} }
+
+	sink := &recordingSink{}
+	r := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", SelectorFile: selector, Tracker: NewSyncTracker()}
+	for _, name := range []string{"web-a", "db-a"} {
+		if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}}); err != nil {
+			t.Fatalf("Reconcile(%s) error = %v", name, err)
+		}
+	}
+	if want := []string{"dev/default/web"}; !slices.Equal(sink.syncs, want) {
+		t.Fatalf("syncs = %v, want %v", sink.syncs, want)
+	}
+
+	writeLiveFile(t, path, "tier=back\n")
+	selector.reload()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var lines []string
+	s := &SelectorResync{
+		Reconciler: r,
+		Changes:    changes,
+		Log: funcr.New(func(prefix, args string) {
+			lines = append(lines, args)
+			if strings.Contains(args, "selector resync finished") {
+				cancel()
+			}
+		}, funcr.Options{}),
+	}
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	if want := []string{"dev/default/web", "dev/default/db"}; !slices.Equal(sink.syncs, want) {
+		t.Errorf("syncs = %v, want the newly selected db written: %v", sink.syncs, want)
+	}
+	if want := []string{"dev/default/web"}; !slices.Equal(sink.deletes, want) {
+		t.Errorf("deletes = %v, want the no longer selected web deleted: %v", sink.deletes, want)
+	}
+	if got := r.Tracker.services(); !slices.Equal(got, []types.NamespacedName{{Namespace: "default", Name: "db"}}) {
+		t.Errorf("tracked services = %v, want only default/db", got)
+	}
+	logs := strings.Join(lines, "\n")
+	for _, msg := range []string{`"msg"="selector changed, resyncing" "selector"="tier=back"`, `"msg"="deleted rows of a service no longer selected" "namespace"="default" "service"="web"`} {
+		if !strings.Contains(logs, msg) {
+			t.Errorf("logs = %s, want %s", logs, msg)
+		}
+	}
+}
+
+func TestSelectorResync_PendingWhilePaused(t *testing.T) {
+	front := newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1"))
+	front.Labels["tier"] = "front"
+	back := newSlice("default", "db-a", "db", podEndpoint("uid-2", "db-1", "10.0.0.2"))
+	back.Labels["tier"] = "back"
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(front, back).Build()
+
+	path := filepath.Join(t.TempDir(), "selector")
+	writeLiveFile(t, path, "tier=back\n")
+	selector, err := LoadLiveValue(path, nil)
+	if err != nil {
+		t.Fatalf("LoadLiveValue() error = %v", err)
+	}
+	pause := &Pause{}
+	pause.Set(true)
+	sink := &hookSink{}
+	sink.onSync = func() error {
+		if pause.Paused() {
+			t.Error("synced while writes are paused")
+		}
+		return nil
+	}
+	tracker := NewSyncTracker()
+	tracker.Record("default", "web") // written under the previous selector
+	r := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", SelectorFile: selector, Tracker: tracker, Pause: pause}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan struct{}, 1)
+	changes <- struct{}{}
+	var lines []string
+	s := &SelectorResync{
+		Reconciler: r,
+		Changes:    changes,
+		Log: funcr.New(func(prefix, args string) {
+			lines = append(lines, args)
+			switch {
+			case strings.Contains(args, "resyncing once writes resume"):
+				time.AfterFunc(20*time.Millisecond, func() { pause.Set(false) })
+			case strings.Contains(args, "selector resync finished"):
+				cancel()
+			}
+		}, funcr.Options{}),
+		pausedDelay: time.Millisecond,
+	}
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	if want := []string{"dev/default/db"}; !slices.Equal(sink.syncs, want) {
+		t.Errorf("syncs = %v, want %v once writes resumed", sink.syncs, want)
+	}
+	if want := []string{"dev/default/web"}; !slices.Equal(sink.deletes, want) {
+		t.Errorf("deletes = %v, want %v once writes resumed", sink.deletes, want)
+	}
+	if n := strings.Count(strings.Join(lines, "\n"), "resyncing once writes resume"); n != 1 {
+		t.Errorf("logged the pending resync %d times, want once", n)
+	}
+}
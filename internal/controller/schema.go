@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// schemaColumn is a column PostgresSink writes, with the data types
+// (as reported by information_schema) it can write into.
+type schemaColumn struct {
+	name  string
+	types []string
+}
+
+var (
+	textTypes      = []string{"text", "character varying"}
+	timestampTypes = []string{"timestamp with time zone", "timestamp without time zone"}
+)
+
+// conflictKey is the ON CONFLICT target of the upsert; the table needs a
+// unique index over exactly these columns.
+var conflictKey = []string{"cluster", "namespace", "service", "pod_uid"}
+
+// upsertKey is p's conflictKey, led by region with Region and without
+// namespace with OmitNamespace.
+func (p *PostgresSink) upsertKey() []string {
+	key := conflictKey
+	if p.OmitNamespace {
+		key = []string{"cluster", "service", "pod_uid"}
+	}
+	if p.Region != "" {
+		return append([]string{"region"}, key...)
+	}
+	return key
+}
+
+// requiredColumns lists the columns p writes. pod_ip may be text so FQDN
+// endpoints fit. RowFormatJSONB only needs the key, payload and last_seen.
+func (p *PostgresSink) requiredColumns() []schemaColumn {
+	var cols []schemaColumn
+	if p.RowFormat == RowFormatJSONB {
+		cols = []schemaColumn{
+			{"cluster", textTypes},
+			{"namespace", textTypes},
+			{"service", textTypes},
+			{"pod_uid", textTypes},
+			{"payload", []string{"jsonb"}},
+			{"last_seen", timestampTypes},
+		}
+	} else {
+		cols = []schemaColumn{
+			{"cluster", textTypes},
+			{"namespace", textTypes},
+			{"service", textTypes},
+			{"pod_uid", textTypes},
+			{"pod_name", textTypes},
+			{"pod_ip", append([]string{"inet"}, textTypes...)},
+			{"ready", []string{"boolean"}},
+			{"last_seen", timestampTypes},
+		}
+	}
+	if p.OmitNamespace {
+		cols = slices.DeleteFunc(cols, func(c schemaColumn) bool { return c.name == "namespace" })
+	}
+	if p.Region != "" {
+		cols = append(cols, schemaColumn{"region", textTypes})
+	}
+	for _, c := range p.optionalColumns() {
+		cols = append(cols, schemaColumn{c.name, c.types})
+	}
+	if p.SyncVersion {
+		cols = append(cols, schemaColumn{"sync_version", []string{"bigint"}})
+	}
+	return cols
+}
+
+// SchemaDiff describes how a table differs from what the observer writes.
+type SchemaDiff struct {
+	Table string
+	// Missing lists absent columns as "name type".
+	Missing []string
+	// WrongType lists columns of an unusable type as "name: have x, want y".
+	WrongType []string
+	// NoConflictKey is set when no unique index covers exactly the
+	// upsert key: (cluster, namespace, service, pod_uid), led by region with
+	// PostgresSink.Region and without namespace with OmitNamespace.
+	NoConflictKey bool
+
+	key []string // the upsert key checked for; nil is conflictKey
+}
+
+// Empty reports whether the table matches.
+func (d *SchemaDiff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.WrongType) == 0 && !d.NoConflictKey
+}
+
+// String renders the diff one problem per line, "+" for what must be added
+// and "~" for what must change.
+func (d *SchemaDiff) String() string {
+	if d.Empty() {
+		return fmt.Sprintf("table %s matches the expected schema\n", d.Table)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "table %s does not match the expected schema:\n", d.Table)
+	for _, c := range d.Missing {
+		fmt.Fprintf(&b, "+ column %s\n", c)
+	}
+	for _, c := range d.WrongType {
+		fmt.Fprintf(&b, "~ column %s\n", c)
+	}
+	if d.NoConflictKey {
+		fmt.Fprintf(&b, "+ unique index on (%s)\n", strings.Join(d.upsertKey(), ", "))
+	}
+	return b.String()
+}
+
+// Err is nil if the table matches, else an error naming every missing
+// column, column of the wrong type and the missing unique index on one
+// line, for failing at startup (--strict-table).
+func (d *SchemaDiff) Err() error {
+	if d.Empty() {
+		return nil
+	}
+	var problems []string
+	if len(d.Missing) > 0 {
+		problems = append(problems, "missing columns "+strings.Join(d.Missing, ", "))
+	}
+	if len(d.WrongType) > 0 {
+		problems = append(problems, "wrong column types "+strings.Join(d.WrongType, ", "))
+	}
+	if d.NoConflictKey {
+		problems = append(problems, "no unique index on ("+strings.Join(d.upsertKey(), ", ")+")")
+	}
+	return fmt.Errorf("table %s does not match the expected schema: %s", d.Table, strings.Join(problems, "; "))
+}
+
+func (d *SchemaDiff) upsertKey() []string {
+	if d.key == nil {
+		return conflictKey
+	}
+	return d.key
+}
+
+// CheckSchema compares TableName against the columns and unique index that
+// p writes with its options. It only reads the catalog.
+func (p *PostgresSink) CheckSchema(ctx context.Context) (*SchemaDiff, error) {
+	db, table := p.DB, p.TableName
+	ident, err := sanitizeTableIdent(table)
+	if err != nil {
+		return nil, err
+	}
+	schema, name := splitTableName(table)
+	diff := &SchemaDiff{Table: ident, key: p.upsertKey()}
+
+	rows, err := db.Query(ctx, `
+	  SELECT column_name::text, data_type::text
+	  FROM information_schema.columns
+	  WHERE table_schema = COALESCE($1, current_schema()) AND table_name = $2`, schema, name)
+	if err != nil {
+		return nil, fmt.Errorf("read columns of %s: %w", ident, err)
+	}
+	have := map[string]string{}
+	for rows.Next() {
+		var col, typ string
+		if err := rows.Scan(&col, &typ); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		have[col] = typ
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read columns of %s: %w", ident, err)
+	}
+
+	for _, c := range p.requiredColumns() {
+		typ, ok := have[c.name]
+		switch {
+		case !ok:
+			diff.Missing = append(diff.Missing, c.name+" "+c.types[0])
+		case !slices.Contains(c.types, typ):
+			diff.WrongType = append(diff.WrongType, fmt.Sprintf("%s: have %s, want %s", c.name, typ, strings.Join(c.types, " or ")))
+		}
+	}
+	if len(have) == 0 { // no table, so no index to look up either
+		diff.NoConflictKey = true
+		return diff, nil
+	}
+
+	// Unique constraints and plain unique indexes both satisfy ON CONFLICT;
+	// partial indexes don't.
+	rows, err = db.Query(ctx, `
+	  SELECT array_agg(a.attname::text ORDER BY a.attname)
+	  FROM pg_index i
+	  JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+	  WHERE i.indrelid = $1::regclass AND i.indisunique AND i.indpred IS NULL
+	  GROUP BY i.indexrelid`, ident)
+	if err != nil {
+		return nil, fmt.Errorf("read indexes of %s: %w", ident, err)
+	}
+	defer rows.Close()
+	want := slices.Sorted(slices.Values(diff.key))
+	diff.NoConflictKey = true
+	for rows.Next() {
+		var cols []string
+		if err := rows.Scan(&cols); err != nil {
+			return nil, err
+		}
+		if slices.Equal(cols, want) {
+			diff.NoConflictKey = false
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read indexes of %s: %w", ident, err)
+	}
+	return diff, nil
+}
@@ -0,0 +1,267 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// serverColumns is the schema from the README.
+var serverColumns = [][]any{
+	{"cluster", "text"},
+	{"namespace", "text"},
+	{"service", "text"},
+	{"pod_uid", "text"},
+	{"pod_name", "text"},
+	{"pod_ip", "inet"},
+	{"ready", "boolean"},
+	{"first_seen", "timestamp with time zone"},
+	{"last_seen", "timestamp with time zone"},
+}
+
+// schemaDB answers the catalog queries of CheckSchema with columns and
+// unique indexes (each a sorted column list).
+func schemaDB(columns [][]any, indexes ...[]string) *fakeDB {
+	return &fakeDB{queryFn: func(sql string, _ []any) ([][]any, error) {
+		if strings.Contains(sql, "information_schema.columns") {
+			return columns, nil
+		}
+		var out [][]any
+		for _, idx := range indexes {
+			out = append(out, []any{idx})
+		}
+		return out, nil
+	}}
+}
+
+func withColumn(cols [][]any, name, typ string) [][]any {
+	out := slices.Clone(cols)
+	for i, c := range out {
+		if c[0] == name {
+			out[i] = []any{name, typ}
+			return out
+		}
+	}
+	return append(out, []any{name, typ})
+}
+
+func withoutColumn(cols [][]any, name string) [][]any {
+	return slices.DeleteFunc(slices.Clone(cols), func(c []any) bool { return c[0] == name })
+}
+
+func TestCheckSchema(t *testing.T) {
+	pk := []string{"cluster", "namespace", "pod_uid", "service"}
+
+	tests := []struct {
+		name        string
+		db          *fakeDB
+		podLabels   bool
+		addressType bool
+		owner       bool
+		sliceNames  bool
+		rowFormat   string
+		syncVersion bool
+		omitNS      bool
+		want        SchemaDiff
+	}{
+		{
+			name: "README schema matches",
+			db:   schemaDB(serverColumns, pk),
+		},
+		{
+			name: "text pod_ip is accepted",
+			db:   schemaDB(withColumn(serverColumns, "pod_ip", "text"), pk),
+		},
+		{
+			name: "missing column",
+			db:   schemaDB(withoutColumn(serverColumns, "last_seen"), pk),
+			want: SchemaDiff{Missing: []string{"last_seen timestamp with time zone"}},
+		},
+		{
+			name: "wrong type",
+			db:   schemaDB(withColumn(serverColumns, "ready", "text"), pk),
+			want: SchemaDiff{WrongType: []string{"ready: have text, want boolean"}},
+		},
+		{
+			name:        "optional columns are required when enabled",
+			db:          schemaDB(withColumn(serverColumns, "pod_labels", "json"), pk),
+			podLabels:   true,
+			addressType: true,
+			owner:       true,
+			want: SchemaDiff{
+				Missing:   []string{"address_type text", "owner text"},
+				WrongType: []string{"pod_labels: have json, want jsonb"},
+			},
+		},
+		{
+			name:       "slice_names must be an array",
+			db:         schemaDB(withColumn(serverColumns, "slice_names", "text"), pk),
+			sliceNames: true,
+			want:       SchemaDiff{WrongType: []string{"slice_names: have text, want ARRAY"}},
+		},
+		{
+			name:      "jsonb rows need payload, not the wide columns",
+			db:        schemaDB(withoutColumn(withoutColumn(serverColumns, "pod_ip"), "ready"), pk),
+			owner:     true,
+			rowFormat: RowFormatJSONB,
+			want:      SchemaDiff{Missing: []string{"payload jsonb"}},
+		},
+		{
+			name:        "sync_version must be a bigint",
+			db:          schemaDB(withColumn(serverColumns, "sync_version", "integer"), pk),
+			syncVersion: true,
+			want:        SchemaDiff{WrongType: []string{"sync_version: have integer, want bigint"}},
+		},
+		{
+			name:   "namespace omitted",
+			db:     schemaDB(withoutColumn(serverColumns, "namespace"), []string{"cluster", "pod_uid", "service"}),
+			omitNS: true,
+		},
+		{
+			name:   "namespace omitted, key with namespace",
+			db:     schemaDB(serverColumns, pk),
+			omitNS: true,
+			want:   SchemaDiff{NoConflictKey: true},
+		},
+		{
+			name: "unique index over other columns",
+			db:   schemaDB(serverColumns, []string{"pod_ip"}, []string{"cluster", "namespace", "service"}),
+			want: SchemaDiff{NoConflictKey: true},
+		},
+		{
+			name: "missing table",
+			db:   schemaDB(nil),
+			want: SchemaDiff{
+				Missing: []string{
+					"cluster text", "namespace text", "service text", "pod_uid text", "pod_name text",
+					"pod_ip inet", "ready boolean", "last_seen timestamp with time zone",
+				},
+				NoConflictKey: true,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &PostgresSink{DB: tt.db, TableName: "public.server", PodLabels: tt.podLabels, AddressType: tt.addressType, Owner: tt.owner, SliceNames: tt.sliceNames, RowFormat: tt.rowFormat, SyncVersion: tt.syncVersion, OmitNamespace: tt.omitNS}
+			got, err := sink.CheckSchema(context.Background())
+			if err != nil {
+				t.Fatalf("CheckSchema() error = %v", err)
+			}
+			if !slices.Equal(got.Missing, tt.want.Missing) || !slices.Equal(got.WrongType, tt.want.WrongType) ||
+				got.NoConflictKey != tt.want.NoConflictKey {
+				t.Errorf("CheckSchema() = %+v, want %+v", got, tt.want)
+			}
+			if got.Empty() != tt.want.Empty() {
+				t.Errorf("Empty() = %v, want %v", got.Empty(), tt.want.Empty())
+			}
+			if len(tt.db.execs) != 0 {
+				t.Errorf("CheckSchema() wrote: %+v", tt.db.execs)
+			}
+		})
+	}
+}
+
+func TestCheckSchema_QueriesSchemaAndTable(t *testing.T) {
+	tests := []struct {
+		table      string
+		wantSchema any
+		wantTable  string
+	}{
+		{table: "server", wantSchema: (*string)(nil), wantTable: "server"},
+		{table: "observer.endpoints", wantSchema: "observer", wantTable: "endpoints"},
+		{table: "db.observer.endpoints", wantSchema: "observer", wantTable: "endpoints"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.table, func(t *testing.T) {
+			var args []any
+			db := &fakeDB{queryFn: func(sql string, a []any) ([][]any, error) {
+				if strings.Contains(sql, "information_schema.columns") {
+					args = a
+				}
+				return nil, nil
+			}}
+			if _, err := (&PostgresSink{DB: db, TableName: tt.table}).CheckSchema(context.Background()); err != nil {
+				t.Fatalf("CheckSchema() error = %v", err)
+			}
+			schema := args[0]
+			if s, ok := schema.(*string); ok && s != nil {
+				schema = *s
+			}
+			if schema != tt.wantSchema || args[1] != tt.wantTable {
+				t.Errorf("queried schema %v table %v, want %v %v", schema, args[1], tt.wantSchema, tt.wantTable)
+			}
+		})
+	}
+}
+
+func TestCheckSchema_QueryError(t *testing.T) {
+	db := &fakeDB{queryFn: func(string, []any) ([][]any, error) { return nil, errFake }}
+	if _, err := (&PostgresSink{DB: db, TableName: "server"}).CheckSchema(context.Background()); !errors.Is(err, errFake) {
+		t.Errorf("CheckSchema() error = %v, want %v", err, errFake)
+	}
+}
+
+func TestSchemaDiff_String(t *testing.T) {
+	d := &SchemaDiff{
+		Table:         `"public"."server"`,
+		Missing:       []string{"last_seen timestamp with time zone"},
+		WrongType:     []string{"ready: have text, want boolean"},
+		NoConflictKey: true,
+	}
+	want := `table "public"."server" does not match the expected schema:
++ column last_seen timestamp with time zone
+~ column ready: have text, want boolean
++ unique index on (cluster, namespace, service, pod_uid)
+`
+	if got := d.String(); got != want {
+		t.Errorf("String() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSchemaDiff_Err(t *testing.T) {
+	pk := []string{"cluster", "namespace", "pod_uid", "service"}
+	withOptions := withColumn(withColumn(withColumn(serverColumns, "pod_labels", "jsonb"), "owner", "text"), "node_name", "text")
+
+	tests := []struct {
+		name    string
+		db      *fakeDB
+		wantErr string
+	}{
+		{
+			name: "every column present",
+			db:   schemaDB(withOptions, pk),
+		},
+		{
+			name:    "optional columns missing",
+			db:      schemaDB(withoutColumn(withoutColumn(withOptions, "pod_labels"), "node_name"), pk),
+			wantErr: `table "public"."server" does not match the expected schema: missing columns pod_labels jsonb, node_name text`,
+		},
+		{
+			name: "missing, wrong type and no unique index",
+			db:   schemaDB(withColumn(withoutColumn(withOptions, "last_seen"), "owner", "integer")),
+			wantErr: `table "public"."server" does not match the expected schema: missing columns last_seen timestamp with time zone; ` +
+				`wrong column types owner: have integer, want text or character varying; no unique index on (cluster, namespace, service, pod_uid)`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &PostgresSink{DB: tt.db, TableName: "public.server", PodLabels: true, Owner: true, NodeName: true}
+			diff, err := sink.CheckSchema(context.Background())
+			if err != nil {
+				t.Fatalf("CheckSchema() error = %v", err)
+			}
+			err = diff.Err()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Err() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Err() = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -5,51 +5,118 @@ import (
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
-	"github.com/jackc/pgx/v5/pgxpool"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
 type ServiceReconciler struct {
 	client.Client
-	DB          *pgxpool.Pool
-	TableName   string
+	Sink        Sink
 	ClusterName string
+	// ClusterFile, if set, replaces ClusterName with its current value
+	// (--cluster=@file).
+	ClusterFile *LiveValue
+	Tracker     *SyncTracker
+	// Status, if set, forgets a deleted Service.
+	Status *SyncStatus
+	// Pause, while paused, makes every reconcile requeue without writing.
+	Pause *Pause
+	// Breaker, while open, makes deletes requeue without writing; resyncs
+	// go through Slices, which shares it.
+	Breaker *Breaker
+	// Slices, if set, resyncs a Service's endpoints through it whenever the
+	// Service is created or its spec changes.
+	Slices *EndpointSliceReconciler
+	// TableAnnotation, if set, is the annotation picking a Service's table
+	// (--table-annotation): changing it resyncs the Service too, which then
+	// writes all of its rows, so they move to the new table.
+	TableAnnotation string
+	// Shard leaves the Services of other shards to their replicas.
+	Shard Shard
+
+	backoff retryBackoff
 }
 
 func (r *ServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx).WithValues("service", req.NamespacedName)
+	if r.Pause.Paused() {
+		logger.V(2).Info("writes paused, requeueing")
+		return ctrl.Result{RequeueAfter: pausedRequeueDelay}, nil
+	}
+	if !r.Shard.Owns(req.Namespace, req.Name) {
+		return ctrl.Result{}, nil
+	}
 
 	// Try to get the Service; if it's gone, wipe rows for {cluster, ns, service}
 	var svc corev1.Service
 	err := r.Get(ctx, req.NamespacedName, &svc)
 	if client.IgnoreNotFound(err) != nil {
-		return ctrl.Result{}, err
+		return ctrl.Result{}, fmt.Errorf("get service %s: %w", req.NamespacedName, err)
 	}
 	if err != nil { // NotFound → delete rows
-		tbl := sanitizeTableIdent(r.TableName)
-		q := fmt.Sprintf(`DELETE FROM %s WHERE cluster=$1 AND namespace=$2 AND service=$3`, tbl)
-		if _, derr := r.DB.Exec(ctx, q, r.ClusterName, req.Namespace, req.Name); derr != nil {
-			return ctrl.Result{}, derr
+		if wait, ok := r.Breaker.Allow(); !ok {
+			logger.V(2).Info("database breaker open, requeueing", "wait", wait)
+			return ctrl.Result{RequeueAfter: wait}, nil
+		}
+		derr := r.Sink.Delete(ctx, r.ClusterFile.Or(r.ClusterName), req.Namespace, req.Name)
+		r.Breaker.Record(derr)
+		if derr != nil {
+			return resultForSinkError(logger, &r.backoff, req.NamespacedName, derr)
 		}
+		r.backoff.reset(req.NamespacedName)
+		r.Tracker.Forget(req.Namespace, req.Name)
+		r.Status.Forget(req.Namespace, req.Name)
+		r.Slices.ForgetService(req.Namespace, req.Name)
 		logger.V(1).Info("pruned rows for deleted service")
 		return ctrl.Result{}, nil
 	}
 
-	// Service still exists → nothing to do; EndpointSlice controller handles adds/updates.
-	return ctrl.Result{}, nil
+	// Service still exists → the EndpointSlice controller handles adds/updates,
+	// but a changed selector or port only reaches it once the slices are
+	// rewritten; resync now to close that window.
+	if r.Slices == nil {
+		return ctrl.Result{}, nil
+	}
+	// The result is the slice path's, so a debounced or failed write is
+	// retried; a periodic requeue only finds the set unchanged. If the table
+	// may have changed, the set written last is forgotten so the rows are
+	// all written, not skipped as unchanged.
+	if r.TableAnnotation != "" {
+		r.Slices.ForgetService(req.Namespace, req.Name)
+	}
+	res, err := r.Slices.ResyncService(ctx, req.Namespace, req.Name)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("resync service %s: %w", req.NamespacedName, err)
+	}
+	return res, nil
 }
 
 func (r *ServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&corev1.Service{}, builder.WithPredicates()).
+		Named(serviceControllerName).
+		For(&corev1.Service{}, builder.WithPredicates(serviceSpecChanged(r.TableAnnotation))).
 		WithOptions(controller.Options{MaxConcurrentReconciles: 1}).
 		Complete(r)
 }
 
-var _ = types.NamespacedName{}
+// serviceSpecChanged drops Service updates that leave the spec and the
+// table annotation, if any, as they were, such as status and other
+// annotation changes. Services have no generation to compare, so the specs
+// are.
+func serviceSpecChanged(tableAnnotation string) predicate.Predicate {
+	return predicate.Funcs{UpdateFunc: func(e event.UpdateEvent) bool {
+		old, ok := e.ObjectOld.(*corev1.Service)
+		cur, ok2 := e.ObjectNew.(*corev1.Service)
+		if !ok || !ok2 || !equality.Semantic.DeepEqual(old.Spec, cur.Spec) {
+			return true
+		}
+		return tableAnnotation != "" && old.Annotations[tableAnnotation] != cur.Annotations[tableAnnotation]
+	}}
+}
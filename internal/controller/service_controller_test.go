@@ -0,0 +1,243 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestServiceReconciler_WrapsErrors(t *testing.T) {
+	errAPI := errors.New("apiserver unavailable")
+	failingDB := &fakeDB{execFn: func(string, []any) (pgconn.CommandTag, error) { return pgconn.CommandTag{}, errFake }}
+
+	tests := []struct {
+		name  string
+		funcs interceptor.Funcs
+		db    *fakeDB
+		want  string
+		cause error
+	}{
+		{
+			name: "get service",
+			funcs: interceptor.Funcs{Get: func(context.Context, client.WithWatch, client.ObjectKey, client.Object, ...client.GetOption) error {
+				return errAPI
+			}},
+			db:    &fakeDB{},
+			want:  "get service default/svc: ",
+			cause: errAPI,
+		},
+		{
+			name:  "delete rows of a deleted service",
+			db:    failingDB,
+			want:  "delete default/svc: ",
+			cause: errFake,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithInterceptorFuncs(tt.funcs).Build()
+			r := &ServiceReconciler{Client: c, Sink: &PostgresSink{DB: tt.db, TableName: "server"}, ClusterName: "dev", Tracker: NewSyncTracker()}
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "svc"}})
+			if !errors.Is(err, tt.cause) || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("Reconcile() error = %v, want %v starting with %q", err, tt.cause, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceReconciler_PruneAction(t *testing.T) {
+	tests := []struct {
+		action string
+		want   string
+	}{
+		{action: PruneDelete, want: `DELETE FROM "server" WHERE cluster = $1 AND namespace = $2 AND service = $3`},
+		{action: PruneClear, want: `UPDATE "server" SET pod_ip = NULL, ready = false WHERE cluster = $1 AND namespace = $2 AND service = $3 AND pod_ip IS NOT NULL`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()
+			db := &fakeDB{}
+			r := &ServiceReconciler{Client: c, Sink: &PostgresSink{DB: db, TableName: "server", PruneAction: tt.action}, ClusterName: "dev", Tracker: NewSyncTracker()}
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "gone"}}); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if len(db.execs) != 1 || db.execs[0].sql != tt.want {
+				t.Errorf("statements = %+v, want %s", db.execs, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceReconciler_ResyncsOnServiceChange(t *testing.T) {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}, Spec: corev1.ServiceSpec{Selector: map[string]string{"app": "web"}}}
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		svc, newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1")),
+	).Build()
+	sink := &recordingSink{}
+	sliceReconciler := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", RequeueAfter: time.Minute}
+	r := &ServiceReconciler{Client: c, Sink: sink, ClusterName: "dev", Tracker: NewSyncTracker(), Slices: sliceReconciler}
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"}}
+
+	res, err := r.Reconcile(ctx, req)
+	if err != nil || res.RequeueAfter != time.Minute {
+		t.Fatalf("Reconcile() = %+v, %v, want the slice path's requeue", res, err)
+	}
+	if len(sink.syncs) != 1 || !slices.Equal(slices.Sorted(maps.Keys(sink.last)), []string{"uid-1"}) {
+		t.Fatalf("syncs = %v, last = %v, want web synced with uid-1", sink.syncs, sink.last)
+	}
+
+	// The selector moves to other pods: the slices are rewritten, and the
+	// Service update syncs them without a slice event.
+	svc.Spec.Selector = map[string]string{"app": "web", "track": "canary"}
+	if err := c.Update(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(ctx, newSlice("default", "web-a", "web")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Create(ctx, newSlice("default", "web-b", "web", podEndpoint("uid-2", "web-canary-1", "10.0.0.2"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(sink.syncs) != 2 || !slices.Equal(slices.Sorted(maps.Keys(sink.last)), []string{"uid-2"}) {
+		t.Errorf("syncs = %v, last = %v, want web resynced with uid-2 only", sink.syncs, sink.last)
+	}
+
+	// Reconciling again finds the set unchanged and writes nothing.
+	if _, err := r.Reconcile(ctx, req); err != nil || len(sink.syncs) != 2 {
+		t.Errorf("unchanged resync: error = %v, syncs = %v, want no new write", err, sink.syncs)
+	}
+}
+
+// TestServiceReconciler_RecreatedWithSamePods deletes a Service and creates
+// it again while its pods keep running: the set is the one written before
+// the delete, but the rows are gone, so it must be written again.
+func TestServiceReconciler_RecreatedWithSamePods(t *testing.T) {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		svc, newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1")),
+	).Build()
+	sink := &recordingSink{}
+	sliceReconciler := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev"}
+	r := &ServiceReconciler{Client: c, Sink: sink, ClusterName: "dev", Slices: sliceReconciler}
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"}}
+
+	if _, err := r.Reconcile(ctx, req); err != nil || len(sink.syncs) != 1 {
+		t.Fatalf("Reconcile() error = %v, syncs = %v, want web synced", err, sink.syncs)
+	}
+	if err := c.Delete(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil || len(sink.deletes) != 1 {
+		t.Fatalf("Reconcile() error = %v, deletes = %v, want web's rows deleted", err, sink.deletes)
+	}
+
+	svc = &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	if err := c.Create(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(sink.syncs) != 2 || !slices.Equal(slices.Sorted(maps.Keys(sink.last)), []string{"uid-1"}) {
+		t.Errorf("syncs = %v, last = %v, want web written again with uid-1", sink.syncs, sink.last)
+	}
+}
+
+func TestEndpointSliceReconciler_ResyncServiceFilters(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1")),
+	).Build()
+
+	tests := []struct {
+		name string
+		r    *EndpointSliceReconciler
+		want int
+	}{
+		{name: "no filter", r: &EndpointSliceReconciler{}, want: 1},
+		{name: "other service name", r: &EndpointSliceReconciler{ServiceName: "db"}},
+		{name: "no slice matches the label selector", r: &EndpointSliceReconciler{LabelSelector: "tier=frontend"}},
+		{name: "denied service", r: &EndpointSliceReconciler{Services: NameFilter{Deny: []string{"web"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &recordingSink{}
+			tt.r.Client, tt.r.Sink, tt.r.ClusterName = c, sink, "dev"
+			if _, err := tt.r.ResyncService(context.Background(), "default", "web"); err != nil {
+				t.Fatalf("ResyncService() error = %v", err)
+			}
+			if len(sink.syncs) != tt.want {
+				t.Errorf("syncs = %v, want %d", sink.syncs, tt.want)
+			}
+		})
+	}
+}
+
+// TestServiceReconciler_TableAnnotationChanged writes a Service's unchanged
+// rows again once its table annotation changes, so they reach the new
+// table.
+func TestServiceReconciler_TableAnnotationChanged(t *testing.T) {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		svc, newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1")),
+	).Build()
+	sink := &recordingSink{}
+	es := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", RequeueAfter: time.Minute}
+	r := &ServiceReconciler{Client: c, Sink: sink, ClusterName: "dev", Slices: es, TableAnnotation: "observer.io/table"}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"}}
+	for range 2 {
+		if _, err := r.Reconcile(context.Background(), req); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+	}
+	if len(sink.syncs) != 2 {
+		t.Errorf("syncs = %v, want each resync written even though the set is unchanged", sink.syncs)
+	}
+}
+
+func TestServiceSpecChanged(t *testing.T) {
+	old := &corev1.Service{Spec: corev1.ServiceSpec{Selector: map[string]string{"app": "web"}}}
+	status := old.DeepCopy()
+	status.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "203.0.113.1"}}
+	status.Annotations = map[string]string{"note": "x"}
+	selector := old.DeepCopy()
+	selector.Spec.Selector["track"] = "canary"
+	ports := old.DeepCopy()
+	ports.Spec.Ports = []corev1.ServicePort{{Name: "http", Port: 8080}}
+	table := old.DeepCopy()
+	table.Annotations = map[string]string{"observer.io/table": "team.endpoints"}
+
+	p := serviceSpecChanged("observer.io/table")
+	for name, tt := range map[string]struct {
+		cur  *corev1.Service
+		want bool
+	}{
+		"status and annotations": {cur: status},
+		"selector":               {cur: selector, want: true},
+		"ports":                  {cur: ports, want: true},
+		"table annotation":       {cur: table, want: true},
+	} {
+		if got := p.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: tt.cur}); got != tt.want {
+			t.Errorf("%s: Update() = %v, want %v", name, got, tt.want)
+		}
+	}
+}
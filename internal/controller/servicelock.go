@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// serviceLocks serializes the syncs of each service, so two reconciles of
+// one service (e.g. of two of its slices, with MaxConcurrentReconciles > 1)
+// can't interleave their list of the slices and their write, while those of
+// different services still run concurrently. A service's lock is freed once
+// nobody holds or waits for it. The zero value is ready.
+type serviceLocks struct {
+	mu    sync.Mutex
+	locks map[types.NamespacedName]*serviceLock
+}
+
+type serviceLock struct {
+	sync.Mutex
+	refs int // holders and waiters, guarded by serviceLocks.mu
+}
+
+// lock blocks until key is free, takes it and returns its unlock.
+func (l *serviceLocks) lock(key types.NamespacedName) (unlock func()) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = map[types.NamespacedName]*serviceLock{}
+	}
+	sl := l.locks[key]
+	if sl == nil {
+		sl = &serviceLock{}
+		l.locks[key] = sl
+	}
+	sl.refs++
+	l.mu.Unlock()
+
+	sl.Lock()
+	return func() {
+		sl.Unlock()
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if sl.refs--; sl.refs == 0 {
+			delete(l.locks, key)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestServiceLocks(t *testing.T) {
+	var l serviceLocks
+	web := types.NamespacedName{Namespace: "default", Name: "web"}
+	db := types.NamespacedName{Namespace: "default", Name: "db"}
+
+	unlockWeb := l.lock(web)
+	// Another service isn't held up.
+	l.lock(db)()
+
+	locked := make(chan struct{})
+	go func() {
+		defer l.lock(web)()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("second lock of a service taken while the first is held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlockWeb()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second lock of a service not taken once the first is released")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		l.mu.Lock()
+		n := len(l.locks)
+		l.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d locks left once released, want none", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Two slices of one service reconciled at once must write in turn: each
+// transaction's upserts followed by its prune, never mixed with the other's.
+func TestReconcile_SerializesService(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1")),
+		newSlice("default", "web-b", "web", podEndpoint("uid-2", "web-2", "10.0.0.2")),
+	).Build()
+	db := &fakeDB{execFn: func(sql string, _ []any) (pgconn.CommandTag, error) {
+		if strings.Contains(sql, "INSERT INTO") {
+			time.Sleep(5 * time.Millisecond) // leave room for the other reconcile to cut in
+		}
+		return pgconn.NewCommandTag("OK 1"), nil
+	}}
+	r := &EndpointSliceReconciler{
+		Client:            c,
+		Sink:              &PostgresSink{DB: db, TableName: "server"},
+		ClusterName:       "dev",
+		HeartbeatInterval: time.Nanosecond, // write every time, though nothing changed
+	}
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"web-a", "web-b", "web-a", "web-b"} {
+		wg.Go(func() {
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}}
+			if _, err := r.Reconcile(context.Background(), req); err != nil {
+				t.Errorf("Reconcile(%s) error = %v", name, err)
+			}
+		})
+	}
+	wg.Wait()
+
+	var got []string
+	for _, e := range db.execs {
+		switch {
+		case strings.Contains(e.sql, "INSERT INTO"):
+			got = append(got, "upsert")
+		case strings.Contains(e.sql, "DELETE FROM"):
+			got = append(got, "prune")
+		}
+	}
+	want := strings.Repeat("upsert upsert prune ", 4)
+	if s := strings.Join(got, " ") + " "; s != want {
+		t.Errorf("writes = %s, want %s", s, want)
+	}
+}
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// Shard splits the services among Count replicas (--shard-count,
+// --shard-index): a replica writes a service only if
+// hash(namespace/service) % Count == Index, so each service has exactly one
+// writer and its prunes stay with it. The zero value, or a Count of one,
+// owns every service.
+//
+// The hash is FNV-1a, so the assignment is the same on every replica and
+// across restarts; changing Count moves most services to another replica,
+// whose next write of each takes over its rows.
+type Shard struct {
+	Count int
+	Index int
+}
+
+// Owns reports whether the service namespace/service belongs to this
+// shard.
+func (s Shard) Owns(namespace, service string) bool {
+	if s.Count <= 1 {
+		return true
+	}
+	return shardOf(namespace, service, s.Count) == s.Index
+}
+
+// shardOf is the shard of namespace/service among count.
+func shardOf(namespace, service string, count int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(namespace + "/" + service))
+	return int(h.Sum32() % uint32(count))
+}
+
+// StatefulSetOrdinal returns the ordinal of a StatefulSet pod from its
+// hostname, e.g. 2 for "observer-2", for --shard-index=-1.
+func StatefulSetOrdinal(hostname string) (int, error) {
+	i := strings.LastIndexByte(hostname, '-')
+	n, err := strconv.Atoi(hostname[i+1:])
+	if i < 0 || err != nil || n < 0 {
+		return 0, fmt.Errorf("hostname %q doesn't end in a StatefulSet ordinal", hostname)
+	}
+	return n, nil
+}
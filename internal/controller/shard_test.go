@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestShard_Owns(t *testing.T) {
+	for _, s := range []Shard{{}, {Count: 1}} {
+		if !s.Owns("default", "web") {
+			t.Errorf("%+v doesn't own default/web, want every service owned", s)
+		}
+	}
+
+	// Each service belongs to exactly one of the shards, and the split is
+	// roughly even.
+	const count, services = 4, 4000
+	owned := make([]int, count)
+	for i := range services {
+		ns, svc := fmt.Sprintf("team-%d", i%10), fmt.Sprintf("svc-%d", i)
+		var owners []int
+		for idx := range count {
+			if (Shard{Count: count, Index: idx}).Owns(ns, svc) {
+				owners = append(owners, idx)
+			}
+		}
+		if len(owners) != 1 {
+			t.Fatalf("%s/%s owned by shards %v, want exactly one", ns, svc, owners)
+		}
+		owned[owners[0]]++
+	}
+	for idx, n := range owned {
+		if n < services/count*8/10 || n > services/count*12/10 {
+			t.Errorf("shard %d owns %d of %d services, want about %d", idx, n, services, services/count)
+		}
+	}
+}
+
+func TestStatefulSetOrdinal(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     int
+		wantErr  bool
+	}{
+		{hostname: "observer-0", want: 0},
+		{hostname: "observer-eu-12", want: 12},
+		{hostname: "observer", wantErr: true},
+		{hostname: "observer-7d4b9c", wantErr: true},
+		{hostname: "observer-", wantErr: true},
+		{hostname: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hostname, func(t *testing.T) {
+			got, err := StatefulSetOrdinal(tt.hostname)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("StatefulSetOrdinal(%q) = %d, %v; want %d, error: %v", tt.hostname, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEndpointSliceReconciler_Shard(t *testing.T) {
+	b := fake.NewClientBuilder().WithScheme(newTestScheme(t))
+	var reqs []types.NamespacedName
+	for i := range 8 {
+		svc := fmt.Sprintf("svc-%d", i)
+		b = b.WithObjects(newSlice("default", svc+"-abc", svc, podEndpoint(fmt.Sprintf("uid-%d", i), svc, fmt.Sprintf("10.0.0.%d", i+1))))
+		reqs = append(reqs, types.NamespacedName{Namespace: "default", Name: svc + "-abc"})
+	}
+	c := b.Build()
+
+	var all []string
+	for idx := range 2 {
+		sink := &recordingSink{}
+		shard := Shard{Count: 2, Index: idx}
+		r := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", Shard: shard}
+		for _, req := range reqs {
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: req}); err != nil {
+				t.Fatalf("Reconcile(%s) error = %v", req, err)
+			}
+		}
+		for _, key := range sink.syncs {
+			if svc := strings.TrimPrefix(key, "dev/default/"); !shard.Owns("default", svc) {
+				t.Errorf("shard %d synced %s of another shard", idx, key)
+			}
+		}
+		synced := sink.syncs
+
+		// SyncAll writes the same services, though it lists all of them
+		// for the Sweeper.
+		sink.syncs = nil
+		if err := r.SyncAll(context.Background(), ""); err != nil {
+			t.Fatalf("SyncAll() error = %v", err)
+		}
+		if !slices.Equal(sink.syncs, synced) {
+			t.Errorf("shard %d: SyncAll() synced %v, Reconcile() %v", idx, sink.syncs, synced)
+		}
+		if services, err := r.listServices(context.Background(), ""); err != nil || len(services) != len(reqs) {
+			t.Errorf("shard %d: listServices() = %d services, %v; want all %d", idx, len(services), err, len(reqs))
+		}
+		all = append(all, synced...)
+	}
+	slices.Sort(all)
+	if len(all) != len(reqs) || len(slices.Compact(slices.Clone(all))) != len(reqs) {
+		t.Errorf("shards synced %v, want each of the %d services once", all, len(reqs))
+	}
+}
+
+func TestServiceReconciler_Shard(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()
+	var owner, other string
+	for i := 0; owner == "" || other == ""; i++ {
+		name := fmt.Sprintf("svc-%d", i)
+		if (Shard{Count: 2}).Owns("default", name) {
+			owner = name
+		} else {
+			other = name
+		}
+	}
+	sink := &recordingSink{}
+	r := &ServiceReconciler{Client: c, Sink: sink, ClusterName: "dev", Shard: Shard{Count: 2}}
+	for _, name := range []string{owner, other} {
+		if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}}); err != nil {
+			t.Fatalf("Reconcile(%s) error = %v", name, err)
+		}
+	}
+	if want := []string{"dev/default/" + owner}; !slices.Equal(sink.deletes, want) {
+		t.Errorf("deletes = %v, want only %v of this shard", sink.deletes, want)
+	}
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Sink receives the desired state of a service. Sync replaces the stored set
+// for {cluster,namespace,service} with rows; Delete removes it entirely.
+type Sink interface {
+	Sync(ctx context.Context, cluster, namespace, service string, rows map[string]endpointRow) error
+	Delete(ctx context.Context, cluster, namespace, service string) error
+}
+
+// FanOutSink forwards every call to all of its sinks, whatever the others
+// returned. The first is the primary, the table: only its error is
+// returned, so only it fails the reconcile, feeds the breaker and is
+// retried with it. The others are auxiliary (webhook, Kafka, ...); their
+// errors are logged and counted, and a RetrySink retries them on its own.
+type FanOutSink []Sink
+
+func (f FanOutSink) Sync(ctx context.Context, cluster, namespace, service string, rows map[string]endpointRow) error {
+	var err error
+	for i, s := range f {
+		serr := s.Sync(ctx, cluster, namespace, service, rows)
+		if i == 0 {
+			err = serr
+		} else if serr != nil {
+			auxSinkFailed(ctx, s, namespace, service, sinkOpSync, serr)
+		}
+	}
+	return err
+}
+
+func (f FanOutSink) Delete(ctx context.Context, cluster, namespace, service string) error {
+	var err error
+	for i, s := range f {
+		serr := s.Delete(ctx, cluster, namespace, service)
+		if i == 0 {
+			err = serr
+		} else if serr != nil {
+			auxSinkFailed(ctx, s, namespace, service, sinkOpDelete, serr)
+		}
+	}
+	return err
+}
+
+func auxSinkFailed(ctx context.Context, s Sink, namespace, service, op string, err error) {
+	name := sinkName(s)
+	auxSinkErrors.WithLabelValues(name, op).Inc()
+	log.FromContext(ctx).Error(err, "auxiliary sink write failed, primary unaffected",
+		"sink", name, "namespace", namespace, "service", service, "op", op)
+}
+
+// sinkName names s in logs and metrics.
+func sinkName(s Sink) string {
+	if r, ok := s.(*RetrySink); ok && r.Name != "" {
+		return r.Name
+	}
+	return fmt.Sprintf("%T", s)
+}
+
+// sortedRows returns rows ordered by UID so serialized output is stable.
+func sortedRows(rows map[string]endpointRow) []endpointRow {
+	out := make([]endpointRow, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].UID < out[j].UID })
+	return out
+}
+
+// diffRows compares two desired sets by UID. Rows that are new or whose
+// content changed are reported as added; rows missing from next as removed.
+// Both results are ordered by UID.
+func diffRows(prev, next map[string]endpointRow) (added, removed []endpointRow) {
+	for uid, r := range next {
+		if old, ok := prev[uid]; !ok || old != r {
+			added = append(added, r)
+		}
+	}
+	for uid, r := range prev {
+		if _, ok := next[uid]; !ok {
+			removed = append(removed, r)
+		}
+	}
+	sort.Slice(added, func(i, j int) bool { return added[i].UID < added[j].UID })
+	sort.Slice(removed, func(i, j int) bool { return removed[i].UID < removed[j].UID })
+	return added, removed
+}
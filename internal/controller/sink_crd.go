@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	observerv1alpha1 "github.com/ealebed/observer/api/v1alpha1"
+)
+
+// ObservedServiceSink is a Sink publishing each service's endpoints in the
+// status of an ObservedService of the same namespace and name
+// (--publish-crd), so `kubectl get observedservices` shows what was written
+// without access to the database. The object is created on the first Sync,
+// owned by its Service so it goes along with it, and deleted by Delete.
+//
+// A Sync that leaves the endpoints as they are doesn't write, so heartbeats
+// cost one read. Replicas syncing the same service retry on conflict.
+type ObservedServiceSink struct {
+	Client client.Client
+	// Reader, if set, reads ObservedServices and Services instead of
+	// Client, e.g. the manager's API reader so they aren't cached.
+	Reader client.Reader
+	// Now is the clock of LastChangeTime; nil is time.Now.
+	Now func() time.Time
+}
+
+func (s *ObservedServiceSink) Sync(ctx context.Context, cluster, namespace, service string, rows map[string]endpointRow) error {
+	key := types.NamespacedName{Namespace: namespace, Name: service}
+	status := observedStatus(cluster, rows)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var obj observerv1alpha1.ObservedService
+		err := s.reader().Get(ctx, key, &obj)
+		if apierrors.IsNotFound(err) {
+			obj, err = s.create(ctx, key)
+		}
+		if err != nil {
+			return err
+		}
+
+		added, removed := diffObserved(obj.Status.Endpoints, status.Endpoints)
+		if obj.Status.LastChangeTime != nil && added == 0 && removed == 0 &&
+			obj.Status.Cluster == status.Cluster && obj.Status.EndpointCount == status.EndpointCount {
+			return nil
+		}
+		status.Added, status.Removed = added, removed
+		status.LastChangeTime = &metav1.Time{Time: s.now()}
+		obj.Status = status
+		return s.Client.Status().Update(ctx, &obj)
+	})
+	if err != nil {
+		return fmt.Errorf("publish observedservice %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *ObservedServiceSink) Delete(ctx context.Context, _, namespace, service string) error {
+	obj := &observerv1alpha1.ObservedService{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: service}}
+	if err := client.IgnoreNotFound(s.Client.Delete(ctx, obj)); err != nil {
+		return fmt.Errorf("delete observedservice %s/%s: %w", namespace, service, err)
+	}
+	return nil
+}
+
+// create creates the ObservedService of key, owned by its Service if that
+// still exists. One created meanwhile by another replica is read instead.
+func (s *ObservedServiceSink) create(ctx context.Context, key types.NamespacedName) (observerv1alpha1.ObservedService, error) {
+	obj := observerv1alpha1.ObservedService{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}}
+	var svc corev1.Service
+	switch err := s.reader().Get(ctx, key, &svc); {
+	case err == nil:
+		obj.OwnerReferences = []metav1.OwnerReference{{APIVersion: "v1", Kind: "Service", Name: svc.Name, UID: svc.UID}}
+	case !apierrors.IsNotFound(err):
+		return obj, err
+	}
+	err := s.Client.Create(ctx, &obj)
+	if apierrors.IsAlreadyExists(err) {
+		err = s.reader().Get(ctx, key, &obj)
+	}
+	return obj, err
+}
+
+func (s *ObservedServiceSink) reader() client.Reader {
+	if s.Reader != nil {
+		return s.Reader
+	}
+	return s.Client
+}
+
+func (s *ObservedServiceSink) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// observedStatus is the status listing rows, without the change fields.
+func observedStatus(cluster string, rows map[string]endpointRow) observerv1alpha1.ObservedServiceStatus {
+	sorted := sortedRows(rows)
+	n := int32(len(sorted)) //nolint:gosec // far fewer endpoints than that fit in a Service
+	status := observerv1alpha1.ObservedServiceStatus{Cluster: cluster, EndpointCount: n}
+	if len(sorted) > observerv1alpha1.MaxListedEndpoints {
+		sorted, status.Truncated = sorted[:observerv1alpha1.MaxListedEndpoints], true
+	}
+	for _, r := range sorted {
+		status.Endpoints = append(status.Endpoints, observerv1alpha1.ObservedEndpoint{
+			UID: r.UID, Name: r.Name, IP: r.IP, Port: r.Port, NodeName: r.NodeName, Owner: r.Owner,
+		})
+	}
+	return status
+}
+
+// diffObserved counts the endpoints of next that are new or changed since
+// prev, and those of prev missing from next, like diffRows.
+func diffObserved(prev, next []observerv1alpha1.ObservedEndpoint) (added, removed int32) {
+	old := make(map[string]observerv1alpha1.ObservedEndpoint, len(prev))
+	for _, e := range prev {
+		old[e.UID] = e
+	}
+	for _, e := range next {
+		if o, ok := old[e.UID]; !ok || o != e {
+			added++
+		}
+		delete(old, e.UID)
+	}
+	return added, int32(len(old)) //nolint:gosec // at most MaxListedEndpoints
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	observerv1alpha1 "github.com/ealebed/observer/api/v1alpha1"
+)
+
+// TestObservedServiceSink_Envtest runs a reconcile through the sink against
+// a real API server with the CRD of manifests/crd installed, so the status
+// must pass its schema too. It needs the envtest binaries (make
+// test-envtest).
+func TestObservedServiceSink_Envtest(t *testing.T) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS not set; run make test-envtest")
+	}
+	env := &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "manifests", "crd")},
+		ErrorIfCRDPathMissing: true,
+	}
+	restCfg, err := env.Start()
+	if err != nil {
+		t.Fatalf("start envtest: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := env.Stop(); err != nil {
+			t.Errorf("stop envtest: %v", err)
+		}
+	})
+	c, err := client.New(restCfg, client.Options{Scheme: newObservedScheme(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+	}
+	slice := newSlice("default", "web-abc", "web",
+		podEndpoint("uid-1", "web-1", "10.0.0.1"), podEndpoint("uid-2", "web-2", "10.0.0.2"))
+	for _, obj := range []client.Object{svc, slice} {
+		if err := c.Create(ctx, obj); err != nil {
+			t.Fatalf("create %s: %v", obj.GetName(), err)
+		}
+	}
+
+	sink := &ObservedServiceSink{Client: c}
+	r := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web-abc"}}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	var obj observerv1alpha1.ObservedService
+	if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "web"}, &obj); err != nil {
+		t.Fatalf("get observedservice: %v", err)
+	}
+	if len(obj.OwnerReferences) != 1 || obj.OwnerReferences[0].UID != svc.UID {
+		t.Errorf("owner references = %+v, want the Service %s", obj.OwnerReferences, svc.UID)
+	}
+	if st := obj.Status; st.Cluster != "dev" || st.EndpointCount != 2 || len(st.Endpoints) != 2 || st.Endpoints[0].IP != "10.0.0.1" {
+		t.Errorf("status = %+v, want both endpoints of cluster dev", st)
+	}
+
+	// Deleting the Service deletes its ObservedService with the rows.
+	if err := c.Delete(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+	sr := &ServiceReconciler{Client: c, Sink: sink, ClusterName: "dev"}
+	if _, err := sr.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"}}); err != nil {
+		t.Fatalf("ServiceReconciler.Reconcile() error = %v", err)
+	}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "web"}, &obj); !apierrors.IsNotFound(err) {
+		t.Errorf("get after the Service was deleted: error = %v, want not found", err)
+	}
+}
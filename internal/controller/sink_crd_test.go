@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	observerv1alpha1 "github.com/ealebed/observer/api/v1alpha1"
+)
+
+func newObservedScheme(t testing.TB) *runtime.Scheme {
+	t.Helper()
+	scheme := newTestScheme(t)
+	if err := observerv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return scheme
+}
+
+func getObserved(t *testing.T, c client.Client, namespace, name string) *observerv1alpha1.ObservedService {
+	t.Helper()
+	var obj observerv1alpha1.ObservedService
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: name}, &obj); err != nil {
+		t.Fatalf("get observedservice: %v", err)
+	}
+	return &obj
+}
+
+func TestObservedServiceSink_Sync(t *testing.T) {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "svc-uid"}}
+	c := fake.NewClientBuilder().WithScheme(newObservedScheme(t)).
+		WithStatusSubresource(&observerv1alpha1.ObservedService{}).WithObjects(svc).Build()
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	sink := &ObservedServiceSink{Client: c, Now: func() time.Time { return now }}
+	ctx := context.Background()
+
+	rows := map[string]endpointRow{
+		"uid-2": {UID: "uid-2", Name: "web-2", IP: "10.0.0.2", Port: 8080, NodeName: "node-b"},
+		"uid-1": {UID: "uid-1", Name: "web-1", IP: "10.0.0.1", Port: 8080, NodeName: "node-a", Owner: "Deployment/web"},
+	}
+	if err := sink.Sync(ctx, "dev", "default", "web", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	obj := getObserved(t, c, "default", "web")
+	if len(obj.OwnerReferences) != 1 || obj.OwnerReferences[0].Kind != "Service" || obj.OwnerReferences[0].UID != "svc-uid" {
+		t.Errorf("owner references = %+v, want the Service", obj.OwnerReferences)
+	}
+	want := observerv1alpha1.ObservedServiceStatus{
+		Cluster:       "dev",
+		EndpointCount: 2,
+		Endpoints: []observerv1alpha1.ObservedEndpoint{
+			{UID: "uid-1", Name: "web-1", IP: "10.0.0.1", Port: 8080, NodeName: "node-a", Owner: "Deployment/web"},
+			{UID: "uid-2", Name: "web-2", IP: "10.0.0.2", Port: 8080, NodeName: "node-b"},
+		},
+		Added:          2,
+		LastChangeTime: &metav1.Time{Time: now},
+	}
+	if got := obj.Status; !equality.Semantic.DeepEqual(got, want) {
+		t.Errorf("status = %+v, want %+v", got, want)
+	}
+
+	// The same endpoints again, as on a heartbeat, write nothing.
+	now = now.Add(time.Minute)
+	if err := sink.Sync(ctx, "dev", "default", "web", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if again := getObserved(t, c, "default", "web"); again.ResourceVersion != obj.ResourceVersion {
+		t.Errorf("unchanged Sync() wrote the object: resourceVersion %s, was %s", again.ResourceVersion, obj.ResourceVersion)
+	}
+
+	// One endpoint moves, one goes away and one is new.
+	rows = map[string]endpointRow{
+		"uid-1": {UID: "uid-1", Name: "web-1", IP: "10.0.0.9", Port: 8080, NodeName: "node-a", Owner: "Deployment/web"},
+		"uid-3": {UID: "uid-3", Name: "web-3", IP: "10.0.0.3", Port: 8080},
+	}
+	if err := sink.Sync(ctx, "dev", "default", "web", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	got := getObserved(t, c, "default", "web").Status
+	if got.EndpointCount != 2 || got.Added != 2 || got.Removed != 1 || !got.LastChangeTime.Time.Equal(now) {
+		t.Errorf("status after a change = %+v, want 2 endpoints, 2 added, 1 removed at %s", got, now)
+	}
+}
+
+func TestObservedServiceSink_SyncWithoutService(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newObservedScheme(t)).
+		WithStatusSubresource(&observerv1alpha1.ObservedService{}).Build()
+	sink := &ObservedServiceSink{Client: c}
+
+	if err := sink.Sync(context.Background(), "dev", "default", "web", map[string]endpointRow{}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	obj := getObserved(t, c, "default", "web")
+	if len(obj.OwnerReferences) != 0 {
+		t.Errorf("owner references = %+v, want none without a Service", obj.OwnerReferences)
+	}
+	if obj.Status.EndpointCount != 0 || obj.Status.LastChangeTime == nil {
+		t.Errorf("status = %+v, want no endpoints, with a change time", obj.Status)
+	}
+}
+
+func TestObservedServiceSink_Truncates(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newObservedScheme(t)).
+		WithStatusSubresource(&observerv1alpha1.ObservedService{}).Build()
+	sink := &ObservedServiceSink{Client: c}
+	const n = observerv1alpha1.MaxListedEndpoints + 5
+	rows := make(map[string]endpointRow, n)
+	for i := range n {
+		uid := fmt.Sprintf("uid-%05d", i)
+		rows[uid] = endpointRow{UID: uid, IP: fmt.Sprintf("10.0.%d.%d", i/256, i%256)}
+	}
+
+	if err := sink.Sync(context.Background(), "dev", "default", "web", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	got := getObserved(t, c, "default", "web").Status
+	if got.EndpointCount != n || len(got.Endpoints) != observerv1alpha1.MaxListedEndpoints || !got.Truncated {
+		t.Errorf("status lists %d of %d endpoints, truncated: %v; want %d of %d, truncated",
+			len(got.Endpoints), got.EndpointCount, got.Truncated, observerv1alpha1.MaxListedEndpoints, n)
+	}
+	if last := got.Endpoints[len(got.Endpoints)-1].UID; last != fmt.Sprintf("uid-%05d", observerv1alpha1.MaxListedEndpoints-1) {
+		t.Errorf("last listed endpoint = %s, want the first by UID", last)
+	}
+}
+
+func TestObservedServiceSink_Delete(t *testing.T) {
+	obj := &observerv1alpha1.ObservedService{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	c := fake.NewClientBuilder().WithScheme(newObservedScheme(t)).WithObjects(obj).Build()
+	sink := &ObservedServiceSink{Client: c}
+
+	// Deleting twice is fine: the second finds nothing.
+	for range 2 {
+		if err := sink.Delete(context.Background(), "dev", "default", "web"); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+	}
+	err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "web"}, &observerv1alpha1.ObservedService{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("get after Delete() error = %v, want not found", err)
+	}
+}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Output formats understood by FileSink.
+const (
+	FileFormatJSON  = "json"
+	FileFormatHosts = "hosts"
+)
+
+// snapshotVersion is bumped whenever the JSON snapshot layout changes.
+const snapshotVersion = 1
+
+type snapshotService struct {
+	Namespace string        `json:"namespace"`
+	Service   string        `json:"service"`
+	Endpoints []endpointRow `json:"endpoints"`
+}
+
+type snapshot struct {
+	Version     int               `json:"version"`
+	Cluster     string            `json:"cluster"`
+	GeneratedAt time.Time         `json:"generatedAt"`
+	Services    []snapshotService `json:"services"`
+}
+
+// FileSink renders every known service to a single file, rewritten
+// atomically (temp file + rename) after each change.
+type FileSink struct {
+	Path   string
+	Format string // FileFormatJSON (default) or FileFormatHosts
+
+	mu       sync.Mutex
+	cluster  string
+	services map[types.NamespacedName][]endpointRow
+}
+
+func (f *FileSink) Sync(_ context.Context, cluster, namespace, service string, rows map[string]endpointRow) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.services == nil {
+		f.services = map[types.NamespacedName][]endpointRow{}
+	}
+	f.cluster = cluster
+	f.services[types.NamespacedName{Namespace: namespace, Name: service}] = sortedRows(rows)
+	return f.write()
+}
+
+func (f *FileSink) Delete(_ context.Context, cluster, namespace, service string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.cluster = cluster
+	delete(f.services, types.NamespacedName{Namespace: namespace, Name: service})
+	return f.write()
+}
+
+func (f *FileSink) snapshot() *snapshot {
+	snap := &snapshot{
+		Version:     snapshotVersion,
+		Cluster:     f.cluster,
+		GeneratedAt: time.Now().UTC(),
+		Services:    make([]snapshotService, 0, len(f.services)),
+	}
+	for key, rows := range f.services {
+		snap.Services = append(snap.Services, snapshotService{Namespace: key.Namespace, Service: key.Name, Endpoints: rows})
+	}
+	sort.Slice(snap.Services, func(i, j int) bool {
+		a, b := snap.Services[i], snap.Services[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Service < b.Service
+	})
+	return snap
+}
+
+func (f *FileSink) render() ([]byte, error) {
+	snap := f.snapshot()
+	switch f.Format {
+	case "", FileFormatJSON:
+		return json.MarshalIndent(snap, "", "  ")
+	case FileFormatHosts:
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "# generated by observer for cluster %s\n", snap.Cluster)
+		for _, svc := range snap.Services {
+			for _, e := range svc.Endpoints {
+				if e.AddressType == discoveryv1.AddressTypeFQDN {
+					continue // a hosts file maps addresses, not names
+				}
+				fmt.Fprintf(&b, "%s\t%s.%s", e.IP, svc.Service, svc.Namespace)
+				if e.Name != "" {
+					fmt.Fprintf(&b, " %s.%s.%s", e.Name, svc.Service, svc.Namespace)
+				}
+				b.WriteByte('\n')
+			}
+		}
+		return b.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", f.Format)
+	}
+}
+
+func (f *FileSink) write() error {
+	data, err := f.render()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), "."+filepath.Base(f.Path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.Path)
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+func TestFileSink_JSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "endpoints.json")
+	sink := &FileSink{Path: path}
+	ctx := context.Background()
+
+	if err := sink.Sync(ctx, "dev", "default", "b", map[string]endpointRow{
+		"uid-2": {UID: "uid-2", Name: "pod-2", IP: "10.0.0.2"},
+		"uid-1": {UID: "uid-1", Name: "pod-1", IP: "10.0.0.1"},
+	}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if err := sink.Sync(ctx, "dev", "default", "a", map[string]endpointRow{
+		"uid-3": {UID: "uid-3", IP: "10.0.0.3"},
+	}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	snap := readSnapshot(t, path)
+	if snap.Version != snapshotVersion || snap.Cluster != "dev" {
+		t.Errorf("snapshot header = version %d cluster %q", snap.Version, snap.Cluster)
+	}
+	if len(snap.Services) != 2 || snap.Services[0].Service != "a" || snap.Services[1].Service != "b" {
+		t.Fatalf("services = %+v, want a then b", snap.Services)
+	}
+	if eps := snap.Services[1].Endpoints; len(eps) != 2 || eps[0].UID != "uid-1" || eps[1].UID != "uid-2" {
+		t.Errorf("endpoints of b = %+v, want uid-1, uid-2", eps)
+	}
+
+	// Deleting a service prunes it from the next rendering.
+	if err := sink.Delete(ctx, "dev", "default", "b"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	snap = readSnapshot(t, path)
+	if len(snap.Services) != 1 || snap.Services[0].Service != "a" {
+		t.Errorf("services after delete = %+v, want only a", snap.Services)
+	}
+}
+
+func TestFileSink_Hosts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	sink := &FileSink{Path: path, Format: FileFormatHosts}
+
+	if err := sink.Sync(context.Background(), "dev", "default", "web", map[string]endpointRow{
+		"uid-1": {UID: "uid-1", Name: "web-0", IP: "10.0.0.1"},
+		"gen":   {UID: "gen", IP: "10.0.0.2"},
+		"fqdn":  {UID: "fqdn", IP: "web.example.com", AddressType: discoveryv1.AddressTypeFQDN},
+	}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"# generated by observer for cluster dev",
+		"10.0.0.2\tweb.default",
+		"10.0.0.1\tweb.default web-0.web.default",
+		"",
+	}, "\n")
+	if string(data) != want {
+		t.Errorf("hosts output =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestFileSink_AtomicReplace(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "endpoints.json")
+	if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// A reader holding the old file keeps seeing the old content.
+	old, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+
+	sink := &FileSink{Path: path}
+	if err := sink.Sync(context.Background(), "dev", "default", "a", nil); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	buf := make([]byte, 16)
+	n, _ := old.Read(buf)
+	if string(buf[:n]) != "old" {
+		t.Errorf("previously opened file content = %q, want old (file should be replaced, not truncated)", buf[:n])
+	}
+	if snap := readSnapshot(t, path); len(snap.Services) != 1 {
+		t.Errorf("new file services = %+v", snap.Services)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only the output file (temp files must be cleaned up)", len(entries))
+	}
+}
+
+func TestFileSink_UnknownFormat(t *testing.T) {
+	sink := &FileSink{Path: filepath.Join(t.TempDir(), "out"), Format: "xml"}
+	if err := sink.Sync(context.Background(), "dev", "default", "a", nil); err == nil {
+		t.Error("Sync() with unknown format expected error, got nil")
+	}
+}
+
+func readSnapshot(t *testing.T, path string) snapshot {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	return snap
+}
@@ -0,0 +1,220 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/ealebed/observer/internal/watchapi"
+)
+
+// defaultWatchBuffer is how many events a subscriber may lag behind when
+// WatchServer.Buffer is zero.
+const defaultWatchBuffer = 1024
+
+// WatchServer is a Sink serving the endpoint changes of each service to
+// gRPC subscribers (--grpc-bind-address). Like KafkaSink it diffs every
+// Sync against the last set of the service; a new subscriber first gets
+// that set as a snapshot. Events reflect what was read from the cluster,
+// whether or not the other sinks wrote it.
+//
+// Sends never block Sync: each subscriber has a buffer of Buffer events,
+// and one that falls further behind is dropped with RESOURCE_EXHAUSTED, to
+// watch again for a fresh snapshot.
+type WatchServer struct {
+	watchapi.UnimplementedEndpointWatcherServer
+
+	// Addr is the address Start listens on.
+	Addr   string
+	Buffer int
+	Log    logr.Logger
+
+	mu       sync.Mutex
+	services map[types.NamespacedName]watchedService
+	watchers map[types.NamespacedName]map[*watcher]struct{}
+}
+
+// watchedService is the last set synced for a service.
+type watchedService struct {
+	cluster string
+	rows    map[string]endpointRow
+}
+
+// watcher is one subscriber. dropped is closed once it fell behind.
+type watcher struct {
+	events  chan *watchapi.EndpointEvent
+	dropped chan struct{}
+}
+
+func (w *WatchServer) Sync(_ context.Context, cluster, namespace, service string, rows map[string]endpointRow) error {
+	key := types.NamespacedName{Namespace: namespace, Name: service}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	prev := w.services[key].rows
+	added, removed := diffRows(prev, rows)
+	var events []*watchapi.EndpointEvent
+	for i := range removed {
+		events = append(events, watchEvent(watchapi.EndpointEvent_REMOVED, cluster, key, &removed[i]))
+	}
+	for i := range added {
+		typ := watchapi.EndpointEvent_ADDED
+		if _, ok := prev[added[i].UID]; ok {
+			typ = watchapi.EndpointEvent_UPDATED
+		}
+		events = append(events, watchEvent(typ, cluster, key, &added[i]))
+	}
+	if w.services == nil {
+		w.services = map[types.NamespacedName]watchedService{}
+	}
+	w.services[key] = watchedService{cluster: cluster, rows: maps.Clone(rows)}
+	w.publish(key, events)
+	return nil
+}
+
+func (w *WatchServer) Delete(_ context.Context, cluster, namespace, service string) error {
+	key := types.NamespacedName{Namespace: namespace, Name: service}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	removed := sortedRows(w.services[key].rows)
+	events := make([]*watchapi.EndpointEvent, 0, len(removed))
+	for i := range removed {
+		events = append(events, watchEvent(watchapi.EndpointEvent_REMOVED, cluster, key, &removed[i]))
+	}
+	delete(w.services, key)
+	w.publish(key, events)
+	return nil
+}
+
+// publish queues events for every subscriber of key, dropping those whose
+// buffer is full. The caller holds mu.
+func (w *WatchServer) publish(key types.NamespacedName, events []*watchapi.EndpointEvent) {
+	for sub := range w.watchers[key] {
+		if !sub.offer(events) {
+			close(sub.dropped)
+			delete(w.watchers[key], sub)
+			grpcWatchersDropped.Inc()
+			w.Log.Info("dropped a watcher that fell behind", "namespace", key.Namespace, "service", key.Name)
+		}
+	}
+}
+
+// offer queues events without blocking and reports whether they all fit.
+func (sub *watcher) offer(events []*watchapi.EndpointEvent) bool {
+	for _, ev := range events {
+		select {
+		case sub.events <- ev:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// subscribe registers a subscriber of key and returns it with the current
+// set of key, so no change falls between the snapshot and the events.
+func (w *WatchServer) subscribe(key types.NamespacedName) (*watcher, watchedService) {
+	buffer := w.Buffer
+	if buffer <= 0 {
+		buffer = defaultWatchBuffer
+	}
+	sub := &watcher{events: make(chan *watchapi.EndpointEvent, buffer), dropped: make(chan struct{})}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.watchers == nil {
+		w.watchers = map[types.NamespacedName]map[*watcher]struct{}{}
+	}
+	if w.watchers[key] == nil {
+		w.watchers[key] = map[*watcher]struct{}{}
+	}
+	w.watchers[key][sub] = struct{}{}
+	grpcWatchers.Inc()
+	return sub, w.services[key]
+}
+
+func (w *WatchServer) unsubscribe(key types.NamespacedName, sub *watcher) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.watchers[key], sub)
+	if len(w.watchers[key]) == 0 {
+		delete(w.watchers, key)
+	}
+	grpcWatchers.Dec()
+}
+
+// Watch implements watchapi.EndpointWatcherServer.
+func (w *WatchServer) Watch(req *watchapi.WatchRequest, stream grpc.ServerStreamingServer[watchapi.EndpointEvent]) error {
+	if req.GetNamespace() == "" || req.GetService() == "" {
+		return status.Error(codes.InvalidArgument, "namespace and service are required")
+	}
+	key := types.NamespacedName{Namespace: req.GetNamespace(), Name: req.GetService()}
+	sub, current := w.subscribe(key)
+	defer w.unsubscribe(key, sub)
+	w.Log.V(1).Info("watcher subscribed", "namespace", key.Namespace, "service", key.Name, "endpoints", len(current.rows))
+
+	rows := sortedRows(current.rows)
+	for i := range rows {
+		if err := stream.Send(watchEvent(watchapi.EndpointEvent_ADDED, current.cluster, key, &rows[i])); err != nil {
+			return err
+		}
+	}
+	if err := stream.Send(watchEvent(watchapi.EndpointEvent_SYNCED, current.cluster, key, nil)); err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			w.Log.V(1).Info("watcher went away", "namespace", key.Namespace, "service", key.Name)
+			return nil
+		case ev := <-sub.events:
+			if err := stream.Send(ev); err != nil {
+				return err
+			}
+		case <-sub.dropped:
+			return status.Errorf(codes.ResourceExhausted, "fell more than %d events behind; watch again", cap(sub.events))
+		}
+	}
+}
+
+// Start serves Watch on Addr until ctx is done. It's a manager Runnable.
+func (w *WatchServer) Start(ctx context.Context) error {
+	lis, err := net.Listen("tcp", w.Addr)
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", w.Addr, err)
+	}
+	srv := grpc.NewServer()
+	watchapi.RegisterEndpointWatcherServer(srv, w)
+	go func() {
+		<-ctx.Done()
+		srv.Stop() // ends the watches, which never finish on their own
+	}()
+	w.Log.Info("serving gRPC watches", "addr", lis.Addr().String())
+	return srv.Serve(lis)
+}
+
+func watchEvent(typ watchapi.EndpointEvent_Type, cluster string, key types.NamespacedName, e *endpointRow) *watchapi.EndpointEvent {
+	ev := &watchapi.EndpointEvent{Type: typ, Cluster: cluster, Namespace: key.Namespace, Service: key.Name}
+	if e != nil {
+		ev.Endpoint = &watchapi.Endpoint{
+			Uid:         e.UID,
+			Name:        e.Name,
+			Ip:          e.IP,
+			Port:        e.Port,
+			AddressType: string(e.AddressType),
+			NodeName:    e.NodeName,
+		}
+	}
+	return ev
+}
@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/ealebed/observer/internal/watchapi"
+)
+
+// dialWatch serves w over an in-memory listener and returns a client.
+func dialWatch(t *testing.T, w *WatchServer) watchapi.EndpointWatcherClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	watchapi.RegisterEndpointWatcherServer(srv, w)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return watchapi.NewEndpointWatcherClient(conn)
+}
+
+// watchedEvent is the part of an EndpointEvent the tests compare.
+type watchedEvent struct {
+	typ watchapi.EndpointEvent_Type
+	uid string
+	ip  string
+}
+
+func recvEvents(t *testing.T, stream grpc.ServerStreamingClient[watchapi.EndpointEvent], n int) []watchedEvent {
+	t.Helper()
+	var got []watchedEvent
+	for range n {
+		ev, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv() after %v: %v", got, err)
+		}
+		if ev.GetCluster() != "dev" || ev.GetNamespace() != "default" || ev.GetService() != "web" {
+			t.Errorf("event %+v, want dev/default/web", ev)
+		}
+		got = append(got, watchedEvent{ev.GetType(), ev.GetEndpoint().GetUid(), ev.GetEndpoint().GetIp()})
+	}
+	return got
+}
+
+func TestWatchServer_ScaleUpAndDown(t *testing.T) {
+	slice := newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1"))
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(slice).Build()
+	watch := &WatchServer{Log: logr.Discard()}
+	r := &EndpointSliceReconciler{Client: c, Sink: FanOutSink{&recordingSink{}, watch}, ClusterName: "dev"}
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web-a"}}
+	scale := func(endpoints ...discoveryv1.Endpoint) {
+		t.Helper()
+		slice.Endpoints = endpoints
+		if err := c.Update(ctx, slice); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Reconcile(ctx, req); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := dialWatch(t, watch).Watch(watchCtx, &watchapi.WatchRequest{Namespace: "default", Service: "web"})
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	steps := []struct {
+		name   string
+		change func()
+		want   []watchedEvent
+	}{
+		{
+			name:   "snapshot",
+			change: func() {},
+			want:   []watchedEvent{{watchapi.EndpointEvent_ADDED, "uid-1", "10.0.0.1"}, {watchapi.EndpointEvent_SYNCED, "", ""}},
+		},
+		{
+			name: "scale up",
+			change: func() {
+				scale(podEndpoint("uid-1", "web-1", "10.0.0.1"), podEndpoint("uid-2", "web-2", "10.0.0.2"), podEndpoint("uid-3", "web-3", "10.0.0.3"))
+			},
+			want: []watchedEvent{{watchapi.EndpointEvent_ADDED, "uid-2", "10.0.0.2"}, {watchapi.EndpointEvent_ADDED, "uid-3", "10.0.0.3"}},
+		},
+		{
+			name:   "scale down",
+			change: func() { scale(podEndpoint("uid-3", "web-3", "10.0.0.3")) },
+			want:   []watchedEvent{{watchapi.EndpointEvent_REMOVED, "uid-1", "10.0.0.1"}, {watchapi.EndpointEvent_REMOVED, "uid-2", "10.0.0.2"}},
+		},
+		{
+			name:   "new IP",
+			change: func() { scale(podEndpoint("uid-3", "web-3", "10.0.0.9")) },
+			want:   []watchedEvent{{watchapi.EndpointEvent_UPDATED, "uid-3", "10.0.0.9"}},
+		},
+		{
+			name: "service deleted",
+			change: func() {
+				svc := &ServiceReconciler{Client: c, Sink: r.Sink, ClusterName: "dev", Tracker: NewSyncTracker()}
+				if _, err := svc.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"}}); err != nil {
+					t.Fatalf("Reconcile() of the Service error = %v", err)
+				}
+			},
+			want: []watchedEvent{{watchapi.EndpointEvent_REMOVED, "uid-3", "10.0.0.9"}},
+		},
+	}
+	for _, step := range steps {
+		step.change()
+		got := recvEvents(t, stream, len(step.want))
+		for i := range got {
+			if got[i] != step.want[i] {
+				t.Errorf("%s: events = %v, want %v", step.name, got, step.want)
+				break
+			}
+		}
+	}
+
+	// The subscription ends with the client.
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(grpcWatchers) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("observer_grpc_watchers = %v after the client went away, want 0", testutil.ToFloat64(grpcWatchers))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	watch.mu.Lock()
+	defer watch.mu.Unlock()
+	if len(watch.watchers) != 0 {
+		t.Errorf("watchers = %v, want none", watch.watchers)
+	}
+}
+
+func TestWatchServer_DropsSlowWatcher(t *testing.T) {
+	watch := &WatchServer{Buffer: 2, Log: logr.Discard()}
+	key := types.NamespacedName{Namespace: "default", Name: "web"}
+	slow, _ := watch.subscribe(key)
+	defer watch.unsubscribe(key, slow)
+	dropped := testutil.ToFloat64(grpcWatchersDropped)
+
+	rows := map[string]endpointRow{
+		"uid-1": {UID: "uid-1", IP: "10.0.0.1"},
+		"uid-2": {UID: "uid-2", IP: "10.0.0.2"},
+	}
+	if err := watch.Sync(context.Background(), "dev", "default", "web", rows); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-slow.dropped:
+		t.Fatal("watcher dropped with a full but not overflowing buffer")
+	default:
+	}
+
+	// A third event doesn't fit and must not block the Sync.
+	rows["uid-3"] = endpointRow{UID: "uid-3", IP: "10.0.0.3"}
+	if err := watch.Sync(context.Background(), "dev", "default", "web", rows); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-slow.dropped:
+	default:
+		t.Fatal("watcher not dropped after falling behind")
+	}
+	if got := testutil.ToFloat64(grpcWatchersDropped) - dropped; got != 1 {
+		t.Errorf("observer_grpc_watchers_dropped_total grew by %v, want 1", got)
+	}
+}
+
+func TestWatchServer_RequiresService(t *testing.T) {
+	client := dialWatch(t, &WatchServer{Buffer: 1, Log: logr.Discard()})
+
+	stream, err := client.Watch(context.Background(), &watchapi.WatchRequest{Namespace: "default"})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Watch() without a service: error = %v, want InvalidArgument", err)
+	}
+}
+
+func TestWatchServer_StopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- (&WatchServer{Addr: "127.0.0.1:0", Log: logr.Discard()}).Start(ctx) }()
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Start() error = %v, want nil once ctx is done", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start() still serving after ctx is done")
+	}
+}
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the request body when the
+// HTTPSink has a secret configured. With Gzip it's of the JSON before
+// compression.
+const SignatureHeader = "X-Observer-Signature"
+
+// BatchHeader numbers the requests of a sync split by HTTPSink.BatchSize as
+// "<batch>/<batches>", counting from 1, so a receiver can reassemble the set
+// of a service once it has every batch.
+const BatchHeader = "X-Observer-Batch"
+
+type webhookPayload struct {
+	Event     string        `json:"event"` // "sync" or "delete"
+	Cluster   string        `json:"cluster"`
+	Namespace string        `json:"namespace"`
+	Service   string        `json:"service"`
+	Rows      []endpointRow `json:"rows"`
+}
+
+// HTTPSink POSTs the desired rows of a service as JSON to URL.
+type HTTPSink struct {
+	URL    string
+	Secret string // optional HMAC key
+	Client *http.Client
+
+	// MaxRetries bounds how many times a failed POST is retried; Backoff is
+	// the initial delay, doubled after each attempt.
+	MaxRetries int
+	Backoff    time.Duration
+
+	// Gzip compresses each body, sent with Content-Encoding: gzip.
+	Gzip bool
+	// BatchSize, if set, splits the rows of a sync into requests of at most
+	// this many, in UID order and numbered in BatchHeader. Each is retried
+	// on its own; the sync fails if any of them does. Deletes are one
+	// request regardless.
+	BatchSize int
+}
+
+func (h *HTTPSink) Sync(ctx context.Context, cluster, namespace, service string, rows map[string]endpointRow) error {
+	all := sortedRows(rows)
+	if h.BatchSize <= 0 {
+		return h.post(ctx, &webhookPayload{
+			Event: "sync", Cluster: cluster, Namespace: namespace, Service: service, Rows: all,
+		}, "")
+	}
+	batches := max((len(all)+h.BatchSize-1)/h.BatchSize, 1)
+	for i := range batches {
+		chunk := all[i*h.BatchSize : min((i+1)*h.BatchSize, len(all))]
+		err := h.post(ctx, &webhookPayload{
+			Event: "sync", Cluster: cluster, Namespace: namespace, Service: service, Rows: chunk,
+		}, strconv.Itoa(i+1)+"/"+strconv.Itoa(batches))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *HTTPSink) Delete(ctx context.Context, cluster, namespace, service string) error {
+	return h.post(ctx, &webhookPayload{
+		Event: "delete", Cluster: cluster, Namespace: namespace, Service: service, Rows: []endpointRow{},
+	}, "")
+}
+
+// post sends payload, numbered batch if that's set, retrying as configured.
+func (h *HTTPSink) post(ctx context.Context, payload *webhookPayload, batch string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	header := http.Header{"Content-Type": {"application/json"}}
+	if h.Secret != "" {
+		header.Set(SignatureHeader, "sha256="+signPayload(h.Secret, body))
+	}
+	if batch != "" {
+		header.Set(BatchHeader, batch)
+	}
+	if h.Gzip {
+		if body, err = gzipBody(body); err != nil {
+			return err
+		}
+		header.Set("Content-Encoding", "gzip")
+	}
+
+	backoff := h.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := h.send(ctx, body, header)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= h.MaxRetries {
+			if batch != "" {
+				return fmt.Errorf("webhook %s/%s batch %s: %w", payload.Namespace, payload.Service, batch, err)
+			}
+			return fmt.Errorf("webhook %s/%s: %w", payload.Namespace, payload.Service, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// send performs one POST and reports whether a failure is worth retrying.
+func (h *HTTPSink) send(ctx context.Context, body []byte, header http.Header) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header = header.Clone()
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("unexpected status %s", resp.Status)
+	default:
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+}
+
+func gzipBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
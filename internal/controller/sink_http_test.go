@@ -0,0 +1,274 @@
+package controller
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHTTPSink_Sync(t *testing.T) {
+	var got webhookPayload
+	var signature string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		signature = req.Header.Get(SignatureHeader)
+		if want := "sha256=" + signPayload("s3cret", body); signature != want {
+			t.Errorf("signature = %q, want %q", signature, want)
+		}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sink := &HTTPSink{URL: srv.URL, Secret: "s3cret", Client: srv.Client()}
+	rows := map[string]endpointRow{
+		"uid-2": {UID: "uid-2", Name: "pod-2", IP: "10.0.0.2"},
+		"uid-1": {UID: "uid-1", Name: "pod-1", IP: "10.0.0.1"},
+	}
+	if err := sink.Sync(context.Background(), "dev", "default", "my-service", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if got.Event != "sync" || got.Cluster != "dev" || got.Namespace != "default" || got.Service != "my-service" {
+		t.Errorf("payload header fields = %+v", got)
+	}
+	if len(got.Rows) != 2 || got.Rows[0].UID != "uid-1" || got.Rows[1].UID != "uid-2" {
+		t.Errorf("payload rows = %+v, want uid-1, uid-2 in order", got.Rows)
+	}
+}
+
+func TestHTTPSink_DeleteWithoutSecret(t *testing.T) {
+	var got webhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if h := req.Header.Get(SignatureHeader); h != "" {
+			t.Errorf("unexpected signature header %q", h)
+		}
+		_ = json.NewDecoder(req.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	sink := &HTTPSink{URL: srv.URL, Client: srv.Client()}
+	if err := sink.Delete(context.Background(), "dev", "default", "my-service"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if got.Event != "delete" || got.Service != "my-service" || len(got.Rows) != 0 {
+		t.Errorf("payload = %+v, want delete event with no rows", got)
+	}
+}
+
+func TestHTTPSink_Retries(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		maxRetries int
+		wantCalls  int32
+		wantErr    bool
+	}{
+		{name: "succeeds after transient 503s", statuses: []int{503, 503, 200}, maxRetries: 3, wantCalls: 3},
+		{name: "429 is retried", statuses: []int{429, 200}, maxRetries: 1, wantCalls: 2},
+		{name: "gives up after max retries", statuses: []int{500, 500, 500}, maxRetries: 2, wantCalls: 3, wantErr: true},
+		{name: "4xx is not retried", statuses: []int{400, 200}, maxRetries: 3, wantCalls: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				n := calls.Add(1)
+				w.WriteHeader(tt.statuses[int(n-1)%len(tt.statuses)])
+			}))
+			defer srv.Close()
+
+			sink := &HTTPSink{URL: srv.URL, Client: srv.Client(), MaxRetries: tt.maxRetries}
+			err := sink.Sync(context.Background(), "dev", "default", "svc", nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Sync() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("server got %d calls, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestHTTPSink_Gzip(t *testing.T) {
+	var got webhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if enc := req.Header.Get("Content-Encoding"); enc != "gzip" {
+			t.Errorf("Content-Encoding = %q, want gzip", enc)
+		}
+		zr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			t.Errorf("body is not gzip: %v", err)
+			return
+		}
+		body, err := io.ReadAll(zr)
+		if err != nil {
+			t.Errorf("gunzip body: %v", err)
+		}
+		if want := "sha256=" + signPayload("s3cret", body); req.Header.Get(SignatureHeader) != want {
+			t.Errorf("signature = %q, want %q of the uncompressed body", req.Header.Get(SignatureHeader), want)
+		}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	rows := map[string]endpointRow{}
+	for i := range 500 {
+		uid := fmt.Sprintf("uid-%03d", i)
+		rows[uid] = endpointRow{UID: uid, Name: fmt.Sprintf("web-%03d", i), IP: fmt.Sprintf("10.0.%d.%d", i/256, i%256), Port: 8080}
+	}
+	sink := &HTTPSink{URL: srv.URL, Secret: "s3cret", Client: srv.Client(), Gzip: true}
+	if err := sink.Sync(context.Background(), "dev", "default", "web", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got.Service != "web" || !slices.Equal(got.Rows, sortedRows(rows)) {
+		t.Errorf("payload = %s/%s with %d rows, want web with all 500 in order", got.Namespace, got.Service, len(got.Rows))
+	}
+}
+
+func TestHTTPSink_Batches(t *testing.T) {
+	rowsOf := func(n int) map[string]endpointRow {
+		rows := map[string]endpointRow{}
+		for i := range n {
+			uid := fmt.Sprintf("uid-%d", i)
+			rows[uid] = endpointRow{UID: uid, IP: fmt.Sprintf("10.0.0.%d", i)}
+		}
+		return rows
+	}
+	tests := []struct {
+		name      string
+		batchSize int
+		rows      int
+		want      []string // X-Observer-Batch and row count of each request
+	}{
+		{name: "off", rows: 5, want: []string{" 5"}},
+		{name: "last batch partial", batchSize: 2, rows: 5, want: []string{"1/3 2", "2/3 2", "3/3 1"}},
+		{name: "exact multiple", batchSize: 2, rows: 4, want: []string{"1/2 2", "2/2 2"}},
+		{name: "fits one batch", batchSize: 10, rows: 5, want: []string{"1/1 5"}},
+		{name: "no rows", batchSize: 2, want: []string{"1/1 0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var got []string
+			var received []endpointRow
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				var p webhookPayload
+				_ = json.NewDecoder(req.Body).Decode(&p)
+				mu.Lock()
+				defer mu.Unlock()
+				got = append(got, fmt.Sprintf("%s %d", req.Header.Get(BatchHeader), len(p.Rows)))
+				received = append(received, p.Rows...)
+			}))
+			defer srv.Close()
+
+			rows := rowsOf(tt.rows)
+			sink := &HTTPSink{URL: srv.URL, Client: srv.Client(), BatchSize: tt.batchSize}
+			if err := sink.Sync(context.Background(), "dev", "default", "web", rows); err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("requests = %q, want %q", got, tt.want)
+			}
+			// Reassembled in order, the batches are the whole set.
+			if !slices.Equal(received, sortedRows(rows)) {
+				t.Errorf("reassembled rows = %v, want %v", received, sortedRows(rows))
+			}
+		})
+	}
+}
+
+func TestHTTPSink_BatchFails(t *testing.T) {
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls = append(calls, req.Header.Get(BatchHeader))
+		if req.Header.Get(BatchHeader) == "2/3" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	rows := map[string]endpointRow{}
+	for _, uid := range []string{"a", "b", "c"} {
+		rows[uid] = endpointRow{UID: uid}
+	}
+	sink := &HTTPSink{URL: srv.URL, Client: srv.Client(), BatchSize: 1}
+	err := sink.Sync(context.Background(), "dev", "default", "web", rows)
+	if err == nil || !strings.Contains(err.Error(), "batch 2/3") {
+		t.Errorf("Sync() error = %v, want batch 2/3 failed", err)
+	}
+	if !slices.Equal(calls, []string{"1/3", "2/3"}) {
+		t.Errorf("requests = %v, want none after the failed batch", calls)
+	}
+	if err := sink.Delete(context.Background(), "dev", "default", "web"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if last := calls[len(calls)-1]; last != "" {
+		t.Errorf("delete sent %s %q, want no batch", BatchHeader, last)
+	}
+}
+
+type recordingSink struct {
+	syncs   []string
+	deletes []string
+	last    map[string]endpointRow // rows of the latest Sync
+	err     error
+}
+
+func (r *recordingSink) Sync(_ context.Context, cluster, namespace, service string, rows map[string]endpointRow) error {
+	r.syncs = append(r.syncs, cluster+"/"+namespace+"/"+service)
+	r.last = rows
+	return r.err
+}
+
+func (r *recordingSink) Delete(_ context.Context, cluster, namespace, service string) error {
+	r.deletes = append(r.deletes, cluster+"/"+namespace+"/"+service)
+	return r.err
+}
+
+func TestFanOutSink(t *testing.T) {
+	failing := &recordingSink{err: errors.New("boom")}
+	ok := &recordingSink{}
+	sink := FanOutSink{failing, ok}
+
+	err := sink.Sync(context.Background(), "dev", "default", "svc", nil)
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Sync() error = %v, want boom", err)
+	}
+	if len(ok.syncs) != 1 {
+		t.Errorf("second sink got %d syncs after first failed, want 1", len(ok.syncs))
+	}
+
+	// Only the primary's error is returned; the others' are counted.
+	before := testutil.ToFloat64(auxSinkErrors.WithLabelValues("*controller.recordingSink", sinkOpSync))
+	if err := (FanOutSink{ok, failing}).Sync(context.Background(), "dev", "default", "svc", nil); err != nil {
+		t.Errorf("Sync() error = %v with only an auxiliary sink failing, want nil", err)
+	}
+	if got := testutil.ToFloat64(auxSinkErrors.WithLabelValues("*controller.recordingSink", sinkOpSync)) - before; got != 1 {
+		t.Errorf("observer_sink_errors_total grew by %v, want 1", got)
+	}
+
+	if err := (FanOutSink{ok}).Delete(context.Background(), "dev", "default", "svc"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if len(failing.deletes) != 0 || len(ok.deletes) != 1 {
+		t.Errorf("deletes = %v / %v", failing.deletes, ok.deletes)
+	}
+}
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Kafka event types.
+const (
+	EventEndpointAdded   = "endpoint_added"
+	EventEndpointRemoved = "endpoint_removed"
+	EventSnapshot        = "snapshot"
+	EventServiceDeleted  = "service_deleted"
+)
+
+type endpointEvent struct {
+	Type      string        `json:"type"`
+	Cluster   string        `json:"cluster"`
+	Namespace string        `json:"namespace"`
+	Service   string        `json:"service"`
+	Endpoint  *endpointRow  `json:"endpoint,omitempty"`
+	Endpoints []endpointRow `json:"endpoints,omitempty"`
+	Time      time.Time     `json:"time"`
+}
+
+// messageWriter is satisfied by *kafka.Writer.
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// KafkaSink emits endpoint change events keyed by "namespace/service". It
+// diffs against the last set it published for each service; the first sync
+// of a service after start-up publishes a full snapshot instead.
+type KafkaSink struct {
+	Writer messageWriter
+
+	mu   sync.Mutex
+	prev map[types.NamespacedName]map[string]endpointRow
+}
+
+func NewKafkaSink(brokers []string, topic string) *KafkaSink {
+	return &KafkaSink{Writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}}
+}
+
+func (k *KafkaSink) Sync(ctx context.Context, cluster, namespace, service string, rows map[string]endpointRow) error {
+	key := types.NamespacedName{Namespace: namespace, Name: service}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := time.Now().UTC()
+	base := endpointEvent{Cluster: cluster, Namespace: namespace, Service: service, Time: now}
+
+	var events []endpointEvent
+	prev, known := k.prev[key]
+	if !known {
+		ev := base
+		ev.Type = EventSnapshot
+		ev.Endpoints = sortedRows(rows)
+		events = append(events, ev)
+	} else {
+		added, removed := diffRows(prev, rows)
+		for i := range removed {
+			ev := base
+			ev.Type = EventEndpointRemoved
+			ev.Endpoint = &removed[i]
+			events = append(events, ev)
+		}
+		for i := range added {
+			ev := base
+			ev.Type = EventEndpointAdded
+			ev.Endpoint = &added[i]
+			events = append(events, ev)
+		}
+	}
+
+	if err := k.publish(ctx, key, events); err != nil {
+		return err
+	}
+	if k.prev == nil {
+		k.prev = map[types.NamespacedName]map[string]endpointRow{}
+	}
+	k.prev[key] = maps.Clone(rows)
+	return nil
+}
+
+func (k *KafkaSink) Delete(ctx context.Context, cluster, namespace, service string) error {
+	key := types.NamespacedName{Namespace: namespace, Name: service}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	ev := endpointEvent{Type: EventServiceDeleted, Cluster: cluster, Namespace: namespace, Service: service, Time: time.Now().UTC()}
+	if err := k.publish(ctx, key, []endpointEvent{ev}); err != nil {
+		return err
+	}
+	delete(k.prev, key)
+	return nil
+}
+
+func (k *KafkaSink) publish(ctx context.Context, key types.NamespacedName, events []endpointEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	msgs := make([]kafka.Message, 0, len(events))
+	for i := range events {
+		value, err := json.Marshal(&events[i])
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, kafka.Message{Key: []byte(key.String()), Value: value})
+	}
+	return k.Writer.WriteMessages(ctx, msgs...)
+}
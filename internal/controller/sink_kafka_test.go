@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type fakeWriter struct {
+	msgs []kafka.Message
+	err  error
+}
+
+func (f *fakeWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.msgs = append(f.msgs, msgs...)
+	return nil
+}
+
+func (f *fakeWriter) drain(t *testing.T) []endpointEvent {
+	t.Helper()
+	events := make([]endpointEvent, 0, len(f.msgs))
+	for _, m := range f.msgs {
+		if string(m.Key) != "default/my-service" {
+			t.Errorf("message key = %q, want default/my-service", m.Key)
+		}
+		var ev endpointEvent
+		if err := json.Unmarshal(m.Value, &ev); err != nil {
+			t.Fatalf("decode message: %v", err)
+		}
+		events = append(events, ev)
+	}
+	f.msgs = nil
+	return events
+}
+
+func TestKafkaSink_Events(t *testing.T) {
+	w := &fakeWriter{}
+	sink := &KafkaSink{Writer: w}
+	ctx := context.Background()
+
+	first := map[string]endpointRow{
+		"uid-1": {UID: "uid-1", IP: "10.0.0.1"},
+		"uid-2": {UID: "uid-2", IP: "10.0.0.2"},
+	}
+	if err := sink.Sync(ctx, "dev", "default", "my-service", first); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	events := w.drain(t)
+	if len(events) != 1 || events[0].Type != EventSnapshot || len(events[0].Endpoints) != 2 {
+		t.Fatalf("first sync events = %+v, want one snapshot with 2 endpoints", events)
+	}
+
+	if err := sink.Sync(ctx, "dev", "default", "my-service", first); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if events := w.drain(t); len(events) != 0 {
+		t.Errorf("unchanged sync emitted %+v, want nothing", events)
+	}
+
+	second := map[string]endpointRow{
+		"uid-2": {UID: "uid-2", IP: "10.0.0.2"},
+		"uid-3": {UID: "uid-3", IP: "10.0.0.3"},
+	}
+	if err := sink.Sync(ctx, "dev", "default", "my-service", second); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	events = w.drain(t)
+	if len(events) != 2 {
+		t.Fatalf("second sync emitted %d events, want 2: %+v", len(events), events)
+	}
+	if events[0].Type != EventEndpointRemoved || events[0].Endpoint.UID != "uid-1" {
+		t.Errorf("events[0] = %+v, want uid-1 removed", events[0])
+	}
+	if events[1].Type != EventEndpointAdded || events[1].Endpoint.UID != "uid-3" {
+		t.Errorf("events[1] = %+v, want uid-3 added", events[1])
+	}
+
+	if err := sink.Delete(ctx, "dev", "default", "my-service"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	events = w.drain(t)
+	if len(events) != 1 || events[0].Type != EventServiceDeleted || events[0].Cluster != "dev" {
+		t.Errorf("delete events = %+v, want one service_deleted", events)
+	}
+
+	// After a delete the service is unknown again, so the next sync snapshots.
+	if err := sink.Sync(ctx, "dev", "default", "my-service", second); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if events := w.drain(t); len(events) != 1 || events[0].Type != EventSnapshot {
+		t.Errorf("sync after delete = %+v, want a snapshot", events)
+	}
+}
+
+func TestKafkaSink_FailedWriteKeepsPreviousState(t *testing.T) {
+	w := &fakeWriter{}
+	sink := &KafkaSink{Writer: w}
+	ctx := context.Background()
+
+	if err := sink.Sync(ctx, "dev", "default", "my-service", map[string]endpointRow{"uid-1": {UID: "uid-1"}}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	w.drain(t)
+
+	w.err = errors.New("broker down")
+	next := map[string]endpointRow{"uid-1": {UID: "uid-1"}, "uid-2": {UID: "uid-2"}}
+	if err := sink.Sync(ctx, "dev", "default", "my-service", next); err == nil {
+		t.Fatal("Sync() expected error, got nil")
+	}
+
+	w.err = nil
+	if err := sink.Sync(ctx, "dev", "default", "my-service", next); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	events := w.drain(t)
+	if len(events) != 1 || events[0].Type != EventEndpointAdded || events[0].Endpoint.UID != "uid-2" {
+		t.Errorf("retry events = %+v, want uid-2 added", events)
+	}
+}
+
+func TestDiffRows(t *testing.T) {
+	prev := map[string]endpointRow{
+		"a": {UID: "a", IP: "10.0.0.1"},
+		"b": {UID: "b", IP: "10.0.0.2"},
+		"c": {UID: "c", IP: "10.0.0.3"},
+	}
+	next := map[string]endpointRow{
+		"b": {UID: "b", IP: "10.0.0.2"},
+		"c": {UID: "c", IP: "10.0.0.30"},
+		"d": {UID: "d", IP: "10.0.0.4"},
+	}
+	added, removed := diffRows(prev, next)
+	if len(added) != 2 || added[0].UID != "c" || added[1].UID != "d" {
+		t.Errorf("added = %+v, want c (changed) and d", added)
+	}
+	if len(removed) != 1 || removed[0].UID != "a" {
+		t.Errorf("removed = %+v, want a", removed)
+	}
+}
@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"context"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// MirrorSink dual-writes to a second database during a migration
+// (--pg-mirror-dsn). Primary is authoritative: its error is returned, so a
+// failed primary write is retried as usual. Mirror errors are only logged
+// and counted; the mirror catches up with the service's next write (at
+// the latest its heartbeat). Every call goes to both, whatever the other
+// returned.
+type MirrorSink struct {
+	Primary Sink
+	Mirror  Sink
+}
+
+func (m *MirrorSink) Sync(ctx context.Context, cluster, namespace, service string, rows map[string]endpointRow) error {
+	err := m.Primary.Sync(ctx, cluster, namespace, service, rows)
+	if merr := m.Mirror.Sync(ctx, cluster, namespace, service, rows); merr != nil {
+		m.mirrorFailed(ctx, namespace, service, mirrorOpSync, merr)
+	}
+	return err
+}
+
+func (m *MirrorSink) Delete(ctx context.Context, cluster, namespace, service string) error {
+	err := m.Primary.Delete(ctx, cluster, namespace, service)
+	if merr := m.Mirror.Delete(ctx, cluster, namespace, service); merr != nil {
+		m.mirrorFailed(ctx, namespace, service, mirrorOpDelete, merr)
+	}
+	return err
+}
+
+func (m *MirrorSink) mirrorFailed(ctx context.Context, namespace, service, op string, err error) {
+	mirrorWriteErrors.WithLabelValues(namespace, service, op).Inc()
+	log.FromContext(ctx).Error(err, "mirror write failed, primary unaffected", "namespace", namespace, "service", service, "op", op)
+}
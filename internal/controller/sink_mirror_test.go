@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestMirrorSink(t *testing.T) {
+	boom := errors.New("boom")
+	rows := map[string]endpointRow{"uid-1": {UID: "uid-1", IP: "10.0.0.1"}}
+
+	tests := []struct {
+		name       string
+		primaryErr error
+		mirrorErr  error
+		wantErr    error
+		wantCount  float64
+	}{
+		{name: "both succeed"},
+		{name: "primary error fails the write", primaryErr: boom, wantErr: boom},
+		{name: "mirror error is only counted", mirrorErr: boom, wantCount: 1},
+		{name: "both fail", primaryErr: boom, mirrorErr: errFake, wantErr: boom, wantCount: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary, mirror := &recordingSink{err: tt.primaryErr}, &recordingSink{err: tt.mirrorErr}
+			sink := &MirrorSink{Primary: primary, Mirror: mirror}
+			ctx := context.Background()
+
+			for _, op := range []struct {
+				name string
+				call func() error
+			}{
+				{mirrorOpSync, func() error { return sink.Sync(ctx, "dev", "default", "mirror", rows) }},
+				{mirrorOpDelete, func() error { return sink.Delete(ctx, "dev", "default", "mirror") }},
+			} {
+				counter := mirrorWriteErrors.WithLabelValues("default", "mirror", op.name)
+				before := testutil.ToFloat64(counter)
+				if err := op.call(); !errors.Is(err, tt.wantErr) {
+					t.Errorf("%s error = %v, want %v", op.name, err, tt.wantErr)
+				}
+				if got := testutil.ToFloat64(counter) - before; got != tt.wantCount {
+					t.Errorf("observer_mirror_write_errors_total{op=%s} grew by %v, want %v", op.name, got, tt.wantCount)
+				}
+			}
+
+			// Both databases get every write and prune, whichever failed.
+			for name, s := range map[string]*recordingSink{"primary": primary, "mirror": mirror} {
+				if len(s.syncs) != 1 || len(s.deletes) != 1 || len(s.last) != 1 {
+					t.Errorf("%s got syncs %v, deletes %v, want one of each", name, s.syncs, s.deletes)
+				}
+			}
+		})
+	}
+}
+
+func TestMirrorSink_FailsReconcileOnlyForPrimary(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newSlice("default", "svc-abc", "svc", podEndpoint("uid-1", "pod-1", "10.0.0.1")),
+	).Build()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "svc-abc"}}
+
+	for _, tt := range []struct {
+		name    string
+		primary error
+		mirror  error
+		wantErr bool
+	}{
+		{name: "primary down", primary: errFake, wantErr: true},
+		{name: "mirror down", mirror: errFake},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &MirrorSink{Primary: &recordingSink{err: tt.primary}, Mirror: &recordingSink{err: tt.mirror}}
+			r := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev"}
+			if _, err := r.Reconcile(context.Background(), req); (err != nil) != tt.wantErr {
+				t.Errorf("Reconcile() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,724 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/ealebed/observer/pkg/endpoint"
+)
+
+// Layouts of the destination table, see PostgresSink.RowFormat.
+const (
+	RowFormatColumns = "columns" // one column per field
+	RowFormatJSONB   = "jsonb"   // the whole row in a payload jsonb column
+)
+
+// What an insert does with an existing row, see PostgresSink.ConflictAction.
+const (
+	ConflictUpdate  = "update"  // overwrite it with the current endpoint
+	ConflictNothing = "nothing" // keep it as first written
+)
+
+// What pruning does with the row of an endpoint that went away, see
+// PostgresSink.PruneAction.
+const (
+	PruneDelete = "delete" // delete it
+	PruneClear  = "clear"  // keep it with pod_ip NULL and ready false
+)
+
+// When the row of an endpoint that went away is pruned, see
+// PostgresSink.PruneMode.
+const (
+	PruneImmediate = "immediate" // by the write of its service
+	PruneTTL       = "ttl"       // by the Reaper, once last_seen is older than --row-ttl
+)
+
+// pruneStatement prunes the rows of tbl matching where: a DELETE, or with
+// PruneClear an UPDATE clearing pod_ip and ready of those not cleared yet.
+// returning, if set, is the statement's RETURNING list.
+func pruneStatement(action, tbl, where, returning string) string {
+	q := fmt.Sprintf("DELETE FROM %s WHERE %s", tbl, where)
+	if action == PruneClear {
+		q = fmt.Sprintf("UPDATE %s SET pod_ip = NULL, ready = false WHERE %s AND pod_ip IS NOT NULL", tbl, where)
+	}
+	if returning != "" {
+		q += " RETURNING " + returning
+	}
+	return q
+}
+
+// PostgresSink upserts the desired rows into TableName and prunes the rest.
+type PostgresSink struct {
+	DB        DB
+	TableName string
+	// TableFile, if set, replaces TableName with its current value
+	// (--table=@file).
+	TableFile *LiveValue
+	// RowFormat is RowFormatColumns (default, also when empty) or
+	// RowFormatJSONB, which writes each row as its JSON encoding into
+	// payload instead of pod_name, pod_ip, ready and the optional columns.
+	RowFormat string
+	// ConflictAction is ConflictUpdate (default, also when empty) or
+	// ConflictNothing, which inserts new rows only and leaves existing
+	// ones as first written, e.g. their first-observed pod_ip
+	// (--conflict-action). Rows are still pruned.
+	ConflictAction string
+	// TouchLastSeen, with ConflictNothing, refreshes last_seen of the
+	// existing rows by a separate UPDATE after the insert (set along with
+	// --heartbeat-interval). Nothing else of them is updated.
+	TouchLastSeen bool
+	// Region, if set, is written into the text region column and scopes
+	// every write, so the rows of a service are keyed by (region, cluster,
+	// namespace, service, pod_uid) (--region). Empty keeps the table
+	// without a region column.
+	Region string
+	// OmitNamespace leaves the namespace column out of every write, for a
+	// table of a single watched namespace without one (--omit-namespace):
+	// the rows of a service are keyed by (cluster, service, pod_uid).
+	OmitNamespace bool
+	// StatementTimeout caps each call, both client-side (context deadline)
+	// and server-side (SET LOCAL statement_timeout). Zero disables both.
+	StatementTimeout time.Duration
+	// PodLabels also writes each row's PodLabels into the jsonb pod_labels
+	// column, which must exist; see --enrich-pod-labels.
+	PodLabels bool
+	// AddressType also writes each row's address type (IPv4, IPv6, FQDN)
+	// into the text address_type column, which must exist.
+	AddressType bool
+	// Owner also writes each row's Owner into the text owner column, which
+	// must exist; see --resolve-owner.
+	Owner bool
+	// SliceNames also writes each row's Slices into the text[] slice_names
+	// column, which must exist; see --record-slice-names.
+	SliceNames bool
+	// NodeName also writes each row's NodeName into the text node_name
+	// column, which must exist; see --watch-nodes.
+	NodeName bool
+	// ServiceUID also writes each row's ServiceUID into the text
+	// service_uid column, which must exist; see --record-service-uid.
+	ServiceUID bool
+	// Addr also writes each row's endpoint.Address into the text addr
+	// column, which must exist; see --addr-column.
+	Addr bool
+	// Instance, if set, is written into the text observer_instance column
+	// of every row upserted, which must exist; see --track-instance.
+	Instance string
+	// VerifyWrites counts each service's rows again after the commit and
+	// reports a count other than the one written (--verify-writes), e.g.
+	// because a trigger or another writer changed them.
+	VerifyWrites bool
+	// SyncVersion also writes each Sync's version (see withSyncVersion) into
+	// the bigint sync_version column, which must exist, and skips a Sync
+	// whose service already has rows of a newer version (--sync-version).
+	// Writes of one service are serialized by an advisory lock for this.
+	SyncVersion bool
+	// PruneGracePeriod, if set, prunes in two phases (--prune-grace-period):
+	// a row whose endpoint went away is first marked ready = false, and
+	// only deleted by a later write once its last_seen is older than this,
+	// so consumers see a briefly unready pod rather than a gap. Needs
+	// RowFormatColumns.
+	PruneGracePeriod time.Duration
+	// PruneAction is PruneDelete (default, also when empty) or PruneClear,
+	// which keeps pruned rows, e.g. for a consumer's foreign key, with
+	// pod_ip NULL and ready false until the endpoint returns
+	// (--prune-action). It applies to the rows of a deleted Service too.
+	// Needs RowFormatColumns with a nullable pod_ip.
+	PruneAction string
+	// PruneMode is PruneImmediate (default, also when empty) or PruneTTL,
+	// which prunes nothing on Sync and leaves the rows of endpoints that
+	// went away to the Reaper (--prune-mode). Delete still prunes all rows
+	// of a service.
+	PruneMode string
+	// NotifyChannel, if set, has every write that changes the endpoints of
+	// a service also send pg_notify(NotifyChannel, payload) in its
+	// transaction (--pg-notify-channel), so LISTENers hear of it once it
+	// commits. The payload is the JSON of an endpointNotification; writes
+	// leaving the set as it was, e.g. heartbeats, notify nothing.
+	NotifyChannel string
+	// Tables, if set, picks a per-service table, falling back to TableName.
+	// A service it moves to another table has its rows deleted from the
+	// table of its last write in the transaction of the next, as long as
+	// that was made by this process.
+	Tables TableResolver
+	// FlushInterval, if set, holds writes for up to this long and commits
+	// the writes of all services queued meanwhile in one transaction; see
+	// --write-flush-interval. Zero writes each call in its own transaction.
+	FlushInterval time.Duration
+	// Now, if set, supplies last_seen from the client (--timestamp-source=
+	// client), in UTC. Nil uses the database's now().
+	Now func() time.Time
+
+	batchMu sync.Mutex
+	batch   *writeBatch
+	flushMu sync.Mutex // one flush at a time, so batches commit in order
+
+	statements sync.Map // SQL by statement name and table, see statement
+
+	notifiedMu sync.Mutex
+	notified   map[serviceKey]map[string]endpointRow // last set notified, see notify
+
+	pickedMu sync.Mutex
+	picked   map[serviceKey]string // what Tables picked for the last write, see moveFrom
+}
+
+// statement returns the SQL of the statement name for tbl, built by build
+// on first use. Its text then stays the same for the sink's life, so the
+// pool's statement cache (--pg-statement-cache-mode) prepares it once per
+// connection. build may only depend on tbl and the sink's options, which
+// don't change once it writes.
+func (p *PostgresSink) statement(name, tbl string, build func() string) string {
+	key := name + " " + tbl
+	if q, ok := p.statements.Load(key); ok {
+		return q.(string)
+	}
+	q, _ := p.statements.LoadOrStore(key, build())
+	return q.(string)
+}
+
+// regionCond scopes a statement to region as its parameter $n. It returns
+// the condition to append to the WHERE clause and the arguments to append,
+// both empty for no region.
+func regionCond(region string, n int) (string, []any) {
+	if region == "" {
+		return "", nil
+	}
+	return fmt.Sprintf(" AND region = $%d", n), []any{region}
+}
+
+// table returns the write of op to the quoted destination table of its
+// service, moving it from the table of the last write if Tables picked
+// another one then.
+func (p *PostgresSink) table(ctx context.Context, op writeOp) (writeOp, error) {
+	if p.Tables != nil {
+		name, err := p.Tables.Table(ctx, op.key.namespace, op.key.service)
+		if err != nil {
+			return op, err
+		}
+		op.picked = name
+	}
+	var err error
+	if op.tbl, err = p.tableIdent(op.picked); err != nil {
+		return op, err
+	}
+	p.pickedMu.Lock()
+	last, ok := p.picked[op.key]
+	p.pickedMu.Unlock()
+	if ok && last != op.picked {
+		if op.from, err = p.tableIdent(last); err != nil || op.from == op.tbl {
+			op.from = ""
+			return op, err
+		}
+	}
+	return op, nil
+}
+
+// tableIdent quotes picked, a table picked by Tables, or TableName if it's
+// empty.
+func (p *PostgresSink) tableIdent(picked string) (string, error) {
+	if picked != "" {
+		return sanitizeTableIdent(picked)
+	}
+	return sanitizeTableIdent(p.TableFile.Or(p.TableName))
+}
+
+// recordPicked remembers the tables of the committed ops, for table.
+func (p *PostgresSink) recordPicked(ops []writeOp, stale []bool) {
+	p.pickedMu.Lock()
+	defer p.pickedMu.Unlock()
+	if p.picked == nil {
+		p.picked = map[serviceKey]string{}
+	}
+	for i, op := range ops {
+		switch {
+		case stale[i]:
+		case op.rows == nil:
+			delete(p.picked, op.key)
+		default:
+			p.picked[op.key] = op.picked
+		}
+	}
+}
+
+// begin opens a transaction bounded by StatementTimeout. The returned cancel
+// func must be called once the transaction is finished.
+func (p *PostgresSink) begin(ctx context.Context) (pgx.Tx, context.Context, context.CancelFunc, error) {
+	cancel := context.CancelFunc(func() {})
+	if p.StatementTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, p.StatementTimeout)
+	}
+	if err := ctx.Err(); err != nil {
+		cancel()
+		return nil, nil, nil, err
+	}
+	tx, err := p.DB.Begin(ctx)
+	if err != nil {
+		cancel()
+		return nil, nil, nil, err
+	}
+	if p.StatementTimeout > 0 {
+		ms := strconv.FormatInt(p.StatementTimeout.Milliseconds(), 10)
+		if _, err := tx.Exec(ctx, `SELECT set_config('statement_timeout', $1, true)`, ms); err != nil {
+			_ = tx.Rollback(ctx)
+			cancel()
+			return nil, nil, nil, err
+		}
+	}
+	return tx, ctx, cancel, nil
+}
+
+func (p *PostgresSink) Sync(ctx context.Context, cluster, namespace, service string, desired map[string]endpointRow) error {
+	if desired == nil {
+		desired = map[string]endpointRow{} // a Sync, not a Delete
+	}
+	op, err := p.table(ctx, writeOp{key: serviceKey{cluster, namespace, service}, rows: desired})
+	if err != nil {
+		return err
+	}
+	if p.SyncVersion {
+		op.version = syncVersionFrom(ctx)
+	}
+	return p.apply(ctx, op)
+}
+
+func (p *PostgresSink) Delete(ctx context.Context, cluster, namespace, service string) error {
+	op, err := p.table(ctx, writeOp{key: serviceKey{cluster, namespace, service}})
+	if err != nil {
+		return err
+	}
+	return p.apply(ctx, op)
+}
+
+// apply writes op in a transaction of its own, or queues it for the next
+// batch when FlushInterval is set.
+func (p *PostgresSink) apply(ctx context.Context, op writeOp) error {
+	if p.FlushInterval > 0 {
+		return p.enqueue(ctx, op)
+	}
+	return p.write(ctx, []writeOp{op})
+}
+
+// write applies ops in one transaction. Every op only touches the rows of
+// its own service, so ops of different services don't interfere.
+func (p *PostgresSink) write(ctx context.Context, ops []writeOp) error {
+	tx, ctx, cancel, err := p.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	upserted := make([]int64, len(ops))
+	pruned := make([]int64, len(ops))
+	moved := make([]int64, len(ops))
+	stale := make([]bool, len(ops))
+	for i, op := range ops {
+		k := op.key
+		if op.version != 0 {
+			if stale[i], err = p.newerVersionStored(ctx, tx, op); err != nil {
+				return fmt.Errorf("check sync version of %s/%s: %w", k.namespace, k.service, err)
+			}
+			if stale[i] {
+				continue
+			}
+		}
+		if op.from != "" {
+			where, args := p.serviceCond(k)
+			region, rargs := regionCond(p.Region, len(args)+1)
+			q := p.statement("delete", op.from, func() string {
+				return pruneStatement(p.PruneAction, op.from, where+region, "")
+			})
+			tag, err := tx.Exec(ctx, q, append(args, rargs...)...)
+			if err != nil {
+				return fmt.Errorf("delete %s/%s from %s: %w", k.namespace, k.service, op.from, err)
+			}
+			moved[i] = tag.RowsAffected()
+		}
+		if op.rows == nil {
+			where, args := p.serviceCond(k)
+			region, rargs := regionCond(p.Region, len(args)+1)
+			q := p.statement("delete", op.tbl, func() string {
+				return pruneStatement(p.PruneAction, op.tbl, where+region, "")
+			})
+			tag, err := tx.Exec(ctx, q, append(args, rargs...)...)
+			if err != nil {
+				return fmt.Errorf("delete %s/%s: %w", k.namespace, k.service, err)
+			}
+			pruned[i] = tag.RowsAffected()
+			if err := p.notify(ctx, tx, op, pruned[i]); err != nil {
+				return fmt.Errorf("notify %s/%s: %w", k.namespace, k.service, err)
+			}
+			continue
+		}
+
+		if upserted[i], err = p.upsertRows(ctx, tx, op.tbl, op.rows, k.cluster, k.namespace, k.service, op.version); err != nil {
+			return err
+		}
+		uids := make([]string, 0, len(op.rows))
+		for uid := range op.rows {
+			uids = append(uids, uid)
+		}
+		if p.ConflictAction == ConflictNothing && p.TouchLastSeen && len(uids) > 0 {
+			if err := p.touchRows(ctx, tx, op.tbl, k, uids); err != nil {
+				return fmt.Errorf("touch %s/%s: %w", k.namespace, k.service, err)
+			}
+		}
+		if p.PruneMode != PruneTTL {
+			if pruned[i], err = p.pruneRows(ctx, tx, op.tbl, k, uids); err != nil {
+				return fmt.Errorf("prune %s/%s: %w", k.namespace, k.service, err)
+			}
+		}
+		if err := p.notify(ctx, tx, op, pruned[i]); err != nil {
+			return fmt.Errorf("notify %s/%s: %w", k.namespace, k.service, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	if p.NotifyChannel != "" {
+		p.recordNotified(ops, stale)
+	}
+	if p.Tables != nil {
+		p.recordPicked(ops, stale)
+	}
+	logger := log.FromContext(ctx)
+	for i, op := range ops {
+		k := op.key
+		if stale[i] {
+			staleWritesSkipped.WithLabelValues(k.namespace, k.service).Inc()
+			logger.V(1).Info("skipped write, the table has a newer sync", "namespace", k.namespace, "service", k.service, "version", op.version)
+			continue
+		}
+		if op.from != "" {
+			logger.Info("moved service to another table", "namespace", k.namespace, "service", k.service, "from", op.from, "to", op.tbl, "deleted", moved[i])
+		}
+		if pruned[i] > 0 {
+			prunedRows(p.PruneAction).WithLabelValues(k.namespace, k.service).Add(float64(pruned[i]))
+		}
+		if op.rows == nil {
+			logger.V(1).Info("deleted rows", "namespace", k.namespace, "service", k.service, "pruned", pruned[i])
+		} else {
+			logger.V(1).Info("wrote rows", "namespace", k.namespace, "service", k.service, "upserted", upserted[i], "pruned", pruned[i])
+		}
+	}
+	if p.VerifyWrites {
+		for i, op := range ops {
+			if !stale[i] {
+				p.verify(ctx, op)
+			}
+		}
+	}
+	return nil
+}
+
+// newerVersionStored locks op's service for the rest of tx and reports
+// whether its rows were written by a sync newer than op. The lock keeps a
+// concurrent older write from committing between the check and op's write.
+func (p *PostgresSink) newerVersionStored(ctx context.Context, tx pgx.Tx, op writeOp) (bool, error) {
+	k := op.key
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, serviceLockKey(k)); err != nil {
+		return false, err
+	}
+	var stored int64
+	where, args := p.serviceCond(k)
+	region, rargs := regionCond(p.Region, len(args)+1)
+	q := fmt.Sprintf(`SELECT COALESCE(max(sync_version), 0) FROM %s WHERE %s%s`, op.tbl, where, region)
+	if err := tx.QueryRow(ctx, q, append(args, rargs...)...).Scan(&stored); err != nil {
+		return false, err
+	}
+	return stored > op.version, nil
+}
+
+// serviceCond is the condition on the rows of service k and its args, the
+// first parameters of a statement; those after them start at len(args)+1.
+func (p *PostgresSink) serviceCond(k serviceKey) (where string, args []any) {
+	if p.OmitNamespace {
+		return "cluster = $1 AND service = $2", []any{k.cluster, k.service}
+	}
+	return "cluster = $1 AND namespace = $2 AND service = $3", []any{k.cluster, k.namespace, k.service}
+}
+
+// serviceLockKey is the advisory lock of the writes of one service.
+func serviceLockKey(k serviceKey) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte("observer/service/" + k.cluster + "/" + k.namespace + "/" + k.service))
+	return int64(h.Sum64())
+}
+
+// verify compares the committed row count of op's service with what op
+// wrote. A mismatch or a failed count is logged, never returned: the write
+// itself succeeded.
+func (p *PostgresSink) verify(ctx context.Context, op writeOp) {
+	k, logger := op.key, log.FromContext(ctx)
+	var n int64
+	where, args := p.serviceCond(k)
+	region, rargs := regionCond(p.Region, len(args)+1)
+	q := fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s%s`, op.tbl, where, region)
+	if p.PruneGracePeriod > 0 || p.PruneAction == PruneClear {
+		q += " AND ready" // rows in their grace period or cleared weren't written
+	}
+	if err := p.DB.QueryRow(ctx, q, append(args, rargs...)...).Scan(&n); err != nil {
+		logger.Error(err, "verify write", "namespace", k.namespace, "service", k.service)
+		return
+	}
+	if want := int64(len(op.rows)); n != want {
+		writeVerifyMismatch.WithLabelValues(k.namespace, k.service).Inc()
+		logger.Info("rows differ from what was written", "namespace", k.namespace, "service", k.service, "written", want, "found", n)
+	}
+}
+
+// optionalColumn is a column written only when its option is enabled.
+type optionalColumn struct {
+	name  string
+	cast  string
+	types []string // accepted information_schema data types, see CheckSchema
+	value func(*endpointRow) any
+}
+
+// nullString writes "" as NULL.
+func nullString(s string) any {
+	if s == "" {
+		return (*string)(nil)
+	}
+	return &s
+}
+
+// optionalColumns lists the enabled optional columns. In RowFormatJSONB
+// there are none: every field is in the payload.
+func (p *PostgresSink) optionalColumns() []optionalColumn {
+	var out []optionalColumn
+	if p.RowFormat == RowFormatJSONB {
+		return nil
+	}
+	if p.PodLabels {
+		out = append(out, optionalColumn{"pod_labels", "::jsonb", []string{"jsonb"}, func(e *endpointRow) any { return nullString(string(e.PodLabels)) }})
+	}
+	if p.AddressType {
+		out = append(out, optionalColumn{"address_type", "", textTypes, func(e *endpointRow) any { return nullString(string(e.AddressType)) }})
+	}
+	if p.Owner {
+		out = append(out, optionalColumn{"owner", "", textTypes, func(e *endpointRow) any { return nullString(e.Owner) }})
+	}
+	if p.SliceNames {
+		// A nil []string is sent as NULL.
+		out = append(out, optionalColumn{"slice_names", "", []string{"ARRAY"}, func(e *endpointRow) any { return e.Slices.List() }})
+	}
+	if p.NodeName {
+		out = append(out, optionalColumn{"node_name", "", textTypes, func(e *endpointRow) any { return nullString(e.NodeName) }})
+	}
+	if p.ServiceUID {
+		out = append(out, optionalColumn{"service_uid", "", textTypes, func(e *endpointRow) any { return nullString(e.ServiceUID) }})
+	}
+	if p.Addr {
+		out = append(out, optionalColumn{"addr", "", textTypes, func(e *endpointRow) any { return endpoint.Address(e.IP, e.Port) }})
+	}
+	if p.Instance != "" {
+		out = append(out, optionalColumn{"observer_instance", "", textTypes, func(*endpointRow) any { return p.Instance }})
+	}
+	return out
+}
+
+// upsertSQL is the upsert of a row into tbl, writing sync_version if
+// versioned.
+func (p *PostgresSink) upsertSQL(tbl string, versioned bool) string {
+	key, n := "cluster, namespace, service", 3
+	if p.OmitNamespace {
+		key, n = "cluster, service", 2
+	}
+	cols := key + ", pod_uid, pod_name, pod_ip, ready, last_seen"
+	vals := placeholders(n+3) + ",true, "
+	set := "pod_ip = EXCLUDED.pod_ip, ready = true, last_seen = EXCLUDED.last_seen"
+	next := n + 4
+	jsonb := p.RowFormat == RowFormatJSONB
+	if jsonb {
+		cols = key + ", pod_uid, payload, last_seen"
+		vals = placeholders(n+1) + fmt.Sprintf(",$%d::jsonb, ", n+2)
+		set = "payload = EXCLUDED.payload, last_seen = EXCLUDED.last_seen"
+		next = n + 3
+	}
+	if p.Now != nil {
+		vals += fmt.Sprintf("$%d", next)
+		next++
+	} else {
+		vals += "now()"
+	}
+	if p.Region != "" {
+		cols += ", region"
+		vals += fmt.Sprintf(", $%d", next)
+		next++
+	}
+	for _, c := range p.optionalColumns() {
+		cols += ", " + c.name
+		vals += fmt.Sprintf(", $%d%s", next, c.cast)
+		set += fmt.Sprintf(", %[1]s = EXCLUDED.%[1]s", c.name)
+		next++
+	}
+	if versioned {
+		cols += ", sync_version"
+		vals += fmt.Sprintf(", $%d", next)
+		set += ", sync_version = EXCLUDED.sync_version"
+	}
+	action := "DO UPDATE SET " + set
+	if p.ConflictAction == ConflictNothing {
+		action = "DO NOTHING"
+	}
+	return fmt.Sprintf(`
+	  INSERT INTO %s (%s)
+	  VALUES (%s)
+	  ON CONFLICT (%s)
+	  %s`, tbl, cols, vals, strings.Join(p.upsertKey(), ", "), action)
+}
+
+// placeholders is "$1,$2,...,$n".
+func placeholders(n int) string {
+	ps := make([]string, n)
+	for i := range ps {
+		ps[i] = fmt.Sprintf("$%d", i+1)
+	}
+	return strings.Join(ps, ",")
+}
+
+// upsertRows writes desired and returns the number of rows affected. A
+// non-zero version goes into sync_version.
+func (p *PostgresSink) upsertRows(
+	ctx context.Context, tx pgx.Tx, tbl string, desired map[string]endpointRow, cluster, namespace, service string, version int64,
+) (int64, error) {
+	name := "upsert"
+	if version != 0 {
+		name = "upsert versioned"
+	}
+	q := p.statement(name, tbl, func() string { return p.upsertSQL(tbl, version != 0) })
+	jsonb := p.RowFormat == RowFormatJSONB
+	extra := p.optionalColumns()
+
+	var now time.Time
+	if p.Now != nil {
+		now = p.Now().UTC()
+	}
+	_, key := p.serviceCond(serviceKey{cluster, namespace, service})
+	var affected int64
+	for _, e := range desired {
+		args := append(slices.Clip(key), e.UID, e.Name, e.IP)
+		if jsonb {
+			payload, err := rowPayload(&e)
+			if err != nil {
+				return affected, fmt.Errorf("encode %s/%s uid=%s: %w", namespace, service, e.UID, err)
+			}
+			args = append(args[:len(key)+1], payload)
+		}
+		if p.Now != nil {
+			args = append(args, now)
+		}
+		if p.Region != "" {
+			args = append(args, p.Region)
+		}
+		for _, c := range extra {
+			args = append(args, c.value(&e))
+		}
+		if version != 0 {
+			args = append(args, version)
+		}
+		tag, err := tx.Exec(ctx, q, args...)
+		if err != nil {
+			return affected, fmt.Errorf("upsert %s/%s uid=%s: %w", namespace, service, e.UID, err)
+		}
+		affected += tag.RowsAffected()
+	}
+	return affected, nil
+}
+
+// rowPayload is the payload of e in RowFormatJSONB: the same JSON object
+// the file sink writes, with the enriched fields of the enabled options.
+func rowPayload(e *endpointRow) (string, error) {
+	b, err := json.Marshal(e)
+	return string(b), err
+}
+
+// touchRows sets last_seen of the service's rows in uids, from the same
+// clock as upsertRows.
+func (p *PostgresSink) touchRows(ctx context.Context, tx pgx.Tx, tbl string, k serviceKey, uids []string) error {
+	where, args := p.serviceCond(k)
+	args = append(args, uids)
+	uidsParam := len(args)
+	ts := "now()"
+	if p.Now != nil {
+		args = append(args, p.Now().UTC())
+		ts = fmt.Sprintf("$%d", len(args))
+	}
+	region, rargs := regionCond(p.Region, len(args)+1)
+	q := fmt.Sprintf(`
+	  UPDATE %s SET last_seen = %s
+	  WHERE %s
+	    AND pod_uid = ANY($%d)%s`, tbl, ts, where, uidsParam, region)
+	_, err := tx.Exec(ctx, q, append(args, rargs...)...)
+	return err
+}
+
+// pruneRows deletes the rows of the service not in uids and returns how many.
+// The live UIDs travel as one text[] parameter rather than an IN list, so the
+// statement has a handful of parameters no matter how large the service is
+// (Postgres caps a statement at 65535). A nil uids is sent as an empty
+// array: pgx would send nil as NULL, and "<> ALL(NULL)" matches nothing,
+// where an empty array prunes all.
+//
+// With PruneGracePeriod the rows are marked not ready instead, and only
+// those already marked with a last_seen older than the grace period are
+// deleted. last_seen isn't touched by the mark, so it still says when the
+// endpoint was last written as ready. With PruneClear the rows are cleared
+// instead of deleted, and how many were cleared is returned.
+func (p *PostgresSink) pruneRows(ctx context.Context, tx pgx.Tx, tbl string, k serviceKey, uids []string) (int64, error) {
+	if uids == nil {
+		uids = []string{}
+	}
+	where, args := p.serviceCond(k)
+	// Clipped, so the appends of the two statements below don't share it.
+	args = slices.Clip(append(args, uids))
+	n := len(args) // of uids
+	if p.PruneGracePeriod <= 0 || p.PruneAction == PruneClear {
+		region, rargs := regionCond(p.Region, n+1)
+		qDel := p.statement("prune", tbl, func() string {
+			return pruneStatement(p.PruneAction, tbl, fmt.Sprintf(`%s
+		    AND pod_uid <> ALL($%d)`, where, n)+region, "")
+		})
+		tag, err := tx.Exec(ctx, qDel, append(args, rargs...)...)
+		return tag.RowsAffected(), err
+	}
+
+	// The cutoff comes from the same clock as last_seen.
+	cutoff, arg := fmt.Sprintf("now() - make_interval(secs => $%d)", n+1), any(p.PruneGracePeriod.Seconds())
+	if p.Now != nil {
+		cutoff, arg = fmt.Sprintf("$%d", n+1), p.Now().UTC().Add(-p.PruneGracePeriod)
+	}
+	region, rargs := regionCond(p.Region, n+2)
+	qDel := p.statement("prune expired", tbl, func() string {
+		return fmt.Sprintf(`
+	  DELETE FROM %s
+	  WHERE %s
+	    AND pod_uid <> ALL($%d) AND NOT ready AND last_seen < %s%s`, tbl, where, n, cutoff, region)
+	})
+	tag, err := tx.Exec(ctx, qDel, append(append(args, arg), rargs...)...)
+	if err != nil {
+		return 0, err
+	}
+	region, rargs = regionCond(p.Region, n+1)
+	qMark := p.statement("prune mark", tbl, func() string {
+		return fmt.Sprintf(`
+	  UPDATE %s SET ready = false
+	  WHERE %s
+	    AND pod_uid <> ALL($%d) AND ready%s`, tbl, where, n, region)
+	})
+	if _, err := tx.Exec(ctx, qMark, append(args, rargs...)...); err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
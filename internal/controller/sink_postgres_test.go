@@ -0,0 +1,1091 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPostgresSink_Sync(t *testing.T) {
+	db := &fakeDB{}
+	sink := &PostgresSink{DB: db, TableName: "public.server"}
+	rows := map[string]endpointRow{"uid-1": {UID: "uid-1", Name: "pod-1", IP: "10.0.0.1"}}
+
+	if err := sink.Sync(context.Background(), "dev", "default", "svc", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := db.statements("set_config"); len(got) != 0 {
+		t.Errorf("statement_timeout set without StatementTimeout: %v", got)
+	}
+	upserts := db.statements("INSERT INTO")
+	if len(upserts) != 1 || !upserts[0].inTx {
+		t.Fatalf("upserts = %+v, want one inside the transaction", upserts)
+	}
+	if args := upserts[0].args; args[0] != "dev" || args[3] != "uid-1" || args[5] != "10.0.0.1" {
+		t.Errorf("upsert args = %v", args)
+	}
+	if prunes := db.statements("DELETE FROM"); len(prunes) != 1 {
+		t.Errorf("prunes = %+v, want one", prunes)
+	}
+	if db.commits != 1 {
+		t.Errorf("commits = %d, want 1", db.commits)
+	}
+}
+
+func TestPostgresSink_WrapsErrors(t *testing.T) {
+	unique := &pgconn.PgError{Code: "23505"}
+	tests := []struct {
+		name   string
+		fail   string // statement that fails
+		delete bool
+		want   string
+	}{
+		{name: "upsert", fail: "INSERT INTO", want: "upsert default/svc uid=uid-1: "},
+		{name: "prune", fail: "pod_uid <> ALL", want: "prune default/svc: "},
+		{name: "delete", fail: "DELETE FROM", delete: true, want: "delete default/svc: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeDB{execFn: func(sql string, _ []any) (pgconn.CommandTag, error) {
+				if strings.Contains(sql, tt.fail) {
+					return pgconn.CommandTag{}, unique
+				}
+				return pgconn.NewCommandTag("OK 1"), nil
+			}}
+			sink := &PostgresSink{DB: db, TableName: "server"}
+			var err error
+			if tt.delete {
+				err = sink.Delete(context.Background(), "dev", "default", "svc")
+			} else {
+				err = sink.Sync(context.Background(), "dev", "default", "svc", map[string]endpointRow{"uid-1": {UID: "uid-1", IP: "10.0.0.1"}})
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want it to start with %q", err, tt.want)
+			}
+			if class := classifyDBError(err); class != dbErrorPermanent {
+				t.Errorf("wrapped error classified %v, want permanent", class)
+			}
+		})
+	}
+}
+
+func TestPostgresSink_VerifyWrites(t *testing.T) {
+	rows := map[string]endpointRow{"uid-1": {UID: "uid-1", IP: "10.0.0.1"}, "uid-2": {UID: "uid-2", IP: "10.0.0.2"}}
+	tests := []struct {
+		name     string
+		verify   bool
+		delete   bool
+		count    int64
+		mismatch bool
+	}{
+		{name: "matching count", verify: true, count: 2},
+		{name: "rows clobbered", verify: true, count: 1, mismatch: true},
+		{name: "rows left after delete", verify: true, delete: true, count: 3, mismatch: true},
+		{name: "disabled", count: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var counted []any
+			db := &fakeDB{queryFn: func(sql string, args []any) ([][]any, error) {
+				if strings.Contains(sql, "count(*)") {
+					counted = args
+				}
+				return [][]any{{tt.count}}, nil
+			}}
+			sink := &PostgresSink{DB: db, TableName: "server", VerifyWrites: tt.verify}
+			counter := writeVerifyMismatch.WithLabelValues("verify-ns", "svc")
+			before := testutil.ToFloat64(counter)
+			ctx, logs := captureLogs()
+
+			var err error
+			if tt.delete {
+				err = sink.Delete(ctx, "dev", "verify-ns", "svc")
+			} else {
+				err = sink.Sync(ctx, "dev", "verify-ns", "svc", rows)
+			}
+			if err != nil {
+				t.Fatalf("write error = %v", err)
+			}
+			if tt.verify != (counted != nil) {
+				t.Fatalf("counted rows = %v, want verify %v", counted, tt.verify)
+			}
+			if counted != nil && (counted[0] != "dev" || counted[1] != "verify-ns" || counted[2] != "svc") {
+				t.Errorf("count args = %v", counted)
+			}
+			want := 0.0
+			if tt.mismatch {
+				want = 1
+			}
+			if got := testutil.ToFloat64(counter) - before; got != want {
+				t.Errorf("observer_write_verify_mismatch_total grew by %v, want %v", got, want)
+			}
+			if logged := strings.Contains(strings.Join(*logs, "\n"), "rows differ"); logged != tt.mismatch {
+				t.Errorf("mismatch logged = %v, want %v", logged, tt.mismatch)
+			}
+		})
+	}
+
+	// A failed count is logged but doesn't fail the write.
+	db := &fakeDB{queryFn: func(string, []any) ([][]any, error) { return nil, errFake }}
+	if err := (&PostgresSink{DB: db, TableName: "server", VerifyWrites: true}).Sync(context.Background(), "dev", "default", "svc", rows); err != nil {
+		t.Errorf("Sync() error = %v, want nil", err)
+	}
+}
+
+func TestPostgresSink_StatementTimeout(t *testing.T) {
+	db := &fakeDB{}
+	sink := &PostgresSink{DB: db, TableName: "server", StatementTimeout: 10 * time.Second}
+
+	if err := sink.Sync(context.Background(), "dev", "default", "svc", nil); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if err := sink.Delete(context.Background(), "dev", "default", "svc"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	sets := db.statements("set_config('statement_timeout'")
+	if len(sets) != 2 {
+		t.Fatalf("got %d statement_timeout settings, want one per transaction", len(sets))
+	}
+	for _, s := range sets {
+		if !s.inTx || s.args[0] != "10000" {
+			t.Errorf("statement_timeout call = %+v, want 10000ms inside the transaction", s)
+		}
+	}
+	if db.execs[0].sql != sets[0].sql {
+		t.Errorf("first statement = %q, want statement_timeout to be set first", db.execs[0].sql)
+	}
+}
+
+func TestEndpointSliceReconciler_StatementTimeoutFires(t *testing.T) {
+	slice := newSlice("default", "svc-abc", "svc", podEndpoint("uid-1", "pod-1", "10.0.0.1"))
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(slice).Build()
+	// A stalled database: Begin only returns once the context gives up.
+	db := &fakeDB{beginFn: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+	r := &EndpointSliceReconciler{
+		Client:       c,
+		Sink:         &PostgresSink{DB: db, TableName: "server", StatementTimeout: 50 * time.Millisecond},
+		ClusterName:  "dev",
+		RequeueAfter: time.Minute,
+	}
+
+	type outcome struct {
+		res ctrl.Result
+		err error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "svc-abc"}})
+		done <- outcome{res, err}
+	}()
+
+	// The timeout is a transient error: the reconcile gives up and schedules
+	// a quick retry instead of waiting for the database.
+	select {
+	case got := <-done:
+		if got.err != nil || got.res.RequeueAfter != dbRetryBaseDelay {
+			t.Errorf("Reconcile() = %+v, %v; want retry after %s", got.res, got.err, dbRetryBaseDelay)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reconcile() blocked past the statement timeout")
+	}
+}
+
+func TestPostgresSink_StatementTimeoutExpires(t *testing.T) {
+	db := &fakeDB{beginFn: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+	sink := &PostgresSink{DB: db, TableName: "server", StatementTimeout: 20 * time.Millisecond}
+
+	err := sink.Sync(context.Background(), "dev", "default", "svc", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Sync() error = %v, want deadline exceeded", err)
+	}
+}
+
+func TestPostgresSink_PodLabels(t *testing.T) {
+	rows := map[string]endpointRow{
+		"uid-1": {UID: "uid-1", Name: "pod-1", IP: "10.0.0.1", PodLabels: `{"version":"v2"}`},
+	}
+
+	db := &fakeDB{}
+	if err := (&PostgresSink{DB: db, TableName: "server"}).Sync(context.Background(), "dev", "default", "svc", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if up := db.statements("INSERT INTO"); strings.Contains(up[0].sql, "pod_labels") || len(up[0].args) != 6 {
+		t.Errorf("pod_labels written without PodLabels: %+v", up[0])
+	}
+
+	db = &fakeDB{}
+	if err := (&PostgresSink{DB: db, TableName: "server", PodLabels: true}).Sync(context.Background(), "dev", "default", "svc", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	up := db.statements("INSERT INTO")[0]
+	if !strings.Contains(up.sql, "pod_labels = EXCLUDED.pod_labels") {
+		t.Errorf("upsert does not refresh pod_labels on conflict:\n%s", up.sql)
+	}
+	if got, ok := up.args[6].(*string); !ok || got == nil || *got != `{"version":"v2"}` {
+		t.Errorf("pod_labels arg = %#v, want the JSON labels", up.args[6])
+	}
+}
+
+func TestPostgresSink_AddressType(t *testing.T) {
+	rows := map[string]endpointRow{
+		"uid-1": {UID: "uid-1", Name: "pod-1", IP: "pod-1.web.example.com", AddressType: discoveryv1.AddressTypeFQDN},
+	}
+
+	db := &fakeDB{}
+	if err := (&PostgresSink{DB: db, TableName: "server"}).Sync(context.Background(), "dev", "default", "svc", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if up := db.statements("INSERT INTO"); strings.Contains(up[0].sql, "address_type") || len(up[0].args) != 6 {
+		t.Errorf("address_type written without AddressType: %+v", up[0])
+	}
+
+	db = &fakeDB{}
+	sink := &PostgresSink{DB: db, TableName: "server", PodLabels: true, AddressType: true}
+	if err := sink.Sync(context.Background(), "dev", "default", "svc", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	up := db.statements("INSERT INTO")[0]
+	if !strings.Contains(up.sql, "$8") || !strings.Contains(up.sql, "address_type = EXCLUDED.address_type") {
+		t.Errorf("upsert does not write address_type after pod_labels:\n%s", up.sql)
+	}
+	if got, ok := up.args[7].(*string); !ok || got == nil || *got != "FQDN" {
+		t.Errorf("address_type arg = %#v, want FQDN", up.args[7])
+	}
+	if up.args[5] != "pod-1.web.example.com" {
+		t.Errorf("pod_ip arg = %#v, want the hostname", up.args[5])
+	}
+}
+
+func TestPostgresSink_PruneParameters(t *testing.T) {
+	large := make(map[string]endpointRow, 50000)
+	for i := range 50000 {
+		uid := fmt.Sprintf("uid-%05d", i)
+		large[uid] = endpointRow{UID: uid, IP: "10.0.0.1"}
+	}
+
+	tests := []struct {
+		name string
+		rows map[string]endpointRow
+	}{
+		{name: "50k endpoints", rows: large},
+		{name: "no endpoints", rows: map[string]endpointRow{}},
+		{name: "nil endpoints", rows: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeDB{}
+			if err := (&PostgresSink{DB: db, TableName: "server"}).Sync(context.Background(), "dev", "default", "svc", tt.rows); err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			del := db.statements("DELETE")
+			if len(del) != 1 {
+				t.Fatalf("got %d DELETE statements, want 1", len(del))
+			}
+			if len(del[0].args) != 4 || strings.Contains(del[0].sql, "$5") {
+				t.Fatalf("prune uses %d parameters, want 4:\n%s", len(del[0].args), del[0].sql)
+			}
+			uids, ok := del[0].args[3].([]string)
+			if !ok || uids == nil {
+				t.Fatalf("live UIDs = %#v, want a non-nil []string (nil is sent as NULL)", del[0].args[3])
+			}
+			if len(uids) != len(tt.rows) {
+				t.Errorf("live UIDs has %d entries, want %d", len(uids), len(tt.rows))
+			}
+		})
+	}
+}
+
+func TestPostgresSink_Owner(t *testing.T) {
+	rows := map[string]endpointRow{
+		"uid-1": {UID: "uid-1", Name: "web-7d9f-a", IP: "10.0.0.1", Owner: "Deployment/web"},
+		"uid-2": {UID: "uid-2", IP: "10.0.0.2"},
+	}
+	db := &fakeDB{}
+	if err := (&PostgresSink{DB: db, TableName: "server", Owner: true}).Sync(context.Background(), "dev", "default", "svc", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	owners := map[any]*string{}
+	for _, up := range db.statements("INSERT INTO") {
+		if !strings.Contains(up.sql, "owner = EXCLUDED.owner") {
+			t.Fatalf("upsert does not refresh owner on conflict:\n%s", up.sql)
+		}
+		owners[up.args[3]], _ = up.args[6].(*string)
+	}
+	if got := owners["uid-1"]; got == nil || *got != "Deployment/web" {
+		t.Errorf("owner of uid-1 = %v, want Deployment/web", got)
+	}
+	if got, ok := owners["uid-2"]; !ok || got != nil {
+		t.Errorf("owner of uid-2 = %v, want NULL", got)
+	}
+}
+
+func TestPostgresSink_SliceNames(t *testing.T) {
+	rows := map[string]endpointRow{
+		"uid-1": {UID: "uid-1", IP: "10.0.0.1", Slices: nameList("svc-a,svc-b")},
+		"uid-2": {UID: "uid-2", IP: "10.0.0.2"},
+	}
+	db := &fakeDB{}
+	if err := (&PostgresSink{DB: db, TableName: "server", SliceNames: true}).Sync(context.Background(), "dev", "default", "svc", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	names := map[any][]string{}
+	for _, up := range db.statements("INSERT INTO") {
+		if !strings.Contains(up.sql, "slice_names = EXCLUDED.slice_names") {
+			t.Fatalf("upsert does not refresh slice_names on conflict:\n%s", up.sql)
+		}
+		names[up.args[3]], _ = up.args[6].([]string)
+	}
+	if got := names["uid-1"]; !slices.Equal(got, []string{"svc-a", "svc-b"}) {
+		t.Errorf("slice_names of uid-1 = %v, want [svc-a svc-b]", got)
+	}
+	if got, ok := names["uid-2"]; !ok || got != nil {
+		t.Errorf("slice_names of uid-2 = %#v, want NULL", got)
+	}
+}
+
+func TestPostgresSink_Addr(t *testing.T) {
+	rows := map[string]endpointRow{
+		"uid-1": {UID: "uid-1", IP: "10.0.0.1", Port: 8080},
+		"uid-2": {UID: "uid-2", IP: "fd00::1", Port: 8080, AddressType: discoveryv1.AddressTypeIPv6},
+		"uid-3": {UID: "uid-3", IP: "10.0.0.3"},
+	}
+	db := &fakeDB{}
+	if err := (&PostgresSink{DB: db, TableName: "server", Addr: true}).Sync(context.Background(), "dev", "default", "svc", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	addrs := map[any]any{}
+	for _, up := range db.statements("INSERT INTO") {
+		if !strings.Contains(up.sql, "addr = EXCLUDED.addr") {
+			t.Fatalf("upsert does not refresh addr on conflict:\n%s", up.sql)
+		}
+		addrs[up.args[3]] = up.args[6]
+	}
+	want := map[any]any{"uid-1": "10.0.0.1:8080", "uid-2": "[fd00::1]:8080", "uid-3": "10.0.0.3"}
+	if !maps.Equal(addrs, want) {
+		t.Errorf("addr by pod_uid = %v, want %v", addrs, want)
+	}
+}
+
+func TestPostgresSink_StatementsBuiltOnce(t *testing.T) {
+	db := &fakeDB{}
+	sink := &PostgresSink{DB: db, TableName: "server", PruneGracePeriod: time.Minute}
+	rows := map[string]endpointRow{"uid-1": {UID: "uid-1", IP: "10.0.0.1"}}
+	for range 2 {
+		if err := sink.Sync(context.Background(), "dev", "default", "web", rows); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+		if err := sink.Delete(context.Background(), "dev", "default", "api"); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+	}
+	// Each write runs the same text, which pgx prepares once per connection.
+	if len(db.execs) != 8 {
+		t.Fatalf("execs = %+v, want 4 per round", db.execs)
+	}
+	for i, e := range db.execs[:4] {
+		if again := db.execs[4+i]; again.sql != e.sql {
+			t.Errorf("statement %d changed between rounds:\n%s\nthen\n%s", i, e.sql, again.sql)
+		}
+	}
+
+	built := 0
+	build := func() string { built++; return "SELECT 1" }
+	sink.statement("check", "server", build)
+	sink.statement("check", "server", build)
+	sink.statement("check", "other", build)
+	if built != 2 {
+		t.Errorf("built %d times, want once per table", built)
+	}
+}
+
+// BenchmarkPostgresSink_StatementCacheModes syncs a 100-endpoint service in
+// each --pg-statement-cache-mode against the database of the PG* variables.
+func BenchmarkPostgresSink_StatementCacheModes(b *testing.B) {
+	if os.Getenv("PGHOST") == "" {
+		b.Skip("needs a database; set PGHOST, PGUSER, PGPASSWORD and PGDATABASE")
+	}
+	const table = "observer_bench_statement_cache"
+	rows := map[string]endpointRow{}
+	for i := range 100 {
+		uid := fmt.Sprintf("uid-%d", i)
+		rows[uid] = endpointRow{UID: uid, Name: fmt.Sprintf("web-%d", i), IP: fmt.Sprintf("10.0.0.%d", i)}
+	}
+	ctx := context.Background()
+
+	for _, mode := range []struct {
+		name string
+		mode pgx.QueryExecMode
+	}{
+		{"statement", pgx.QueryExecModeCacheStatement},
+		{"describe", pgx.QueryExecModeCacheDescribe},
+		{"exec", pgx.QueryExecModeExec},
+		{"off", pgx.QueryExecModeDescribeExec},
+	} {
+		b.Run(mode.name, func(b *testing.B) {
+			cfg, err := pgxpool.ParseConfig("") // from the PG* variables
+			if err != nil {
+				b.Fatal(err)
+			}
+			cfg.ConnConfig.DefaultQueryExecMode = mode.mode
+			pool, err := pgxpool.NewWithConfig(ctx, cfg)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer pool.Close()
+			for _, stmt := range append([]string{"DROP TABLE IF EXISTS " + table}, createTable(migrationTarget{table: table, base: table})...) {
+				if _, err := pool.Exec(ctx, stmt); err != nil {
+					b.Fatal(err)
+				}
+			}
+			defer func() { _, _ = pool.Exec(ctx, "DROP TABLE "+table) }()
+			sink := &PostgresSink{DB: pool, TableName: table}
+
+			b.ReportAllocs()
+			for b.Loop() {
+				if err := sink.Sync(ctx, "bench", "default", "web", rows); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestPostgresSink_Instance(t *testing.T) {
+	rows := map[string]endpointRow{
+		"uid-1": {UID: "uid-1", IP: "10.0.0.1"},
+		"uid-2": {UID: "uid-2", IP: "10.0.0.2"},
+	}
+	db := &fakeDB{}
+	sink := &PostgresSink{DB: db, TableName: "server", Instance: "observer-0-1a2b3c"}
+	for range 2 {
+		if err := sink.Sync(context.Background(), "dev", "default", "svc", rows); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+	}
+	ups := db.statements("INSERT INTO")
+	if len(ups) != 4 {
+		t.Fatalf("upserts = %d, want 4", len(ups))
+	}
+	for _, up := range ups {
+		if !strings.Contains(up.sql, "observer_instance = EXCLUDED.observer_instance") {
+			t.Fatalf("upsert does not refresh observer_instance on conflict:\n%s", up.sql)
+		}
+		if up.args[6] != "observer-0-1a2b3c" {
+			t.Errorf("observer_instance of %v = %v, want observer-0-1a2b3c", up.args[3], up.args[6])
+		}
+	}
+
+	db = &fakeDB{}
+	if err := (&PostgresSink{DB: db, TableName: "server"}).Sync(context.Background(), "dev", "default", "svc", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if up := db.statements("INSERT INTO")[0]; strings.Contains(up.sql, "observer_instance") {
+		t.Errorf("upsert writes observer_instance without an Instance:\n%s", up.sql)
+	}
+}
+
+func TestPostgresSink_OmitNamespace(t *testing.T) {
+	rows := map[string]endpointRow{"uid-1": {UID: "uid-1", Name: "pod-1", IP: "10.0.0.1"}}
+	tests := []struct {
+		name       string
+		omit       bool
+		wantInsert []string
+		wantArgs   []any
+		wantPrune  string
+		wantDelete string
+		wantKey    []any
+	}{
+		{
+			name: "with namespace",
+			wantInsert: []string{
+				`INSERT INTO "server" (cluster, namespace, service, pod_uid, pod_name, pod_ip, ready, last_seen)`,
+				"VALUES ($1,$2,$3,$4,$5,$6,true, now())",
+				"ON CONFLICT (cluster, namespace, service, pod_uid)",
+			},
+			wantArgs:   []any{"dev", "default", "web", "uid-1", "pod-1", "10.0.0.1"},
+			wantPrune:  `DELETE FROM "server" WHERE cluster = $1 AND namespace = $2 AND service = $3 AND pod_uid <> ALL($4)`,
+			wantDelete: `DELETE FROM "server" WHERE cluster = $1 AND namespace = $2 AND service = $3`,
+			wantKey:    []any{"dev", "default", "web"},
+		},
+		{
+			name: "without namespace",
+			omit: true,
+			wantInsert: []string{
+				`INSERT INTO "server" (cluster, service, pod_uid, pod_name, pod_ip, ready, last_seen)`,
+				"VALUES ($1,$2,$3,$4,$5,true, now())",
+				"ON CONFLICT (cluster, service, pod_uid)",
+			},
+			wantArgs:   []any{"dev", "web", "uid-1", "pod-1", "10.0.0.1"},
+			wantPrune:  `DELETE FROM "server" WHERE cluster = $1 AND service = $2 AND pod_uid <> ALL($3)`,
+			wantDelete: `DELETE FROM "server" WHERE cluster = $1 AND service = $2`,
+			wantKey:    []any{"dev", "web"},
+		},
+	}
+	oneLine := func(sql string) string { return strings.Join(strings.Fields(sql), " ") }
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeDB{}
+			sink := &PostgresSink{DB: db, TableName: "server", OmitNamespace: tt.omit}
+			ctx := context.Background()
+			if err := sink.Sync(ctx, "dev", "default", "web", rows); err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			if err := sink.Delete(ctx, "dev", "default", "web"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+
+			up := db.statements("INSERT INTO")[0]
+			for _, want := range tt.wantInsert {
+				if !strings.Contains(oneLine(up.sql), want) {
+					t.Errorf("upsert lacks %q:\n%s", want, up.sql)
+				}
+			}
+			if !slices.Equal(up.args, tt.wantArgs) {
+				t.Errorf("upsert args = %v, want %v", up.args, tt.wantArgs)
+			}
+			del := db.statements("DELETE FROM")
+			if len(del) != 2 {
+				t.Fatalf("got %d DELETE statements, want the prune and the delete", len(del))
+			}
+			if got := oneLine(del[0].sql); got != tt.wantPrune || !slices.Equal(del[0].args[:len(tt.wantKey)], tt.wantKey) || len(del[0].args) != len(tt.wantKey)+1 {
+				t.Errorf("prune = %s with %v, want %s with %v and the live UIDs", got, del[0].args, tt.wantPrune, tt.wantKey)
+			}
+			if got := oneLine(del[1].sql); got != tt.wantDelete || !slices.Equal(del[1].args, tt.wantKey) {
+				t.Errorf("delete = %s with %v, want %s with %v", got, del[1].args, tt.wantDelete, tt.wantKey)
+			}
+		})
+	}
+}
+
+// Parameters after the service's are renumbered without the namespace.
+func TestPostgresSink_OmitNamespaceParameters(t *testing.T) {
+	rows := map[string]endpointRow{"uid-1": {UID: "uid-1", IP: "10.0.0.1"}}
+	db := &fakeDB{}
+	sink := &PostgresSink{
+		DB: db, TableName: "server", OmitNamespace: true, Region: "eu-west",
+		PruneGracePeriod: time.Minute, SyncVersion: true, VerifyWrites: true,
+	}
+	if err := sink.Sync(context.Background(), "dev", "default", "web", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	for _, s := range db.execs {
+		if strings.Contains(s.sql, "namespace") {
+			t.Errorf("statement writes or reads namespace:\n%s", s.sql)
+		}
+		for i := range s.args {
+			if !strings.Contains(s.sql, fmt.Sprintf("$%d", i+1)) {
+				t.Errorf("statement has %d args but doesn't use $%d:\n%s", len(s.args), i+1, s.sql)
+			}
+		}
+		if strings.Contains(s.sql, fmt.Sprintf("$%d", len(s.args)+1)) {
+			t.Errorf("statement uses $%d beyond its %d args:\n%s", len(s.args)+1, len(s.args), s.sql)
+		}
+	}
+	up := db.statements("INSERT INTO")[0]
+	if want := "ON CONFLICT (region, cluster, service, pod_uid)"; !strings.Contains(up.sql, want) {
+		t.Errorf("upsert lacks %q:\n%s", want, up.sql)
+	}
+	if mark := db.statements("SET ready = false"); len(mark) != 1 || !strings.Contains(mark[0].sql, "pod_uid <> ALL($3) AND ready AND region = $4") {
+		t.Errorf("mark = %+v, want the live UIDs in $3 and the region in $4", mark)
+	}
+}
+
+func TestRowPayload(t *testing.T) {
+	tests := []struct {
+		name string
+		row  endpointRow
+		want string
+	}{
+		{
+			name: "plain",
+			row:  endpointRow{UID: "uid-1", Name: "pod-1", IP: "10.0.0.1"},
+			want: `{"uid":"uid-1","name":"pod-1","ip":"10.0.0.1"}`,
+		},
+		{
+			name: "enriched",
+			row: endpointRow{
+				UID: "uid-1", Name: "pod-1", IP: "fd00::1", Port: 8080, AddressType: discoveryv1.AddressTypeIPv6,
+				PodLabels: newLabelSet(map[string]string{"version": "v2", "track": "canary"}), Owner: "Deployment/web",
+				Slices: nameList("web-a,web-b"),
+			},
+			want: `{"uid":"uid-1","name":"pod-1","ip":"fd00::1","port":8080,"addressType":"IPv6",` +
+				`"podLabels":{"track":"canary","version":"v2"},"owner":"Deployment/web","slices":["web-a","web-b"]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rowPayload(&tt.row)
+			if err != nil {
+				t.Fatalf("rowPayload() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("rowPayload() = %s, want %s", got, tt.want)
+			}
+			var back endpointRow
+			if err := json.Unmarshal([]byte(got), &back); err != nil || back != tt.row {
+				t.Errorf("payload decodes to %+v (%v), want %+v", back, err, tt.row)
+			}
+		})
+	}
+}
+
+func TestPostgresSink_JSONB(t *testing.T) {
+	rows := map[string]endpointRow{"uid-1": {UID: "uid-1", Name: "pod-1", IP: "10.0.0.1", Owner: "Deployment/web"}}
+	db := &fakeDB{}
+	sink := &PostgresSink{DB: db, TableName: "server", RowFormat: RowFormatJSONB, Owner: true, Now: func() time.Time { return time.Unix(0, 0) }}
+	if err := sink.Sync(context.Background(), "dev", "default", "svc", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	ups := db.statements("INSERT INTO")
+	if len(ups) != 1 {
+		t.Fatalf("upserts = %d, want 1", len(ups))
+	}
+	up := ups[0]
+	for _, want := range []string{
+		"(cluster, namespace, service, pod_uid, payload, last_seen)", "$5::jsonb, $6", "payload = EXCLUDED.payload",
+	} {
+		if !strings.Contains(up.sql, want) {
+			t.Errorf("upsert lacks %q:\n%s", want, up.sql)
+		}
+	}
+	if strings.Contains(up.sql, "pod_ip") || strings.Contains(up.sql, "owner") {
+		t.Errorf("upsert writes wide columns:\n%s", up.sql)
+	}
+	want := `{"uid":"uid-1","name":"pod-1","ip":"10.0.0.1","owner":"Deployment/web"}`
+	if len(up.args) != 6 || up.args[4] != want || up.args[5] != time.Unix(0, 0).UTC() {
+		t.Errorf("upsert args = %v, want the payload %s and last_seen", up.args, want)
+	}
+	// Pruning is unchanged: it keys on pod_uid.
+	if prunes := db.statements("pod_uid <> ALL($4)"); len(prunes) != 1 || !slices.Equal(prunes[0].args[3].([]string), []string{"uid-1"}) {
+		t.Errorf("prunes = %+v, want one keeping uid-1", prunes)
+	}
+}
+
+func TestPostgresSink_CountsDeletedRows(t *testing.T) {
+	db := &fakeDB{execFn: func(sql string, _ []any) (pgconn.CommandTag, error) {
+		if strings.Contains(sql, "DELETE") {
+			return pgconn.NewCommandTag("DELETE 3"), nil
+		}
+		return pgconn.NewCommandTag("INSERT 0 1"), nil
+	}}
+	sink := &PostgresSink{DB: db, TableName: "server"}
+	ctx, logs := captureLogs()
+	counter := rowsDeleted.WithLabelValues("metrics-ns", "svc")
+	before := testutil.ToFloat64(counter)
+
+	rows := map[string]endpointRow{
+		"uid-1": {UID: "uid-1", IP: "10.0.0.1"},
+		"uid-2": {UID: "uid-2", IP: "10.0.0.2"},
+	}
+	if err := sink.Sync(ctx, "dev", "metrics-ns", "svc", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if err := sink.Delete(ctx, "dev", "metrics-ns", "svc"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if got := testutil.ToFloat64(counter) - before; got != 6 {
+		t.Errorf("observer_rows_deleted_total grew by %v, want 6 (3 pruned + 3 deleted)", got)
+	}
+	joined := strings.Join(*logs, "\n")
+	if !strings.Contains(joined, `"upserted"=2`) || !strings.Contains(joined, `"pruned"=3`) {
+		t.Errorf("logs do not report row counts:\n%s", joined)
+	}
+}
+
+func TestPostgresSink_TimestampSource(t *testing.T) {
+	rows := map[string]endpointRow{"uid-1": {UID: "uid-1", IP: "10.0.0.1", PodLabels: `{"v":"1"}`}}
+	at := time.Date(2024, 5, 1, 14, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	tests := []struct {
+		name      string
+		now       func() time.Time
+		podLabels bool
+		wantSQL   []string
+		wantArgs  []any // beyond the first six
+	}{
+		{
+			name:    "server",
+			wantSQL: []string{"true, now()", "last_seen = EXCLUDED.last_seen"},
+		},
+		{
+			name:     "client passes a UTC timestamp",
+			now:      func() time.Time { return at },
+			wantSQL:  []string{"true, $7)", "last_seen = EXCLUDED.last_seen"},
+			wantArgs: []any{at.UTC()},
+		},
+		{
+			name:      "client with pod labels",
+			now:       func() time.Time { return at },
+			podLabels: true,
+			wantSQL:   []string{"true, $7, $8::jsonb", "pod_labels = EXCLUDED.pod_labels"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeDB{}
+			sink := &PostgresSink{DB: db, TableName: "server", Now: tt.now, PodLabels: tt.podLabels}
+			if err := sink.Sync(context.Background(), "dev", "default", "svc", rows); err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			up := db.statements("INSERT INTO")[0]
+			for _, want := range tt.wantSQL {
+				if !strings.Contains(up.sql, want) {
+					t.Errorf("upsert missing %q:\n%s", want, up.sql)
+				}
+			}
+			for i, want := range tt.wantArgs {
+				got, ok := up.args[6+i].(time.Time)
+				if !ok || !got.Equal(want.(time.Time)) || got.Location() != time.UTC {
+					t.Errorf("arg $%d = %#v, want %v in UTC", 7+i, up.args[6+i], want)
+				}
+			}
+			if tt.now == nil && len(up.args) != 6 {
+				t.Errorf("server mode passed %d args, want 6", len(up.args))
+			}
+		})
+	}
+}
+
+// graceRow is a row of graceTable.
+type graceRow struct {
+	ready    bool
+	lastSeen time.Time
+}
+
+// graceTable runs the upserts and two-phase prunes of a PostgresSink with
+// PruneGracePeriod and a client clock against a map keyed by pod_uid.
+func graceTable(rows map[string]*graceRow) *fakeDB {
+	return &fakeDB{execFn: func(sql string, args []any) (pgconn.CommandTag, error) {
+		switch {
+		case strings.Contains(sql, "INSERT"):
+			rows[args[3].(string)] = &graceRow{ready: true, lastSeen: args[6].(time.Time)}
+		case strings.Contains(sql, "DELETE"):
+			live, cutoff := args[3].([]string), args[4].(time.Time)
+			n := 0
+			for uid, r := range rows {
+				if !slices.Contains(live, uid) && !r.ready && r.lastSeen.Before(cutoff) {
+					delete(rows, uid)
+					n++
+				}
+			}
+			return pgconn.NewCommandTag(fmt.Sprintf("DELETE %d", n)), nil
+		case strings.Contains(sql, "SET ready = false"):
+			for uid, r := range rows {
+				if !slices.Contains(args[3].([]string), uid) {
+					r.ready = false
+				}
+			}
+		}
+		return pgconn.NewCommandTag("OK 1"), nil
+	}}
+}
+
+func TestPostgresSink_PruneGracePeriod(t *testing.T) {
+	table := map[string]*graceRow{}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	sink := &PostgresSink{DB: graceTable(table), TableName: "server", PruneGracePeriod: time.Minute, Now: func() time.Time { return now }}
+	both := map[string]endpointRow{"uid-1": {UID: "uid-1", IP: "10.0.0.1"}, "uid-2": {UID: "uid-2", IP: "10.0.0.2"}}
+	one := map[string]endpointRow{"uid-1": both["uid-1"]}
+
+	steps := []struct {
+		name    string
+		elapsed time.Duration
+		rows    map[string]endpointRow
+		want    map[string]bool // pod_uid -> ready
+	}{
+		{name: "both written", rows: both, want: map[string]bool{"uid-1": true, "uid-2": true}},
+		{name: "gone endpoint is marked", elapsed: 10 * time.Second, rows: one, want: map[string]bool{"uid-1": true, "uid-2": false}},
+		{name: "kept within the grace period", elapsed: 30 * time.Second, rows: one, want: map[string]bool{"uid-1": true, "uid-2": false}},
+		{name: "deleted once last_seen is older", elapsed: 30 * time.Second, rows: one, want: map[string]bool{"uid-1": true}},
+		{name: "returning endpoint is ready again", elapsed: time.Second, rows: both, want: map[string]bool{"uid-1": true, "uid-2": true}},
+		{name: "marked again", elapsed: time.Second, rows: one, want: map[string]bool{"uid-1": true, "uid-2": false}},
+		{name: "revived before the deadline", elapsed: 50 * time.Second, rows: both, want: map[string]bool{"uid-1": true, "uid-2": true}},
+	}
+	for _, step := range steps {
+		now = now.Add(step.elapsed)
+		if err := sink.Sync(context.Background(), "dev", "default", "svc", step.rows); err != nil {
+			t.Fatalf("%s: Sync() error = %v", step.name, err)
+		}
+		got := map[string]bool{}
+		for uid, r := range table {
+			got[uid] = r.ready
+		}
+		if !maps.Equal(got, step.want) {
+			t.Errorf("%s: table = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestPostgresSink_PruneGracePeriodStatements(t *testing.T) {
+	rows := map[string]endpointRow{"uid-1": {UID: "uid-1", IP: "10.0.0.1"}}
+
+	// The default prune is a single unconditional DELETE.
+	db := &fakeDB{}
+	if err := (&PostgresSink{DB: db, TableName: "server"}).Sync(context.Background(), "dev", "default", "svc", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if del := db.statements("DELETE"); len(del) != 1 || strings.Contains(del[0].sql, "ready") || len(db.statements("SET ready = false")) != 0 {
+		t.Errorf("without a grace period: DELETE %+v, UPDATE %+v, want one plain DELETE", del, db.statements("SET ready = false"))
+	}
+
+	// With the database clock, the cutoff is computed by the database.
+	db = &fakeDB{}
+	if err := (&PostgresSink{DB: db, TableName: "server", PruneGracePeriod: 90 * time.Second}).Sync(context.Background(), "dev", "default", "svc", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	del, mark := db.statements("DELETE"), db.statements("SET ready = false")
+	if len(del) != 1 || !strings.Contains(del[0].sql, "NOT ready AND last_seen < now() - make_interval(secs => $5)") || del[0].args[4] != 90.0 {
+		t.Errorf("DELETE = %+v, want the not-ready rows older than 90s", del)
+	}
+	if len(mark) != 1 || !slices.Equal(mark[0].args[3].([]string), []string{"uid-1"}) {
+		t.Errorf("UPDATE = %+v, want the rows other than uid-1 marked not ready", mark)
+	}
+}
+
+func TestPostgresSink_PruneMode(t *testing.T) {
+	rows := map[string]endpointRow{"uid-1": {UID: "uid-1", IP: "10.0.0.1"}}
+	tests := []struct {
+		name       string
+		mode       string
+		wantPrunes int
+	}{
+		{name: "default", wantPrunes: 1},
+		{name: "immediate", mode: PruneImmediate, wantPrunes: 1},
+		{name: "ttl", mode: PruneTTL, wantPrunes: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeDB{}
+			sink := &PostgresSink{DB: db, TableName: "server", PruneMode: tt.mode}
+			if err := sink.Sync(context.Background(), "dev", "default", "svc", rows); err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			if ups := db.statements("INSERT INTO"); len(ups) != 1 {
+				t.Errorf("upserts = %+v, want one", ups)
+			}
+			if prunes := db.statements("pod_uid <> ALL"); len(prunes) != tt.wantPrunes {
+				t.Errorf("prunes = %+v, want %d", prunes, tt.wantPrunes)
+			}
+
+			// A deleted Service is pruned in every mode.
+			if err := sink.Delete(context.Background(), "dev", "default", "svc"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if del := db.statements("DELETE FROM"); len(del) != tt.wantPrunes+1 || strings.Contains(del[len(del)-1].sql, "pod_uid") {
+				t.Errorf("deletes = %+v, want the service's rows deleted", del)
+			}
+		})
+	}
+}
+
+func TestPostgresSink_ConflictAction(t *testing.T) {
+	rows := map[string]endpointRow{"uid-1": {UID: "uid-1", Name: "web-1", IP: "10.0.0.1"}}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		action     string
+		touch      bool
+		now        func() time.Time
+		region     string
+		wantAction string
+		// wantTouch is the SET and trailing condition of the last_seen
+		// UPDATE, empty for none; wantArgs its arguments after the UIDs.
+		wantTouch string
+		wantArgs  []any
+	}{
+		{name: "default", wantAction: "DO UPDATE SET pod_ip = EXCLUDED.pod_ip, ready = true, last_seen = EXCLUDED.last_seen"},
+		{name: "update", action: ConflictUpdate, touch: true, wantAction: "DO UPDATE SET pod_ip = EXCLUDED.pod_ip"},
+		{name: "nothing", action: ConflictNothing, wantAction: "DO NOTHING"},
+		{
+			name: "nothing with heartbeats", action: ConflictNothing, touch: true, wantAction: "DO NOTHING",
+			wantTouch: "SET last_seen = now()",
+		},
+		{
+			name: "client clock and region", action: ConflictNothing, touch: true, now: func() time.Time { return now }, region: "eu-west",
+			wantAction: "DO NOTHING", wantTouch: "SET last_seen = $5", wantArgs: []any{now, "eu-west"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeDB{}
+			sink := &PostgresSink{DB: db, TableName: "server", ConflictAction: tt.action, TouchLastSeen: tt.touch, Now: tt.now, Region: tt.region}
+			if err := sink.Sync(context.Background(), "dev", "default", "web", rows); err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+
+			ups := db.statements("INSERT INTO")
+			if len(ups) != 1 || !strings.Contains(ups[0].sql, "ON CONFLICT (") || !strings.Contains(ups[0].sql, tt.wantAction) {
+				t.Fatalf("upserts = %+v, want one with %q", ups, tt.wantAction)
+			}
+			if tt.action == ConflictNothing && strings.Contains(ups[0].sql, "DO UPDATE") {
+				t.Errorf("upsert = %s, want no DO UPDATE", ups[0].sql)
+			}
+
+			touches := db.statements("SET last_seen")
+			if tt.wantTouch == "" {
+				if len(touches) != 0 {
+					t.Errorf("touches = %+v, want none", touches)
+				}
+				return
+			}
+			if len(touches) != 1 || !strings.Contains(touches[0].sql, tt.wantTouch) || !strings.Contains(touches[0].sql, "pod_uid = ANY($4)") {
+				t.Fatalf("touches = %+v, want one of the written UIDs containing %q", touches, tt.wantTouch)
+			}
+			if tt.region != "" && !strings.HasSuffix(touches[0].sql, "AND region = $6") {
+				t.Errorf("touch = %s, want it scoped to region $6", touches[0].sql)
+			}
+			args := touches[0].args
+			if args[0] != "dev" || args[1] != "default" || args[2] != "web" || !slices.Equal(args[3].([]string), []string{"uid-1"}) {
+				t.Errorf("touch args = %v, want the row of uid-1 of dev/default/web", args)
+			}
+			if !slices.Equal(args[4:], tt.wantArgs) {
+				t.Errorf("touch args = %v, want %v after the UIDs", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+// clearRow is a row of pruneTable; an empty ip is NULL.
+type clearRow struct {
+	ip    string
+	ready bool
+}
+
+// pruneTable runs the upserts and prunes of a PostgresSink against a map
+// keyed by pod_uid, with either PruneAction.
+func pruneTable(rows map[string]*clearRow) *fakeDB {
+	return &fakeDB{execFn: func(sql string, args []any) (pgconn.CommandTag, error) {
+		// The prunes of a Sync exclude the live UIDs in $4; a Delete has none.
+		gone := func(uid string) bool {
+			live, ok := args[len(args)-1].([]string)
+			return !ok || !slices.Contains(live, uid)
+		}
+		n := 0
+		switch {
+		case strings.Contains(sql, "INSERT"):
+			rows[args[3].(string)] = &clearRow{ip: args[5].(string), ready: true}
+		case strings.Contains(sql, "DELETE"):
+			for uid := range rows {
+				if gone(uid) {
+					delete(rows, uid)
+					n++
+				}
+			}
+		case strings.Contains(sql, "SET pod_ip = NULL, ready = false") && strings.Contains(sql, "pod_ip IS NOT NULL"):
+			for uid, r := range rows {
+				if gone(uid) && r.ip != "" {
+					r.ip, r.ready = "", false
+					n++
+				}
+			}
+		}
+		return pgconn.NewCommandTag(fmt.Sprintf("OK %d", n)), nil
+	}}
+}
+
+func TestPostgresSink_PruneAction(t *testing.T) {
+	both := map[string]endpointRow{"uid-1": {UID: "uid-1", IP: "10.0.0.1"}, "uid-2": {UID: "uid-2", IP: "10.0.0.2"}}
+	one := map[string]endpointRow{"uid-1": both["uid-1"]}
+	ready := func(ip string) clearRow { return clearRow{ip: ip, ready: true} }
+
+	// Each step is a Sync of rows, or a Delete with nil rows.
+	type step struct {
+		name string
+		rows map[string]endpointRow
+		want map[string]clearRow
+	}
+	tests := []struct {
+		action      string
+		counter     *prometheus.CounterVec
+		steps       []step
+		wantCounted float64
+	}{
+		{
+			action:  PruneDelete,
+			counter: rowsDeleted,
+			steps: []step{
+				{name: "both written", rows: both, want: map[string]clearRow{"uid-1": ready("10.0.0.1"), "uid-2": ready("10.0.0.2")}},
+				{name: "gone endpoint is deleted", rows: one, want: map[string]clearRow{"uid-1": ready("10.0.0.1")}},
+				{name: "returning endpoint is inserted", rows: both, want: map[string]clearRow{"uid-1": ready("10.0.0.1"), "uid-2": ready("10.0.0.2")}},
+				{name: "service deleted", want: map[string]clearRow{}},
+			},
+			wantCounted: 3,
+		},
+		{
+			action:  PruneClear,
+			counter: rowsCleared,
+			steps: []step{
+				{name: "both written", rows: both, want: map[string]clearRow{"uid-1": ready("10.0.0.1"), "uid-2": ready("10.0.0.2")}},
+				{name: "gone endpoint is cleared", rows: one, want: map[string]clearRow{"uid-1": ready("10.0.0.1"), "uid-2": {}}},
+				{name: "cleared row is left alone", rows: one, want: map[string]clearRow{"uid-1": ready("10.0.0.1"), "uid-2": {}}},
+				{name: "returning endpoint gets its pod_ip back", rows: both, want: map[string]clearRow{"uid-1": ready("10.0.0.1"), "uid-2": ready("10.0.0.2")}},
+				{name: "service deleted", want: map[string]clearRow{"uid-1": {}, "uid-2": {}}},
+			},
+			wantCounted: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			table := map[string]*clearRow{}
+			db := pruneTable(table)
+			sink := &PostgresSink{DB: db, TableName: "server", PruneAction: tt.action}
+			counter := tt.counter.WithLabelValues("prune-"+tt.action, "svc")
+			before := testutil.ToFloat64(counter)
+
+			for _, st := range tt.steps {
+				var err error
+				if st.rows == nil {
+					err = sink.Delete(context.Background(), "dev", "prune-"+tt.action, "svc")
+				} else {
+					err = sink.Sync(context.Background(), "dev", "prune-"+tt.action, "svc", st.rows)
+				}
+				if err != nil {
+					t.Fatalf("%s: error = %v", st.name, err)
+				}
+				got := map[string]clearRow{}
+				for uid, r := range table {
+					got[uid] = *r
+				}
+				if !maps.Equal(got, st.want) {
+					t.Errorf("%s: table = %+v, want %+v", st.name, got, st.want)
+				}
+			}
+
+			if got := testutil.ToFloat64(counter) - before; got != tt.wantCounted {
+				t.Errorf("counter grew by %v, want %v", got, tt.wantCounted)
+			}
+			if ups := db.statements("INSERT INTO"); !strings.Contains(ups[0].sql, "pod_ip = EXCLUDED.pod_ip, ready = true") {
+				t.Errorf("upsert = %s, want pod_ip and ready restored", ups[0].sql)
+			}
+			if del := db.statements("DELETE"); (tt.action == PruneClear) != (len(del) == 0) {
+				t.Errorf("DELETEs = %+v with action %s", del, tt.action)
+			}
+		})
+	}
+}
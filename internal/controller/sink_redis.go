@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"context"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisKeyTemplate is used when RedisSink.KeyTemplate is empty.
+const DefaultRedisKeyTemplate = "{cluster}:{namespace}:{service}"
+
+// RedisSink keeps a Redis SET of ready pod IPs per service.
+type RedisSink struct {
+	Client redis.UniversalClient
+	// KeyTemplate may reference {cluster}, {namespace} and {service}.
+	KeyTemplate string
+}
+
+func (s *RedisSink) key(cluster, namespace, service string) string {
+	tpl := s.KeyTemplate
+	if tpl == "" {
+		tpl = DefaultRedisKeyTemplate
+	}
+	return strings.NewReplacer(
+		"{cluster}", cluster,
+		"{namespace}", namespace,
+		"{service}", service,
+	).Replace(tpl)
+}
+
+func (s *RedisSink) Sync(ctx context.Context, cluster, namespace, service string, rows map[string]endpointRow) error {
+	key := s.key(cluster, namespace, service)
+
+	current, err := s.Client.SMembers(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+
+	want := make(map[string]struct{}, len(rows))
+	for _, r := range rows {
+		want[r.IP] = struct{}{}
+	}
+	var add, rem []any
+	for ip := range want {
+		add = append(add, ip)
+	}
+	for _, ip := range current {
+		if _, ok := want[ip]; !ok {
+			rem = append(rem, ip)
+		}
+	}
+	if len(add) == 0 && len(rem) == 0 {
+		return nil
+	}
+
+	_, err = s.Client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		if len(rem) > 0 {
+			p.SRem(ctx, key, rem...)
+		}
+		if len(add) > 0 {
+			p.SAdd(ctx, key, add...)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *RedisSink) Delete(ctx context.Context, cluster, namespace, service string) error {
+	return s.Client.Del(ctx, s.key(cluster, namespace, service)).Err()
+}
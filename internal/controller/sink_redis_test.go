@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedisSink(t *testing.T, tpl string) (*RedisSink, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return &RedisSink{Client: client, KeyTemplate: tpl}, mr
+}
+
+func members(t *testing.T, mr *miniredis.Miniredis, key string) []string {
+	t.Helper()
+	if !mr.Exists(key) {
+		return nil
+	}
+	m, err := mr.Members(key)
+	if err != nil {
+		t.Fatalf("members %s: %v", key, err)
+	}
+	sort.Strings(m)
+	return m
+}
+
+func TestRedisSink_SyncReconcilesSet(t *testing.T) {
+	sink, mr := newTestRedisSink(t, "")
+	ctx := context.Background()
+	key := "dev:default:my-service"
+
+	if err := sink.Sync(ctx, "dev", "default", "my-service", map[string]endpointRow{
+		"uid-1": {UID: "uid-1", IP: "10.0.0.1"},
+		"uid-2": {UID: "uid-2", IP: "10.0.0.2"},
+	}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := members(t, mr, key); len(got) != 2 || got[0] != "10.0.0.1" || got[1] != "10.0.0.2" {
+		t.Errorf("members after first sync = %v", got)
+	}
+
+	if err := sink.Sync(ctx, "dev", "default", "my-service", map[string]endpointRow{
+		"uid-2": {UID: "uid-2", IP: "10.0.0.2"},
+		"uid-3": {UID: "uid-3", IP: "10.0.0.3"},
+	}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := members(t, mr, key); len(got) != 2 || got[0] != "10.0.0.2" || got[1] != "10.0.0.3" {
+		t.Errorf("members after second sync = %v, want 10.0.0.2, 10.0.0.3", got)
+	}
+
+	if err := sink.Sync(ctx, "dev", "default", "my-service", map[string]endpointRow{}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if mr.Exists(key) {
+		t.Errorf("key %s still exists after syncing an empty set", key)
+	}
+}
+
+func TestRedisSink_Delete(t *testing.T) {
+	sink, mr := newTestRedisSink(t, "")
+	ctx := context.Background()
+	if _, err := mr.SAdd("dev:default:my-service", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mr.SAdd("dev:default:other", "10.0.0.9"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.Delete(ctx, "dev", "default", "my-service"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if mr.Exists("dev:default:my-service") {
+		t.Error("deleted service key still exists")
+	}
+	if !mr.Exists("dev:default:other") {
+		t.Error("unrelated service key was removed")
+	}
+}
+
+func TestRedisSink_KeyTemplate(t *testing.T) {
+	tests := []struct {
+		tpl      string
+		expected string
+	}{
+		{tpl: "", expected: "dev:default:svc"},
+		{tpl: "lb/{namespace}/{service}", expected: "lb/default/svc"},
+		{tpl: "{service}@{cluster}", expected: "svc@dev"},
+	}
+	for _, tt := range tests {
+		sink := &RedisSink{KeyTemplate: tt.tpl}
+		if got := sink.key("dev", "default", "svc"); got != tt.expected {
+			t.Errorf("key(%q) = %q, want %q", tt.tpl, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// RetrySink retries the failed writes of an auxiliary sink on its own, so
+// they don't fail the reconcile (see FanOutSink). Each call hands the sink
+// the whole set of a service, so only a service's latest failed call is
+// kept and retried; any later call of the service supersedes it. Retries
+// are Backoff apart, doubling up to MaxBackoff. Calls of one service never
+// overlap, so a retry can't land after a newer write.
+//
+// It's a manager Runnable: retries only run once it's started.
+type RetrySink struct {
+	Sink Sink
+	// Name labels the sink in logs and metrics, e.g. "webhook".
+	Name string
+	// Backoff is the delay before the first retry; MaxBackoff caps it.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Log        logr.Logger
+
+	locks   serviceLocks
+	mu      sync.Mutex
+	pending map[types.NamespacedName]*pendingCall
+}
+
+// pendingCall is the latest failed call of a service.
+type pendingCall struct {
+	cluster string
+	op      string
+	rows    map[string]endpointRow
+	retries int
+	due     time.Time
+}
+
+func (s *RetrySink) Sync(ctx context.Context, cluster, namespace, service string, rows map[string]endpointRow) error {
+	key := types.NamespacedName{Namespace: namespace, Name: service}
+	unlock := s.locks.lock(key)
+	defer unlock()
+	err := s.Sink.Sync(ctx, cluster, namespace, service, rows)
+	s.settle(key, &pendingCall{cluster: cluster, op: sinkOpSync, rows: rows}, err)
+	return err
+}
+
+func (s *RetrySink) Delete(ctx context.Context, cluster, namespace, service string) error {
+	key := types.NamespacedName{Namespace: namespace, Name: service}
+	unlock := s.locks.lock(key)
+	defer unlock()
+	err := s.Sink.Delete(ctx, cluster, namespace, service)
+	s.settle(key, &pendingCall{cluster: cluster, op: sinkOpDelete}, err)
+	return err
+}
+
+// settle drops the pending call of key, or makes c it if err is set.
+func (s *RetrySink) settle(key types.NamespacedName, c *pendingCall, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		delete(s.pending, key)
+		return
+	}
+	if s.pending == nil {
+		s.pending = map[types.NamespacedName]*pendingCall{}
+	}
+	c.due = time.Now().Add(s.delay(c.retries))
+	s.pending[key] = c
+}
+
+// delay is the wait before retry number retries+1.
+func (s *RetrySink) delay(retries int) time.Duration {
+	d := s.Backoff
+	for range retries {
+		if d *= 2; s.MaxBackoff > 0 && d >= s.MaxBackoff {
+			return s.MaxBackoff
+		}
+	}
+	return d
+}
+
+// Start retries the due calls every Backoff until ctx is done.
+func (s *RetrySink) Start(ctx context.Context) error {
+	ticker := time.NewTicker(s.Backoff)
+	defer ticker.Stop()
+	ctx = log.IntoContext(ctx, s.Log)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			s.retryDue(ctx, now)
+		}
+	}
+}
+
+// retryDue retries the pending calls due by now, once each.
+func (s *RetrySink) retryDue(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	var due []types.NamespacedName
+	for key, c := range s.pending {
+		if !c.due.After(now) {
+			due = append(due, key)
+		}
+	}
+	s.mu.Unlock()
+	for _, key := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		s.retry(ctx, key)
+	}
+}
+
+// retry makes the pending call of key again, unless a newer call settled
+// it meanwhile.
+func (s *RetrySink) retry(ctx context.Context, key types.NamespacedName) {
+	unlock := s.locks.lock(key)
+	defer unlock()
+	s.mu.Lock()
+	c := s.pending[key]
+	s.mu.Unlock()
+	if c == nil {
+		return
+	}
+	var err error
+	if c.op == sinkOpDelete {
+		err = s.Sink.Delete(ctx, c.cluster, key.Namespace, key.Name)
+	} else {
+		err = s.Sink.Sync(ctx, c.cluster, key.Namespace, key.Name, c.rows)
+	}
+	logger := log.FromContext(ctx)
+	if err != nil {
+		auxSinkErrors.WithLabelValues(sinkName(s), c.op).Inc()
+		logger.Error(err, "auxiliary sink retry failed", "sink", sinkName(s), "namespace", key.Namespace, "service", key.Name, "op", c.op, "retries", c.retries+1)
+		c.retries++
+	} else {
+		logger.V(1).Info("auxiliary sink retry succeeded", "sink", sinkName(s), "namespace", key.Namespace, "service", key.Name, "op", c.op)
+	}
+	s.settle(key, c, err)
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRetrySink(t *testing.T) {
+	ctx := context.Background()
+	inner := &recordingSink{err: errors.New("webhook down")}
+	s := &RetrySink{Sink: inner, Name: "webhook", Backoff: time.Second, MaxBackoff: 3 * time.Second, Log: logr.Discard()}
+	a := map[string]endpointRow{"uid-a": {UID: "uid-a", IP: "10.0.0.1"}}
+	b := map[string]endpointRow{"uid-b": {UID: "uid-b", IP: "10.0.0.2"}}
+
+	if err := s.Sync(ctx, "dev", "default", "web", a); err == nil {
+		t.Fatal("Sync() error = nil, want the sink's")
+	}
+	if err := s.Sync(ctx, "dev", "default", "web", b); err == nil {
+		t.Fatal("Sync() error = nil, want the sink's")
+	}
+	if err := s.Delete(ctx, "dev", "default", "db"); err == nil {
+		t.Fatal("Delete() error = nil, want the sink's")
+	}
+
+	s.retryDue(ctx, time.Now())
+	if len(inner.syncs) != 2 || len(inner.deletes) != 1 {
+		t.Fatalf("retried before the backoff: syncs %v, deletes %v", inner.syncs, inner.deletes)
+	}
+	// Still failing: each is retried once, and backs off further.
+	s.retryDue(ctx, time.Now().Add(time.Second))
+	if len(inner.syncs) != 3 || len(inner.deletes) != 2 {
+		t.Fatalf("after one retry: syncs %v, deletes %v, want one more of each", inner.syncs, inner.deletes)
+	}
+	if d := s.pending[types.NamespacedName{Namespace: "default", Name: "web"}].due; time.Until(d) < time.Second {
+		t.Errorf("next retry in %s, want the doubled backoff", time.Until(d))
+	}
+
+	// Only the latest state of web is retried.
+	inner.err = nil
+	s.retryDue(ctx, time.Now().Add(time.Hour))
+	if want := []string{"dev/default/web", "dev/default/web", "dev/default/web", "dev/default/web"}; !slices.Equal(inner.syncs, want) || inner.last["uid-b"] != b["uid-b"] {
+		t.Errorf("syncs %v of %v, want web retried with its latest rows", inner.syncs, inner.last)
+	}
+	if len(s.pending) != 0 {
+		t.Errorf("pending = %v after the retries succeeded, want none", s.pending)
+	}
+}
+
+// TestRetrySink_Superseded drops a pending retry once a later call of the
+// service succeeds.
+func TestRetrySink_Superseded(t *testing.T) {
+	ctx := context.Background()
+	inner := &recordingSink{err: errors.New("kafka down")}
+	s := &RetrySink{Sink: inner, Backoff: time.Second, Log: logr.Discard()}
+	_ = s.Sync(ctx, "dev", "default", "web", nil)
+	inner.err = nil
+	if err := s.Sync(ctx, "dev", "default", "web", nil); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	s.retryDue(ctx, time.Now().Add(time.Hour))
+	if len(inner.syncs) != 2 {
+		t.Errorf("syncs = %v, want no retry after the later write", inner.syncs)
+	}
+}
+
+// TestEndpointSliceReconciler_AuxSinkFails keeps a failing auxiliary sink
+// from failing the reconcile or tripping the breaker.
+func TestEndpointSliceReconciler_AuxSinkFails(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1")),
+	).Build()
+	table := &recordingSink{}
+	webhook := &RetrySink{Sink: &recordingSink{err: errors.New("webhook down")}, Name: "webhook", Backoff: time.Second, Log: logr.Discard()}
+	breaker := &Breaker{Threshold: 1, Cooldown: time.Minute, Log: logr.Discard()}
+	defer breakerState.Set(breakerClosed)
+	r := &EndpointSliceReconciler{Client: c, Sink: FanOutSink{table, webhook}, ClusterName: "dev", Breaker: breaker}
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web-a"}}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v, want the webhook's failure kept from it", err)
+	}
+	if len(table.syncs) != 1 {
+		t.Errorf("table syncs = %v, want 1", table.syncs)
+	}
+	if _, ok := breaker.Allow(); !ok {
+		t.Error("breaker opened on the webhook's failure")
+	}
+	if len(webhook.pending) != 1 {
+		t.Errorf("webhook pending = %v, want its write queued for retry", webhook.pending)
+	}
+}
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// EndpointSlice API versions the reconciler can watch.
+const (
+	EndpointSliceV1      = "v1"
+	EndpointSliceV1beta1 = "v1beta1"
+)
+
+// DetectEndpointSliceVersion asks the API server which EndpointSlice version
+// it serves, preferring v1. Clusters older than 1.21 only serve v1beta1.
+func DetectEndpointSliceVersion(dc discovery.ServerResourcesInterface) (string, error) {
+	var lastErr error
+	for _, gv := range []struct{ version, groupVersion string }{
+		{EndpointSliceV1, discoveryv1.SchemeGroupVersion.String()},
+		{EndpointSliceV1beta1, discoveryv1beta1.SchemeGroupVersion.String()},
+	} {
+		resources, err := dc.ServerResourcesForGroupVersion(gv.groupVersion)
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				return "", fmt.Errorf("discover %s: %w", gv.groupVersion, err)
+			}
+			lastErr = err
+			continue
+		}
+		for _, res := range resources.APIResources {
+			if res.Name == "endpointslices" {
+				return gv.version, nil
+			}
+		}
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("resource not listed")
+	}
+	return "", fmt.Errorf("no EndpointSlice API served: %w", lastErr)
+}
+
+// getSlice reads the slice in whichever version the reconciler watches,
+// always returning it as v1.
+func (r *EndpointSliceReconciler) getSlice(ctx context.Context, key client.ObjectKey, out *discoveryv1.EndpointSlice) error {
+	if r.APIVersion != EndpointSliceV1beta1 {
+		return r.Get(ctx, key, out)
+	}
+	var old discoveryv1beta1.EndpointSlice
+	if err := r.Get(ctx, key, &old); err != nil {
+		return err
+	}
+	*out = sliceFromV1beta1(&old)
+	return nil
+}
+
+func (r *EndpointSliceReconciler) listSlices(ctx context.Context, out *discoveryv1.EndpointSliceList, opts ...client.ListOption) error {
+	return r.listSlicesWith(ctx, r.list, out, opts...)
+}
+
+// listSlicesWith is listSlices through list.
+func (r *EndpointSliceReconciler) listSlicesWith(ctx context.Context, list listFunc, out *discoveryv1.EndpointSliceList, opts ...client.ListOption) error {
+	if r.APIVersion != EndpointSliceV1beta1 {
+		return list(ctx, out, opts...)
+	}
+	var old discoveryv1beta1.EndpointSliceList
+	if err := list(ctx, &old, opts...); err != nil {
+		return err
+	}
+	out.Items = make([]discoveryv1.EndpointSlice, 0, len(old.Items))
+	for i := range old.Items {
+		out.Items = append(out.Items, sliceFromV1beta1(&old.Items[i]))
+	}
+	return nil
+}
+
+// watchedObject returns an empty object of the watched kind and version.
+func (r *EndpointSliceReconciler) watchedObject() client.Object {
+	if r.Source == SourceEndpoints {
+		return &corev1.Endpoints{} //nolint:staticcheck // see reconcileEndpoints
+	}
+	if r.APIVersion == EndpointSliceV1beta1 {
+		return &discoveryv1beta1.EndpointSlice{}
+	}
+	return &discoveryv1.EndpointSlice{}
+}
+
+// sliceFromV1beta1 maps a v1beta1 slice onto v1. The v1beta1 topology map
+// carries the zone under the well-known label and becomes DeprecatedTopology.
+func sliceFromV1beta1(in *discoveryv1beta1.EndpointSlice) discoveryv1.EndpointSlice {
+	out := discoveryv1.EndpointSlice{
+		ObjectMeta:  in.ObjectMeta,
+		AddressType: discoveryv1.AddressType(in.AddressType),
+	}
+	for _, p := range in.Ports {
+		out.Ports = append(out.Ports, discoveryv1.EndpointPort{
+			Name: p.Name, Protocol: p.Protocol, Port: p.Port, AppProtocol: p.AppProtocol,
+		})
+	}
+	for _, ep := range in.Endpoints {
+		v1 := discoveryv1.Endpoint{
+			Addresses: ep.Addresses,
+			Conditions: discoveryv1.EndpointConditions{
+				Ready:       ep.Conditions.Ready,
+				Serving:     ep.Conditions.Serving,
+				Terminating: ep.Conditions.Terminating,
+			},
+			Hostname:           ep.Hostname,
+			TargetRef:          ep.TargetRef,
+			DeprecatedTopology: ep.Topology,
+			NodeName:           ep.NodeName,
+		}
+		if zone, ok := ep.Topology[corev1.LabelTopologyZone]; ok {
+			v1.Zone = &zone
+		}
+		out.Endpoints = append(out.Endpoints, v1)
+	}
+	return out
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newV1beta1Slice(namespace, name, service string, endpoints ...discoveryv1beta1.Endpoint) *discoveryv1beta1.EndpointSlice {
+	return &discoveryv1beta1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels:    map[string]string{discoveryv1beta1.LabelServiceName: service},
+		},
+		AddressType: discoveryv1beta1.AddressTypeIPv4,
+		Endpoints:   endpoints,
+	}
+}
+
+func TestDetectEndpointSliceVersion(t *testing.T) {
+	sliceList := func(gv string) *metav1.APIResourceList {
+		return &metav1.APIResourceList{GroupVersion: gv, APIResources: []metav1.APIResource{{Name: "endpointslices"}}}
+	}
+	tests := []struct {
+		name      string
+		resources []*metav1.APIResourceList
+		want      string
+		wantErr   bool
+	}{
+		{"v1 preferred", []*metav1.APIResourceList{sliceList("discovery.k8s.io/v1beta1"), sliceList("discovery.k8s.io/v1")}, EndpointSliceV1, false},
+		{"v1beta1 fallback", []*metav1.APIResourceList{sliceList("discovery.k8s.io/v1beta1")}, EndpointSliceV1beta1, false},
+		{"group served without slices", []*metav1.APIResourceList{{GroupVersion: "discovery.k8s.io/v1"}}, "", true},
+		{"not served", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dc := &discoveryfake.FakeDiscovery{Fake: &clienttesting.Fake{Resources: tt.resources}}
+			got, err := DetectEndpointSliceVersion(dc)
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("DetectEndpointSliceVersion() = %q, %v; want %q, wantErr %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDetectEndpointSliceVersion_DiscoveryError(t *testing.T) {
+	fakeClient := &clienttesting.Fake{}
+	fakeClient.AddReactor("get", "resource", func(clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	if _, err := DetectEndpointSliceVersion(&discoveryfake.FakeDiscovery{Fake: fakeClient}); err == nil {
+		t.Error("DetectEndpointSliceVersion() expected error when discovery fails, got nil")
+	}
+}
+
+func TestSliceFromV1beta1(t *testing.T) {
+	portName, port := "http", int32(8080)
+	in := newV1beta1Slice("default", "svc-abc", "svc", discoveryv1beta1.Endpoint{
+		Addresses:  []string{"10.0.0.1"},
+		Conditions: discoveryv1beta1.EndpointConditions{Ready: boolPtr(true), Serving: boolPtr(true)},
+		TargetRef:  &corev1.ObjectReference{Kind: "Pod", UID: "uid-1", Name: "pod-1"},
+		Topology:   map[string]string{corev1.LabelTopologyZone: "eu-west-1a", corev1.LabelHostname: "node-1"},
+	})
+	in.Ports = []discoveryv1beta1.EndpointPort{{Name: &portName, Port: &port}}
+
+	out := sliceFromV1beta1(in)
+	if out.Name != "svc-abc" || out.Labels[discoveryv1.LabelServiceName] != "svc" || out.AddressType != discoveryv1.AddressTypeIPv4 {
+		t.Errorf("metadata not carried over: %+v", out.ObjectMeta)
+	}
+	if len(out.Ports) != 1 || *out.Ports[0].Name != "http" || *out.Ports[0].Port != 8080 {
+		t.Errorf("ports = %+v", out.Ports)
+	}
+	ep := out.Endpoints[0]
+	if ep.Zone == nil || *ep.Zone != "eu-west-1a" {
+		t.Errorf("zone = %v, want eu-west-1a from topology", ep.Zone)
+	}
+	if ep.DeprecatedTopology[corev1.LabelHostname] != "node-1" {
+		t.Errorf("deprecated topology = %v", ep.DeprecatedTopology)
+	}
+	if ep.TargetRef.UID != "uid-1" || *ep.Conditions.Ready != true || ep.Addresses[0] != "10.0.0.1" {
+		t.Errorf("endpoint = %+v", ep)
+	}
+}
+
+func TestEndpointSliceReconciler_V1beta1(t *testing.T) {
+	ep := func(uid, name, ip string) discoveryv1beta1.Endpoint {
+		return discoveryv1beta1.Endpoint{
+			Addresses:  []string{ip},
+			Conditions: discoveryv1beta1.EndpointConditions{Ready: boolPtr(true)},
+			TargetRef:  &corev1.ObjectReference{Kind: "Pod", UID: types.UID(uid), Name: name},
+		}
+	}
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newV1beta1Slice("default", "svc-a", "svc", ep("uid-1", "pod-1", "10.0.0.1")),
+		newV1beta1Slice("default", "svc-b", "svc", ep("uid-2", "pod-2", "10.0.0.2")),
+	).Build()
+	r := &EndpointSliceReconciler{Client: c, Sink: &recordingSink{}, ClusterName: "dev", RequeueAfter: time.Minute, APIVersion: EndpointSliceV1beta1}
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "svc-a"}}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	prev, ok := r.serviceSnapshots().get(types.NamespacedName{Namespace: "default", Name: "svc"})
+	want := map[string]endpointRow{
+		"uid-1": {UID: "uid-1", Name: "pod-1", IP: "10.0.0.1", AddressType: discoveryv1.AddressTypeIPv4},
+		"uid-2": {UID: "uid-2", Name: "pod-2", IP: "10.0.0.2", AddressType: discoveryv1.AddressTypeIPv4},
+	}
+	if !ok || !maps.Equal(prev.rows, want) {
+		t.Errorf("synced rows = %v, want %v", prev.rows, want)
+	}
+	if _, isOld := r.watchedObject().(*discoveryv1beta1.EndpointSlice); !isOld {
+		t.Errorf("watchedObject() = %T, want v1beta1", r.watchedObject())
+	}
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"maps"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type serviceSnapshot struct {
+	rows   map[string]endpointRow
+	seen   time.Time // last reconcile that observed this set
+	synced time.Time // last time the set was actually written to the sink
+}
+
+// serviceSnapshots keeps the last successfully synced desired set per
+// service. Entries not refreshed within ttl are evicted so services that
+// vanished without a delete event don't pin memory forever.
+type serviceSnapshots struct {
+	mu        sync.Mutex
+	entries   map[types.NamespacedName]*serviceSnapshot
+	ttl       time.Duration
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+func newServiceSnapshots(ttl time.Duration) *serviceSnapshots {
+	return &serviceSnapshots{
+		entries: map[types.NamespacedName]*serviceSnapshot{},
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+// get returns the last stored snapshot for key and whether one exists.
+func (s *serviceSnapshots) get(key types.NamespacedName) (serviceSnapshot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return serviceSnapshot{}, false
+	}
+	return *e, true
+}
+
+// touch marks key as observed without a write, keeping it from eviction.
+func (s *serviceSnapshots) touch(key types.NamespacedName) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.seen = s.now()
+	}
+}
+
+// put stores a copy of rows for key as just written and opportunistically
+// evicts stale keys.
+func (s *serviceSnapshots) put(key types.NamespacedName, rows map[string]endpointRow) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.entries[key] = &serviceSnapshot{rows: maps.Clone(rows), seen: now, synced: now}
+
+	if s.ttl <= 0 || now.Sub(s.lastSweep) < s.ttl {
+		return
+	}
+	s.lastSweep = now
+	for k, e := range s.entries {
+		if now.Sub(e.seen) > s.ttl {
+			delete(s.entries, k)
+		}
+	}
+}
+
+// forget drops the snapshot of key.
+func (s *serviceSnapshots) forget(key types.NamespacedName) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+// reset drops every snapshot.
+func (s *serviceSnapshots) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.entries)
+}
+
+func (s *serviceSnapshots) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// uids returns the UIDs of rows, e.g. for logging.
+func uids(rows []endpointRow) []string {
+	out := make([]string, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, r.UID)
+	}
+	return out
+}
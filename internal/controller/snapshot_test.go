@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestServiceSnapshots_Eviction(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newServiceSnapshots(time.Minute)
+	s.now = func() time.Time { return now }
+
+	a := types.NamespacedName{Namespace: "default", Name: "a"}
+	b := types.NamespacedName{Namespace: "default", Name: "b"}
+
+	s.put(a, map[string]endpointRow{"uid-1": {UID: "uid-1"}})
+	now = now.Add(30 * time.Second)
+	s.put(b, map[string]endpointRow{"uid-2": {UID: "uid-2"}})
+
+	now = now.Add(45 * time.Second) // a is 75s old, b is 45s old
+	s.put(b, map[string]endpointRow{"uid-2": {UID: "uid-2"}})
+
+	if _, ok := s.get(a); ok {
+		t.Error("stale snapshot for a was not evicted")
+	}
+	if snap, ok := s.get(b); !ok || len(snap.rows) != 1 {
+		t.Errorf("snapshot for b = %v, %v; want kept", snap.rows, ok)
+	}
+	if s.len() != 1 {
+		t.Errorf("len() = %d, want 1", s.len())
+	}
+}
+
+func TestServiceSnapshots_StoresCopy(t *testing.T) {
+	s := newServiceSnapshots(0)
+	key := types.NamespacedName{Namespace: "default", Name: "a"}
+	rows := map[string]endpointRow{"uid-1": {UID: "uid-1"}}
+	s.put(key, rows)
+	rows["uid-2"] = endpointRow{UID: "uid-2"}
+
+	if got, _ := s.get(key); len(got.rows) != 1 {
+		t.Errorf("stored snapshot changed with caller's map: %v", got.rows)
+	}
+}
+
+func TestServiceSnapshots_TouchKeepsSyncedTime(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newServiceSnapshots(time.Minute)
+	s.now = func() time.Time { return now }
+	key := types.NamespacedName{Namespace: "default", Name: "a"}
+
+	s.put(key, nil)
+	synced := now
+	now = now.Add(50 * time.Second)
+	s.touch(key)
+	now = now.Add(50 * time.Second)
+	s.put(types.NamespacedName{Namespace: "default", Name: "b"}, nil) // triggers a sweep
+
+	snap, ok := s.get(key)
+	if !ok {
+		t.Fatal("touched snapshot was evicted")
+	}
+	if !snap.synced.Equal(synced) {
+		t.Errorf("synced = %v, want %v (touch must not count as a write)", snap.synced, synced)
+	}
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// Objects the EndpointSliceReconciler can take endpoints from.
+const (
+	SourceEndpointSlices = "endpointslices"
+	SourceEndpoints      = "endpoints"
+)
+
+// reconcileEndpoints is Reconcile for --source=endpoints. An Endpoints
+// object is named after its Service and holds all of its addresses, so there
+// is nothing to list.
+//
+//nolint:staticcheck // corev1.Endpoints is deprecated, but some clusters only maintain it
+func (r *EndpointSliceReconciler) reconcileEndpoints(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithValues("endpoints", req.NamespacedName)
+	defer r.locks.lock(req.NamespacedName)()
+	ctx = withSyncVersion(ctx, r.versions.next())
+
+	var eps corev1.Endpoints
+	if err := r.Get(ctx, req.NamespacedName, &eps); err != nil {
+		return ctrl.Result{RequeueAfter: r.requeueAfter()}, client.IgnoreNotFound(err)
+	}
+	if sel := r.selector(); sel != "" && !matchKV(eps.Labels, sel) {
+		logger.V(2).Info("skipping Endpoints not matching the selector", "selector", sel)
+		slicesFiltered.WithLabelValues(filterSelector).Inc()
+		return ctrl.Result{RequeueAfter: r.requeueAfter()}, nil
+	}
+
+	list := &discoveryv1.EndpointSliceList{Items: slicesFromEndpoints(&eps, r.serviceLabel())}
+	return r.syncService(ctx, logger, eps.Namespace, eps.Name, list)
+}
+
+// slicesFromEndpoints maps each subset of eps onto one EndpointSlice, so the
+// regular slice handling (port filter, dedup, readiness) applies unchanged.
+// NotReadyAddresses become endpoints with Ready=false. The Service name is
+// set under serviceLabel.
+//
+//nolint:staticcheck // corev1.Endpoints is deprecated, but some clusters only maintain it
+func slicesFromEndpoints(eps *corev1.Endpoints, serviceLabel string) []discoveryv1.EndpointSlice {
+	lbls := maps.Clone(eps.Labels)
+	if lbls == nil {
+		lbls = map[string]string{}
+	}
+	lbls[serviceLabel] = eps.Name
+
+	ready, notReady := true, false
+	out := make([]discoveryv1.EndpointSlice, 0, len(eps.Subsets))
+	for i, ss := range eps.Subsets {
+		sl := discoveryv1.EndpointSlice{
+			ObjectMeta:  *eps.ObjectMeta.DeepCopy(),
+			AddressType: discoveryv1.AddressTypeIPv4,
+		}
+		sl.Name = fmt.Sprintf("%s-%03d", eps.Name, i)
+		sl.Labels = lbls
+		for _, p := range ss.Ports {
+			sl.Ports = append(sl.Ports, discoveryv1.EndpointPort{
+				Name: &p.Name, Protocol: &p.Protocol, Port: &p.Port, AppProtocol: p.AppProtocol,
+			})
+		}
+		for _, a := range ss.Addresses {
+			sl.Endpoints = append(sl.Endpoints, endpointFromAddress(a, &ready))
+		}
+		for _, a := range ss.NotReadyAddresses {
+			sl.Endpoints = append(sl.Endpoints, endpointFromAddress(a, &notReady))
+		}
+		out = append(out, sl)
+	}
+	return out
+}
+
+func endpointFromAddress(a corev1.EndpointAddress, ready *bool) discoveryv1.Endpoint {
+	ep := discoveryv1.Endpoint{
+		Addresses:  []string{a.IP},
+		Conditions: discoveryv1.EndpointConditions{Ready: ready},
+		NodeName:   a.NodeName,
+		TargetRef:  a.TargetRef,
+	}
+	if a.Hostname != "" {
+		ep.Hostname = &a.Hostname
+	}
+	return ep
+}
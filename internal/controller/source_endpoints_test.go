@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"context"
+	"maps"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+//nolint:staticcheck // corev1.Endpoints is deprecated
+func newEndpoints(namespace, name string, subsets ...corev1.EndpointSubset) *corev1.Endpoints {
+	return &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: map[string]string{"app": name}},
+		Subsets:    subsets,
+	}
+}
+
+func podAddress(uid, name, ip string) corev1.EndpointAddress {
+	return corev1.EndpointAddress{IP: ip, TargetRef: &corev1.ObjectReference{Kind: "Pod", UID: types.UID(uid), Name: name}}
+}
+
+//nolint:staticcheck // corev1.Endpoints is deprecated
+func TestEndpointSliceReconciler_EndpointsSource(t *testing.T) {
+	eps := newEndpoints("default", "web",
+		corev1.EndpointSubset{
+			Addresses:         []corev1.EndpointAddress{podAddress("uid-1", "web-1", "10.0.0.1"), {IP: "10.0.0.9"}},
+			NotReadyAddresses: []corev1.EndpointAddress{podAddress("uid-2", "web-2", "10.0.0.2")},
+			Ports:             []corev1.EndpointPort{{Name: "http", Port: 8080}},
+		},
+		corev1.EndpointSubset{
+			Addresses: []corev1.EndpointAddress{podAddress("uid-3", "web-3", "10.0.0.3")},
+			Ports:     []corev1.EndpointPort{{Name: "grpc", Port: 9090}},
+		},
+	)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"}}
+
+	tests := []struct {
+		name       string
+		selector   string
+		portFilter string
+		want       map[string]endpointRow
+	}{
+		{
+			name: "ready addresses of every subset",
+			want: map[string]endpointRow{
+				"uid-1":                {UID: "uid-1", Name: "web-1", IP: "10.0.0.1", AddressType: discoveryv1.AddressTypeIPv4},
+				"default/web/10.0.0.9": {UID: "default/web/10.0.0.9", IP: "10.0.0.9", AddressType: discoveryv1.AddressTypeIPv4},
+				"uid-3":                {UID: "uid-3", Name: "web-3", IP: "10.0.0.3", AddressType: discoveryv1.AddressTypeIPv4},
+			},
+		},
+		{
+			name:       "port filter applies to subset ports",
+			portFilter: "grpc",
+			want: map[string]endpointRow{
+				"uid-3": {UID: "uid-3", Name: "web-3", IP: "10.0.0.3", Port: 9090, AddressType: discoveryv1.AddressTypeIPv4},
+			},
+		},
+		{
+			name:     "label selector applies to the Endpoints object",
+			selector: "app=other",
+			want:     nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(eps.DeepCopy()).Build()
+			r := &EndpointSliceReconciler{
+				Client: c, Sink: &recordingSink{}, ClusterName: "dev", RequeueAfter: time.Minute,
+				Source: SourceEndpoints, LabelSelector: tt.selector, PortFilter: tt.portFilter,
+			}
+			if _, err := r.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			prev, ok := r.serviceSnapshots().get(types.NamespacedName{Namespace: "default", Name: "web"})
+			if ok != (tt.want != nil) || !maps.Equal(prev.rows, tt.want) {
+				t.Errorf("synced rows = %v (stored %v), want %v", prev.rows, ok, tt.want)
+			}
+		})
+	}
+
+	r := &EndpointSliceReconciler{Source: SourceEndpoints}
+	if _, ok := r.watchedObject().(*corev1.Endpoints); !ok {
+		t.Errorf("watchedObject() = %T, want *corev1.Endpoints", r.watchedObject())
+	}
+}
+
+//nolint:staticcheck // corev1.Endpoints is deprecated
+func TestEndpointSliceReconciler_EndpointsSourceMissing(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()
+	sink := &recordingSink{}
+	r := &EndpointSliceReconciler{Client: c, Sink: sink, RequeueAfter: time.Minute, Source: SourceEndpoints}
+	res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "gone"}})
+	if err != nil || res.RequeueAfter != time.Minute {
+		t.Errorf("Reconcile() = %+v, %v; want requeue without error", res, err)
+	}
+	if len(sink.syncs) != 0 {
+		t.Errorf("sink synced %v for a missing Endpoints object", sink.syncs)
+	}
+}
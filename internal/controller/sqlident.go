@@ -1,17 +1,53 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 
 	pgx "github.com/jackc/pgx/v5"
 )
 
 // sanitizeTableIdent returns a safely-quoted identifier suitable for SQL
-// (supports "schema.table"). Defaults to public.server.
-func sanitizeTableIdent(name string) string {
+// (supports "schema.table" and "db.schema.table"). Defaults to public.server.
+// Names with empty segments ("public.", ".server", "a..b") or more than three
+// parts are rejected rather than quoted into something Postgres won't accept.
+func sanitizeTableIdent(name string) (string, error) {
 	if name == "" {
 		name = "public.server"
 	}
 	parts := strings.Split(name, ".")
-	return pgx.Identifier(parts).Sanitize()
+	if len(parts) > 3 {
+		return "", fmt.Errorf("table name %q has %d parts, at most 3 are allowed", name, len(parts))
+	}
+	for _, p := range parts {
+		if p == "" {
+			return "", fmt.Errorf("table name %q has an empty segment", name)
+		}
+	}
+	return pgx.Identifier(parts).Sanitize(), nil
+}
+
+// ValidateTableName reports whether name can be used as the destination
+// table. pgx silently drops NUL bytes while sanitizing, which would make us
+// write to a different table than the one configured, so reject them here.
+func ValidateTableName(name string) error {
+	if strings.ContainsRune(name, 0) {
+		return errors.New("table name must not contain NUL bytes")
+	}
+	_, err := sanitizeTableIdent(name)
+	return err
+}
+
+// splitTableName splits a name accepted by sanitizeTableIdent into its
+// schema (nil when unqualified, i.e. resolved through search_path) and table.
+func splitTableName(name string) (schema *string, table string) {
+	if name == "" {
+		name = "public.server"
+	}
+	parts := strings.Split(name, ".")
+	if len(parts) == 1 {
+		return nil, parts[0]
+	}
+	return &parts[len(parts)-2], parts[len(parts)-1]
 }
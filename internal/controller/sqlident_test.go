@@ -6,9 +6,10 @@ import (
 
 func TestSanitizeTableIdent(t *testing.T) {
 	tests := []struct {
-		name     string
-		input    string
-		expected string
+		name        string
+		input       string
+		expected    string
+		expectError bool
 	}{
 		{
 			name:     "empty string defaults to public.server",
@@ -90,14 +91,62 @@ func TestSanitizeTableIdent(t *testing.T) {
 			input:    "public.select",
 			expected: `"public"."select"`,
 		},
+		{
+			name:        "trailing dot",
+			input:       "public.",
+			expectError: true,
+		},
+		{
+			name:        "leading dot",
+			input:       ".server",
+			expectError: true,
+		},
+		{
+			name:        "empty middle segment",
+			input:       "a..b",
+			expectError: true,
+		},
+		{
+			name:        "more than three parts",
+			input:       "a.b.c.d",
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := sanitizeTableIdent(tt.input)
+			result, err := sanitizeTableIdent(tt.input)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("sanitizeTableIdent(%q) error = %v, expectError %v", tt.input, err, tt.expectError)
+			}
 			if result != tt.expected {
 				t.Errorf("sanitizeTableIdent(%q) = %q, want %q", tt.input, result, tt.expected)
 			}
 		})
 	}
 }
+
+func TestValidateTableName(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expectError bool
+	}{
+		{name: "empty uses default", input: ""},
+		{name: "schema-qualified", input: "public.server"},
+		{name: "NUL byte rejected", input: "pub\x00lic.server", expectError: true},
+		{name: "trailing dot rejected", input: "public.", expectError: true},
+		{name: "leading dot rejected", input: ".server", expectError: true},
+		{name: "empty segment rejected", input: "a..b", expectError: true},
+		{name: "four parts rejected", input: "a.b.c.d", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTableName(tt.input)
+			if (err != nil) != tt.expectError {
+				t.Errorf("ValidateTableName(%q) error = %v, expectError %v", tt.input, err, tt.expectError)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// SyncStatus records the outcome of the latest sync of each
+// {namespace,service}: when it last succeeded, how many endpoints that
+// wrote, and since then the last error and how many syncs failed in a row.
+// It's served as JSON on /status and exported as the
+// observer_service_* gauges, for alerting on services that stopped
+// syncing. A nil *SyncStatus is valid and records nothing.
+type SyncStatus struct {
+	mu       sync.RWMutex
+	services map[types.NamespacedName]*serviceStatus
+	now      func() time.Time
+}
+
+// serviceStatus is the status of one service.
+type serviceStatus struct {
+	Namespace string `json:"namespace"`
+	Service   string `json:"service"`
+	// LastSync is when a sync last succeeded; zero if none has yet.
+	LastSync            time.Time `json:"lastSync,omitzero"`
+	Endpoints           int       `json:"endpoints"`
+	LastError           string    `json:"lastError,omitempty"`
+	LastErrorTime       time.Time `json:"lastErrorTime,omitzero"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+}
+
+func NewSyncStatus() *SyncStatus {
+	return &SyncStatus{services: map[types.NamespacedName]*serviceStatus{}, now: time.Now}
+}
+
+func (s *SyncStatus) entry(key types.NamespacedName) *serviceStatus {
+	st := s.services[key]
+	if st == nil {
+		st = &serviceStatus{Namespace: key.Namespace, Service: key.Name}
+		s.services[key] = st
+	}
+	return st
+}
+
+// Succeeded records a sync of namespace/service that wrote endpoints, or
+// found them unchanged.
+func (s *SyncStatus) Succeeded(namespace, service string, endpoints int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.entry(types.NamespacedName{Namespace: namespace, Name: service})
+	st.LastSync, st.Endpoints = s.now(), endpoints
+	st.LastError, st.LastErrorTime, st.ConsecutiveFailures = "", time.Time{}, 0
+	serviceEndpoints.WithLabelValues(namespace, service).Set(float64(endpoints))
+	serviceLastSync.WithLabelValues(namespace, service).Set(float64(st.LastSync.Unix()))
+	serviceSyncFailures.WithLabelValues(namespace, service).Set(0)
+}
+
+// Failed records a sync of namespace/service that failed with err.
+func (s *SyncStatus) Failed(namespace, service string, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.entry(types.NamespacedName{Namespace: namespace, Name: service})
+	st.LastError, st.LastErrorTime = err.Error(), s.now()
+	st.ConsecutiveFailures++
+	serviceSyncFailures.WithLabelValues(namespace, service).Set(float64(st.ConsecutiveFailures))
+}
+
+// Forget drops namespace/service and its gauges, e.g. once the Service is
+// deleted.
+func (s *SyncStatus) Forget(namespace, service string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.services, types.NamespacedName{Namespace: namespace, Name: service})
+	for _, g := range []interface{ DeleteLabelValues(...string) bool }{serviceEndpoints, serviceLastSync, serviceSyncFailures} {
+		g.DeleteLabelValues(namespace, service)
+	}
+	serviceEndpointStates.DeletePartialMatch(prometheus.Labels{"namespace": namespace, "service": service})
+}
+
+// EndpointStates records how many endpoints the slices of namespace/service
+// list per state (see endpointState), whether or not the sync writes them.
+func (s *SyncStatus) EndpointStates(namespace, service string, counts map[string]int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock() // orders the gauges against a concurrent Forget
+	defer s.mu.Unlock()
+	for _, state := range []string{stateReady, stateNotReady, stateTerminating} {
+		serviceEndpointStates.WithLabelValues(namespace, service, state).Set(float64(counts[state]))
+	}
+}
+
+// snapshot returns a copy of every service's status, sorted by namespace
+// and service.
+func (s *SyncStatus) snapshot() []serviceStatus {
+	if s == nil {
+		return []serviceStatus{}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]serviceStatus, 0, len(s.services))
+	for _, st := range s.services {
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Namespace != out[j].Namespace {
+			return out[i].Namespace < out[j].Namespace
+		}
+		return out[i].Service < out[j].Service
+	})
+	return out
+}
+
+// Handler serves the status of every service as JSON.
+func (s *SyncStatus) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, struct {
+			Services []serviceStatus `json:"services"`
+		}{s.snapshot()})
+	})
+}
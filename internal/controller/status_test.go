@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestSyncStatus_Handler(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	status := NewSyncStatus()
+	status.now = func() time.Time { return now }
+
+	status.Succeeded("default", "web", 3)
+	status.Failed("default", "web", errors.New("connection refused"))
+	status.Failed("default", "web", errors.New("connection reset"))
+	status.Failed("default", "new", errors.New("too many endpoints"))
+	status.Succeeded("other", "db", 1)
+	status.Succeeded("other", "gone", 2)
+	status.Forget("other", "gone")
+
+	rec := httptest.NewRecorder()
+	status.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	want := `{"services":[` +
+		`{"namespace":"default","service":"new","endpoints":0,"lastError":"too many endpoints","lastErrorTime":"2026-01-01T12:00:00Z","consecutiveFailures":1},` +
+		`{"namespace":"default","service":"web","lastSync":"2026-01-01T12:00:00Z","endpoints":3,"lastError":"connection reset",` +
+		`"lastErrorTime":"2026-01-01T12:00:00Z","consecutiveFailures":2},` +
+		`{"namespace":"other","service":"db","lastSync":"2026-01-01T12:00:00Z","endpoints":1,"consecutiveFailures":0}]}`
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Errorf("body =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := testutil.ToFloat64(serviceSyncFailures.WithLabelValues("default", "web")); got != 2 {
+		t.Errorf("observer_service_consecutive_sync_failures{default,web} = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(serviceEndpoints.WithLabelValues("default", "web")); got != 3 {
+		t.Errorf("observer_service_endpoints{default,web} = %v, want 3 from the last success", got)
+	}
+	if got := testutil.ToFloat64(serviceLastSync.WithLabelValues("other", "db")); got != float64(now.Unix()) {
+		t.Errorf("observer_service_last_sync_timestamp_seconds{other,db} = %v, want %d", got, now.Unix())
+	}
+	if deleted := serviceEndpoints.DeleteLabelValues("other", "gone"); deleted {
+		t.Error("observer_service_endpoints{other,gone} still exported after Forget")
+	}
+}
+
+func TestSyncStatus_Concurrent(t *testing.T) {
+	status := NewSyncStatus()
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Go(func() {
+			service := fmt.Sprintf("svc-%d", i%2)
+			for range 100 {
+				status.Failed("concurrent", service, errors.New("boom"))
+				status.Succeeded("concurrent", service, i)
+				_ = status.snapshot()
+			}
+		})
+	}
+	wg.Wait()
+
+	got := status.snapshot()
+	if len(got) != 2 {
+		t.Fatalf("services = %+v, want svc-0 and svc-1", got)
+	}
+	for _, st := range got {
+		if st.ConsecutiveFailures > 8 || st.LastSync.IsZero() {
+			t.Errorf("status = %+v, want a success and at most one failure per writer since", st)
+		}
+	}
+	for _, svc := range []string{"svc-0", "svc-1"} {
+		status.Forget("concurrent", svc)
+	}
+}
+
+func TestSyncStatus_Nil(t *testing.T) {
+	var status *SyncStatus
+	status.Succeeded("default", "web", 1)
+	status.Failed("default", "web", errors.New("boom"))
+	status.Forget("default", "web")
+	if got := status.snapshot(); len(got) != 0 {
+		t.Errorf("nil snapshot() = %v, want empty", got)
+	}
+}
+
+func TestEndpointSliceReconciler_RecordsStatus(t *testing.T) {
+	slice := newSlice("status", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1"), podEndpoint("uid-2", "web-2", "10.0.0.2"))
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(slice).Build()
+	sink := &recordingSink{err: &pgconn.PgError{Code: "08006"}}
+	status := NewSyncStatus()
+	defer status.Forget("status", "web")
+	r := &EndpointSliceReconciler{Client: c, Sink: sink, ClusterName: "dev", Status: status}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "status", Name: "web-a"}}
+
+	for range 2 {
+		_, _ = r.Reconcile(context.Background(), req)
+	}
+	if got := status.snapshot(); len(got) != 1 || got[0].ConsecutiveFailures != 2 || !strings.Contains(got[0].LastError, "08006") {
+		t.Fatalf("status after two failed writes = %+v, want 2 failures with the error", got)
+	}
+
+	sink.err = nil
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got := status.snapshot(); got[0].ConsecutiveFailures != 0 || got[0].LastError != "" || got[0].Endpoints != 2 {
+		t.Errorf("status after a successful write = %+v, want 2 endpoints and no failure", got[0])
+	}
+}
+
+func TestEndpointSliceReconciler_EndpointStates(t *testing.T) {
+	notReady := podEndpoint("uid-2", "web-2", "10.0.0.2")
+	notReady.Conditions.Ready = boolPtr(false)
+	draining := podEndpoint("uid-3", "web-3", "10.0.0.3")
+	draining.Conditions = discoveryv1.EndpointConditions{Ready: boolPtr(false), Serving: boolPtr(true), Terminating: boolPtr(true)}
+	gone := podEndpoint("uid-4", "web-4", "10.0.0.4")
+	gone.Conditions = discoveryv1.EndpointConditions{Ready: boolPtr(false), Serving: boolPtr(false), Terminating: boolPtr(true)}
+	unknown := podEndpoint("uid-5", "web-5", "10.0.0.5")
+	unknown.Conditions = discoveryv1.EndpointConditions{}
+	slice := newSlice("states", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1"), notReady, draining, gone, unknown)
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(slice).Build()
+	status := NewSyncStatus()
+	r := &EndpointSliceReconciler{Client: c, Sink: &recordingSink{}, ClusterName: "dev", Status: status}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "states", Name: "web-a"}}
+	states := func() map[string]float64 {
+		got := map[string]float64{}
+		for _, state := range []string{stateReady, stateNotReady, stateTerminating} {
+			got[state] = testutil.ToFloat64(serviceEndpointStates.WithLabelValues("states", "web", state))
+		}
+		return got
+	}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got, want := states(), map[string]float64{stateReady: 2, stateNotReady: 1, stateTerminating: 2}; !maps.Equal(got, want) {
+		t.Errorf("observer_endpoints{states,web} = %v, want %v", got, want)
+	}
+
+	// The draining endpoints go away; their state drops to zero.
+	slice.Endpoints = slice.Endpoints[:2]
+	if err := c.Update(context.Background(), slice); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got, want := states(), map[string]float64{stateReady: 1, stateNotReady: 1, stateTerminating: 0}; !maps.Equal(got, want) {
+		t.Errorf("observer_endpoints{states,web} after scale-down = %v, want %v", got, want)
+	}
+
+	status.Forget("states", "web")
+	for _, state := range []string{stateReady, stateNotReady, stateTerminating} {
+		if serviceEndpointStates.DeleteLabelValues("states", "web", state) {
+			t.Errorf("observer_endpoints{states,web,%s} still exported after Forget", state)
+		}
+	}
+}
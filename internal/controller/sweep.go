@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Sweeper periodically deletes the rows of services that no longer have
+// endpoints to watch (--gc-interval), e.g. of a Service deleted while the
+// observer was down, which no delete event will ever prune.
+//
+// Replicas don't elect a leader, so every sweep takes a transaction-level
+// advisory lock keyed by the cluster name first; a replica that can't get
+// it skips that sweep. Only TableName is swept, not per-service tables.
+type Sweeper struct {
+	DB        DB
+	TableName string
+	// TableFile, if set, replaces TableName with its current value
+	// (--table=@file).
+	TableFile *LiveValue
+	// Reconciler lists the live services, with its filters applied: rows of
+	// a service it no longer matches are swept too. Its Shard isn't, so a
+	// sharded replica never sweeps the services of the others.
+	Reconciler *EndpointSliceReconciler
+	// Namespace limits listing and sweeping to one namespace; empty is all.
+	Namespace string
+	// Region, if set, limits sweeping to the rows of this region, the
+	// PostgresSink.Region of the reconcilers.
+	Region string
+	// PruneAction is the PostgresSink.PruneAction of the reconcilers.
+	PruneAction string
+	// Interval is the time between sweeps. Rows written within the last
+	// Interval are kept, so a service created after the listing survives.
+	Interval time.Duration
+	// Now, if set, is the clock of last_seen (the PostgresSink.Now of the
+	// reconcilers); nil is the database's now().
+	Now func() time.Time
+	// Pause, while paused, skips sweeps.
+	Pause *Pause
+	Log   logr.Logger
+}
+
+// sweepLockKey is the advisory lock of the sweeps of cluster. Keys are
+// shared by the whole database, hence the prefix.
+func sweepLockKey(cluster string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte("observer/sweep/" + cluster))
+	return int64(h.Sum64())
+}
+
+// Start sweeps every Interval until ctx is done. It's a manager Runnable;
+// the manager starts it once the caches have synced.
+func (s *Sweeper) Start(ctx context.Context) error {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	ctx = log.IntoContext(ctx, s.Log)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := s.Sweep(ctx); err != nil && ctx.Err() == nil {
+				s.Log.Error(err, "sweep orphaned rows")
+			}
+		}
+	}
+}
+
+// Sweep deletes the rows of the services missing from the current listing
+// once. It returns nil without deleting anything if another instance holds
+// the lock or writes are paused. pg_try_advisory_xact_lock is used rather than the session-level
+// pg_try_advisory_lock because DB is a pool: the unlock could land on
+// another connection, while the transaction's lock is released with it.
+func (s *Sweeper) Sweep(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+	if s.Pause.Paused() {
+		logger.V(1).Info("skipping sweep, writes are paused")
+		return nil
+	}
+	tbl, err := sanitizeTableIdent(s.TableFile.Or(s.TableName))
+	if err != nil {
+		return err
+	}
+	cluster := s.Reconciler.cluster()
+	services, err := s.Reconciler.listServices(ctx, s.Namespace)
+	if err != nil {
+		return err
+	}
+	keys := make([]serviceKey, 0, len(services))
+	for key := range services {
+		keys = append(keys, serviceKey{cluster, key.Namespace, key.Name})
+	}
+	slices.SortFunc(keys, serviceKey.compare)
+	namespaces := make([]string, 0, len(keys))
+	names := make([]string, 0, len(keys))
+	for _, k := range keys {
+		namespaces = append(namespaces, k.namespace)
+		names = append(names, k.service)
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// Instances of different regions may share a cluster name.
+	lockName := cluster
+	if s.Region != "" {
+		lockName = s.Region + "/" + cluster
+	}
+	var locked bool
+	if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, sweepLockKey(lockName)).Scan(&locked); err != nil {
+		return fmt.Errorf("take sweep lock: %w", err)
+	}
+	if !locked {
+		logger.V(1).Info("skipping sweep, another instance is sweeping", "cluster", cluster)
+		return nil
+	}
+
+	// $4 and $5 list the live services pairwise, as two arrays of equal
+	// length; an empty namespace or service in $2/$3 matches any. The
+	// cutoff comes from the same clock as last_seen.
+	cutoff, arg := "now() - make_interval(secs => $6)", any(s.Interval.Seconds())
+	if s.Now != nil {
+		cutoff, arg = "$6", s.Now().UTC().Add(-s.Interval)
+	}
+	args := []any{cluster, s.Namespace, s.Reconciler.ServiceName, namespaces, names, arg}
+	region, rargs := regionCond(s.Region, 7)
+	q := pruneStatement(s.PruneAction, tbl, `cluster = $1 AND ($2 = '' OR namespace = $2) AND ($3 = '' OR service = $3)
+	    AND (namespace, service) NOT IN (SELECT * FROM unnest($4::text[], $5::text[]))
+	    AND last_seen < `+cutoff+region, "namespace, service")
+	rows, err := tx.Query(ctx, q, append(args, rargs...)...)
+	if err != nil {
+		return fmt.Errorf("sweep %s: %w", tbl, err)
+	}
+	deleted := map[types.NamespacedName]int{}
+	for rows.Next() {
+		var key types.NamespacedName
+		if err := rows.Scan(&key.Namespace, &key.Name); err != nil {
+			rows.Close()
+			return err
+		}
+		deleted[key]++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("sweep %s: %w", tbl, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+
+	for key, n := range deleted {
+		prunedRows(s.PruneAction).WithLabelValues(key.Namespace, key.Name).Add(float64(n))
+		s.Reconciler.ForgetService(key.Namespace, key.Name)
+		logger.Info("swept rows of a service without endpoints", "namespace", key.Namespace, "service", key.Name, "pruned", n)
+	}
+	logger.V(1).Info("sweep finished", "cluster", cluster, "live", len(keys), "swept", len(deleted))
+	return nil
+}
@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// sweepDB answers the lock query with locked and the sweep with deleted
+// (namespace, service) rows, recording the arguments of both.
+func sweepDB(locked bool, deleted ...[]any) (*fakeDB, *[]execCall) {
+	var queries []execCall
+	db := &fakeDB{queryFn: func(sql string, args []any) ([][]any, error) {
+		queries = append(queries, execCall{sql: sql, args: args})
+		if strings.Contains(sql, "pg_try_advisory_xact_lock") {
+			return [][]any{{locked}}, nil
+		}
+		return deleted, nil
+	}}
+	return db, &queries
+}
+
+func TestSweeper_Sweep(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1")),
+		newSlice("default", "db-a", "db", podEndpoint("uid-2", "db-1", "10.0.0.2")),
+		newSlice("other", "web-a", "web", podEndpoint("uid-3", "web-1", "10.0.1.1")),
+	).Build()
+	db, queries := sweepDB(true, []any{"default", "gone"}, []any{"default", "gone"})
+	s := &Sweeper{
+		DB:         db,
+		TableName:  "public.server",
+		Reconciler: &EndpointSliceReconciler{Client: c, ClusterName: "dev"},
+		Interval:   time.Hour,
+	}
+	before := testutil.ToFloat64(rowsDeleted.WithLabelValues("default", "gone"))
+	if err := s.Sweep(context.Background()); err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+
+	if len(*queries) != 2 {
+		t.Fatalf("queries = %+v, want the lock and the sweep", *queries)
+	}
+	lock, sweep := (*queries)[0], (*queries)[1]
+	if lock.args[0] != sweepLockKey("dev") {
+		t.Errorf("lock key = %v, want %v", lock.args[0], sweepLockKey("dev"))
+	}
+	if !strings.Contains(sweep.sql, `DELETE FROM "public"."server"`) {
+		t.Errorf("sweep = %s, want a delete from the table", sweep.sql)
+	}
+	wantNamespaces, wantNames := []string{"default", "default", "other"}, []string{"db", "web", "web"}
+	if sweep.args[0] != "dev" || !slices.Equal(sweep.args[3].([]string), wantNamespaces) || !slices.Equal(sweep.args[4].([]string), wantNames) {
+		t.Errorf("sweep args = %v, want cluster dev and live services %v %v", sweep.args, wantNamespaces, wantNames)
+	}
+	if sweep.args[5] != time.Hour.Seconds() {
+		t.Errorf("grace = %v, want %v", sweep.args[5], time.Hour.Seconds())
+	}
+	if db.commits != 1 {
+		t.Errorf("commits = %d, want 1", db.commits)
+	}
+	if got := testutil.ToFloat64(rowsDeleted.WithLabelValues("default", "gone")) - before; got != 2 {
+		t.Errorf("observer_rows_deleted_total{default,gone} grew by %v, want 2", got)
+	}
+}
+
+// TestSweeper_ClientClock cuts off with the clock of last_seen when it's
+// the observer's, not the database's.
+func TestSweeper_ClientClock(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	db, queries := sweepDB(true)
+	s := &Sweeper{
+		DB:         db,
+		TableName:  "server",
+		Reconciler: &EndpointSliceReconciler{Client: c, ClusterName: "dev"},
+		Interval:   time.Hour,
+		Now:        func() time.Time { return now },
+	}
+	if err := s.Sweep(context.Background()); err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+	sweep := (*queries)[1]
+	if strings.Contains(sweep.sql, "now()") || !strings.Contains(sweep.sql, "last_seen < $6") {
+		t.Errorf("sweep = %s, want last_seen compared with $6", sweep.sql)
+	}
+	if want := now.Add(-time.Hour); sweep.args[5] != want {
+		t.Errorf("cutoff = %v, want %v", sweep.args[5], want)
+	}
+}
+
+func TestSweeper_SkipsWithoutLock(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()
+	db, queries := sweepDB(false, []any{"default", "gone"})
+	s := &Sweeper{DB: db, TableName: "server", Reconciler: &EndpointSliceReconciler{Client: c, ClusterName: "dev"}, Interval: time.Hour}
+	ctx, logs := captureLogs()
+	if err := s.Sweep(ctx); err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+	if len(*queries) != 1 {
+		t.Errorf("queries = %+v, want only the lock", *queries)
+	}
+	if db.commits != 0 || db.rollbacks != 1 {
+		t.Errorf("commits = %d, rollbacks = %d, want the transaction rolled back", db.commits, db.rollbacks)
+	}
+	if !slices.ContainsFunc(*logs, func(l string) bool { return strings.Contains(l, "skipping sweep") }) {
+		t.Errorf("logs = %v, want the skip logged", *logs)
+	}
+}
+
+func TestSweeper_Scope(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1")),
+		newSlice("other", "web-a", "web", podEndpoint("uid-3", "web-1", "10.0.1.1")),
+		newSlice("other", "db-a", "db", podEndpoint("uid-2", "db-1", "10.0.1.2")),
+	).Build()
+	db, queries := sweepDB(true)
+	s := &Sweeper{
+		DB:         db,
+		TableName:  "server",
+		Reconciler: &EndpointSliceReconciler{Client: c, ClusterName: "dev", ServiceName: "web"},
+		Namespace:  "other",
+		Interval:   time.Hour,
+	}
+	if err := s.Sweep(context.Background()); err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+	// Only the rows of web in other may be swept, and web is live there.
+	sweep := (*queries)[1]
+	if sweep.args[1] != "other" || sweep.args[2] != "web" ||
+		!slices.Equal(sweep.args[3].([]string), []string{"other"}) || !slices.Equal(sweep.args[4].([]string), []string{"web"}) {
+		t.Errorf("sweep args = %v, want namespace other, service web and web live", sweep.args)
+	}
+}
+
+func TestSweeper_LockError(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()
+	db := &fakeDB{queryFn: func(string, []any) ([][]any, error) { return nil, errFake }}
+	s := &Sweeper{DB: db, TableName: "server", Reconciler: &EndpointSliceReconciler{Client: c, ClusterName: "dev"}, Interval: time.Hour}
+	if err := s.Sweep(context.Background()); !errors.Is(err, errFake) {
+		t.Errorf("Sweep() error = %v, want %v", err, errFake)
+	}
+	if db.commits != 0 {
+		t.Errorf("commits = %d, want 0", db.commits)
+	}
+}
+
+func TestSweepLockKey(t *testing.T) {
+	if sweepLockKey("dev") != sweepLockKey("dev") {
+		t.Error("sweepLockKey() is not stable")
+	}
+	if sweepLockKey("dev") == sweepLockKey("prod") {
+		t.Error("sweepLockKey() is the same for dev and prod")
+	}
+}
@@ -0,0 +1,228 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// SyncAll performs one full pass instead of watching: it lists every
+// matching slice (or Endpoints object) in namespace, or in all namespaces
+// if empty, and writes each service through the sink exactly like
+// Reconcile does. It returns the joined errors of all failed services.
+func (r *EndpointSliceReconciler) SyncAll(ctx context.Context, namespace string) error {
+	_, err := r.syncAll(ctx, namespace)
+	return err
+}
+
+// syncAll is SyncAll, also returning the services it found to sync; nil if
+// they couldn't be listed.
+//
+// The pass runs alongside the reconcilers, so each service is listed again
+// and written under its lock, like a reconcile: written from the listing at
+// the start of the pass, it could prune rows a reconcile just wrote.
+func (r *EndpointSliceReconciler) syncAll(ctx context.Context, namespace string) (map[types.NamespacedName]*discoveryv1.EndpointSliceList, error) {
+	logger := log.FromContext(ctx)
+	services, err := r.listServices(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	// services lists every shard's, as the Sweeper needs; only this one's
+	// are written.
+	keys := make([]types.NamespacedName, 0, len(services))
+	for key := range services {
+		if r.Shard.Owns(key.Namespace, key.Name) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+	var errs []error
+	for _, key := range keys {
+		failed, err := r.syncListed(ctx, key)
+		if err != nil {
+			return services, errors.Join(append(errs, err)...)
+		}
+		if failed != nil {
+			errs = append(errs, fmt.Errorf("sync %s: %w", key, failed))
+		}
+	}
+	logger.Info("full sync finished", "services", len(keys), "failed", len(errs))
+	return services, errors.Join(errs...)
+}
+
+// syncListed lists the slices of key and writes its rows, holding its lock
+// from the list to the write, and through the Breaker like a reconcile.
+// failed is the error of this service alone, which the pass reports and
+// goes on; err ends the pass.
+func (r *EndpointSliceReconciler) syncListed(ctx context.Context, key types.NamespacedName) (failed, err error) {
+	defer r.locks.lock(key)()
+	ctx = withSyncVersion(ctx, r.versions.next())
+	list, ok, err := r.listedService(ctx, key)
+	if !ok || err != nil {
+		return nil, err // gone since the pass listed it
+	}
+	if sel := r.selector(); sel != "" && !slices.ContainsFunc(list.Items, func(es discoveryv1.EndpointSlice) bool { return matchKV(es.Labels, sel) }) {
+		return nil, nil // no longer selected, as ResyncService
+	}
+	desired, err := r.buildDesiredRows(ctx, list, key.Name)
+	if errors.Is(err, errTooManyEndpoints) {
+		r.Status.Failed(key.Namespace, key.Name, err)
+		return err, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.applyPods(ctx, key.Namespace, desired)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if wait, ok := r.Breaker.Allow(); !ok {
+		return fmt.Errorf("%w, next probe in %s", errBreakerOpen, wait), nil
+	}
+	err = r.Sink.Sync(ctx, r.cluster(), key.Namespace, key.Name, desired)
+	r.Breaker.Record(err)
+	if err != nil {
+		r.Status.Failed(key.Namespace, key.Name, err)
+		return err, nil
+	}
+	r.Tracker.Record(key.Namespace, key.Name)
+	r.Status.Succeeded(key.Namespace, key.Name, len(desired))
+	log.FromContext(ctx).V(1).Info("synced endpoints",
+		"cluster", r.cluster(), "namespace", key.Namespace, "service", key.Name, "count", len(desired))
+	return nil, nil
+}
+
+// listedService lists the slices of key again, or maps its Endpoints object
+// onto slices; ok is false if the service is gone.
+func (r *EndpointSliceReconciler) listedService(ctx context.Context, key types.NamespacedName) (list *discoveryv1.EndpointSliceList, ok bool, err error) {
+	if r.Source != SourceEndpoints {
+		list, ok, err = r.serviceSlices(ctx, key.Namespace, key.Name)
+		if err != nil {
+			return nil, false, fmt.Errorf("list endpointslices of %s: %w", key, err)
+		}
+		return list, ok, nil
+	}
+	var eps corev1.Endpoints //nolint:staticcheck // see reconcileEndpoints
+	if err := r.Get(ctx, key, &eps); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("get endpoints %s: %w", key, err)
+	}
+	return &discoveryv1.EndpointSliceList{Items: slicesFromEndpoints(&eps, r.serviceLabel())}, true, nil
+}
+
+// SyncAllSelected runs SyncAll, then deletes the rows of every service synced
+// before in namespace (or all namespaces if empty) that it no longer found,
+// e.g. since LabelSelector changed to exclude it. Only services in Tracker
+// are known to have rows; those of earlier runs are left to the Sweeper.
+func (r *EndpointSliceReconciler) SyncAllSelected(ctx context.Context, namespace string) error {
+	logger := log.FromContext(ctx)
+	synced := r.Tracker.services()
+	services, err := r.syncAll(ctx, namespace)
+	if services == nil || ctx.Err() != nil {
+		return err
+	}
+
+	errs := []error{err}
+	for _, key := range synced {
+		if _, ok := services[key]; ok || (namespace != "" && key.Namespace != namespace) {
+			continue
+		}
+		if err := r.deleteService(ctx, key); err != nil {
+			errs = append(errs, fmt.Errorf("delete %s: %w", key, err))
+			continue
+		}
+		logger.Info("deleted rows of a service no longer selected", "namespace", key.Namespace, "service", key.Name)
+	}
+	return errors.Join(errs...)
+}
+
+// deleteService deletes the rows of key and forgets it.
+func (r *EndpointSliceReconciler) deleteService(ctx context.Context, key types.NamespacedName) error {
+	defer r.locks.lock(key)()
+	if wait, ok := r.Breaker.Allow(); !ok {
+		return fmt.Errorf("%w, next probe in %s", errBreakerOpen, wait)
+	}
+	err := r.Sink.Delete(ctx, r.cluster(), key.Namespace, key.Name)
+	r.Breaker.Record(err)
+	if err != nil {
+		r.Status.Failed(key.Namespace, key.Name, err)
+		return err
+	}
+	r.Tracker.Forget(key.Namespace, key.Name)
+	r.Status.Forget(key.Namespace, key.Name)
+	r.ForgetService(key.Namespace, key.Name)
+	return nil
+}
+
+// listServices groups all matching slices by the service they belong to.
+// The services of every Shard are listed.
+func (r *EndpointSliceReconciler) listServices(ctx context.Context, namespace string) (map[types.NamespacedName]*discoveryv1.EndpointSliceList, error) {
+	var opts []client.ListOption
+	if namespace != "" {
+		opts = append(opts, client.InNamespace(namespace))
+	}
+
+	var slices []discoveryv1.EndpointSlice
+	if r.Source == SourceEndpoints {
+		var list corev1.EndpointsList //nolint:staticcheck // see reconcileEndpoints
+		if err := r.list(ctx, &list, opts...); err != nil {
+			return nil, fmt.Errorf("list endpoints: %w", err)
+		}
+		for i := range list.Items {
+			slices = append(slices, slicesFromEndpoints(&list.Items[i], r.serviceLabel())...)
+		}
+	} else {
+		var list discoveryv1.EndpointSliceList
+		selector := client.ListOption(client.HasLabels{r.serviceLabel()})
+		if r.ServiceName != "" {
+			selector = client.MatchingLabels{r.serviceLabel(): r.ServiceName}
+		}
+		if !r.UseOwnerRef {
+			opts = append(opts, selector)
+		}
+		if err := r.listSlices(ctx, &list, opts...); err != nil {
+			return nil, fmt.Errorf("list endpointslices: %w", err)
+		}
+		slices = list.Items
+	}
+
+	services, sel := map[types.NamespacedName]*discoveryv1.EndpointSliceList{}, r.selector()
+	for _, sl := range slices {
+		service := r.sliceService(&sl)
+		if service == "" || (sel != "" && !matchKV(sl.Labels, sel)) {
+			continue
+		}
+		if (r.ServiceName != "" && service != r.ServiceName) || !r.inScope(sl.Namespace, service) {
+			continue
+		}
+		key := types.NamespacedName{Namespace: sl.Namespace, Name: service}
+		if services[key] == nil {
+			services[key] = &discoveryv1.EndpointSliceList{}
+		}
+		services[key].Items = append(services[key].Items, sl)
+	}
+	if r.UseOwnerRef {
+		for key, list := range services {
+			uid, ok, err := r.serviceUID(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+			if list.Items = ownedBy(list.Items, uid); !ok || len(list.Items) == 0 {
+				delete(services, key)
+			}
+		}
+	}
+	return services, nil
+}
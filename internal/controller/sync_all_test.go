@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestEndpointSliceReconciler_SyncAll(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1")),
+		newSlice("default", "web-b", "web", podEndpoint("uid-2", "web-2", "10.0.0.2")),
+		newSlice("default", "db-a", "db", podEndpoint("uid-3", "db-1", "10.0.0.3")),
+		newSlice("other", "web-a", "web", podEndpoint("uid-4", "web-1", "10.0.1.1")),
+	).Build()
+
+	tests := []struct {
+		name      string
+		namespace string
+		service   string
+		want      []string // service per upsert, in order
+		services  int
+	}{
+		{name: "all namespaces", want: []string{"db", "web", "web", "web"}, services: 3},
+		{name: "single namespace", namespace: "other", want: []string{"web"}, services: 1},
+		{name: "single service", service: "web", want: []string{"web", "web", "web"}, services: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeDB{}
+			r := &EndpointSliceReconciler{Client: c, Sink: &PostgresSink{DB: db, TableName: "server"}, ClusterName: "dev", ServiceName: tt.service}
+			if err := r.SyncAll(context.Background(), tt.namespace); err != nil {
+				t.Fatalf("SyncAll() error = %v", err)
+			}
+
+			var got []string
+			for _, e := range db.statements("INSERT INTO") {
+				got = append(got, e.args[2].(string))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("upserted services = %v, want %v", got, tt.want)
+			}
+			// One transaction (and one prune) per service.
+			if prunes := db.statements("DELETE FROM"); len(prunes) != tt.services || db.commits != tt.services {
+				t.Errorf("prunes = %d, commits = %d, want %d each", len(prunes), db.commits, tt.services)
+			}
+		})
+	}
+}
+
+func TestEndpointSliceReconciler_SyncAllReportsFailures(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1")),
+		newSlice("default", "db-a", "db", podEndpoint("uid-3", "db-1", "10.0.0.3")),
+	).Build()
+	db := &fakeDB{execFn: func(sql string, args []any) (pgconn.CommandTag, error) {
+		if strings.Contains(sql, "INSERT") && args[2] == "db" {
+			return pgconn.CommandTag{}, errFake
+		}
+		return pgconn.NewCommandTag("OK 1"), nil
+	}}
+	r := &EndpointSliceReconciler{Client: c, Sink: &PostgresSink{DB: db, TableName: "server"}, ClusterName: "dev"}
+
+	err := r.SyncAll(context.Background(), "")
+	if !errors.Is(err, errFake) || !strings.Contains(err.Error(), "default/db") {
+		t.Errorf("SyncAll() error = %v, want the failure of default/db", err)
+	}
+	// The failing service doesn't stop the others.
+	if db.commits != 1 {
+		t.Errorf("commits = %d, want 1 (web)", db.commits)
+	}
+}
+
+func TestEndpointSliceReconciler_SyncAllReportsServicesOverLimit(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1"), podEndpoint("uid-2", "web-2", "10.0.0.2")),
+		newSlice("default", "db-a", "db", podEndpoint("uid-3", "db-1", "10.0.0.3")),
+	).Build()
+	db := &fakeDB{}
+	r := &EndpointSliceReconciler{Client: c, Sink: &PostgresSink{DB: db, TableName: "server"}, ClusterName: "dev", MaxEndpointsPerService: 1}
+
+	err := r.SyncAll(context.Background(), "")
+	if !errors.Is(err, errTooManyEndpoints) || !strings.Contains(err.Error(), "default/web") {
+		t.Errorf("SyncAll() error = %v, want the limit error of default/web", err)
+	}
+	if db.commits != 1 {
+		t.Errorf("commits = %d, want 1 (db)", db.commits)
+	}
+}
+
+// TestEndpointSliceReconciler_SyncAllTakesServiceLock checks the pass waits
+// for the lock of a service being reconciled and then writes the set that
+// reconcile saw, not the one of its own earlier listing.
+func TestEndpointSliceReconciler_SyncAllTakesServiceLock(t *testing.T) {
+	slice := newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1"))
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(slice).Build()
+	db := &fakeDB{}
+	r := &EndpointSliceReconciler{Client: c, Sink: &PostgresSink{DB: db, TableName: "server"}, ClusterName: "dev"}
+	ctx := context.Background()
+
+	unlock := r.locks.lock(types.NamespacedName{Namespace: "default", Name: "web"})
+	done := make(chan error, 1)
+	go func() { done <- r.SyncAll(ctx, "") }()
+	time.Sleep(50 * time.Millisecond)
+	if ups := db.statements("INSERT INTO"); len(ups) != 0 {
+		t.Fatalf("upserts = %+v while the service is locked, want none", ups)
+	}
+
+	// The reconcile holding the lock sees the endpoint replaced.
+	slice.Endpoints = []discoveryv1.Endpoint{podEndpoint("uid-2", "web-2", "10.0.0.2")}
+	if err := c.Update(ctx, slice); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatalf("SyncAll() error = %v", err)
+	}
+	ups := db.statements("INSERT INTO")
+	if len(ups) != 1 || !slices.Contains(ups[0].args, any("uid-2")) {
+		t.Errorf("upserts = %+v, want uid-2 of the latest list", ups)
+	}
+}
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A sync version orders the writes of a service by when their endpoints were
+// read, so PostgresSink.SyncVersion can refuse a write that finishes after
+// a newer one, e.g. of two replicas syncing one service at once.
+type syncVersionKey struct{}
+
+// withSyncVersion attaches the version of the endpoints about to be read.
+func withSyncVersion(ctx context.Context, v int64) context.Context {
+	return context.WithValue(ctx, syncVersionKey{}, v)
+}
+
+// syncVersionFrom returns the version attached to ctx, or 0 if none is.
+func syncVersionFrom(ctx context.Context) int64 {
+	v, _ := ctx.Value(syncVersionKey{}).(int64)
+	return v
+}
+
+// syncClock hands out strictly increasing versions: Unix nanoseconds, bumped
+// past the last version handed out, so they also keep growing across
+// restarts as long as the clock doesn't go back. The zero value is ready.
+type syncClock struct {
+	mu   sync.Mutex
+	last int64
+	now  func() time.Time // time.Now if nil
+}
+
+func (c *syncClock) next() int64 {
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last = max(now().UnixNano(), c.last+1)
+	return c.last
+}
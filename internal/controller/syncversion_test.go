@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSyncClock(t *testing.T) {
+	now := time.Unix(100, 0)
+	c := &syncClock{now: func() time.Time { return now }}
+	first := c.next()
+	if first != now.UnixNano() {
+		t.Errorf("next() = %d, want %d", first, now.UnixNano())
+	}
+	// A clock that stands still or goes back still yields larger versions.
+	if got := c.next(); got != first+1 {
+		t.Errorf("next() = %d, want %d", got, first+1)
+	}
+	now = now.Add(-time.Second)
+	if got := c.next(); got != first+2 {
+		t.Errorf("next() after the clock went back = %d, want %d", got, first+2)
+	}
+	now = now.Add(time.Hour)
+	if got := c.next(); got != now.UnixNano() {
+		t.Errorf("next() = %d, want %d", got, now.UnixNano())
+	}
+}
+
+// versionedDB stores the sync_version of the latest upsert and answers
+// max(sync_version) with it, like a table would.
+func versionedDB() *fakeDB {
+	db := &fakeDB{}
+	db.queryFn = func(sql string, _ []any) ([][]any, error) {
+		var stored int64
+		if strings.Contains(sql, "max(sync_version)") {
+			for _, up := range db.statements("INSERT INTO") {
+				stored = max(stored, up.args[len(up.args)-1].(int64))
+			}
+		}
+		return [][]any{{stored}}, nil
+	}
+	return db
+}
+
+func TestPostgresSink_SyncVersion(t *testing.T) {
+	db := versionedDB()
+	sink := &PostgresSink{DB: db, TableName: "server", SyncVersion: true}
+	newer := map[string]endpointRow{"uid-2": {UID: "uid-2", IP: "10.0.0.2"}}
+	older := map[string]endpointRow{"uid-1": {UID: "uid-1", IP: "10.0.0.1"}}
+	skipped := staleWritesSkipped.WithLabelValues("default", "versioned")
+	before := testutil.ToFloat64(skipped)
+
+	if err := sink.Sync(withSyncVersion(context.Background(), 2), "dev", "default", "versioned", newer); err != nil {
+		t.Fatalf("Sync(v2) error = %v", err)
+	}
+	ups := db.statements("INSERT INTO")
+	if len(ups) != 1 || !strings.Contains(ups[0].sql, "sync_version = EXCLUDED.sync_version") || ups[0].args[6] != int64(2) {
+		t.Fatalf("upserts = %+v, want uid-2 written with sync_version 2", ups)
+	}
+	if locks := db.statements("pg_advisory_xact_lock"); len(locks) != 1 || locks[0].args[0] != serviceLockKey(serviceKey{"dev", "default", "versioned"}) {
+		t.Errorf("locks = %+v, want the service locked", locks)
+	}
+
+	// A write whose endpoints were read before the stored ones is skipped.
+	if err := sink.Sync(withSyncVersion(context.Background(), 1), "dev", "default", "versioned", older); err != nil {
+		t.Fatalf("Sync(v1) error = %v", err)
+	}
+	if ups := db.statements("INSERT INTO"); len(ups) != 1 {
+		t.Errorf("upserts = %d, want the older write skipped", len(ups))
+	}
+	if prunes := db.statements("pod_uid <> ALL"); len(prunes) != 1 {
+		t.Errorf("prunes = %d, want the older write not to prune", len(prunes))
+	}
+	if got := testutil.ToFloat64(skipped) - before; got != 1 {
+		t.Errorf("observer_stale_writes_skipped_total grew by %v, want 1", got)
+	}
+
+	// Without a version in ctx nothing is checked.
+	if err := sink.Sync(context.Background(), "dev", "default", "versioned", older); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if ups := db.statements("INSERT INTO"); len(ups) != 2 || strings.Contains(ups[1].sql, "sync_version") {
+		t.Errorf("upserts = %+v, want an unversioned write", ups)
+	}
+}
+
+func TestPostgresSink_SyncVersionBatchKeepsNewer(t *testing.T) {
+	db := versionedDB()
+	sink := &PostgresSink{DB: db, TableName: "server", SyncVersion: true, FlushInterval: 200 * time.Millisecond}
+	var wg sync.WaitGroup
+	for _, v := range []int64{2, 1} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rows := map[string]endpointRow{"uid": {UID: "uid", IP: "10.0.0.1"}}
+			if err := sink.Sync(withSyncVersion(context.Background(), v), "dev", "default", "svc", rows); err != nil {
+				t.Errorf("Sync(v%d) error = %v", v, err)
+			}
+		}()
+		queued(t, sink, func(b *writeBatch) bool { return len(b.ops) == 1 })
+	}
+	wg.Wait()
+	if ups := db.statements("INSERT INTO"); len(ups) != 1 || ups[0].args[6] != int64(2) || db.commits != 1 {
+		t.Errorf("upserts = %+v in %d transactions, want only the newer write in one", ups, db.commits)
+	}
+}
+
+// Two replicas reconcile different slices of one service: the first reads
+// the slices, then stalls before writing until the second has written a
+// newer set. Its write must not clobber the newer one. (Within a replica
+// the service's lock keeps the second from starting at all.)
+func TestEndpointSliceReconciler_OutOfOrderWrites(t *testing.T) {
+	webA := newSlice("default", "web-a", "web", podEndpoint("uid-1", "web-1", "10.0.0.1"))
+	webB := newSlice("default", "web-b", "web")
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(webA, webB).Build()
+
+	db := versionedDB()
+	stalled, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	db.beginFn = func(context.Context) error {
+		first := false
+		once.Do(func() { first = true })
+		if first {
+			close(stalled)
+			<-release
+		}
+		return nil
+	}
+	r := &EndpointSliceReconciler{Client: c, Sink: &PostgresSink{DB: db, TableName: "server", SyncVersion: true}, ClusterName: "dev"}
+	other := &EndpointSliceReconciler{Client: c, Sink: r.Sink, ClusterName: "dev"}
+
+	done := make(chan error)
+	go func() {
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web-a"}})
+		done <- err
+	}()
+	<-stalled
+
+	// uid-1 moves to web-b as uid-2 while the first reconcile is stalled.
+	webA.Endpoints = nil
+	webB.Endpoints = append(webB.Endpoints, podEndpoint("uid-2", "web-2", "10.0.0.2"))
+	for _, sl := range []client.Object{webA, webB} {
+		if err := c.Update(context.Background(), sl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := other.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web-b"}}); err != nil {
+		t.Fatalf("second Reconcile() error = %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("first Reconcile() error = %v", err)
+	}
+
+	ups := db.statements("INSERT INTO")
+	if len(ups) != 1 || ups[0].args[3] != "uid-2" {
+		t.Errorf("upserts = %+v, want only the newer uid-2", ups)
+	}
+}
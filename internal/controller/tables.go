@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// errInvalidTable marks a per-service table name that can't be used.
+// Retrying won't fix it, so classifyDBError treats it as permanent.
+var errInvalidTable = errors.New("invalid table name")
+
+// TableResolver picks the destination table of a service. An empty name
+// means PostgresSink.TableName.
+type TableResolver interface {
+	Table(ctx context.Context, namespace, service string) (string, error)
+}
+
+// AnnotationTables routes a service to the table named by its Annotation
+// (--table-annotation). The last table seen per service is remembered so
+// the rows of a deleted Service are pruned from where they were written.
+type AnnotationTables struct {
+	Reader     client.Reader
+	Annotation string
+
+	mu   sync.Mutex
+	last map[types.NamespacedName]string
+}
+
+func (a *AnnotationTables) Table(ctx context.Context, namespace, service string) (string, error) {
+	key := types.NamespacedName{Namespace: namespace, Name: service}
+	var svc corev1.Service
+	if err := a.Reader.Get(ctx, key, &svc); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return "", fmt.Errorf("get service %s: %w", key, err)
+		}
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		return a.last[key], nil
+	}
+
+	table := svc.Annotations[a.Annotation]
+	if table != "" {
+		// The cause is formatted, not wrapped, so classifyDBError sees a
+		// single permanent error rather than a joined one.
+		if err := ValidateTableName(table); err != nil {
+			return "", fmt.Errorf("%w from annotation %s of service %s: %v", errInvalidTable, a.Annotation, key, err)
+		}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.last == nil {
+		a.last = map[types.NamespacedName]string{}
+	}
+	if table == "" {
+		delete(a.last, key)
+	} else {
+		a.last[key] = table
+	}
+	return table, nil
+}
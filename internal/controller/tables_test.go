@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const tableAnnotation = "observer.io/table"
+
+func annotatedService(name, table string) *corev1.Service {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+	if table != "" {
+		svc.Annotations = map[string]string{tableAnnotation: table}
+	}
+	return svc
+}
+
+func TestAnnotationTables(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		annotatedService("billing", "team_billing.endpoints"),
+		annotatedService("plain", ""),
+		annotatedService("bad", "a..b"),
+	).Build()
+	tables := &AnnotationTables{Reader: c, Annotation: tableAnnotation}
+
+	tests := []struct {
+		name    string
+		service string
+		want    string
+		wantErr error
+	}{
+		{name: "annotated", service: "billing", want: "team_billing.endpoints"},
+		{name: "not annotated falls back", service: "plain", want: ""},
+		{name: "unknown service falls back", service: "missing", want: ""},
+		{name: "invalid annotation is rejected", service: "bad", wantErr: errInvalidTable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tables.Table(context.Background(), "default", tt.service)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Table() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Table() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnnotationTables_RemembersDeletedService(t *testing.T) {
+	svc := annotatedService("billing", "team_billing.endpoints")
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(svc).Build()
+	tables := &AnnotationTables{Reader: c, Annotation: tableAnnotation}
+	ctx := context.Background()
+
+	if _, err := tables.Table(ctx, "default", "billing"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := tables.Table(ctx, "default", "billing"); err != nil || got != "team_billing.endpoints" {
+		t.Errorf("Table() after delete = %q, %v; want the last annotated table", got, err)
+	}
+}
+
+func TestPostgresSink_Tables(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(
+		annotatedService("billing", "team_billing.endpoints"),
+		annotatedService("plain", ""),
+		annotatedService("bad", "a..b"),
+	).Build()
+	ctx := context.Background()
+
+	tests := []struct {
+		service   string
+		wantTable string
+	}{
+		{service: "billing", wantTable: `"team_billing"."endpoints"`},
+		{service: "plain", wantTable: `"public"."server"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.service, func(t *testing.T) {
+			db := &fakeDB{}
+			sink := &PostgresSink{DB: db, TableName: "public.server", Tables: &AnnotationTables{Reader: c, Annotation: tableAnnotation}}
+			rows := map[string]endpointRow{"uid-1": {UID: "uid-1", IP: "10.0.0.1"}}
+			if err := sink.Sync(ctx, "dev", "default", tt.service, rows); err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			if err := sink.Delete(ctx, "dev", "default", tt.service); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			for _, stmt := range []string{"INSERT INTO " + tt.wantTable, "DELETE FROM " + tt.wantTable} {
+				if len(db.statements(stmt)) == 0 {
+					t.Errorf("no statement contains %q", stmt)
+				}
+			}
+		})
+	}
+
+	db := &fakeDB{}
+	sink := &PostgresSink{DB: db, TableName: "public.server", Tables: &AnnotationTables{Reader: c, Annotation: tableAnnotation}}
+	err := sink.Sync(ctx, "dev", "default", "bad", nil)
+	if !errors.Is(err, errInvalidTable) || classifyDBError(err) != dbErrorPermanent {
+		t.Errorf("Sync() with invalid annotation error = %v, want a permanent errInvalidTable", err)
+	}
+	if len(db.execs) != 0 {
+		t.Errorf("invalid annotation still wrote: %+v", db.execs)
+	}
+}
+
+// TestPostgresSink_TablesMove deletes a service's rows from its previous
+// table in the write that moves it to another.
+func TestPostgresSink_TablesMove(t *testing.T) {
+	svc := annotatedService("billing", "team_billing.endpoints")
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(svc).Build()
+	ctx := context.Background()
+	db := &fakeDB{}
+	sink := &PostgresSink{DB: db, TableName: "public.server", Tables: &AnnotationTables{Reader: c, Annotation: tableAnnotation}}
+	rows := map[string]endpointRow{"uid-1": {UID: "uid-1", IP: "10.0.0.1"}}
+	if err := sink.Sync(ctx, "dev", "default", "billing", rows); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	// The move's delete, unlike the prune, spares no pod_uid.
+	moveDeletes := func(tbl string) []execCall {
+		var out []execCall
+		for _, e := range db.statements("DELETE FROM " + tbl) {
+			if !strings.Contains(e.sql, "pod_uid") {
+				out = append(out, e)
+			}
+		}
+		return out
+	}
+	if got := moveDeletes(`"team_billing"."endpoints"`); len(got) != 0 {
+		t.Fatalf("first write deleted the service from its table: %+v", got)
+	}
+
+	for _, move := range []struct{ annotation, from, to string }{
+		{annotation: "team_billing.endpoints_v2", from: `"team_billing"."endpoints"`, to: `"team_billing"."endpoints_v2"`},
+		{from: `"team_billing"."endpoints_v2"`, to: `"public"."server"`}, // annotation removed
+	} {
+		svc.Annotations = map[string]string{tableAnnotation: move.annotation}
+		if err := c.Update(ctx, svc); err != nil {
+			t.Fatal(err)
+		}
+		db.execs = nil
+		if err := sink.Sync(ctx, "dev", "default", "billing", rows); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+		del := moveDeletes(move.from)
+		if len(del) != 1 || !del[0].inTx || len(db.statements("INSERT INTO "+move.to)) != 1 {
+			t.Errorf("move to %s: statements %+v, want the rows deleted from %s in the write", move.to, db.execs, move.from)
+		}
+
+		db.execs = nil
+		if err := sink.Sync(ctx, "dev", "default", "billing", rows); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+		if got := moveDeletes(move.from); len(got) != 0 {
+			t.Errorf("next write after the move deleted from %s again: %+v", move.from, got)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Package testutil builds Kubernetes objects for tests and benchmarks.
+package testutil
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// EndpointsPerSlice is how many endpoints GenerateSlices puts in a slice,
+// the EndpointSlice controller's default --max-endpoints-per-slice.
+const EndpointsPerSlice = 100
+
+// GenerateSlices returns the IPv4 slices of a service with n ready
+// endpoints, EndpointsPerSlice to a slice, as the EndpointSlice controller
+// would write them: labeled with the service, one "http" port, and each
+// endpoint backed by a Pod on one of ten nodes. Names, UIDs and addresses
+// are derived from the endpoint's index, so they are unique up to 2^24
+// endpoints and the same on every call.
+func GenerateSlices(namespace, service string, n int) *discoveryv1.EndpointSliceList {
+	list := &discoveryv1.EndpointSliceList{}
+	port, proto, portName := int32(8080), corev1.ProtocolTCP, "http"
+	ready := true
+	for first := 0; first < n; first += EndpointsPerSlice {
+		sl := discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      fmt.Sprintf("%s-%05d", service, first/EndpointsPerSlice),
+				Labels: map[string]string{
+					discoveryv1.LabelServiceName: service,
+					discoveryv1.LabelManagedBy:   "endpointslice-controller.k8s.io",
+				},
+			},
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Ports:       []discoveryv1.EndpointPort{{Name: &portName, Port: &port, Protocol: &proto}},
+		}
+		for i := first; i < min(first+EndpointsPerSlice, n); i++ {
+			name := fmt.Sprintf("%s-%d", service, i)
+			node := fmt.Sprintf("node-%d", i%10)
+			sl.Endpoints = append(sl.Endpoints, discoveryv1.Endpoint{
+				Addresses:  []string{fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff)},
+				Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+				NodeName:   &node,
+				TargetRef: &corev1.ObjectReference{
+					Kind: "Pod", Namespace: namespace, Name: name,
+					UID: types.UID(fmt.Sprintf("00000000-0000-4000-8000-%012d", i)),
+				},
+			})
+		}
+		list.Items = append(list.Items, sl)
+	}
+	return list
+}
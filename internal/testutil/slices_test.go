@@ -0,0 +1,49 @@
+package testutil
+
+import (
+	"testing"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+func TestGenerateSlices(t *testing.T) {
+	tests := []struct {
+		n          int
+		wantSlices int
+		wantLast   int
+	}{
+		{n: 0, wantSlices: 0},
+		{n: 1, wantSlices: 1, wantLast: 1},
+		{n: 100, wantSlices: 1, wantLast: 100},
+		{n: 10001, wantSlices: 101, wantLast: 1},
+	}
+	for _, tt := range tests {
+		list := GenerateSlices("default", "web", tt.n)
+		if len(list.Items) != tt.wantSlices {
+			t.Fatalf("n=%d: %d slices, want %d", tt.n, len(list.Items), tt.wantSlices)
+		}
+		if tt.wantSlices > 0 {
+			if got := len(list.Items[len(list.Items)-1].Endpoints); got != tt.wantLast {
+				t.Errorf("n=%d: last slice has %d endpoints, want %d", tt.n, got, tt.wantLast)
+			}
+		}
+
+		names, uids, ips := map[string]bool{}, map[string]bool{}, map[string]bool{}
+		for _, sl := range list.Items {
+			if sl.Namespace != "default" || sl.Labels[discoveryv1.LabelServiceName] != "web" {
+				t.Fatalf("slice %s/%s has labels %v, want those of default/web", sl.Namespace, sl.Name, sl.Labels)
+			}
+			names[sl.Name] = true
+			for _, ep := range sl.Endpoints {
+				if ep.Conditions.Ready == nil || !*ep.Conditions.Ready {
+					t.Fatalf("endpoint %v not ready", ep.Addresses)
+				}
+				uids[string(ep.TargetRef.UID)] = true
+				ips[ep.Addresses[0]] = true
+			}
+		}
+		if len(names) != tt.wantSlices || len(uids) != tt.n || len(ips) != tt.n {
+			t.Errorf("n=%d: %d slice names, %d UIDs and %d IPs, want all distinct", tt.n, len(names), len(uids), len(ips))
+		}
+	}
+}
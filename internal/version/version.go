@@ -1,3 +1,10 @@
 package version
 
+import "runtime"
+
 var Version = "dev-0.0.1"
+
+// GoVersion is the Go release the binary was built with.
+func GoVersion() string {
+	return runtime.Version()
+}
@@ -0,0 +1,385 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: internal/watchapi/watch.proto
+
+package watchapi
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type EndpointEvent_Type int32
+
+const (
+	EndpointEvent_TYPE_UNSPECIFIED EndpointEvent_Type = 0
+	// ADDED is an endpoint new to the subscriber, also sent for each one
+	// of the initial snapshot.
+	EndpointEvent_ADDED EndpointEvent_Type = 1
+	// UPDATED is an endpoint whose row changed, e.g. its IP.
+	EndpointEvent_UPDATED EndpointEvent_Type = 2
+	// REMOVED is an endpoint that went away, also sent for every endpoint
+	// of a deleted Service.
+	EndpointEvent_REMOVED EndpointEvent_Type = 3
+	// SYNCED ends the initial snapshot; it carries no endpoint.
+	EndpointEvent_SYNCED EndpointEvent_Type = 4
+)
+
+// Enum value maps for EndpointEvent_Type.
+var (
+	EndpointEvent_Type_name = map[int32]string{
+		0: "TYPE_UNSPECIFIED",
+		1: "ADDED",
+		2: "UPDATED",
+		3: "REMOVED",
+		4: "SYNCED",
+	}
+	EndpointEvent_Type_value = map[string]int32{
+		"TYPE_UNSPECIFIED": 0,
+		"ADDED":            1,
+		"UPDATED":          2,
+		"REMOVED":          3,
+		"SYNCED":           4,
+	}
+)
+
+func (x EndpointEvent_Type) Enum() *EndpointEvent_Type {
+	p := new(EndpointEvent_Type)
+	*p = x
+	return p
+}
+
+func (x EndpointEvent_Type) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (EndpointEvent_Type) Descriptor() protoreflect.EnumDescriptor {
+	return file_internal_watchapi_watch_proto_enumTypes[0].Descriptor()
+}
+
+func (EndpointEvent_Type) Type() protoreflect.EnumType {
+	return &file_internal_watchapi_watch_proto_enumTypes[0]
+}
+
+func (x EndpointEvent_Type) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use EndpointEvent_Type.Descriptor instead.
+func (EndpointEvent_Type) EnumDescriptor() ([]byte, []int) {
+	return file_internal_watchapi_watch_proto_rawDescGZIP(), []int{2, 0}
+}
+
+type WatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Namespace     string                 `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Service       string                 `protobuf:"bytes,2,opt,name=service,proto3" json:"service,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchRequest) Reset() {
+	*x = WatchRequest{}
+	mi := &file_internal_watchapi_watch_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchRequest) ProtoMessage() {}
+
+func (x *WatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_watchapi_watch_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchRequest.ProtoReflect.Descriptor instead.
+func (*WatchRequest) Descriptor() ([]byte, []int) {
+	return file_internal_watchapi_watch_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *WatchRequest) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *WatchRequest) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+// Endpoint is one row of the service, as written to the table.
+type Endpoint struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Uid   string                 `protobuf:"bytes,1,opt,name=uid,proto3" json:"uid,omitempty"`
+	Name  string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Ip    string                 `protobuf:"bytes,3,opt,name=ip,proto3" json:"ip,omitempty"`
+	// port is set with --port-filter.
+	Port          int32  `protobuf:"varint,4,opt,name=port,proto3" json:"port,omitempty"`
+	AddressType   string `protobuf:"bytes,5,opt,name=address_type,json=addressType,proto3" json:"address_type,omitempty"`
+	NodeName      string `protobuf:"bytes,6,opt,name=node_name,json=nodeName,proto3" json:"node_name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Endpoint) Reset() {
+	*x = Endpoint{}
+	mi := &file_internal_watchapi_watch_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Endpoint) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Endpoint) ProtoMessage() {}
+
+func (x *Endpoint) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_watchapi_watch_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Endpoint.ProtoReflect.Descriptor instead.
+func (*Endpoint) Descriptor() ([]byte, []int) {
+	return file_internal_watchapi_watch_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Endpoint) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+func (x *Endpoint) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Endpoint) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *Endpoint) GetPort() int32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *Endpoint) GetAddressType() string {
+	if x != nil {
+		return x.AddressType
+	}
+	return ""
+}
+
+func (x *Endpoint) GetNodeName() string {
+	if x != nil {
+		return x.NodeName
+	}
+	return ""
+}
+
+type EndpointEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          EndpointEvent_Type     `protobuf:"varint,1,opt,name=type,proto3,enum=observer.watch.v1.EndpointEvent_Type" json:"type,omitempty"`
+	Cluster       string                 `protobuf:"bytes,2,opt,name=cluster,proto3" json:"cluster,omitempty"`
+	Namespace     string                 `protobuf:"bytes,3,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Service       string                 `protobuf:"bytes,4,opt,name=service,proto3" json:"service,omitempty"`
+	Endpoint      *Endpoint              `protobuf:"bytes,5,opt,name=endpoint,proto3" json:"endpoint,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EndpointEvent) Reset() {
+	*x = EndpointEvent{}
+	mi := &file_internal_watchapi_watch_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EndpointEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EndpointEvent) ProtoMessage() {}
+
+func (x *EndpointEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_watchapi_watch_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EndpointEvent.ProtoReflect.Descriptor instead.
+func (*EndpointEvent) Descriptor() ([]byte, []int) {
+	return file_internal_watchapi_watch_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *EndpointEvent) GetType() EndpointEvent_Type {
+	if x != nil {
+		return x.Type
+	}
+	return EndpointEvent_TYPE_UNSPECIFIED
+}
+
+func (x *EndpointEvent) GetCluster() string {
+	if x != nil {
+		return x.Cluster
+	}
+	return ""
+}
+
+func (x *EndpointEvent) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *EndpointEvent) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+func (x *EndpointEvent) GetEndpoint() *Endpoint {
+	if x != nil {
+		return x.Endpoint
+	}
+	return nil
+}
+
+var File_internal_watchapi_watch_proto protoreflect.FileDescriptor
+
+const file_internal_watchapi_watch_proto_rawDesc = "" +
+	"\n" +
+	"\x1dinternal/watchapi/watch.proto\x12\x11observer.watch.v1\"F\n" +
+	"\fWatchRequest\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x18\n" +
+	"\aservice\x18\x02 \x01(\tR\aservice\"\x94\x01\n" +
+	"\bEndpoint\x12\x10\n" +
+	"\x03uid\x18\x01 \x01(\tR\x03uid\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x0e\n" +
+	"\x02ip\x18\x03 \x01(\tR\x02ip\x12\x12\n" +
+	"\x04port\x18\x04 \x01(\x05R\x04port\x12!\n" +
+	"\faddress_type\x18\x05 \x01(\tR\vaddressType\x12\x1b\n" +
+	"\tnode_name\x18\x06 \x01(\tR\bnodeName\"\xa4\x02\n" +
+	"\rEndpointEvent\x129\n" +
+	"\x04type\x18\x01 \x01(\x0e2%.observer.watch.v1.EndpointEvent.TypeR\x04type\x12\x18\n" +
+	"\acluster\x18\x02 \x01(\tR\acluster\x12\x1c\n" +
+	"\tnamespace\x18\x03 \x01(\tR\tnamespace\x12\x18\n" +
+	"\aservice\x18\x04 \x01(\tR\aservice\x127\n" +
+	"\bendpoint\x18\x05 \x01(\v2\x1b.observer.watch.v1.EndpointR\bendpoint\"M\n" +
+	"\x04Type\x12\x14\n" +
+	"\x10TYPE_UNSPECIFIED\x10\x00\x12\t\n" +
+	"\x05ADDED\x10\x01\x12\v\n" +
+	"\aUPDATED\x10\x02\x12\v\n" +
+	"\aREMOVED\x10\x03\x12\n" +
+	"\n" +
+	"\x06SYNCED\x10\x042_\n" +
+	"\x0fEndpointWatcher\x12L\n" +
+	"\x05Watch\x12\x1f.observer.watch.v1.WatchRequest\x1a .observer.watch.v1.EndpointEvent0\x01B/Z-github.com/ealebed/observer/internal/watchapib\x06proto3"
+
+var (
+	file_internal_watchapi_watch_proto_rawDescOnce sync.Once
+	file_internal_watchapi_watch_proto_rawDescData []byte
+)
+
+func file_internal_watchapi_watch_proto_rawDescGZIP() []byte {
+	file_internal_watchapi_watch_proto_rawDescOnce.Do(func() {
+		file_internal_watchapi_watch_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_internal_watchapi_watch_proto_rawDesc), len(file_internal_watchapi_watch_proto_rawDesc)))
+	})
+	return file_internal_watchapi_watch_proto_rawDescData
+}
+
+var file_internal_watchapi_watch_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_internal_watchapi_watch_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_internal_watchapi_watch_proto_goTypes = []any{
+	(EndpointEvent_Type)(0), // 0: observer.watch.v1.EndpointEvent.Type
+	(*WatchRequest)(nil),    // 1: observer.watch.v1.WatchRequest
+	(*Endpoint)(nil),        // 2: observer.watch.v1.Endpoint
+	(*EndpointEvent)(nil),   // 3: observer.watch.v1.EndpointEvent
+}
+var file_internal_watchapi_watch_proto_depIdxs = []int32{
+	0, // 0: observer.watch.v1.EndpointEvent.type:type_name -> observer.watch.v1.EndpointEvent.Type
+	2, // 1: observer.watch.v1.EndpointEvent.endpoint:type_name -> observer.watch.v1.Endpoint
+	1, // 2: observer.watch.v1.EndpointWatcher.Watch:input_type -> observer.watch.v1.WatchRequest
+	3, // 3: observer.watch.v1.EndpointWatcher.Watch:output_type -> observer.watch.v1.EndpointEvent
+	3, // [3:4] is the sub-list for method output_type
+	2, // [2:3] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_internal_watchapi_watch_proto_init() }
+func file_internal_watchapi_watch_proto_init() {
+	if File_internal_watchapi_watch_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_internal_watchapi_watch_proto_rawDesc), len(file_internal_watchapi_watch_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_internal_watchapi_watch_proto_goTypes,
+		DependencyIndexes: file_internal_watchapi_watch_proto_depIdxs,
+		EnumInfos:         file_internal_watchapi_watch_proto_enumTypes,
+		MessageInfos:      file_internal_watchapi_watch_proto_msgTypes,
+	}.Build()
+	File_internal_watchapi_watch_proto = out.File
+	file_internal_watchapi_watch_proto_goTypes = nil
+	file_internal_watchapi_watch_proto_depIdxs = nil
+}
@@ -0,0 +1,140 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: internal/watchapi/watch.proto
+
+package watchapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	EndpointWatcher_Watch_FullMethodName = "/observer.watch.v1.EndpointWatcher/Watch"
+)
+
+// EndpointWatcherClient is the client API for EndpointWatcher service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// EndpointWatcher streams the endpoints the observer writes, for consumers
+// that would rather subscribe than poll the table. It's served on
+// --grpc-bind-address.
+type EndpointWatcherClient interface {
+	// Watch sends the current endpoints of a service as ADDED events and a
+	// SYNCED event, then an event per change until the client goes away. A
+	// subscriber too slow to keep up is dropped with RESOURCE_EXHAUSTED and
+	// should watch again for a fresh snapshot.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[EndpointEvent], error)
+}
+
+type endpointWatcherClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEndpointWatcherClient(cc grpc.ClientConnInterface) EndpointWatcherClient {
+	return &endpointWatcherClient{cc}
+}
+
+func (c *endpointWatcherClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[EndpointEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &EndpointWatcher_ServiceDesc.Streams[0], EndpointWatcher_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, EndpointEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EndpointWatcher_WatchClient = grpc.ServerStreamingClient[EndpointEvent]
+
+// EndpointWatcherServer is the server API for EndpointWatcher service.
+// All implementations must embed UnimplementedEndpointWatcherServer
+// for forward compatibility.
+//
+// EndpointWatcher streams the endpoints the observer writes, for consumers
+// that would rather subscribe than poll the table. It's served on
+// --grpc-bind-address.
+type EndpointWatcherServer interface {
+	// Watch sends the current endpoints of a service as ADDED events and a
+	// SYNCED event, then an event per change until the client goes away. A
+	// subscriber too slow to keep up is dropped with RESOURCE_EXHAUSTED and
+	// should watch again for a fresh snapshot.
+	Watch(*WatchRequest, grpc.ServerStreamingServer[EndpointEvent]) error
+	mustEmbedUnimplementedEndpointWatcherServer()
+}
+
+// UnimplementedEndpointWatcherServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedEndpointWatcherServer struct{}
+
+func (UnimplementedEndpointWatcherServer) Watch(*WatchRequest, grpc.ServerStreamingServer[EndpointEvent]) error {
+	return status.Error(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedEndpointWatcherServer) mustEmbedUnimplementedEndpointWatcherServer() {}
+func (UnimplementedEndpointWatcherServer) testEmbeddedByValue()                         {}
+
+// UnsafeEndpointWatcherServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EndpointWatcherServer will
+// result in compilation errors.
+type UnsafeEndpointWatcherServer interface {
+	mustEmbedUnimplementedEndpointWatcherServer()
+}
+
+func RegisterEndpointWatcherServer(s grpc.ServiceRegistrar, srv EndpointWatcherServer) {
+	// If the following call panics, it indicates UnimplementedEndpointWatcherServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&EndpointWatcher_ServiceDesc, srv)
+}
+
+func _EndpointWatcher_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EndpointWatcherServer).Watch(m, &grpc.GenericServerStream[WatchRequest, EndpointEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EndpointWatcher_WatchServer = grpc.ServerStreamingServer[EndpointEvent]
+
+// EndpointWatcher_ServiceDesc is the grpc.ServiceDesc for EndpointWatcher service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var EndpointWatcher_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "observer.watch.v1.EndpointWatcher",
+	HandlerType: (*EndpointWatcherServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _EndpointWatcher_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "internal/watchapi/watch.proto",
+}
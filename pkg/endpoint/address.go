@@ -0,0 +1,17 @@
+// Package endpoint holds helpers for consumers of the observer's rows.
+package endpoint
+
+import (
+	"net"
+	"strconv"
+)
+
+// Address formats the pod_ip and port of an endpoint as a dialable
+// "host:port", bracketing IPv6 addresses ("[fd00::1]:8080"). Without a port
+// (0, as when the observer runs without --port-filter) it's ip unchanged.
+func Address(ip string, port int32) string {
+	if port == 0 {
+		return ip
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(int(port)))
+}
@@ -0,0 +1,25 @@
+package endpoint
+
+import "testing"
+
+func TestAddress(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+		port int32
+		want string
+	}{
+		{name: "IPv4", ip: "10.0.0.1", port: 8080, want: "10.0.0.1:8080"},
+		{name: "IPv6", ip: "fd00::1", port: 8080, want: "[fd00::1]:8080"},
+		{name: "FQDN", ip: "web-1.example.com", port: 443, want: "web-1.example.com:443"},
+		{name: "IPv4 without port", ip: "10.0.0.1", want: "10.0.0.1"},
+		{name: "IPv6 without port", ip: "fd00::1", want: "fd00::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Address(tt.ip, tt.port); got != tt.want {
+				t.Errorf("Address(%q, %d) = %q, want %q", tt.ip, tt.port, got, tt.want)
+			}
+		})
+	}
+}